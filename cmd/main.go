@@ -1,45 +1,214 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"github.com/sirupsen/logrus"
 	"github.com/skatteetaten/fiona/pkg/apis"
 	"github.com/skatteetaten/fiona/pkg/config"
+	"github.com/skatteetaten/fiona/pkg/inventory"
+	"github.com/skatteetaten/fiona/pkg/logging"
 	"github.com/skatteetaten/fiona/pkg/s3"
-	"net/http"
+	"github.com/skatteetaten/fiona/pkg/server"
+	"github.com/skatteetaten/fiona/pkg/tracing"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 )
 
 func main() {
-	appConfigReader := config.NewConfigReader()
+	configFile := flag.String("config", "", "YAML or JSON config file, overrides "+config.FionaConfigFile)
+	flag.Parse()
+	appConfigReader := config.NewConfigReaderForFile(*configFile)
 
-	initWebServer(appConfigReader)
+	if args := flag.Args(); len(args) > 0 {
+		os.Exit(runCommand(args, appConfigReader, os.Stdout))
+	}
+
+	servers, closeAPI, shutdownTracing := initWebServer(appConfigReader)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		logrus.Infof("Received %s", <-signals)
+		cancel()
+	}()
 
-	logrus.Fatal(http.ListenAndServe(":8080", nil))
+	servers.clusters.MonitorUsage(ctx)
+	servers.clusters.RunJobs(ctx)
+	err := server.Run(ctx, servers.shutdownTimeout, servers.api, servers.management)
+	// The jobs record audit events until they stop, so the audit logger is closed last
+	cancel()
+	servers.clusters.Wait()
+	if closeErr := closeAPI(); closeErr != nil {
+		logrus.Warnf("Could not close the API: %s", closeErr)
+	}
+	if tracingErr := shutdownTracing(context.Background()); tracingErr != nil {
+		logrus.Warnf("Could not flush traces: %s", tracingErr)
+	}
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	logrus.Info("Fiona stopped")
 }
 
-func initWebServer(appConfigReader config.Reader) {
+// runCommand runs a command line command and returns the exit code
+func runCommand(args []string, appConfigReader config.Reader, out io.Writer) int {
+	if len(args) == 2 && args[0] == "config" && args[1] == "validate" {
+		return validateConfig(appConfigReader, out)
+	}
+	if len(args) == 2 && args[0] == "inventory" && (args[1] == "drift" || args[1] == "rebuild") {
+		return reconcileInventory(appConfigReader, args[1] == "rebuild", out)
+	}
+	fmt.Fprintf(out, "Unknown command %q, usage: fiona [-config file] [config validate | inventory drift | inventory rebuild]\n", strings.Join(args, " "))
+	return 2
+}
+
+func validateConfig(appConfigReader config.Reader, out io.Writer) int {
+	_, err := appConfigReader.ReadConfig()
+	if validationError, ok := err.(*config.ValidationError); ok {
+		fmt.Fprintln(out, "Configuration is invalid:")
+		for _, problem := range validationError.Problems {
+			fmt.Fprintf(out, "  - %s\n", problem)
+		}
+		return 1
+	} else if err != nil {
+		fmt.Fprintf(out, "Configuration is invalid: %s\n", err)
+		return 1
+	}
+	fmt.Fprintln(out, "Configuration is valid")
+	return 0
+}
+
+// reconcileInventory reports the drift between the inventory and every cluster, and rebuilds the inventory from the
+// clusters when asked to. It returns 1 when drift is found without rebuilding.
+func reconcileInventory(appConfigReader config.Reader, rebuild bool, out io.Writer) int {
+	appConfig, err := appConfigReader.ReadConfig()
+	if err != nil {
+		fmt.Fprintf(out, "Could not read config: %s\n", err)
+		return 1
+	}
+	resources, err := inventory.Open(&appConfig.InventoryConfig)
+	if err != nil {
+		fmt.Fprintf(out, "Could not open inventory: %s. Stop the server, or reconcile through the API.\n", err)
+		return 1
+	}
+	defer resources.Close()
+	clusters, err := s3.NewClusterPool(&appConfig.S3Config, appConfig.S3Clusters)
+	if err != nil {
+		fmt.Fprintf(out, "Could not create s3 clients: %s\n", err)
+		return 1
+	}
+	discoverers := map[string]inventory.Discoverer{}
+	for _, cluster := range clusters.Clusters() {
+		discoverers[cluster.Name] = inventory.NewMinioDiscoverer(cluster.Name, cluster.Client, cluster.AdminClient)
+	}
+	return reconcileClusters(context.Background(), resources, discoverers, rebuild, out)
+}
+
+func reconcileClusters(ctx context.Context, resources *inventory.Inventory, discoverers map[string]inventory.Discoverer, rebuild bool, out io.Writer) int {
+	var names []string
+	for name := range discoverers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	code := 0
+	for _, name := range names {
+		discovered, err := discoverers[name].Discover(ctx)
+		if err != nil {
+			fmt.Fprintf(out, "Cluster %s: could not discover resources: %s\n", name, err)
+			code = 1
+			continue
+		}
+		drift := inventory.Compare(resources.List(inventory.Filter{Cluster: name}), discovered)
+		fmt.Fprintf(out, "Cluster %s: %d missing, %d untracked and %d changed resources\n", name, len(drift.Missing), len(drift.Untracked), len(drift.Changed))
+		for _, change := range []struct {
+			label     string
+			resources []*inventory.Resource
+		}{{"missing", drift.Missing}, {"untracked", drift.Untracked}, {"changed", drift.Changed}} {
+			for _, resource := range change.resources {
+				fmt.Fprintf(out, "  - %s %s %s\n", change.label, resource.Kind, resource.Name)
+			}
+		}
+		if !rebuild {
+			if !drift.Empty() {
+				code = 1
+			}
+			continue
+		}
+		if err := resources.Rebuild(name, discovered); err != nil {
+			fmt.Fprintf(out, "Cluster %s: could not rebuild inventory: %s\n", name, err)
+			code = 1
+			continue
+		}
+		fmt.Fprintf(out, "Cluster %s: inventory rebuilt\n", name)
+	}
+	return code
+}
+
+type fionaServers struct {
+	api             *server.Server
+	management      *server.Server
+	shutdownTimeout time.Duration
+	clusters        *s3.ClusterPool
+}
+
+func initWebServer(appConfigReader config.Reader) (*fionaServers, func() error, tracing.ShutdownFunc) {
 	appConfig, err := appConfigReader.ReadConfig()
 	if err != nil {
 		logrus.Fatalf("Fatal error: Failed to read application config: %s", err)
 	}
+	if err := logging.Configure(appConfig.LogFormat); err != nil {
+		logrus.Fatalf("Fatal error: Failed to configure logging: %s", err)
+	}
 	if appConfig.DebugLog {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
+	if appConfig.DevMode {
+		logrus.Warnf("%s is enabled: well-known development credentials are allowed. Never use in production", config.FionaDevMode)
+	}
 
-	minioAdmClient, err := s3.NewAdmClient(&appConfig.S3Config)
+	shutdownTracing, err := tracing.Init(&appConfig.TracingConfig)
 	if err != nil {
-		logrus.Fatalf("Fatal error: Failed to create s3 adminclient: %s", err)
+		logrus.Fatalf("Fatal error: Failed to initialize tracing: %s", err)
 	}
-	minioclient, err := s3.NewClient(&appConfig.S3Config)
+
+	clusters, err := s3.NewClusterPool(&appConfig.S3Config, appConfig.S3Clusters)
+	if err != nil {
+		logrus.Fatalf("Fatal error: Failed to create s3 clients: %s", err)
+	}
+	checkCtx, cancelCheck := context.WithTimeout(context.Background(), 30*time.Second)
+	err = clusters.CheckAdminAPIs(checkCtx)
+	cancelCheck()
 	if err != nil {
-		logrus.Fatalf("Fatal error: Failed to create s3 client: %s", err)
+		logrus.Fatalf("Fatal error: Unsupported minio release: %s", err)
 	}
 
 	logrus.Info("Starting the webserver")
-	err = apis.InitAPI(appConfig, minioAdmClient, minioclient)
+	apiHandler, closeAPI, err := apis.InitAPI(appConfig, clusters)
 	if err != nil {
 		logrus.Fatal(err)
 	}
 
-	managementInterfaceHandler := apis.InitManagementHandler(minioAdmClient)
-	managementInterfaceHandler.StartHTTPListener()
+	managementInterfaceHandler := apis.InitManagementHandler(clusters)
+	serverConfig := &appConfig.ServerConfig
+	apiServer := server.New("api", serverConfig.ListenAddress, apiHandler, serverConfig)
+	if serverConfig.TLSEnabled() {
+		apiServer, err = server.NewTLS("api", serverConfig.ListenAddress, apiHandler, serverConfig)
+		if err != nil {
+			logrus.Fatalf("Fatal error: Failed to set up TLS: %s", err)
+		}
+	}
+	return &fionaServers{
+		api:             apiServer,
+		management:      server.New("management interface", serverConfig.ManagementListenAddress, managementInterfaceHandler, serverConfig),
+		shutdownTimeout: serverConfig.ShutdownTimeout,
+		clusters:        clusters,
+	}, closeAPI, shutdownTracing
 }
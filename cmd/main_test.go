@@ -1,8 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"github.com/skatteetaten/fiona/pkg/config"
+	"github.com/skatteetaten/fiona/pkg/inventory"
 	"github.com/skatteetaten/fiona/pkg/s3"
+	"github.com/stretchr/testify/assert"
 	"testing"
 )
 
@@ -35,3 +39,51 @@ func getTestAppConfig() *config.Config {
 		AuroraTokenLocation: "testdata/token",
 	}
 }
+
+type testDiscoverer struct {
+}
+
+func (td testDiscoverer) Discover(ctx context.Context) ([]*inventory.Resource, error) {
+	return []*inventory.Resource{{Kind: inventory.KindUser, Name: "appuser", Cluster: "default", Policy: "utvappx_appuser_R"}}, nil
+}
+
+type failingConfigReader struct {
+}
+
+func (fcr failingConfigReader) ReadConfig() (*config.Config, error) {
+	return nil, &config.ValidationError{Problems: []string{"FIONA_S3_PORT must be a port number", "FIONA_S3_REGION must not be empty"}}
+}
+
+func TestRunCommand(t *testing.T) {
+	t.Run("Should report a valid config", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		assert.Equal(t, 0, runCommand([]string{"config", "validate"}, testConfigReader{}, out))
+		assert.Equal(t, "Configuration is valid\n", out.String())
+	})
+
+	t.Run("Should list every problem of an invalid config", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		assert.Equal(t, 1, runCommand([]string{"config", "validate"}, failingConfigReader{}, out))
+		assert.Contains(t, out.String(), "  - FIONA_S3_PORT must be a port number\n")
+		assert.Contains(t, out.String(), "  - FIONA_S3_REGION must not be empty\n")
+	})
+
+	t.Run("Should report drift of the inventory, and rebuild it", func(t *testing.T) {
+		resources, _ := inventory.New(inventory.NewMemoryStore())
+		_ = resources.Put(&inventory.Resource{Kind: inventory.KindUser, Name: "removed", Cluster: "default"})
+		discoverers := map[string]inventory.Discoverer{"default": testDiscoverer{}}
+		out := &bytes.Buffer{}
+
+		assert.Equal(t, 1, reconcileClusters(context.Background(), resources, discoverers, false, out))
+		assert.Contains(t, out.String(), "Cluster default: 1 missing, 1 untracked and 0 changed resources\n")
+		assert.Contains(t, out.String(), "  - missing user removed\n")
+
+		assert.Equal(t, 0, reconcileClusters(context.Background(), resources, discoverers, true, out))
+		assert.Equal(t, 0, reconcileClusters(context.Background(), resources, discoverers, false, &bytes.Buffer{}))
+	})
+
+	t.Run("Should reject unknown commands", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		assert.Equal(t, 2, runCommand([]string{"serve"}, testConfigReader{}, out))
+	})
+}
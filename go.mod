@@ -1,16 +1,24 @@
 module github.com/skatteetaten/fiona
 
-go 1.13
+go 1.15
 
 require (
-	github.com/gorilla/handlers v1.4.2
-	github.com/gorilla/mux v1.7.3
+	filippo.io/age v1.0.0
+	github.com/gorilla/mux v1.8.0
 	github.com/konsorten/go-windows-terminal-sequences v1.0.2 // indirect
 	github.com/minio/minio v0.0.0-20200207105536-de924605a1bf
 	github.com/minio/minio-go/v6 v6.0.47
+	github.com/prometheus/client_golang v1.5.1
 	github.com/secure-io/sio-go v0.3.0
 	github.com/sirupsen/logrus v1.4.2
 	github.com/skatteetaten/aurora-management-interface-go v0.1.5
-	github.com/stretchr/testify v1.4.0
-	golang.org/x/sys v0.0.0-20200317113312-5766fd39f98d // indirect
+	github.com/stretchr/testify v1.7.0
+	go.etcd.io/bbolt v1.3.6
+	go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux v0.25.0
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.1
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
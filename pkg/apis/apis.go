@@ -2,91 +2,291 @@ package apis
 
 import (
 	"fmt"
-	ghandlers "github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
-	"github.com/minio/minio-go/v6"
-	"github.com/minio/minio/pkg/madmin"
 	"github.com/sirupsen/logrus"
 	management "github.com/skatteetaten/aurora-management-interface-go"
 	"github.com/skatteetaten/aurora-management-interface-go/env"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/auth"
 	"github.com/skatteetaten/fiona/pkg/config"
 	"github.com/skatteetaten/fiona/pkg/handlers"
 	"github.com/skatteetaten/fiona/pkg/handlers/healthcheck"
+	"github.com/skatteetaten/fiona/pkg/inventory"
+	"github.com/skatteetaten/fiona/pkg/kubernetes"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"github.com/skatteetaten/fiona/pkg/metrics"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"github.com/skatteetaten/fiona/pkg/server"
+	"github.com/skatteetaten/fiona/pkg/tracing"
+	"github.com/skatteetaten/fiona/pkg/vault"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"net"
 	"net/http"
 )
 
-// InitAPI initializes API with routing
-func InitAPI(config *config.Config, adminClient *madmin.AdminClient, minioClient *minio.Client) error {
+// InitAPI initializes API with routing and returns the handler serving it, and a function closing the audit logger
+// and the inventory to call once the server and the background jobs have stopped
+func InitAPI(config *config.Config, clusters *s3.ClusterPool) (http.Handler, func() error, error) {
 
-	auroraTokenAuthenticator, err := NewAuroraTokenAuthenticator(config.AuroraTokenLocation)
+	auroraTokenAuthenticator, err := NewAuroraTokenAuthenticator(config.AuroraTokenLocation, config.AuroraTokenClusters...)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	identifiers := []Identifier{auroraTokenAuthenticator}
+	if config.ClientCertIdentitiesLocation != "" {
+		clientCertAuthenticator, err := NewClientCertAuthenticator(config.ClientCertIdentitiesLocation)
+		if err != nil {
+			return nil, nil, err
+		}
+		identifiers = append([]Identifier{clientCertAuthenticator}, identifiers...)
 	}
 
-	routeHandler, err := createRouter(config, auroraTokenAuthenticator, adminClient, minioClient)
+	auditor, err := audit.NewLogger(&config.AuditConfig)
 	if err != nil {
-		logrus.Errorf("Error while creating router: %s", err)
-		return err
+		return nil, nil, fmt.Errorf("could not create audit logger. %v", err)
 	}
 
-	http.Handle("/", routeHandler)
+	resources, err := inventory.Open(&config.InventoryConfig)
+	if err != nil {
+		_ = auditor.Close()
+		return nil, nil, fmt.Errorf("could not open inventory. %v", err)
+	}
+	closeAPI := func() error {
+		inventoryErr := resources.Close()
+		if err := auditor.Close(); err != nil {
+			return fmt.Errorf("could not close audit logger. %v", err)
+		}
+		if inventoryErr != nil {
+			return fmt.Errorf("could not close inventory. %v", inventoryErr)
+		}
+		return nil
+	}
 
-	return nil
+	routeHandler, err := createRouter(config, NewChainAuthenticator(identifiers...), inventory.NewRecorder(resources, auditor), resources, clusters)
+	if err != nil {
+		logrus.Errorf("Error while creating router: %s", err)
+		_ = closeAPI()
+		return nil, nil, err
+	}
+
+	return routeHandler, closeAPI, nil
 }
 
-func createRouter(config *config.Config, amw AuthMiddleware, adminClient *madmin.AdminClient, minioClient *minio.Client) (http.Handler, error) {
+func createRouter(config *config.Config, amw AuthMiddleware, auditor audit.Logger, resources *inventory.Inventory, clusters *s3.ClusterPool) (http.Handler, error) {
+
+	trustedProxies, err := server.ParseTrustedProxies(config.ServerConfig.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
 
 	router := mux.NewRouter()
+	router.Use(logging.RouteMiddleware)
+	router.Use(tracing.RouteMiddleware)
+	router.Use(sourceIPMiddleware(trustedProxies))
 
-	if err := addRoutes(router, amw, config, adminClient, minioClient); err != nil {
+	if err := addRoutes(router, amw, config, auditor, resources, clusters); err != nil {
 		return nil, err
 	}
 
-	logger := logrus.New()
-	logwriter := logger.Writer()
-	loggedRouter := ghandlers.LoggingHandler(logwriter, router)
+	// Wrapping the router rather than using router.Use also covers the not found and method not allowed responses
+	return logging.Middleware(otelmux.Middleware(tracing.ServiceName)(metrics.Middleware(router))), nil
+}
 
-	return loggedRouter, nil
+// sourceIPMiddleware resolves the client address, honoring X-Forwarded-For only from trusted proxies
+func sourceIPMiddleware(trustedProxies []*net.IPNet) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := auth.WithSourceIP(r.Context(), server.ClientIP(r, trustedProxies))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
 }
 
-func addRoutes(router *mux.Router, amw AuthMiddleware, config *config.Config, adminClient *madmin.AdminClient, minioClient *minio.Client) error {
+func addRoutes(router *mux.Router, amw AuthMiddleware, config *config.Config, auditor audit.Logger, resources *inventory.Inventory, clusters *s3.ClusterPool) error {
 	router.HandleFunc("/", roothandler)
 
-	createAppUserHandler, err := handlers.NewCreateAppUserHandler(&config.S3Config, adminClient, minioClient)
+	secretSinks, err := newSecretSinks(config)
+	if err != nil {
+		return err
+	}
+	createAppUserHandler, err := newClusterHandler(clusters, func(cluster *s3.Cluster) (http.Handler, error) {
+		return handlers.NewCreateAppUserHandler(cluster.Config, cluster.AdminClient, cluster.Client, auditor, secretSinks)
+	})
+	if err != nil {
+		return err
+	}
+	handleInClusters(router, "/buckets/{bucketname}/paths/{path}/userpolicies/", amw.Authenticate(requireScope(auth.ScopeCreateUserPolicy, createAppUserHandler)), "POST")
+
+	presignHandler, err := newClusterHandler(clusters, func(cluster *s3.Cluster) (http.Handler, error) {
+		return handlers.NewPresignHandler(cluster.Config, cluster.Client, auditor), nil
+	})
 	if err != nil {
 		return err
 	}
-	router.Handle("/buckets/{bucketname}/paths/{path}/userpolicies/", amw.Authenticate(createAppUserHandler)).Methods("POST")
+	handleInClusters(router, "/buckets/{bucketname}/paths/{path}/presign", amw.Authenticate(requireScope(auth.ScopeCreateUserPolicy, presignHandler)), "POST")
 
-	// Deprecated methods.  Not REST based.
-	listusersHandler := handlers.NewListUsersHandler(adminClient)
-	serverinfoHandler := handlers.NewServerInfoHandler(adminClient)
-	// createuserHandler, err := handlers.NewCreateUserHandler(config, adminClient, minioClient)
+	temporaryCredentialsHandler, err := newClusterHandler(clusters, func(cluster *s3.Cluster) (http.Handler, error) {
+		return handlers.NewTemporaryCredentialsHandler(cluster.Config, cluster.Client, auditor)
+	})
+	if err != nil {
+		return err
+	}
+	handleInClusters(router, "/buckets/{bucketname}/paths/{path}/credentials", amw.Authenticate(requireScope(auth.ScopeCreateCredentials, temporaryCredentialsHandler)), "POST")
+
+	serviceAccountsHandler, err := newClusterHandler(clusters, func(cluster *s3.Cluster) (http.Handler, error) {
+		return handlers.NewServiceAccountsHandler(cluster.Config, cluster.AdminClient, cluster.AdminAPI, auditor), nil
+	})
+	if err != nil {
+		return err
+	}
+	serviceAccountsPath := "/buckets/{bucketname}/paths/{path}/userpolicies/{username}/serviceaccounts"
+	handleInClusters(router, serviceAccountsPath, amw.Authenticate(requireScope(auth.ScopeManageServiceAccounts, serviceAccountsHandler)), "POST")
+	handleInClusters(router, serviceAccountsPath, amw.Authenticate(requireScope(auth.ScopeReadServiceAccounts, serviceAccountsHandler)), "GET")
+	handleInClusters(router, serviceAccountsPath+"/{accesskey}", amw.Authenticate(requireScope(auth.ScopeManageServiceAccounts, serviceAccountsHandler)), "DELETE")
+
+	createGroupHandler, err := newClusterHandler(clusters, func(cluster *s3.Cluster) (http.Handler, error) {
+		return handlers.NewCreateGroupHandler(cluster.Config, cluster.AdminClient, cluster.Client, auditor), nil
+	})
+	if err != nil {
+		return err
+	}
+	handleInClusters(router, "/buckets/{bucketname}/paths/{path}/groups/", amw.Authenticate(requireScope(auth.ScopeManageGroups, createGroupHandler)), "POST")
+
+	groupHandler, err := newClusterHandler(clusters, func(cluster *s3.Cluster) (http.Handler, error) {
+		return handlers.NewGroupHandler(cluster.AdminClient), nil
+	})
+	if err != nil {
+		return err
+	}
+	handleInClusters(router, "/groups/{group}", amw.Authenticate(requireScope(auth.ScopeReadGroups, groupHandler)), "GET")
+
+	groupMemberHandler, err := newClusterHandler(clusters, func(cluster *s3.Cluster) (http.Handler, error) {
+		return handlers.NewGroupMemberHandler(cluster.AdminClient, auditor), nil
+	})
 	if err != nil {
 		return err
 	}
-	router.Handle("/listusers", amw.Authenticate(listusersHandler)).Methods("GET")
-	router.Handle("/serverinfo", amw.Authenticate(serverinfoHandler)).Methods("GET")
-	// router.Handle("/createuser", amw.Authenticate(createuserHandler)).Methods("POST")
+	handleInClusters(router, "/groups/{group}/members/{username}", amw.Authenticate(requireScope(auth.ScopeManageGroups, groupMemberHandler)), "PUT", "DELETE")
+
+	bucketHandler, err := newClusterHandler(clusters, func(cluster *s3.Cluster) (http.Handler, error) {
+		return handlers.NewBucketHandler(cluster.Config, cluster.Client, cluster.AdminAPI, auditor), nil
+	})
+	if err != nil {
+		return err
+	}
+	handleInClusters(router, "/buckets/{bucketname}", amw.Authenticate(requireScope(auth.ScopeManageBuckets, bucketHandler)), "PUT")
+	handleInClusters(router, "/buckets/{bucketname}", amw.Authenticate(requireScope(auth.ScopeReadBuckets, bucketHandler)), "GET")
+
+	lifecycleHandler, err := newClusterHandler(clusters, func(cluster *s3.Cluster) (http.Handler, error) {
+		return handlers.NewLifecycleHandler(cluster.Config, cluster.Client, auditor), nil
+	})
+	if err != nil {
+		return err
+	}
+	handleInClusters(router, "/buckets/{bucketname}/paths/{path}/lifecycle", amw.Authenticate(requireScope(auth.ScopeManageLifecycle, lifecycleHandler)), "PUT")
+	handleInClusters(router, "/buckets/{bucketname}/paths/{path}/lifecycle", amw.Authenticate(requireScope(auth.ScopeReadLifecycle, lifecycleHandler)), "GET")
+
+	notificationsHandler, err := newClusterHandler(clusters, func(cluster *s3.Cluster) (http.Handler, error) {
+		return handlers.NewNotificationsHandler(cluster.Config, cluster.Client, auditor), nil
+	})
+	if err != nil {
+		return err
+	}
+	notificationsPath := "/buckets/{bucketname}/paths/{path}/notifications"
+	handleInClusters(router, notificationsPath, amw.Authenticate(requireScope(auth.ScopeReadNotifications, notificationsHandler)), "GET")
+	handleInClusters(router, notificationsPath+"/{target}", amw.Authenticate(requireScope(auth.ScopeManageNotifications, notificationsHandler)), "PUT", "DELETE")
+
+	decommissionHandler, err := newClusterHandler(clusters, func(cluster *s3.Cluster) (http.Handler, error) {
+		return handlers.NewDecommissionHandler(cluster.Config, cluster.Client, cluster.AdminClient, cluster.Jobs, auditor), nil
+	})
+	if err != nil {
+		return err
+	}
+	handleInClusters(router, "/buckets/{bucketname}/paths/{path}", amw.Authenticate(requireScope(auth.ScopeDecommissionPaths, decommissionHandler)), "DELETE")
+
+	usageHandler, err := newClusterHandler(clusters, func(cluster *s3.Cluster) (http.Handler, error) {
+		return handlers.NewUsageHandler(cluster.Config, cluster.Client, cluster.Usage, cluster.Jobs), nil
+	})
+	if err != nil {
+		return err
+	}
+	handleInClusters(router, "/buckets/{bucketname}/paths/{path}/usage", amw.Authenticate(requireScope(auth.ScopeReadUsage, usageHandler)), "GET")
+	handleInClusters(router, "/buckets/{bucketname}/paths/{path}/usage", amw.Authenticate(requireScope(auth.ScopeScanUsage, usageHandler)), "POST")
+
+	jobsHandler, err := newClusterHandler(clusters, func(cluster *s3.Cluster) (http.Handler, error) {
+		return handlers.NewJobsHandler(cluster.Jobs, auditor), nil
+	})
+	if err != nil {
+		return err
+	}
+	handleInClusters(router, "/jobs", amw.Authenticate(requireScope(auth.ScopeReadJobs, jobsHandler)), "GET")
+	handleInClusters(router, "/jobs/{id}", amw.Authenticate(requireScope(auth.ScopeReadJobs, jobsHandler)), "GET")
+	handleInClusters(router, "/jobs/{id}", amw.Authenticate(requireScope(auth.ScopeManageJobs, jobsHandler)), "DELETE")
+
+	inventoryHandler, err := newClusterHandler(clusters, func(cluster *s3.Cluster) (http.Handler, error) {
+		return handlers.NewInventoryHandler(cluster.Name, cluster.Client, cluster.AdminClient, resources, cluster.Jobs, auditor), nil
+	})
+	if err != nil {
+		return err
+	}
+	handleInClusters(router, "/inventory", amw.Authenticate(requireScope(auth.ScopeReadInventory, inventoryHandler)), "GET")
+	handleInClusters(router, "/inventory/reconcile", amw.Authenticate(requireScope(auth.ScopeReconcileInventory, inventoryHandler)), "POST")
+
+	serverinfoHandler, err := newClusterHandler(clusters, func(cluster *s3.Cluster) (http.Handler, error) {
+		return handlers.NewServerInfoHandler(cluster.AdminClient), nil
+	})
+	if err != nil {
+		return err
+	}
+	handleInClusters(router, "/serverinfo", amw.Authenticate(requireScope(auth.ScopeReadServerInfo, serverinfoHandler)), "GET")
+
+	// Deprecated methods.  Not REST based.
+	listusersHandler := handlers.NewListUsersHandler(clusters.Default().AdminClient)
+	router.Handle("/listusers", amw.Authenticate(requireScope(auth.ScopeListUsers, requireCluster(listusersHandler)))).Methods("GET")
 
 	return nil
 }
 
+// newSecretSinks creates the secret sinks enabled in config
+func newSecretSinks(config *config.Config) (handlers.SecretSinks, error) {
+	sinks := handlers.SecretSinks{}
+	if config.KubernetesConfig.Enabled {
+		kubernetesClient, err := kubernetes.NewClient(&config.KubernetesConfig)
+		if err != nil {
+			return sinks, fmt.Errorf("could not create Kubernetes client. %v", err)
+		}
+		sinks.Kubernetes = kubernetesClient
+	}
+	if config.VaultConfig.Enabled() {
+		vaultClient, err := vault.NewClient(&config.VaultConfig)
+		if err != nil {
+			return sinks, fmt.Errorf("could not create Vault client. %v", err)
+		}
+		sinks.Vault = vaultClient
+	}
+	return sinks, nil
+}
+
 func roothandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "Fiona says hi at %s!", r.Host)
 }
 
-// InitManagementHandler initializes the management interface with /health and /env endpoints
-func InitManagementHandler(admClient *madmin.AdminClient) *management.RoutingHandler {
+// InitManagementHandler initializes the management interface with /health, /env and /metrics endpoints
+func InitManagementHandler(clusters *s3.ClusterPool) http.Handler {
 	managementHandler := management.CreateRoutingHandler()
-
-	fionaHealthRetriever := healthcheck.NewFionaHealthRetriever(admClient)
-
+	fionaHealthRetriever := healthcheck.NewFionaHealthRetriever(clusters.Default().AdminClient)
+	for _, cluster := range clusters.Clusters() {
+		if cluster.Name != s3.DefaultClusterName {
+			fionaHealthRetriever.AddCluster(cluster.Name, cluster.AdminClient)
+		}
+	}
 	fionaEnvRetriever := env.GetDefaultEnvRetriever()
-	fionaEnvRetriever.SetKeysToMask([]string{config.FionaDefaultPassword, config.FionaSecretKey, config.FionaAccessKey})
-
+	fionaEnvRetriever.SetKeysToMask([]string{config.FionaDefaultPassword, config.FionaSecretKey, config.FionaAccessKey, config.FionaSTSSecretKey})
 	managementHandler.RouteApplicationHealthRetriever(fionaHealthRetriever)
 	managementHandler.RouteApplicationEnvRetriever(fionaEnvRetriever)
 
-	return managementHandler
+	managementMux := http.NewServeMux()
+	managementMux.Handle("/metrics", metrics.Handler())
+	managementMux.Handle("/", managementHandler)
+	return managementMux
 }
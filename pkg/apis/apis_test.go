@@ -1,43 +1,157 @@
 package apis
 
 import (
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/auth"
 	"github.com/skatteetaten/fiona/pkg/config"
+	"github.com/skatteetaten/fiona/pkg/inventory"
 	"github.com/skatteetaten/fiona/pkg/s3"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
+// testAmw lets every request through as caller, or as a caller with all scopes and clusters when caller is empty
 type testAmw struct {
+	caller auth.Caller
 }
 
 func (ta testAmw) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		next.ServeHTTP(w, r)
+		caller := ta.caller
+		if caller.Name == "" {
+			caller = auth.Caller{Name: "test", Scopes: []string{auth.ScopeAll}, Clusters: []string{auth.AllClusters}}
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithCaller(r.Context(), caller)))
 	})
 }
 
+type testAuditor struct {
+	events []audit.Event
+}
+
+func (ta *testAuditor) Record(event audit.Event) {
+	ta.events = append(ta.events, event)
+}
+
 func TestApis(t *testing.T) {
 	t.Run("Should initialize web router without failing", func(t *testing.T) {
-		dummyAdmClient, _ := s3.NewAdmClient(&getTestAppConfig().S3Config)
-		dummyClient, _ := s3.NewClient(&getTestAppConfig().S3Config)
-		InitAPI(getTestAppConfig(), dummyAdmClient, dummyClient)
+		handler, closeAPI, err := InitAPI(getTestAppConfig(), getTestClusters())
+		assert.Nil(t, err)
+		assert.NotNil(t, handler)
+		assert.Nil(t, closeAPI())
 	})
 
 	t.Run("Should return correct welcome string on root request to router", func(t *testing.T) {
 		request, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
 		request.Header.Set("Authorization", "aurora-token ")
 		response := httptest.NewRecorder()
-		dummyAdmClient, _ := s3.NewAdmClient(&getTestAppConfig().S3Config)
-		dummyClient, _ := s3.NewClient(&getTestAppConfig().S3Config)
 
-		routerHandler, _ := createRouter(getTestAppConfig(), &testAmw{}, dummyAdmClient, dummyClient)
+		routerHandler, _ := createRouter(getTestAppConfig(), &testAmw{}, &testAuditor{}, getTestInventory(), getTestClusters())
 		routerHandler.ServeHTTP(response, request)
 
 		assert.Equal(t, http.StatusOK, response.Code, "OK response is expected")
 		assert.Equal(t, "Fiona says hi at localhost:8080!", response.Body.String())
 	})
+
+	t.Run("Should give requests no route matches a request id", func(t *testing.T) {
+		routerHandler, _ := createRouter(getTestAppConfig(), &testAmw{}, &testAuditor{}, getTestInventory(), getTestClusters())
+		for _, method := range []string{"GET", "PATCH"} {
+			request := httptest.NewRequest(method, "http://localhost:8080/nosuchroute", nil)
+			response := httptest.NewRecorder()
+
+			routerHandler.ServeHTTP(response, request)
+
+			assert.Equal(t, http.StatusNotFound, response.Code, method)
+			assert.NotEmpty(t, response.Header().Get("X-Request-ID"), method)
+		}
+	})
+}
+
+func TestClusterRoutes(t *testing.T) {
+	createAppUser := func(amw AuthMiddleware, path string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("POST", "http://localhost:8080"+path, strings.NewReader("{}"))
+		response := httptest.NewRecorder()
+		routerHandler, _ := createRouter(getTestAppConfig(), amw, &testAuditor{}, getTestInventory(), getTestClusters())
+		routerHandler.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("Should route to a named cluster", func(t *testing.T) {
+		response := createAppUser(&testAmw{}, "/clusters/archive/buckets/utv/paths/appx/userpolicies/")
+		assert.Equal(t, http.StatusBadRequest, response.Code, "The cluster handler should reject the empty input")
+	})
+
+	t.Run("Should return not found for unknown clusters", func(t *testing.T) {
+		response := createAppUser(&testAmw{}, "/clusters/nosuchcluster/buckets/utv/paths/appx/userpolicies/")
+		assert.Equal(t, http.StatusNotFound, response.Code)
+	})
+
+	t.Run("Should forbid clusters the caller may not target", func(t *testing.T) {
+		amw := &testAmw{caller: auth.Caller{Name: "appx", Scopes: []string{auth.ScopeAll}, Clusters: []string{s3.DefaultClusterName}}}
+
+		assert.Equal(t, http.StatusForbidden, createAppUser(amw, "/clusters/archive/buckets/utv/paths/appx/userpolicies/").Code)
+		assert.Equal(t, http.StatusBadRequest, createAppUser(amw, "/buckets/utv/paths/appx/userpolicies/").Code)
+		assert.Equal(t, http.StatusBadRequest, createAppUser(amw, "/clusters/default/buckets/utv/paths/appx/userpolicies/").Code)
+	})
+}
+
+func TestReservedPaths(t *testing.T) {
+	t.Run("Should reject paths reserved for Fiona on every path route", func(t *testing.T) {
+		routerHandler, _ := createRouter(getTestAppConfig(), &testAmw{}, &testAuditor{}, getTestInventory(), getTestClusters())
+		for _, route := range []string{"POST /buckets/utv/paths/.fiona/userpolicies/", "GET /buckets/utv/paths/.fiona/usage", "DELETE /clusters/archive/buckets/utv/paths/.hidden"} {
+			methodPath := strings.SplitN(route, " ", 2)
+			request := httptest.NewRequest(methodPath[0], "http://localhost:8080"+methodPath[1], strings.NewReader("{}"))
+			response := httptest.NewRecorder()
+
+			routerHandler.ServeHTTP(response, request)
+
+			assert.Equal(t, http.StatusBadRequest, response.Code, route)
+			assert.Contains(t, response.Body.String(), "is reserved", route)
+		}
+	})
+
+	t.Run("Should authenticate and authorize before rejecting reserved paths", func(t *testing.T) {
+		reserved := func(amw AuthMiddleware) *httptest.ResponseRecorder {
+			routerHandler, _ := createRouter(getTestAppConfig(), amw, &testAuditor{}, getTestInventory(), getTestClusters())
+			request := httptest.NewRequest("GET", "http://localhost:8080/buckets/utv/paths/.fiona/usage", nil)
+			response := httptest.NewRecorder()
+			routerHandler.ServeHTTP(response, request)
+			return response
+		}
+
+		assert.Equal(t, http.StatusUnauthorized, reserved(&testRejectingAmw{}).Code)
+		assert.Equal(t, http.StatusForbidden, reserved(&testAmw{caller: auth.Caller{Name: "appx", Clusters: []string{auth.AllClusters}}}).Code)
+	})
+}
+
+// testRejectingAmw rejects every request as unauthenticated
+type testRejectingAmw struct{}
+
+func (testRejectingAmw) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+func getTestClusters() *s3.ClusterPool {
+	archiveConfig := getTestAppConfig().S3Config
+	archiveConfig.S3Host = "minio-archive"
+	clusters, err := s3.NewClusterPool(&getTestAppConfig().S3Config, map[string]s3.Config{"archive": archiveConfig})
+	if err != nil {
+		panic(err)
+	}
+	return clusters
+}
+
+func getTestInventory() *inventory.Inventory {
+	resources, err := inventory.New(inventory.NewMemoryStore())
+	if err != nil {
+		panic(err)
+	}
+	return resources
 }
 
 func getTestAppConfig() *config.Config {
@@ -58,9 +172,7 @@ func getTestAppConfig() *config.Config {
 }
 
 func TestInitManagementHandler(t *testing.T) {
-	dummyAdmClient, _ := s3.NewAdmClient(&getTestAppConfig().S3Config)
-
-	routingHandler := InitManagementHandler(dummyAdmClient)
+	routingHandler := InitManagementHandler(getTestClusters())
 
 	assert.NotNil(t, routingHandler, "Routing handler should not be nil")
 }
@@ -4,6 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"github.com/skatteetaten/fiona/pkg/auth"
+	"github.com/skatteetaten/fiona/pkg/handlers"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"github.com/skatteetaten/fiona/pkg/metrics"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -12,39 +16,114 @@ import (
 
 const tokenPrefix = "aurora-token"
 
+// auroraTokenCaller is the caller identity of requests authenticated with the aurora token
+const auroraTokenCaller = "aurora-token"
+
 // AuthMiddleware is an interface for authentication
 type AuthMiddleware interface {
 	Authenticate(next http.Handler) http.Handler
 }
 
+// Identifier resolves the caller of a request from its credentials
+type Identifier interface {
+	Identify(r *http.Request) (auth.Caller, bool)
+}
+
+// ChainAuthenticator authenticates a request with the first Identifier that recognizes its credentials
+type ChainAuthenticator struct {
+	identifiers []Identifier
+}
+
+// NewChainAuthenticator creates a ChainAuthenticator trying identifiers in order
+func NewChainAuthenticator(identifiers ...Identifier) *ChainAuthenticator {
+	return &ChainAuthenticator{identifiers: identifiers}
+}
+
+// Authenticate verifies that the request carries credentials known to one of the identifiers
+func (amw *ChainAuthenticator) Authenticate(next http.Handler) http.Handler {
+	return authenticate(next, func(r *http.Request) (auth.Caller, bool) {
+		for _, identifier := range amw.identifiers {
+			if caller, ok := identifier.Identify(r); ok {
+				return caller, true
+			}
+		}
+		return auth.Caller{}, false
+	})
+}
+
+func authenticate(next http.Handler, identify func(r *http.Request) (auth.Caller, bool)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller, found := identify(r)
+		if found {
+			logging.SetCaller(r.Context(), caller.Name)
+			logging.FromContext(r.Context()).Info("Authentication OK")
+			next.ServeHTTP(w, r.WithContext(auth.WithCaller(r.Context(), caller)))
+		} else {
+			logging.FromContext(r.Context()).Warn("Authentication failed")
+			metrics.CountAuthenticationFailure()
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		}
+	})
+}
+
+// requireScope rejects requests from callers that have not been granted scope
+func requireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller, ok := auth.CallerFromContext(r.Context())
+		if !ok || !caller.HasScope(scope) {
+			logging.FromContext(r.Context()).Warnf("Caller lacks scope %s", scope)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireCluster rejects requests to clusters the caller may not target. Routes without a cluster target the
+// default cluster.
+func requireCluster(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cluster := handlers.ClusterName(r)
+		caller, ok := auth.CallerFromContext(r.Context())
+		if !ok || !caller.CanTargetCluster(cluster) {
+			logging.FromContext(r.Context()).Warnf("Caller may not target cluster %s", cluster)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // AuroraTokenAuthenticator handles authentication for certain routes in api
 type AuroraTokenAuthenticator struct {
 	auroratoken string
+	clusters    []string
 }
 
-// NewAuroraTokenAuthenticator creates and initializes an AuroraTokenAuthenticator
-func NewAuroraTokenAuthenticator(auroraTokenLocation string) (*AuroraTokenAuthenticator, error) {
+// NewAuroraTokenAuthenticator creates and initializes an AuroraTokenAuthenticator whose callers may target clusters
+func NewAuroraTokenAuthenticator(auroraTokenLocation string, clusters ...string) (*AuroraTokenAuthenticator, error) {
 	auroratoken, err := getAuroraToken(auroraTokenLocation)
 	if err != nil {
 		return nil, fmt.Errorf("could not get auroratoken. %v", err)
 	}
+	if len(clusters) == 0 {
+		clusters = []string{auth.AllClusters}
+	}
 
-	return &AuroraTokenAuthenticator{auroratoken: auroratoken}, nil
+	return &AuroraTokenAuthenticator{auroratoken: auroratoken, clusters: clusters}, nil
 }
 
 // Authenticate verifies that request token is valid
 func (amw *AuroraTokenAuthenticator) Authenticate(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("Authorization")
-		found := amw.equalToAuroraToken(token)
-		if found {
-			logrus.Info("Authentication OK")
-			next.ServeHTTP(w, r)
-		} else {
-			logrus.Warn("Authentication failed")
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		}
-	})
+	return authenticate(next, amw.Identify)
+}
+
+// Identify returns the aurora token caller, which has all scopes, when the request carries the aurora token
+func (amw *AuroraTokenAuthenticator) Identify(r *http.Request) (auth.Caller, bool) {
+	if !amw.equalToAuroraToken(r.Header.Get("Authorization")) {
+		return auth.Caller{}, false
+	}
+	return auth.Caller{Name: auroraTokenCaller, Scopes: []string{auth.ScopeAll}, Clusters: amw.clusters}, true
 }
 
 func (amw *AuroraTokenAuthenticator) equalToAuroraToken(token string) bool {
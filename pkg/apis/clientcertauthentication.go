@@ -0,0 +1,86 @@
+package apis
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"github.com/skatteetaten/fiona/pkg/auth"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"io/ioutil"
+	"net/http"
+)
+
+// ClientCertIdentity maps a client certificate subject to a caller identity and scopes.
+// Subject is one of "CN=<common name>", "DNS=<dns SAN>", "URI=<uri SAN>" or "EMAIL=<email SAN>".
+// Clusters are the minio clusters the caller may target, only the default cluster when empty.
+type ClientCertIdentity struct {
+	Subject  string   `json:"subject"`
+	Caller   string   `json:"caller"`
+	Scopes   []string `json:"scopes"`
+	Clusters []string `json:"clusters"`
+}
+
+// ClientCertAuthenticator authenticates requests by their verified TLS client certificate
+type ClientCertAuthenticator struct {
+	identities map[string]auth.Caller
+}
+
+// NewClientCertAuthenticator creates a ClientCertAuthenticator from a JSON file of ClientCertIdentity entries
+func NewClientCertAuthenticator(identitiesLocation string) (*ClientCertAuthenticator, error) {
+	content, err := ioutil.ReadFile(identitiesLocation)
+	if err != nil {
+		return nil, fmt.Errorf("could not read client certificate identities. %v", err)
+	}
+	var identities []ClientCertIdentity
+	if err := json.Unmarshal(content, &identities); err != nil {
+		return nil, fmt.Errorf("could not parse client certificate identities in %s. %v", identitiesLocation, err)
+	}
+	return newClientCertAuthenticator(identities), nil
+}
+
+func newClientCertAuthenticator(identities []ClientCertIdentity) *ClientCertAuthenticator {
+	callers := make(map[string]auth.Caller)
+	for _, identity := range identities {
+		clusters := identity.Clusters
+		if len(clusters) == 0 {
+			clusters = []string{s3.DefaultClusterName}
+		}
+		callers[identity.Subject] = auth.Caller{Name: identity.Caller, Scopes: identity.Scopes, Clusters: clusters}
+	}
+	return &ClientCertAuthenticator{identities: callers}
+}
+
+// Authenticate verifies that the request carries a known client certificate
+func (amw *ClientCertAuthenticator) Authenticate(next http.Handler) http.Handler {
+	return authenticate(next, amw.Identify)
+}
+
+// Identify returns the caller mapped to the subject or a SAN of the verified client certificate
+func (amw *ClientCertAuthenticator) Identify(r *http.Request) (auth.Caller, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return auth.Caller{}, false
+	}
+	for _, subject := range certificateSubjects(r.TLS.VerifiedChains[0][0]) {
+		if caller, ok := amw.identities[subject]; ok {
+			return caller, true
+		}
+	}
+	return auth.Caller{}, false
+}
+
+func certificateSubjects(certificate *x509.Certificate) []string {
+	var subjects []string
+	if certificate.Subject.CommonName != "" {
+		subjects = append(subjects, "CN="+certificate.Subject.CommonName)
+	}
+	for _, name := range certificate.DNSNames {
+		subjects = append(subjects, "DNS="+name)
+	}
+	for _, uri := range certificate.URIs {
+		subjects = append(subjects, "URI="+uri.String())
+	}
+	for _, email := range certificate.EmailAddresses {
+		subjects = append(subjects, "EMAIL="+email)
+	}
+	return subjects
+}
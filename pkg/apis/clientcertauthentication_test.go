@@ -0,0 +1,75 @@
+package apis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/skatteetaten/fiona/pkg/auth"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func requestWithClientCert(commonName string, dnsNames ...string) *http.Request {
+	request, _ := http.NewRequest("POST", "https://localhost:8080/", nil)
+	certificate := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}, DNSNames: dnsNames}
+	request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{certificate}}}
+	return request
+}
+
+func TestClientCertAuthentication(t *testing.T) {
+	authenticator := newClientCertAuthenticator([]ClientCertIdentity{
+		{Subject: "DNS=boober.aurora.svc", Caller: "boober", Scopes: []string{auth.ScopeCreateUserPolicy}},
+		{Subject: "CN=archiver", Caller: "archiver", Scopes: []string{auth.ScopeCreateUserPolicy}, Clusters: []string{"archive"}},
+	})
+
+	t.Run("Should identify caller from certificate SAN", func(t *testing.T) {
+		caller, ok := authenticator.Identify(requestWithClientCert("someone", "boober.aurora.svc"))
+
+		assert.True(t, ok)
+		assert.Equal(t, "boober", caller.Name)
+		assert.True(t, caller.HasScope(auth.ScopeCreateUserPolicy))
+		assert.False(t, caller.HasScope(auth.ScopeListUsers))
+	})
+
+	t.Run("Should only allow the default cluster when no clusters are given", func(t *testing.T) {
+		caller, _ := authenticator.Identify(requestWithClientCert("someone", "boober.aurora.svc"))
+		assert.True(t, caller.CanTargetCluster(s3.DefaultClusterName))
+		assert.False(t, caller.CanTargetCluster("archive"))
+
+		caller, _ = authenticator.Identify(requestWithClientCert("archiver"))
+		assert.False(t, caller.CanTargetCluster(s3.DefaultClusterName))
+		assert.True(t, caller.CanTargetCluster("archive"))
+	})
+
+	t.Run("Should not identify unknown or missing certificate", func(t *testing.T) {
+		_, ok := authenticator.Identify(requestWithClientCert("someone"))
+		assert.False(t, ok)
+
+		request, _ := http.NewRequest("POST", "http://localhost:8080/", nil)
+		_, ok = authenticator.Identify(request)
+		assert.False(t, ok)
+	})
+
+	t.Run("Should fall back to aurora token in chain", func(t *testing.T) {
+		chain := NewChainAuthenticator(authenticator, &AuroraTokenAuthenticator{auroratoken: "testtoken"})
+		request, _ := http.NewRequest("POST", "http://localhost:8080/", nil)
+		request.Header.Set("Authorization", "aurora-token testtoken")
+		response := httptest.NewRecorder()
+
+		chain.Authenticate(dummyHandler{}).ServeHTTP(response, request)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+	})
+
+	t.Run("Should forbid caller without required scope", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		handler := authenticator.Authenticate(requireScope(auth.ScopeListUsers, dummyHandler{}))
+
+		handler.ServeHTTP(response, requestWithClientCert("someone", "boober.aurora.svc"))
+
+		assert.Equal(t, http.StatusForbidden, response.Code)
+	})
+}
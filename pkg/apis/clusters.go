@@ -0,0 +1,57 @@
+package apis
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/skatteetaten/fiona/pkg/handlers"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"net/http"
+)
+
+// clusterHandler dispatches requests to the handler of the minio cluster named in the route
+type clusterHandler struct {
+	handlers map[string]http.Handler
+}
+
+// newClusterHandler creates a handler for each cluster in the pool
+func newClusterHandler(clusters *s3.ClusterPool, create func(cluster *s3.Cluster) (http.Handler, error)) (http.Handler, error) {
+	clusterHandlers := map[string]http.Handler{}
+	for _, cluster := range clusters.Clusters() {
+		handler, err := create(cluster)
+		if err != nil {
+			return nil, err
+		}
+		clusterHandlers[cluster.Name] = handler
+	}
+	return requireCluster(requireTenantPath(&clusterHandler{handlers: clusterHandlers})), nil
+}
+
+func (ch *clusterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cluster := handlers.ClusterName(r)
+	handler, ok := ch.handlers[cluster]
+	if !ok {
+		logging.FromContext(r.Context()).Warnf("Unknown cluster %s", cluster)
+		http.Error(w, "Unknown cluster", http.StatusNotFound)
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// handleInClusters registers handler on path for the default cluster and on /clusters/{cluster}/path for named clusters
+func handleInClusters(router *mux.Router, path string, handler http.Handler, methods ...string) {
+	router.Handle(path, handler).Methods(methods...)
+	router.Handle("/clusters/{cluster}"+path, handler).Methods(methods...)
+}
+
+// requireTenantPath rejects requests on the paths reserved for Fiona. It is applied by newClusterHandler, so only
+// authenticated callers are told that a path is reserved.
+func requireTenantPath(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := s3.ValidatePath(mux.Vars(r)["path"]); err != nil {
+			logging.FromContext(r.Context()).Warnf("Rejected path: %s", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// Operations recorded in the audit log
+const (
+	OperationCreateAppUser              = "CreateAppUser"
+	OperationCreateGroup                = "CreateGroup"
+	OperationAddGroupMember             = "AddGroupMember"
+	OperationRemoveGroupMember          = "RemoveGroupMember"
+	OperationCreateServiceAccount       = "CreateServiceAccount"
+	OperationDeleteServiceAccount       = "DeleteServiceAccount"
+	OperationCreateTemporaryCredentials = "CreateTemporaryCredentials"
+	OperationPresignURL                 = "PresignURL"
+	OperationCreateBucket               = "CreateBucket"
+	OperationUpdateBucket               = "UpdateBucket"
+	OperationSetLifecycle               = "SetLifecycle"
+	OperationSetNotification            = "SetNotification"
+	OperationDeleteNotification         = "DeleteNotification"
+	OperationDecommissionPath           = "DecommissionPath"
+	OperationCancelJob                  = "CancelJob"
+	OperationRebuildInventory           = "RebuildInventory"
+)
+
+// Outcomes recorded in the audit log
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Event is a single audit record. It must never carry secrets.
+type Event struct {
+	Time           time.Time `json:"time"`
+	RequestID      string    `json:"requestId,omitempty"`
+	Caller         string    `json:"caller,omitempty"`
+	SourceIP       string    `json:"sourceIp,omitempty"`
+	Operation      string    `json:"operation"`
+	Cluster        string    `json:"cluster,omitempty"`
+	Bucket         string    `json:"bucket,omitempty"`
+	Path           string    `json:"path,omitempty"`
+	Object         string    `json:"object,omitempty"`
+	Username       string    `json:"username,omitempty"`
+	Access         []string  `json:"access,omitempty"`
+	PolicyName     string    `json:"policyName,omitempty"`
+	Group          string    `json:"group,omitempty"`
+	ServiceAccount string    `json:"serviceAccount,omitempty"`
+	Target         string    `json:"target,omitempty"`     // Notification target
+	Job            string    `json:"job,omitempty"`        // Background job carrying out the operation
+	SecretSink     string    `json:"secretSink,omitempty"` // Where the credentials were delivered, when not in the response
+	Outcome        string    `json:"outcome"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// Logger records audit events
+type Logger interface {
+	Record(event Event)
+}
+
+// Sink receives serialized audit events, one JSON document per call
+type Sink interface {
+	Write(line []byte) error
+	Close() error
+}
+
+// SinkLogger is a Logger writing JSON lines to a Sink
+type SinkLogger struct {
+	sink Sink
+}
+
+// NewSinkLogger is a factory for SinkLogger
+func NewSinkLogger(sink Sink) *SinkLogger {
+	return &SinkLogger{sink: sink}
+}
+
+// NewLogger creates a Logger for the sink specified in config
+func NewLogger(config *Config) (*SinkLogger, error) {
+	sink, err := newSink(config)
+	if err != nil {
+		return nil, err
+	}
+	return NewSinkLogger(sink), nil
+}
+
+// Record writes the event to the sink. Failures are logged, never returned, so that
+// auditing does not break provisioning.
+func (logger *SinkLogger) Record(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		logrus.Errorf("Could not marshal audit event for %s: %s", event.Operation, err)
+		return
+	}
+	if err := logger.sink.Write(append(line, '\n')); err != nil {
+		logrus.Errorf("Could not write audit event for %s: %s", event.Operation, err)
+	}
+}
+
+// Close closes the underlying sink
+func (logger *SinkLogger) Close() error {
+	return logger.sink.Close()
+}
+
+// Succeeded marks the event as successful
+func (event Event) Succeeded() Event {
+	event.Outcome = OutcomeSuccess
+	event.Error = ""
+	return event
+}
+
+// Failed marks the event as failed with the given cause
+func (event Event) Failed(cause error) Event {
+	event.Outcome = OutcomeFailure
+	if cause != nil {
+		event.Error = cause.Error()
+	}
+	return event
+}
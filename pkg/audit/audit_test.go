@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testSink struct {
+	lines []string
+}
+
+func (ts *testSink) Write(line []byte) error {
+	ts.lines = append(ts.lines, string(line))
+	return nil
+}
+
+func (ts *testSink) Close() error {
+	return nil
+}
+
+func TestAuditLogger(t *testing.T) {
+	t.Run("Should write event as a single JSON line", func(t *testing.T) {
+		sink := &testSink{}
+		logger := NewSinkLogger(sink)
+
+		logger.Record(Event{Operation: OperationCreateAppUser, Bucket: "utv", Username: "testuser"}.Succeeded())
+
+		assert.Equal(t, 1, len(sink.lines))
+		assert.True(t, strings.HasSuffix(sink.lines[0], "\n"))
+		var event Event
+		assert.Nil(t, json.Unmarshal([]byte(sink.lines[0]), &event))
+		assert.Equal(t, OutcomeSuccess, event.Outcome)
+		assert.Equal(t, "testuser", event.Username)
+		assert.False(t, event.Time.IsZero())
+	})
+
+	t.Run("Should record failure cause", func(t *testing.T) {
+		event := Event{Operation: OperationCreateAppUser}.Failed(errors.New("Bucket does not exist"))
+
+		assert.Equal(t, OutcomeFailure, event.Outcome)
+		assert.Equal(t, "Bucket does not exist", event.Error)
+	})
+
+	t.Run("Should fail on unknown sink", func(t *testing.T) {
+		_, err := NewLogger(&Config{Sink: "carrierpigeon"})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestFileSink(t *testing.T) {
+	t.Run("Should rotate file when max size is exceeded", func(t *testing.T) {
+		dir, _ := ioutil.TempDir("", "fiona-audit")
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "audit.log")
+		sink, err := newFileSink(path, 1, 2)
+		assert.Nil(t, err)
+		sink.maxSize = 10
+
+		assert.Nil(t, sink.Write([]byte("first000\n")))
+		assert.Nil(t, sink.Write([]byte("second00\n")))
+		assert.Nil(t, sink.Write([]byte("third000\n")))
+		assert.Nil(t, sink.Write([]byte("fourth00\n")))
+		assert.Nil(t, sink.Close())
+
+		current, _ := ioutil.ReadFile(path)
+		backup1, _ := ioutil.ReadFile(path + ".1")
+		backup2, _ := ioutil.ReadFile(path + ".2")
+		assert.Equal(t, "fourth00\n", string(current))
+		assert.Equal(t, "third000\n", string(backup1))
+		assert.Equal(t, "second00\n", string(backup2))
+		_, err = os.Stat(path + ".3")
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("Should keep writing to the file when rotation fails", func(t *testing.T) {
+		dir, _ := ioutil.TempDir("", "fiona-audit")
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "audit.log")
+		sink, err := newFileSink(path, 1, 1)
+		assert.Nil(t, err)
+		sink.maxSize = 10
+		// A file can not be renamed onto a directory
+		assert.Nil(t, os.MkdirAll(filepath.Join(path+".1", "occupied"), 0700))
+
+		assert.Nil(t, sink.Write([]byte("first000\n")))
+		assert.Nil(t, sink.Write([]byte("second00\n")))
+		assert.Nil(t, sink.Write([]byte("third000\n")))
+		assert.Nil(t, sink.Close())
+
+		current, _ := ioutil.ReadFile(path)
+		assert.Equal(t, "first000\nsecond00\nthird000\n", string(current))
+	})
+}
+
+func TestWebhookSink(t *testing.T) {
+	t.Run("Should post event to webhook", func(t *testing.T) {
+		var received string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			received = string(body)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+		logger, err := NewLogger(&Config{Sink: SinkWebhook, WebhookURL: server.URL})
+		assert.Nil(t, err)
+
+		logger.Record(Event{Operation: OperationCreateAppUser}.Succeeded())
+
+		assert.Contains(t, received, OperationCreateAppUser)
+	})
+
+	t.Run("Should fail when webhook returns error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+		sink, _ := newWebhookSink(server.URL)
+
+		assert.NotNil(t, sink.Write([]byte("{}\n")))
+	})
+}
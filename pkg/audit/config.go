@@ -0,0 +1,36 @@
+package audit
+
+import (
+	"fmt"
+)
+
+// Sink types
+const (
+	SinkNone    = "none"
+	SinkStdout  = "stdout"
+	SinkFile    = "file"
+	SinkWebhook = "webhook"
+)
+
+// Config for the audit log
+type Config struct {
+	Sink           string // Default "stdout"
+	FilePath       string // Used by the file sink
+	FileMaxSizeMB  int    // Rotate when the file exceeds this size, default 100
+	FileMaxBackups int    // Number of rotated files to keep, default 10
+	WebhookURL     string // Used by the webhook sink
+}
+
+func newSink(config *Config) (Sink, error) {
+	switch config.Sink {
+	case SinkNone:
+		return discardSink{}, nil
+	case SinkStdout, "":
+		return newStdoutSink(), nil
+	case SinkFile:
+		return newFileSink(config.FilePath, config.FileMaxSizeMB, config.FileMaxBackups)
+	case SinkWebhook:
+		return newWebhookSink(config.WebhookURL)
+	}
+	return nil, fmt.Errorf("unknown audit sink %q", config.Sink)
+}
@@ -0,0 +1,167 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFileMaxSizeMB  = 100
+	defaultFileMaxBackups = 10
+	webhookTimeoutSeconds = 5
+)
+
+type discardSink struct{}
+
+func (discardSink) Write(line []byte) error { return nil }
+func (discardSink) Close() error            { return nil }
+
+// writerSink writes to an io.Writer, typically stdout
+type writerSink struct {
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+func newStdoutSink() *writerSink {
+	return &writerSink{writer: os.Stdout}
+}
+
+func (sink *writerSink) Write(line []byte) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	_, err := sink.writer.Write(line)
+	return err
+}
+
+func (sink *writerSink) Close() error {
+	return nil
+}
+
+// fileSink appends to a file and rotates it by size
+type fileSink struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func newFileSink(path string, maxSizeMB int, maxBackups int) (*fileSink, error) {
+	if path == "" {
+		return nil, errors.New("audit file sink requires a file path")
+	}
+	if maxSizeMB <= 0 {
+		maxSizeMB = defaultFileMaxSizeMB
+	}
+	if maxBackups <= 0 {
+		maxBackups = defaultFileMaxBackups
+	}
+	sink := &fileSink{
+		path:       path,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		maxBackups: maxBackups,
+	}
+	if err := sink.open(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (sink *fileSink) open() error {
+	file, err := os.OpenFile(sink.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open audit file %s: %w", sink.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	sink.file = file
+	sink.size = info.Size()
+	return nil
+}
+
+func (sink *fileSink) Write(line []byte) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if sink.size > 0 && sink.size+int64(len(line)) > sink.maxSize {
+		if err := sink.rotate(); err != nil {
+			logrus.Errorf("Could not rotate audit file %s, appending to it: %s", sink.path, err)
+		}
+	}
+	n, err := sink.file.Write(line)
+	sink.size += int64(n)
+	return err
+}
+
+// rotate renames path to path.1, path.1 to path.2 and so on, dropping the oldest. Path is opened again even when
+// renaming fails, so events are still written, and rotation is retried on the next write.
+func (sink *fileSink) rotate() error {
+	err := sink.file.Close()
+	if err == nil {
+		err = sink.renameBackups()
+	}
+	if openErr := sink.open(); openErr != nil {
+		return openErr
+	}
+	return err
+}
+
+func (sink *fileSink) renameBackups() error {
+	for i := sink.maxBackups - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", sink.path, i)
+		if _, err := os.Stat(from); err == nil {
+			if err := os.Rename(from, fmt.Sprintf("%s.%d", sink.path, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Rename(sink.path, sink.path+".1")
+}
+
+func (sink *fileSink) Close() error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	return sink.file.Close()
+}
+
+// webhookSink posts each event to an HTTP endpoint
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhookSink(url string) (*webhookSink, error) {
+	if url == "" {
+		return nil, errors.New("audit webhook sink requires a URL")
+	}
+	return &webhookSink{
+		url:    url,
+		client: &http.Client{Timeout: webhookTimeoutSeconds * time.Second},
+	}, nil
+}
+
+func (sink *webhookSink) Write(line []byte) error {
+	response, err := sink.client.Post(sink.url, "application/json", bytes.NewReader(line))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("audit webhook returned %s", response.Status)
+	}
+	return nil
+}
+
+func (sink *webhookSink) Close() error {
+	return nil
+}
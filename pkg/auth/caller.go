@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+)
+
+type contextKey int
+
+const (
+	callerKey contextKey = iota
+	sourceIPKey
+)
+
+// Scopes granted to callers
+const (
+	ScopeAll                   = "*"
+	ScopeCreateUserPolicy      = "userpolicies:create"
+	ScopeListUsers             = "users:list"
+	ScopeReadServerInfo        = "serverinfo:read"
+	ScopeManageGroups          = "groups:manage"
+	ScopeReadGroups            = "groups:read"
+	ScopeManageServiceAccounts = "serviceaccounts:manage"
+	ScopeReadServiceAccounts   = "serviceaccounts:read"
+	ScopeCreateCredentials     = "credentials:create"
+	ScopeReadUsage             = "usage:read"
+	ScopeScanUsage             = "usage:scan"
+	ScopeManageBuckets         = "buckets:manage"
+	ScopeReadBuckets           = "buckets:read"
+	ScopeManageLifecycle       = "lifecycle:manage"
+	ScopeReadLifecycle         = "lifecycle:read"
+	ScopeManageNotifications   = "notifications:manage"
+	ScopeReadNotifications     = "notifications:read"
+	ScopeDecommissionPaths     = "paths:decommission"
+	ScopeManageJobs            = "jobs:manage"
+	ScopeReadJobs              = "jobs:read"
+	ScopeReadInventory         = "inventory:read"
+	ScopeReconcileInventory    = "inventory:reconcile"
+)
+
+// AllClusters grants a caller access to every configured minio cluster
+const AllClusters = "*"
+
+// Caller identifies the authenticated client of a request
+type Caller struct {
+	Name     string
+	Scopes   []string
+	Clusters []string
+}
+
+// HasScope tells whether the caller has been granted scope
+func (caller Caller) HasScope(scope string) bool {
+	for _, s := range caller.Scopes {
+		if s == scope || s == ScopeAll {
+			return true
+		}
+	}
+	return false
+}
+
+// CanTargetCluster tells whether the caller may provision in the named minio cluster
+func (caller Caller) CanTargetCluster(cluster string) bool {
+	for _, c := range caller.Clusters {
+		if c == cluster || c == AllClusters {
+			return true
+		}
+	}
+	return false
+}
+
+// WithCaller returns a copy of ctx carrying the authenticated caller
+func WithCaller(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, callerKey, caller)
+}
+
+// CallerFromContext returns the authenticated caller, if any
+func CallerFromContext(ctx context.Context) (Caller, bool) {
+	caller, ok := ctx.Value(callerKey).(Caller)
+	return caller, ok
+}
+
+// WithSourceIP returns a copy of ctx carrying the address of the client
+func WithSourceIP(ctx context.Context, sourceIP string) context.Context {
+	return context.WithValue(ctx, sourceIPKey, sourceIP)
+}
+
+// SourceIPFromContext returns the address of the client, if any
+func SourceIPFromContext(ctx context.Context) (string, bool) {
+	sourceIP, ok := ctx.Value(sourceIPKey).(string)
+	return sourceIP, ok
+}
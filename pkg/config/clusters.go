@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+)
+
+// clusterCredentials is the content of a cluster credentials file
+type clusterCredentials struct {
+	AccessKey string `yaml:"accessKey"`
+	SecretKey string `yaml:"secretKey"`
+}
+
+// readClusters reads the clusters file and returns the S3 config of each named cluster. Settings not given for a
+// cluster, like TLS and the user password policy, are taken from the default cluster. Temporary credentials are only
+// enabled for a cluster with its own stsCredentialsFile.
+func readClusters(location string, defaultConfig *s3.Config) (map[string]s3.Config, []string) {
+	content, err := ioutil.ReadFile(location)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("FIONA_CLUSTERS_FILE could not be read: %s", err)}
+	}
+	var clusterConfigs []s3.ClusterConfig
+	if err := yaml.Unmarshal(content, &clusterConfigs); err != nil {
+		return nil, []string{fmt.Sprintf("FIONA_CLUSTERS_FILE could not be parsed: %s", err)}
+	}
+
+	var problems []string
+	clusters := map[string]s3.Config{}
+	for i, clusterConfig := range clusterConfigs {
+		name := clusterConfig.Name
+		if name == "" {
+			problems = append(problems, fmt.Sprintf("cluster %d in FIONA_CLUSTERS_FILE has no name", i+1))
+			continue
+		}
+		if _, exists := clusters[name]; exists || name == s3.DefaultClusterName {
+			problems = append(problems, fmt.Sprintf("cluster %s in FIONA_CLUSTERS_FILE is configured more than once", name))
+			continue
+		}
+
+		config := *defaultConfig
+		config.S3Host = clusterConfig.Host
+		config.S3Port = clusterConfig.Port
+		config.S3UseSSL = clusterConfig.UseSSL
+		if clusterConfig.Region != "" {
+			config.S3Region = clusterConfig.Region
+		}
+		config.AccessKey, config.SecretKey = "", ""
+		if clusterConfig.CredentialsFile == "" {
+			problems = append(problems, fmt.Sprintf("cluster %s must have a credentialsFile", name))
+		} else if credentials, err := readClusterCredentials(clusterConfig.CredentialsFile); err != nil {
+			problems = append(problems, fmt.Sprintf("cluster %s: %s", name, err))
+		} else {
+			config.AccessKey, config.SecretKey = credentials.AccessKey, credentials.SecretKey
+		}
+		config.STS.AccessKey, config.STS.SecretKey = "", ""
+		if clusterConfig.STSCredentialsFile != "" {
+			if credentials, err := readClusterCredentials(clusterConfig.STSCredentialsFile); err != nil {
+				problems = append(problems, fmt.Sprintf("cluster %s: %s", name, err))
+			} else {
+				config.STS.AccessKey, config.STS.SecretKey = credentials.AccessKey, credentials.SecretKey
+			}
+		}
+
+		for _, problem := range validateEndpoint(&config, "host", "port", "region") {
+			problems = append(problems, fmt.Sprintf("cluster %s: %s", name, problem))
+		}
+		clusters[name] = config
+	}
+	return clusters, problems
+}
+
+func readClusterCredentials(location string) (*clusterCredentials, error) {
+	content, err := ioutil.ReadFile(location)
+	if err != nil {
+		return nil, fmt.Errorf("credentials could not be read: %s", err)
+	}
+	var credentials clusterCredentials
+	if err := yaml.Unmarshal(content, &credentials); err != nil {
+		return nil, fmt.Errorf("credentials in %s could not be parsed: %s", location, err)
+	}
+	if credentials.AccessKey == "" || credentials.SecretKey == "" {
+		return nil, fmt.Errorf("credentials in %s must have accessKey and secretKey", location)
+	}
+	return &credentials, nil
+}
@@ -1,11 +1,16 @@
 package config
 
 import (
-	"fmt"
-	"github.com/sirupsen/logrus"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/inventory"
+	"github.com/skatteetaten/fiona/pkg/jobs"
+	"github.com/skatteetaten/fiona/pkg/kubernetes"
 	"github.com/skatteetaten/fiona/pkg/s3"
+	"github.com/skatteetaten/fiona/pkg/server"
+	"github.com/skatteetaten/fiona/pkg/tracing"
+	"github.com/skatteetaten/fiona/pkg/vault"
 	"os"
-	"strconv"
+	"time"
 )
 
 const auroraTokenLocation = "./aurora-token"
@@ -15,13 +20,40 @@ const (
 	FionaDefaultPassword = "FIONA_DEFAULT_PASSWORD"
 	FionaSecretKey       = "FIONA_SECRET_KEY"
 	FionaAccessKey       = "FIONA_ACCESS_KEY"
+	FionaConfigFile      = "FIONA_CONFIG_FILE"
+	FionaDevMode         = "FIONA_DEV_MODE"
+	FionaSTSSecretKey    = "FIONA_STS_SECRET_KEY"
+)
+
+// Well-known credentials, only used in development mode
+const (
+	devAccessKey       = "aurora"
+	devSecretKey       = "fragleberget"
+	devDefaultUserpass = "S3userpass"
 )
 
 // Config for the S3 access
 type Config struct {
+	// DevMode allows the well-known development credentials. Without it missing secrets abort startup.
+	DevMode             bool
 	S3Config            s3.Config
-	DebugLog            bool // default "false"
+	ServerConfig        server.Config
+	AuditConfig         audit.Config
+	TracingConfig       tracing.Config
+	KubernetesConfig    kubernetes.Config
+	VaultConfig         vault.Config
+	InventoryConfig     inventory.Config
+	DebugLog            bool   // default "false"
+	LogFormat           string // "text" or "json", default "text"
 	AuroraTokenLocation string
+	// ClustersLocation is a YAML or JSON file with additional named minio clusters, read into S3Clusters
+	ClustersLocation string
+	S3Clusters       map[string]s3.Config
+	// AuroraTokenClusters are the clusters requests authenticated with the aurora token may target, "*" for all
+	AuroraTokenClusters []string
+	// ClientCertIdentitiesLocation is a JSON file mapping client certificate subjects to callers and scopes.
+	// Client certificate authentication is enabled when it is set.
+	ClientCertIdentitiesLocation string
 }
 
 // Reader interface
@@ -31,6 +63,8 @@ type Reader interface {
 
 // ConfReader is a Reader receiver
 type ConfReader struct {
+	// ConfigFile is an optional YAML or JSON config file. FIONA_CONFIG_FILE is used when it is empty.
+	ConfigFile string
 }
 
 // NewConfigReader factory method
@@ -38,47 +72,132 @@ func NewConfigReader() Reader {
 	return &ConfReader{}
 }
 
-// ReadConfig implementation
+// NewConfigReaderForFile creates a Reader merging the given config file with the environment
+func NewConfigReaderForFile(configFile string) Reader {
+	return &ConfReader{ConfigFile: configFile}
+}
+
+// ReadConfig reads the config file, if any, and the environment, which takes precedence over the file.
+// All problems found are returned together in a ValidationError.
 func (m *ConfReader) ReadConfig() (*Config, error) {
-	useSsl := getEnvBoolOrDefault("FIONA_S3_USESSL", false)
-	randomUserpass := getEnvBoolOrDefault("FIONA_RANDOMPASS", true)
-	debuglog := getEnvBoolOrDefault("FIONA_DEBUG", false)
+	configFile := m.ConfigFile
+	if configFile == "" {
+		configFile = os.Getenv(FionaConfigFile)
+	}
+	s := &settings{}
+	if configFile != "" {
+		file, err := readConfigFile(configFile)
+		if err != nil {
+			return nil, err
+		}
+		s.file = file
+	}
 
-	return &Config{
+	devMode := s.bool(FionaDevMode, false)
+	config := &Config{
+		DevMode: devMode,
 		S3Config: s3.Config{
-			S3Host:          getEnvOrDefault("FIONA_S3_HOST", "localhost"),
-			S3Port:          getEnvOrDefault("FIONA_S3_PORT", "9000"),
-			S3UseSSL:        useSsl,
-			S3Region:        getEnvOrDefault("FIONA_S3_REGION", "us-east-1"),
-			RandomUserpass:  randomUserpass,
-			DefaultUserpass: getEnvOrDefault(FionaDefaultPassword, "S3userpass"),
-			AccessKey:       getEnvOrDefault(FionaAccessKey, "aurora"),
-			SecretKey:       getEnvOrDefault(FionaSecretKey, "fragleberget"),
-			DefaultBucket:   getEnvOrDefault("FIONA_DEFAULTBUCKET", "utv"),
+			S3Host:          s.string("FIONA_S3_HOST", "localhost"),
+			S3Port:          s.string("FIONA_S3_PORT", "9000"),
+			S3UseSSL:        s.bool("FIONA_S3_USESSL", false),
+			S3Region:        s.string("FIONA_S3_REGION", "us-east-1"),
+			RandomUserpass:  s.bool("FIONA_RANDOMPASS", true),
+			DefaultUserpass: s.secret(FionaDefaultPassword, devMode, devDefaultUserpass),
+			AccessKey:       s.secret(FionaAccessKey, devMode, devAccessKey),
+			SecretKey:       s.secret(FionaSecretKey, devMode, devSecretKey),
+			DefaultBucket:   s.string("FIONA_DEFAULTBUCKET", "utv"),
+			UseGroups:       s.bool("FIONA_USE_GROUPS", false),
+			TLS: s3.TLSConfig{
+				CABundle:           s.string("FIONA_S3_CA_BUNDLE", ""),
+				ServerName:         s.string("FIONA_S3_TLS_SERVERNAME", ""),
+				InsecureSkipVerify: s.bool("FIONA_S3_TLS_INSECURE_SKIP_VERIFY", false),
+				ClientCertFile:     s.string("FIONA_S3_TLS_CLIENT_CERT_FILE", ""),
+				ClientKeyFile:      s.string("FIONA_S3_TLS_CLIENT_KEY_FILE", ""),
+				MinVersion:         s.string("FIONA_S3_TLS_MIN_VERSION", "1.2"),
+			},
+			STS: s3.STSConfig{
+				AccessKey:  s.secret("FIONA_STS_ACCESS_KEY", devMode, ""),
+				SecretKey:  s.secret(FionaSTSSecretKey, devMode, ""),
+				DefaultTTL: s.duration("FIONA_STS_DEFAULT_TTL", time.Hour),
+				MaxTTL:     s.duration("FIONA_STS_MAX_TTL", 12*time.Hour),
+			},
+			Quota: s3.QuotaConfig{
+				ScanInterval: s.duration("FIONA_QUOTA_SCAN_INTERVAL", 15*time.Minute),
+				Enforce:      s.bool("FIONA_QUOTA_ENFORCE", false),
+			},
+			NotificationTargets: s.mapping("FIONA_NOTIFICATION_TARGETS"),
+			SeedTemplatePrefix:  s.string("FIONA_SEED_TEMPLATE_PREFIX", ".fiona/templates/"),
+			Jobs: jobs.Config{
+				Dir:       s.string("FIONA_JOBS_DIR", "./fiona-jobs"),
+				Workers:   s.int("FIONA_JOBS_WORKERS", 2),
+				Retention: s.duration("FIONA_JOBS_RETENTION", 7*24*time.Hour),
+			},
 		},
-		DebugLog:            debuglog,
-		AuroraTokenLocation: getEnvOrDefault("FIONA_AURORATOKENLOCATION", auroraTokenLocation),
-	}, nil
-}
-
-func getEnvBoolOrDefault(key string, fallback bool) bool {
-	value := os.Getenv(key)
-	if len(value) == 0 {
-		return fallback
+		ServerConfig: server.Config{
+			ListenAddress:           s.string("FIONA_LISTEN_ADDRESS", ":8080"),
+			ManagementListenAddress: s.string("FIONA_MANAGEMENT_LISTEN_ADDRESS", ":8081"),
+			ReadTimeout:             s.duration("FIONA_READ_TIMEOUT", 30*time.Second),
+			WriteTimeout:            s.duration("FIONA_WRITE_TIMEOUT", 60*time.Second),
+			IdleTimeout:             s.duration("FIONA_IDLE_TIMEOUT", 120*time.Second),
+			MaxHeaderBytes:          s.int("FIONA_MAX_HEADER_BYTES", 1<<20),
+			ShutdownTimeout:         s.duration("FIONA_SHUTDOWN_TIMEOUT", 30*time.Second),
+			TLSCertFile:             s.string("FIONA_TLS_CERT_FILE", ""),
+			TLSKeyFile:              s.string("FIONA_TLS_KEY_FILE", ""),
+			TLSClientCAFile:         s.string("FIONA_TLS_CLIENT_CA_FILE", ""),
+			TrustedProxies:          s.list("FIONA_TRUSTED_PROXIES", nil),
+		},
+		AuditConfig: audit.Config{
+			Sink:           s.string("FIONA_AUDIT_SINK", audit.SinkStdout),
+			FilePath:       s.string("FIONA_AUDIT_FILE", "./fiona-audit.log"),
+			FileMaxSizeMB:  s.int("FIONA_AUDIT_FILE_MAXSIZEMB", 100),
+			FileMaxBackups: s.int("FIONA_AUDIT_FILE_MAXBACKUPS", 10),
+			WebhookURL:     s.string("FIONA_AUDIT_WEBHOOK_URL", ""),
+		},
+		TracingConfig: tracing.Config{
+			Exporter:     s.string("FIONA_TRACING_EXPORTER", tracing.ExporterNone),
+			OTLPEndpoint: s.string("FIONA_TRACING_OTLP_ENDPOINT", "localhost:4318"),
+			OTLPInsecure: s.bool("FIONA_TRACING_OTLP_INSECURE", false),
+		},
+		KubernetesConfig: kubernetes.Config{
+			Enabled:    s.bool("FIONA_KUBERNETES_SECRETS_ENABLED", false),
+			APIURL:     s.string("FIONA_KUBERNETES_API_URL", ""),
+			TokenFile:  s.string("FIONA_KUBERNETES_TOKEN_FILE", ""),
+			CAFile:     s.string("FIONA_KUBERNETES_CA_FILE", ""),
+			Namespaces: s.list("FIONA_KUBERNETES_NAMESPACES", nil),
+		},
+		VaultConfig: vault.Config{
+			Address:      s.string("FIONA_VAULT_ADDR", ""),
+			PathTemplate: s.string("FIONA_VAULT_PATH_TEMPLATE", vault.DefaultPathTemplate),
+			Token:        s.secret("FIONA_VAULT_TOKEN", devMode, ""),
+			RoleID:       s.string("FIONA_VAULT_ROLE_ID", ""),
+			SecretID:     s.secret("FIONA_VAULT_SECRET_ID", devMode, ""),
+			AppRoleMount: s.string("FIONA_VAULT_APPROLE_MOUNT", "approle"),
+			CAFile:       s.string("FIONA_VAULT_CA_FILE", ""),
+		},
+		InventoryConfig: inventory.Config{
+			Store: s.string("FIONA_INVENTORY_STORE", inventory.StoreBolt),
+			File:  s.string("FIONA_INVENTORY_FILE", "./fiona-inventory.db"),
+		},
+		DebugLog:                     s.bool("FIONA_DEBUG", false),
+		LogFormat:                    s.string("FIONA_LOG_FORMAT", "text"),
+		AuroraTokenLocation:          s.string("FIONA_AURORATOKENLOCATION", auroraTokenLocation),
+		ClientCertIdentitiesLocation: s.string("FIONA_CLIENTCERT_IDENTITIES_FILE", ""),
+		ClustersLocation:             s.string("FIONA_CLUSTERS_FILE", ""),
+		AuroraTokenClusters:          s.list("FIONA_AURORATOKEN_CLUSTERS", []string{"*"}),
 	}
-
-	valueBool, err := strconv.ParseBool(value)
-	if err != nil {
-		logrus.Warnf(fmt.Sprintf("%s must be a boolean (true or false), was %s. Using fallback value.", key, value))
-		return fallback
+	if config.KubernetesConfig.Enabled {
+		config.KubernetesConfig.InClusterDefaults()
+	}
+	if config.ClustersLocation != "" {
+		clusters, problems := readClusters(config.ClustersLocation, &config.S3Config)
+		config.S3Clusters = clusters
+		s.problems = append(s.problems, problems...)
 	}
-	return valueBool
-}
 
-func getEnvOrDefault(key, fallback string) string {
-	value := os.Getenv(key)
-	if len(value) == 0 {
-		return fallback
+	problems := append(s.problems, s.unknownFileKeys()...)
+	problems = append(problems, Validate(config)...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
 	}
-	return value
+	return config, nil
 }
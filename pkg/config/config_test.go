@@ -1,15 +1,22 @@
 package config
 
 import (
+	"github.com/skatteetaten/fiona/pkg/inventory"
+	"github.com/skatteetaten/fiona/pkg/kubernetes"
+	"github.com/skatteetaten/fiona/pkg/s3"
 	"github.com/stretchr/testify/assert"
+	"os"
 	"testing"
+	"time"
 )
 
 func TestConfig(t *testing.T) {
-	t.Run("Should return config with default values", func(t *testing.T) {
-		if getEnvBoolOrDefault("FIONA_DEBUG", false) {
+	t.Run("Should return config with default values in development mode", func(t *testing.T) {
+		if os.Getenv("FIONA_DEBUG") == "true" {
 			t.Skip("Skipping default config test when FIONA_DEBUG is true")
 		}
+		defer setEnv("FIONA_AURORATOKENLOCATION", "testdata/token")()
+		defer setEnv(FionaDevMode, "true")()
 		confreader := ConfReader{}
 
 		config, err := confreader.ReadConfig()
@@ -24,7 +31,219 @@ func TestConfig(t *testing.T) {
 		assert.Equal(t, "aurora", config.S3Config.AccessKey)
 		assert.Equal(t, "fragleberget", config.S3Config.SecretKey)
 		assert.Equal(t, "utv", config.S3Config.DefaultBucket)
+		assert.Equal(t, "./fiona-jobs", config.S3Config.Jobs.Dir)
+		assert.Equal(t, inventory.StoreBolt, config.InventoryConfig.Store)
+		assert.Equal(t, "./fiona-inventory.db", config.InventoryConfig.File)
 		assert.Equal(t, false, config.DebugLog)
 	})
 
+	t.Run("Should refuse to start without secrets in production mode", func(t *testing.T) {
+		defer setEnv("FIONA_AURORATOKENLOCATION", "testdata/token")()
+		defer setEnv("FIONA_RANDOMPASS", "false")()
+
+		_, err := NewConfigReader().ReadConfig()
+		assert.Error(t, err)
+		assert.Len(t, err.(*ValidationError).Problems, 3)
+		assert.Contains(t, err.Error(), "FIONA_ACCESS_KEY or FIONA_ACCESS_KEY_FILE must be set")
+		assert.Contains(t, err.Error(), "FIONA_SECRET_KEY or FIONA_SECRET_KEY_FILE must be set")
+		assert.Contains(t, err.Error(), "FIONA_DEFAULT_PASSWORD or FIONA_DEFAULT_PASSWORD_FILE must be set")
+	})
+
+	t.Run("Should refuse the development credentials in production mode", func(t *testing.T) {
+		defer setEnv("FIONA_AURORATOKENLOCATION", "testdata/token")()
+		defer setEnv(FionaAccessKey, "aurora")()
+		defer setEnv(FionaSecretKey, "fragleberget")()
+
+		_, err := NewConfigReader().ReadConfig()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "FIONA_SECRET_KEY must not be the well-known development default")
+	})
+
+	t.Run("Should read secrets from files", func(t *testing.T) {
+		config, err := NewConfigReaderForFile("testdata/fiona.json").ReadConfig()
+		assert.Nil(t, err)
+		assert.Equal(t, "minioadmin", config.S3Config.AccessKey)
+		assert.Equal(t, "n0t-s0-s3cret", config.S3Config.SecretKey)
+		assert.Equal(t, false, config.DevMode)
+	})
+
+	t.Run("Should not allow a secret both directly and from file", func(t *testing.T) {
+		defer setEnv(FionaSecretKey, "another-secret")()
+
+		_, err := NewConfigReaderForFile("testdata/fiona.json").ReadConfig()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "only one of FIONA_SECRET_KEY and FIONA_SECRET_KEY_FILE may be set")
+	})
+
+	t.Run("Should read config file with environment taking precedence", func(t *testing.T) {
+		defer setEnv("FIONA_S3_HOST", "minio.override.local")()
+
+		config, err := NewConfigReaderForFile("testdata/fiona.json").ReadConfig()
+		assert.Nil(t, err)
+
+		assert.Equal(t, "minio.override.local", config.S3Config.S3Host)
+		assert.Equal(t, "9443", config.S3Config.S3Port)
+		assert.Equal(t, true, config.S3Config.S3UseSSL)
+		assert.Equal(t, 10*time.Second, config.ServerConfig.ReadTimeout)
+		assert.Equal(t, "utv", config.S3Config.DefaultBucket)
+	})
+
+	t.Run("Should take the config file from FIONA_CONFIG_FILE", func(t *testing.T) {
+		defer setEnv(FionaConfigFile, "testdata/fiona.json")()
+
+		config, err := NewConfigReader().ReadConfig()
+		assert.Nil(t, err)
+		assert.Equal(t, "minio.example.com", config.S3Config.S3Host)
+	})
+
+	t.Run("Should fail when the config file is missing", func(t *testing.T) {
+		_, err := NewConfigReaderForFile("testdata/missing.yaml").ReadConfig()
+		assert.Error(t, err)
+	})
+
+	t.Run("Should return all problems together", func(t *testing.T) {
+		defer setEnv("FIONA_AURORATOKENLOCATION", "testdata/missing-token")()
+		defer setEnv("FIONA_S3_PORT", "ninethousand")()
+		defer setEnv("FIONA_S3_REGION", " ")()
+		defer setEnv("FIONA_DEBUG", "yes please")()
+
+		_, err := NewConfigReaderForFile("testdata/fiona.yaml").ReadConfig()
+		assert.Error(t, err)
+		validationError, ok := err.(*ValidationError)
+		assert.True(t, ok)
+		assert.Len(t, validationError.Problems, 5)
+		assert.Contains(t, err.Error(), "FIONA_DEBUG must be a boolean")
+		assert.Contains(t, err.Error(), "unknown setting aurora_tokenlocation_typo")
+		assert.Contains(t, err.Error(), "FIONA_S3_PORT must be a port number")
+		assert.Contains(t, err.Error(), "FIONA_S3_REGION must not be empty")
+		assert.Contains(t, err.Error(), "FIONA_AURORATOKENLOCATION must point to a token file")
+	})
+}
+
+func TestClusters(t *testing.T) {
+	t.Run("Should read named clusters with defaults from the default cluster", func(t *testing.T) {
+		defaultConfig := &s3.Config{S3Region: "us-east-1", DefaultBucket: "utv", RandomUserpass: true, STS: s3.STSConfig{AccessKey: "fiona-sts", SecretKey: "s3cret"}}
+
+		clusters, problems := readClusters("testdata/clusters.yaml", defaultConfig)
+
+		archive := clusters["archive"]
+		assert.Equal(t, "minio-archive.example.com", archive.S3Host)
+		assert.Equal(t, true, archive.S3UseSSL)
+		assert.Equal(t, "us-east-1", archive.S3Region)
+		assert.Equal(t, "utv", archive.DefaultBucket)
+		assert.Equal(t, "archiveadmin", archive.AccessKey)
+		assert.Equal(t, "archive-s3cret", archive.SecretKey)
+		assert.False(t, archive.STS.Enabled(), "STS credentials of the default cluster must not be used in other clusters")
+
+		assert.Len(t, problems, 2)
+		assert.Contains(t, problems[0], "cluster broken: credentials could not be read")
+		assert.Contains(t, problems[1], "cluster broken: host must be a host name")
+	})
+
+	t.Run("Should fail startup on invalid clusters", func(t *testing.T) {
+		defer setEnv("FIONA_CLUSTERS_FILE", "testdata/clusters.yaml")()
+
+		_, err := NewConfigReaderForFile("testdata/fiona.json").ReadConfig()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "cluster broken")
+	})
+}
+
+func TestValidate(t *testing.T) {
+	validConfig := func() *Config {
+		config, err := NewConfigReaderForFile("testdata/fiona.json").ReadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return config
+	}
+
+	t.Run("Should accept host names and IP addresses", func(t *testing.T) {
+		for _, host := range []string{"localhost", "minio", "minio.example.com", "10.0.0.1", "::1"} {
+			config := validConfig()
+			config.S3Config.S3Host = host
+			assert.Empty(t, Validate(config), host)
+		}
+	})
+
+	t.Run("Should reject hosts with scheme or port", func(t *testing.T) {
+		for _, host := range []string{"", "http://minio", "minio:9000", "minio/path", "-minio"} {
+			config := validConfig()
+			config.S3Config.S3Host = host
+			assert.Len(t, Validate(config), 1, host)
+		}
+	})
+
+	t.Run("Should require the namespaces of Kubernetes secrets", func(t *testing.T) {
+		config := validConfig()
+		config.KubernetesConfig = kubernetes.Config{Enabled: true, APIURL: "https://kubernetes"}
+		assert.Len(t, Validate(config), 1)
+
+		config.KubernetesConfig.Namespaces = []string{"appx"}
+		assert.Empty(t, Validate(config))
+	})
+
+	t.Run("Should reject ports out of range", func(t *testing.T) {
+		config := validConfig()
+		config.S3Config.S3Port = "70000"
+		assert.Len(t, Validate(config), 1)
+	})
+
+	t.Run("Should require TLS certificate and key together", func(t *testing.T) {
+		config := validConfig()
+		config.ServerConfig.TLSCertFile = "cert.pem"
+		assert.Len(t, Validate(config), 1)
+	})
+
+	t.Run("Should reject unknown audit sink and tracing exporter", func(t *testing.T) {
+		config := validConfig()
+		config.AuditConfig.Sink = "syslog"
+		config.TracingConfig.Exporter = "jaeger"
+		assert.Len(t, Validate(config), 2)
+	})
+
+	t.Run("Should require STS secret key and TTLs minio accepts", func(t *testing.T) {
+		config := validConfig()
+		config.S3Config.STS.AccessKey = "fiona-sts"
+		config.S3Config.STS.DefaultTTL = 5 * time.Minute
+		config.S3Config.STS.MaxTTL = 24 * time.Hour
+		assert.Len(t, Validate(config), 3)
+	})
+
+	t.Run("Should reject trusted proxies that are not addresses or ranges", func(t *testing.T) {
+		config := validConfig()
+		config.ServerConfig.TrustedProxies = []string{"10.0.0.0/8", "proxy.example.com"}
+		assert.Len(t, Validate(config), 1)
+	})
+
+	t.Run("Should reject quota scans more often than every minute", func(t *testing.T) {
+		config := validConfig()
+		config.S3Config.Quota.ScanInterval = 10 * time.Second
+		assert.Len(t, Validate(config), 1)
+	})
+
+	t.Run("Should require a reserved seed template prefix", func(t *testing.T) {
+		config := validConfig()
+		config.S3Config.SeedTemplatePrefix = "templates/"
+		assert.Len(t, Validate(config), 1)
+	})
+
+	t.Run("Should reject unknown inventory stores", func(t *testing.T) {
+		config := validConfig()
+		config.InventoryConfig.Store = "sqlite"
+		assert.Len(t, Validate(config), 1)
+	})
+}
+
+// setEnv sets an environment variable and returns a function restoring the previous value
+func setEnv(key, value string) func() {
+	previous, existed := os.LookupEnv(key)
+	os.Setenv(key, value)
+	return func() {
+		if existed {
+			os.Setenv(key, previous)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
 }
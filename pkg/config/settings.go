@@ -0,0 +1,176 @@
+package config
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// settings looks up configuration values. Environment variables take precedence over the config file,
+// and values that cannot be parsed are collected as problems instead of falling back to the default.
+type settings struct {
+	file     map[string]string
+	used     map[string]bool
+	problems []string
+}
+
+// readConfigFile reads a flat YAML or JSON file. Keys are the environment variable names in lower case
+// without the FIONA_ prefix, e.g. s3_host for FIONA_S3_HOST.
+func readConfigFile(path string) (map[string]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %s", err)
+	}
+	raw := map[string]interface{}{}
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("could not parse config file %s: %s", path, err)
+	}
+
+	file := map[string]string{}
+	for key, value := range raw {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, fmt.Errorf("could not parse config file %s: %s must be a single value", path, key)
+		case nil:
+			file[key] = ""
+		default:
+			file[key] = fmt.Sprint(value)
+		}
+	}
+	return file, nil
+}
+
+func fileKey(envKey string) string {
+	return strings.ToLower(strings.TrimPrefix(envKey, "FIONA_"))
+}
+
+func (s *settings) lookup(key string) (string, string, bool) {
+	fkey := fileKey(key)
+	if s.used == nil {
+		s.used = map[string]bool{}
+	}
+	s.used[fkey] = true
+	if value := os.Getenv(key); len(value) > 0 {
+		return value, key, true
+	}
+	if value, ok := s.file[fkey]; ok && len(value) > 0 {
+		return value, fkey, true
+	}
+	return "", "", false
+}
+
+func (s *settings) string(key, fallback string) string {
+	value, _, ok := s.lookup(key)
+	if !ok {
+		return fallback
+	}
+	return value
+}
+
+func (s *settings) bool(key string, fallback bool) bool {
+	value, source, ok := s.lookup(key)
+	if !ok {
+		return fallback
+	}
+	valueBool, err := strconv.ParseBool(value)
+	if err != nil {
+		s.problems = append(s.problems, fmt.Sprintf("%s must be a boolean (true or false), was %q", source, value))
+		return fallback
+	}
+	return valueBool
+}
+
+func (s *settings) int(key string, fallback int) int {
+	value, source, ok := s.lookup(key)
+	if !ok {
+		return fallback
+	}
+	valueInt, err := strconv.Atoi(value)
+	if err != nil {
+		s.problems = append(s.problems, fmt.Sprintf("%s must be an integer, was %q", source, value))
+		return fallback
+	}
+	return valueInt
+}
+
+func (s *settings) duration(key string, fallback time.Duration) time.Duration {
+	value, source, ok := s.lookup(key)
+	if !ok {
+		return fallback
+	}
+	valueDuration, err := time.ParseDuration(value)
+	if err != nil {
+		s.problems = append(s.problems, fmt.Sprintf("%s must be a duration (e.g. 30s), was %q", source, value))
+		return fallback
+	}
+	return valueDuration
+}
+
+// list reads a comma separated list
+func (s *settings) list(key string, fallback []string) []string {
+	value, _, ok := s.lookup(key)
+	if !ok {
+		return fallback
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// mapping reads a comma separated list of name=value pairs
+func (s *settings) mapping(key string) map[string]string {
+	mapping := map[string]string{}
+	for _, item := range s.list(key, nil) {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			s.problems = append(s.problems, fmt.Sprintf("%s must be a list of name=value, was %q", key, item))
+			continue
+		}
+		mapping[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return mapping
+}
+
+// secret reads a secret from the variable itself or from the file named by its _FILE variant.
+// The development default is only used in development mode.
+func (s *settings) secret(key string, devMode bool, devDefault string) string {
+	value := s.string(key, "")
+	path, source, ok := s.lookup(key + "_FILE")
+	if ok {
+		if value != "" {
+			s.problems = append(s.problems, fmt.Sprintf("only one of %s and %s may be set", key, key+"_FILE"))
+			return value
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			s.problems = append(s.problems, fmt.Sprintf("%s could not be read: %s", source, err))
+			return ""
+		}
+		value = strings.TrimRight(string(content), "\r\n")
+	}
+	if value == "" && devMode {
+		return devDefault
+	}
+	return value
+}
+
+// unknownFileKeys reports config file keys that no setting was read from, typically misspellings
+func (s *settings) unknownFileKeys() []string {
+	var problems []string
+	for key := range s.file {
+		if !s.used[key] {
+			problems = append(problems, fmt.Sprintf("unknown setting %s in config file", key))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
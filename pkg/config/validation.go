@@ -0,0 +1,183 @@
+package config
+
+import (
+	"fmt"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/inventory"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"github.com/skatteetaten/fiona/pkg/server"
+	"github.com/skatteetaten/fiona/pkg/tracing"
+	"github.com/skatteetaten/fiona/pkg/vault"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var hostnamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+// ValidationError holds every problem found in the configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks the configuration and returns a description of each problem found
+func Validate(config *Config) []string {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	s3Config := &config.S3Config
+	problems = append(problems, validateEndpoint(s3Config, "FIONA_S3_HOST", "FIONA_S3_PORT", "FIONA_S3_REGION")...)
+	if strings.TrimSpace(s3Config.DefaultBucket) == "" {
+		problem("FIONA_DEFAULTBUCKET must not be empty")
+	}
+	if s3Config.TLS.MinVersion != "1.2" && s3Config.TLS.MinVersion != "1.3" {
+		problem("FIONA_S3_TLS_MIN_VERSION must be 1.2 or 1.3, was %q", s3Config.TLS.MinVersion)
+	}
+	if (s3Config.TLS.ClientCertFile == "") != (s3Config.TLS.ClientKeyFile == "") {
+		problem("FIONA_S3_TLS_CLIENT_CERT_FILE and FIONA_S3_TLS_CLIENT_KEY_FILE must be set together")
+	}
+
+	problems = append(problems, validateSTS(&s3Config.STS)...)
+	for name, arn := range s3Config.NotificationTargets {
+		if !strings.HasPrefix(arn, "arn:minio:sqs:") {
+			problem("FIONA_NOTIFICATION_TARGETS must map %s to the ARN of a minio notification target, was %q", name, arn)
+		}
+	}
+	if err := s3.ValidateSeedTemplatePrefix(s3Config.SeedTemplatePrefix); err != nil {
+		problem("FIONA_SEED_TEMPLATE_PREFIX is invalid: %s", err)
+	}
+	if s3Config.Quota.ScanInterval < time.Minute {
+		problem("FIONA_QUOTA_SCAN_INTERVAL must be at least 1m, was %s", s3Config.Quota.ScanInterval)
+	}
+	if s3Config.Jobs.Workers < 1 {
+		problem("FIONA_JOBS_WORKERS must be at least 1, was %d", s3Config.Jobs.Workers)
+	}
+	if s3Config.Jobs.Retention < time.Hour {
+		problem("FIONA_JOBS_RETENTION must be at least 1h, was %s", s3Config.Jobs.Retention)
+	}
+
+	if !config.DevMode {
+		problems = append(problems, validateSecret(FionaAccessKey, s3Config.AccessKey, devAccessKey)...)
+		problems = append(problems, validateSecret(FionaSecretKey, s3Config.SecretKey, devSecretKey)...)
+		if !s3Config.RandomUserpass {
+			problems = append(problems, validateSecret(FionaDefaultPassword, s3Config.DefaultUserpass, devDefaultUserpass)...)
+		}
+	}
+
+	if info, err := os.Stat(config.AuroraTokenLocation); err != nil || info.IsDir() {
+		problem("FIONA_AURORATOKENLOCATION must point to a token file, %q was not found", config.AuroraTokenLocation)
+	}
+
+	serverConfig := &config.ServerConfig
+	if (serverConfig.TLSCertFile == "") != (serverConfig.TLSKeyFile == "") {
+		problem("FIONA_TLS_CERT_FILE and FIONA_TLS_KEY_FILE must be set together")
+	}
+	if serverConfig.TLSClientCAFile != "" && !serverConfig.TLSEnabled() {
+		problem("FIONA_TLS_CLIENT_CA_FILE requires FIONA_TLS_CERT_FILE and FIONA_TLS_KEY_FILE")
+	}
+	if serverConfig.ReadTimeout < 0 || serverConfig.WriteTimeout < 0 || serverConfig.IdleTimeout < 0 || serverConfig.ShutdownTimeout < 0 {
+		problem("FIONA_READ_TIMEOUT, FIONA_WRITE_TIMEOUT, FIONA_IDLE_TIMEOUT and FIONA_SHUTDOWN_TIMEOUT must not be negative")
+	}
+	if serverConfig.MaxHeaderBytes <= 0 {
+		problem("FIONA_MAX_HEADER_BYTES must be positive, was %d", serverConfig.MaxHeaderBytes)
+	}
+	if _, err := server.ParseTrustedProxies(serverConfig.TrustedProxies); err != nil {
+		problem("FIONA_TRUSTED_PROXIES is invalid: %s", err)
+	}
+
+	switch config.AuditConfig.Sink {
+	case audit.SinkNone, audit.SinkStdout:
+	case audit.SinkFile:
+		if config.AuditConfig.FilePath == "" {
+			problem("FIONA_AUDIT_FILE must be set when FIONA_AUDIT_SINK is file")
+		}
+	case audit.SinkWebhook:
+		if config.AuditConfig.WebhookURL == "" {
+			problem("FIONA_AUDIT_WEBHOOK_URL must be set when FIONA_AUDIT_SINK is webhook")
+		}
+	default:
+		problem("FIONA_AUDIT_SINK must be none, stdout, file or webhook, was %q", config.AuditConfig.Sink)
+	}
+
+	switch config.TracingConfig.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		problem("FIONA_TRACING_EXPORTER must be none, stdout or otlp, was %q", config.TracingConfig.Exporter)
+	}
+
+	if config.KubernetesConfig.Enabled && config.KubernetesConfig.APIURL == "" {
+		problem("FIONA_KUBERNETES_API_URL must be set when Fiona is not running in a pod")
+	}
+	if config.KubernetesConfig.Enabled && len(config.KubernetesConfig.Namespaces) == 0 {
+		problem("FIONA_KUBERNETES_NAMESPACES must list the namespaces secrets may be written to")
+	}
+
+	if vaultConfig := &config.VaultConfig; vaultConfig.Enabled() {
+		if err := vault.ValidatePathTemplate(vaultConfig.PathTemplate); err != nil {
+			problem("FIONA_VAULT_PATH_TEMPLATE is invalid: %s", err)
+		}
+		if vaultConfig.Token == "" && (vaultConfig.RoleID == "" || vaultConfig.SecretID == "") {
+			problem("FIONA_VAULT_TOKEN, or FIONA_VAULT_ROLE_ID and FIONA_VAULT_SECRET_ID, must be set when FIONA_VAULT_ADDR is set")
+		}
+	}
+
+	if store := config.InventoryConfig.Store; store != inventory.StoreBolt && store != inventory.StoreJSON {
+		problem("FIONA_INVENTORY_STORE must be %s or %s, was %q", inventory.StoreBolt, inventory.StoreJSON, store)
+	}
+
+	if config.LogFormat != "text" && config.LogFormat != "json" {
+		problem("FIONA_LOG_FORMAT must be text or json, was %q", config.LogFormat)
+	}
+	return problems
+}
+
+// validateEndpoint checks the host, port and region of a minio cluster, naming them with the given keys
+func validateEndpoint(s3Config *s3.Config, hostKey, portKey, regionKey string) []string {
+	var problems []string
+	if net.ParseIP(s3Config.S3Host) == nil && !hostnamePattern.MatchString(s3Config.S3Host) {
+		problems = append(problems, fmt.Sprintf("%s must be a host name or IP address without scheme or port, was %q", hostKey, s3Config.S3Host))
+	}
+	if port, err := strconv.Atoi(s3Config.S3Port); err != nil || port < 1 || port > 65535 {
+		problems = append(problems, fmt.Sprintf("%s must be a port number, was %q", portKey, s3Config.S3Port))
+	}
+	if strings.TrimSpace(s3Config.S3Region) == "" {
+		problems = append(problems, fmt.Sprintf("%s must not be empty", regionKey))
+	}
+	return problems
+}
+
+// maxSTSTTL is the longest lifetime minio allows for AssumeRole credentials
+const maxSTSTTL = 12 * time.Hour
+
+func validateSTS(sts *s3.STSConfig) []string {
+	var problems []string
+	if sts.Enabled() && sts.SecretKey == "" {
+		problems = append(problems, fmt.Sprintf("%s must be set when FIONA_STS_ACCESS_KEY is set", FionaSTSSecretKey))
+	}
+	if sts.MaxTTL < s3.MinTTL || sts.MaxTTL > maxSTSTTL {
+		problems = append(problems, fmt.Sprintf("FIONA_STS_MAX_TTL must be between %s and %s, was %s", s3.MinTTL, maxSTSTTL, sts.MaxTTL))
+	}
+	if sts.DefaultTTL < s3.MinTTL || sts.DefaultTTL > sts.MaxTTL {
+		problems = append(problems, fmt.Sprintf("FIONA_STS_DEFAULT_TTL must be between %s and FIONA_STS_MAX_TTL, was %s", s3.MinTTL, sts.DefaultTTL))
+	}
+	return problems
+}
+
+func validateSecret(key, value, devDefault string) []string {
+	if value == "" {
+		return []string{fmt.Sprintf("%s or %s_FILE must be set (or enable %s for local development)", key, key, FionaDevMode)}
+	}
+	if value == devDefault {
+		return []string{fmt.Sprintf("%s must not be the well-known development default outside %s", key, FionaDevMode)}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"fmt"
+	"strings"
+)
+
+// Encryption schemes, reported to the caller with the encrypted value
+const (
+	SchemeAge           = "age"
+	SchemeRSAOAEPSHA256 = "rsa-oaep-sha256"
+)
+
+// minRSABits is the smallest RSA key accepted
+const minRSABits = 2048
+
+// Recipient encrypts values for the holder of a private key
+type Recipient interface {
+	// Scheme names the encryption scheme
+	Scheme() string
+	// Encrypt returns plaintext encrypted in a text form: ASCII armor for age, base64 for RSA-OAEP
+	Encrypt(plaintext []byte) (string, error)
+}
+
+// ParseRecipient parses an age public key (age1...) or an RSA public key in PEM
+func ParseRecipient(publicKey string) (Recipient, error) {
+	publicKey = strings.TrimSpace(publicKey)
+	if strings.HasPrefix(publicKey, "age1") {
+		recipient, err := age.ParseX25519Recipient(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid age public key: %v", err)
+		}
+		return &ageRecipient{recipient}, nil
+	}
+
+	block, _ := pem.Decode([]byte(publicKey))
+	if block == nil {
+		return nil, errors.New("public key must be an age public key or an RSA public key in PEM")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q, expected PUBLIC KEY", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid RSA public key: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("only RSA keys are supported in PEM")
+	}
+	if rsaKey.N.BitLen() < minRSABits {
+		return nil, fmt.Errorf("RSA key must be at least %d bits", minRSABits)
+	}
+	return &rsaRecipient{rsaKey}, nil
+}
+
+type ageRecipient struct {
+	recipient *age.X25519Recipient
+}
+
+func (r *ageRecipient) Scheme() string {
+	return SchemeAge
+}
+
+func (r *ageRecipient) Encrypt(plaintext []byte) (string, error) {
+	out := &bytes.Buffer{}
+	armorWriter := armor.NewWriter(out)
+	writer, err := age.Encrypt(armorWriter, r.recipient)
+	if err != nil {
+		return "", err
+	}
+	if _, err := writer.Write(plaintext); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	if err := armorWriter.Close(); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+type rsaRecipient struct {
+	key *rsa.PublicKey
+}
+
+func (r *rsaRecipient) Scheme() string {
+	return SchemeRSAOAEPSHA256
+}
+
+func (r *rsaRecipient) Encrypt(plaintext []byte) (string, error) {
+	ciphertext, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, r.key, plaintext, nil)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
@@ -0,0 +1,61 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestEncryption(t *testing.T) {
+	t.Run("Should encrypt for an age recipient", func(t *testing.T) {
+		identity, _ := age.GenerateX25519Identity()
+
+		recipient, err := ParseRecipient(identity.Recipient().String())
+		assert.Nil(t, err)
+		encrypted, err := recipient.Encrypt([]byte("s3cret"))
+		assert.Nil(t, err)
+
+		assert.Equal(t, SchemeAge, recipient.Scheme())
+		assert.True(t, strings.HasPrefix(encrypted, "-----BEGIN AGE ENCRYPTED FILE-----"))
+		reader, err := age.Decrypt(armor.NewReader(strings.NewReader(encrypted)), identity)
+		assert.Nil(t, err)
+		decrypted, _ := ioutil.ReadAll(reader)
+		assert.Equal(t, "s3cret", string(decrypted))
+	})
+
+	t.Run("Should encrypt for an RSA public key with OAEP", func(t *testing.T) {
+		privateKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+		publicKeyDER, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+		publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})
+
+		recipient, err := ParseRecipient(string(publicKeyPEM))
+		assert.Nil(t, err)
+		encrypted, err := recipient.Encrypt([]byte("s3cret"))
+		assert.Nil(t, err)
+
+		assert.Equal(t, SchemeRSAOAEPSHA256, recipient.Scheme())
+		ciphertext, _ := base64.StdEncoding.DecodeString(encrypted)
+		decrypted, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, ciphertext, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "s3cret", string(decrypted))
+	})
+
+	t.Run("Should refuse weak and unknown keys", func(t *testing.T) {
+		weakKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+		weakKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&weakKey.PublicKey)})
+
+		for _, publicKey := range []string{string(weakKeyPEM), "ssh-rsa AAAA", "age1notakey", ""} {
+			_, err := ParseRecipient(publicKey)
+			assert.Error(t, err, publicKey)
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/auth"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"github.com/skatteetaten/fiona/pkg/server"
+	"net/http"
+)
+
+func newAuditEvent(r *http.Request, operation string) audit.Event {
+	event := audit.Event{
+		Operation: operation,
+		Cluster:   ClusterName(r),
+		RequestID: logging.RequestID(r.Context()),
+		SourceIP:  sourceIP(r),
+	}
+	if caller, ok := auth.CallerFromContext(r.Context()); ok {
+		event.Caller = caller.Name
+	}
+	return event
+}
+
+// ClusterName returns the minio cluster named in the route, or the default cluster for routes without one
+func ClusterName(r *http.Request) string {
+	if cluster, ok := mux.Vars(r)["cluster"]; ok {
+		return cluster
+	}
+	return s3.DefaultClusterName
+}
+
+// sourceIP is the client address resolved from trusted proxies, or the direct peer when it was not resolved
+func sourceIP(r *http.Request) string {
+	if sourceIP, ok := auth.SourceIPFromContext(r.Context()); ok {
+		return sourceIP
+	}
+	return server.ClientIP(r, nil)
+}
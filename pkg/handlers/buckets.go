@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v6"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"net/http"
+)
+
+// BucketResult describes a bucket and its settings
+type BucketResult struct {
+	Bucket string `json:"bucket"`
+	s3.BucketSettings
+}
+
+// BucketHandler creates or updates a bucket with settings on PUT, and reports the settings on GET
+type BucketHandler struct {
+	BucketManager         s3.BucketManager
+	BucketSettingsManager s3.BucketSettingsManager
+	Auditor               audit.Logger
+}
+
+// NewBucketHandler is a factory for BucketHandler
+func NewBucketHandler(config *s3.Config, minioClient *minio.Client, adminAPI *s3.AdminAPI, auditor audit.Logger) *BucketHandler {
+	return &BucketHandler{
+		BucketManager:         s3.NewMinioBucketManager(config, minioClient),
+		BucketSettingsManager: s3.NewMinioBucketSettingsManager(config, minioClient, adminAPI),
+		Auditor:               auditor,
+	}
+}
+
+// ServeHTTP handles the requests for BucketHandler
+func (buckethandler *BucketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket := mux.Vars(r)["bucketname"]
+	bucketExists, err := buckethandler.BucketManager.BucketNameExists(r.Context(), bucket)
+	if err != nil {
+		failLogAndResponse(w, r, "Could not verify existing bucket", http.StatusInternalServerError, err)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		if !bucketExists {
+			failLogAndResponse(w, r, "Bucket does not exist", http.StatusNotFound, fmt.Errorf("bucket %s", bucket))
+			return
+		}
+		buckethandler.writeSettings(w, r, http.StatusOK, bucket, nil)
+		return
+	}
+
+	auditEvent := newAuditEvent(r, audit.OperationUpdateBucket)
+	if !bucketExists {
+		auditEvent.Operation = audit.OperationCreateBucket
+	}
+	auditEvent.Bucket = bucket
+
+	var settings s3.BucketSettings
+	body, err := readRequestBody(r.Body)
+	if err != nil {
+		failLogAndResponse(w, r, "Could not read request body", http.StatusBadRequest, err)
+		buckethandler.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &settings); err != nil {
+			failLogAndResponse(w, r, "Could not unmarshal body", http.StatusUnprocessableEntity, err)
+			buckethandler.Auditor.Record(auditEvent.Failed(err))
+			return
+		}
+	}
+
+	status := http.StatusOK
+	if bucketExists {
+		err = buckethandler.BucketSettingsManager.UpdateBucket(r.Context(), bucket, &settings)
+	} else {
+		status = http.StatusCreated
+		err = buckethandler.BucketSettingsManager.CreateBucket(r.Context(), bucket, &settings)
+	}
+	if err != nil {
+		var invalidSettings *s3.InvalidBucketSettingsError
+		switch {
+		case errors.As(err, &invalidSettings):
+			failLogAndResponse(w, r, "Invalid bucket settings", http.StatusBadRequest, err)
+		case minio.ToErrorResponse(err).Code == "InvalidBucketName":
+			failLogAndResponse(w, r, "Invalid bucket name", http.StatusBadRequest, err)
+		default:
+			failLogAndResponse(w, r, "Error applying bucket settings", http.StatusInternalServerError, err)
+		}
+		buckethandler.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	buckethandler.Auditor.Record(auditEvent.Succeeded())
+
+	buckethandler.writeSettings(w, r, status, bucket, &settings)
+	logging.FromContext(r.Context()).Infof("%s: bucket %s", http.StatusText(status), bucket)
+}
+
+// writeSettings responds with the current settings of the bucket. When the settings were just applied, a failure to
+// read them back is only logged, and the applied settings are returned, so the caller does not retry a change that
+// succeeded.
+func (buckethandler *BucketHandler) writeSettings(w http.ResponseWriter, r *http.Request, status int, bucket string, applied *s3.BucketSettings) {
+	settings, err := buckethandler.BucketSettingsManager.GetBucketSettings(r.Context(), bucket)
+	if err != nil && applied != nil {
+		logging.FromContext(r.Context()).Warnf("Could not read back the settings applied to bucket %s, returning the applied settings: %s", bucket, err)
+		settings = applied
+	} else if err != nil {
+		failLogAndResponse(w, r, "Error reading bucket settings", http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, r, status, BucketResult{Bucket: bucket, BucketSettings: *settings})
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testBucketSettingsManager struct {
+	created  map[string]*s3.BucketSettings
+	updated  map[string]*s3.BucketSettings
+	settings s3.BucketSettings
+	getErr   error
+}
+
+func (tbsm *testBucketSettingsManager) CreateBucket(ctx context.Context, bucket string, settings *s3.BucketSettings) error {
+	if err := s3.ValidateBucketSettings(settings); err != nil {
+		return err
+	}
+	tbsm.created[bucket] = settings
+	return nil
+}
+
+func (tbsm *testBucketSettingsManager) UpdateBucket(ctx context.Context, bucket string, settings *s3.BucketSettings) error {
+	if err := s3.ValidateBucketSettings(settings); err != nil {
+		return err
+	}
+	tbsm.updated[bucket] = settings
+	return nil
+}
+
+func (tbsm *testBucketSettingsManager) GetBucketSettings(ctx context.Context, bucket string) (*s3.BucketSettings, error) {
+	if tbsm.getErr != nil {
+		return nil, tbsm.getErr
+	}
+	return &tbsm.settings, nil
+}
+
+func TestBucket(t *testing.T) {
+	quota, versioning, encryption := int64(1024), true, s3.EncryptionSSES3
+	newHandler := func() (*BucketHandler, *testBucketSettingsManager, *testAuditor) {
+		settingsManager := &testBucketSettingsManager{
+			created:  map[string]*s3.BucketSettings{},
+			updated:  map[string]*s3.BucketSettings{},
+			settings: s3.BucketSettings{QuotaBytes: &quota, Versioning: &versioning, ObjectLock: &s3.ObjectLockSettings{}, Encryption: &encryption},
+		}
+		auditor := &testAuditor{}
+		return &BucketHandler{BucketManager: testAppUserCreator{}, BucketSettingsManager: settingsManager, Auditor: auditor}, settingsManager, auditor
+	}
+	serve := func(handler http.Handler, method, bucket, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, "http://localhost:8080/buckets/"+bucket, strings.NewReader(body))
+		request = mux.SetURLVars(request, map[string]string{"bucketname": bucket})
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("Should create a missing bucket with settings", func(t *testing.T) {
+		handler, settingsManager, auditor := newHandler()
+
+		response := serve(handler, "PUT", "archive", `{"versioning":true, "objectLock":{"enabled":true, "mode":"COMPLIANCE", "validity":7, "unit":"YEARS"}}`)
+
+		assert.Equal(t, http.StatusCreated, response.Code)
+		assert.Equal(t, "COMPLIANCE", settingsManager.created["archive"].ObjectLock.Mode)
+		assert.Contains(t, response.Body.String(), `"bucket":"archive"`)
+		assert.Equal(t, audit.OperationCreateBucket, auditor.events[0].Operation)
+	})
+
+	t.Run("Should update an existing bucket", func(t *testing.T) {
+		handler, settingsManager, auditor := newHandler()
+
+		response := serve(handler, "PUT", validtestbucketname, `{"quotaBytes":1024}`)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, quota, *settingsManager.updated[validtestbucketname].QuotaBytes)
+		assert.Nil(t, settingsManager.updated[validtestbucketname].Versioning)
+		assert.Equal(t, audit.OperationUpdateBucket, auditor.events[0].Operation)
+		assert.Equal(t, audit.OutcomeSuccess, auditor.events[0].Outcome)
+	})
+
+	t.Run("Should return the applied settings when they can not be read back", func(t *testing.T) {
+		handler, settingsManager, auditor := newHandler()
+		settingsManager.getErr = errors.New("minio is down")
+
+		response := serve(handler, "PUT", validtestbucketname, `{"quotaBytes":2048}`)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.JSONEq(t, `{"bucket":"testbucketname","quotaBytes":2048}`, response.Body.String())
+		assert.Equal(t, audit.OutcomeSuccess, auditor.events[0].Outcome)
+		assert.Equal(t, http.StatusInternalServerError, serve(handler, "GET", validtestbucketname, "").Code)
+	})
+
+	t.Run("Should refuse invalid settings", func(t *testing.T) {
+		handler, _, auditor := newHandler()
+
+		response := serve(handler, "PUT", validtestbucketname, `{"encryption":"rot13"}`)
+
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Equal(t, audit.OutcomeFailure, auditor.events[0].Outcome)
+	})
+
+	t.Run("Should report the settings of a bucket", func(t *testing.T) {
+		handler, _, _ := newHandler()
+
+		response := serve(handler, "GET", validtestbucketname, "")
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.JSONEq(t, `{"bucket":"testbucketname","quotaBytes":1024,"versioning":true,"objectLock":{"enabled":false},"encryption":"AES256"}`, response.Body.String())
+		assert.Equal(t, http.StatusNotFound, serve(handler, "GET", "nosuchbucket", "").Code)
+	})
+}
@@ -7,88 +7,156 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/minio/minio-go/v6"
 	"github.com/minio/minio/pkg/madmin"
-	"github.com/sirupsen/logrus"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/logging"
 	"github.com/skatteetaten/fiona/pkg/s3"
 	"net/http"
 )
 
 // CreateAppUserHandler adds an application user for a specified path
 type CreateAppUserHandler struct {
-	BucketManager s3.BucketManager
-	UserManager   s3.UserManager
+	BucketManager    s3.BucketManager
+	UserManager      s3.UserManager
+	QuotaRegistry    s3.QuotaRegistry
+	LifecycleManager s3.LifecycleManager
+	PathInitializer  s3.PathInitializer
+	Auditor          audit.Logger
+	SecretSinks      SecretSinks
+	// SeedTemplatePrefix is the prefix seed prefixes must be below, empty disables seeding
+	SeedTemplatePrefix string
 }
 
 // NewCreateAppUserHandler is a factory for CreateUserHandler
-func NewCreateAppUserHandler(config *s3.Config, adminClient *madmin.AdminClient, minioClient *minio.Client) (*CreateAppUserHandler, error) {
+func NewCreateAppUserHandler(config *s3.Config, adminClient *madmin.AdminClient, minioClient *minio.Client, auditor audit.Logger, secretSinks SecretSinks) (*CreateAppUserHandler, error) {
 	bucketManager := s3.NewMinioBucketManager(config, minioClient)
 	userManager := s3.NewMinioUserManager(config, adminClient)
 	return &CreateAppUserHandler{
-		BucketManager: bucketManager,
-		UserManager:   userManager,
+		BucketManager:      bucketManager,
+		UserManager:        userManager,
+		QuotaRegistry:      s3.NewMinioQuotaRegistry(minioClient),
+		LifecycleManager:   s3.NewMinioLifecycleManager(minioClient),
+		PathInitializer:    s3.NewMinioPathInitializer(config, minioClient),
+		Auditor:            auditor,
+		SecretSinks:        secretSinks,
+		SeedTemplatePrefix: config.SeedTemplatePrefix,
 	}, nil
 }
 
 // ServeHTTP handles the requests for CreateAppUserHandler
 func (createappuser *CreateAppUserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
-	// Header based access info not needed at present
-	/*	minioAccess, err := readMinioAccessHeader(r.Header)
-		if err != nil {
-			failLogAndResponse(w, "Could not read access header", http.StatusBadRequest, err)
-			return
-		}
-		if minioAccess != nil {
-			adminClient, err = s3.NewAdmClientForExternalAccess(minioAccess)
-			if err != nil {
-				failLogAndResponse(w, fmt.Sprintf("Could create minio admin client for incoming %s", MinioAccess), http.StatusBadRequest, err)
-				return
-			}
-		}
-		userManager := s3.NewMinioUserManager(createappuser.S3Config, adminClient) */
+	auditEvent := newAuditEvent(r, audit.OperationCreateAppUser)
+	params := mux.Vars(r)
+	auditEvent.Bucket = params["bucketname"]
+	auditEvent.Path = params["path"]
 
-	createAppUserInput, doneWithError := getCreateAppUserInput(w, r)
+	createAppUserInput, doneWithError := getCreateAppUserInput(w, r, createappuser.SeedTemplatePrefix)
 	if doneWithError {
+		createappuser.Auditor.Record(auditEvent.Failed(errors.New("Invalid input")))
 		return
 	}
-	logrus.Debugf("createAppUserInput: %+v", *createAppUserInput)
+	logging.FromContext(r.Context()).Debugf("createAppUserInput: %+v", *createAppUserInput)
+	auditEvent.Bucket = createAppUserInput.Bucketname
+	auditEvent.Path = createAppUserInput.Path
+	auditEvent.Username = createAppUserInput.Username
+	auditEvent.Access = createAppUserInput.Access
 
-	bucketExists, err := createappuser.BucketManager.BucketNameExists(createAppUserInput.Bucketname)
+	if err := createappuser.SecretSinks.validate(createAppUserInput); err != nil {
+		failLogAndResponse(w, r, "Invalid secret delivery", http.StatusBadRequest, err)
+		createappuser.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	if err := createappuser.SecretSinks.check(r.Context(), createAppUserInput); err != nil {
+		failLogAndResponse(w, r, "Error creating user. The credentials can not be delivered", secretSinkStatus(err, http.StatusBadGateway), err)
+		createappuser.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+
+	bucketExists, err := createappuser.BucketManager.BucketNameExists(r.Context(), createAppUserInput.Bucketname)
 	if err != nil {
-		failLogAndResponse(w, "Error creating user. Could not verify existing bucket", http.StatusInternalServerError, err)
+		failLogAndResponse(w, r, "Error creating user. Could not verify existing bucket", http.StatusInternalServerError, err)
+		createappuser.Auditor.Record(auditEvent.Failed(err))
 		return
 	}
 	if !bucketExists {
-		failLogAndResponse(w, "Error creating user", http.StatusUnprocessableEntity, errors.New("Bucket does not exist"))
+		err = errors.New("Bucket does not exist")
+		failLogAndResponse(w, r, "Error creating user", http.StatusUnprocessableEntity, err)
+		createappuser.Auditor.Record(auditEvent.Failed(err))
 		return
 	}
 
-	createAppUserResult, err := createappuser.UserManager.CreateAppUser(createAppUserInput)
+	if createAppUserInput.QuotaBytes > 0 {
+		if err := createappuser.recordQuota(r, createAppUserInput); err != nil {
+			failLogAndResponse(w, r, "Error creating user. Could not record quota", http.StatusInternalServerError, err)
+			createappuser.Auditor.Record(auditEvent.Failed(err))
+			return
+		}
+	}
+
+	createAppUserResult, err := createappuser.UserManager.CreateAppUser(r.Context(), createAppUserInput)
 	if err != nil {
-		failLogAndResponse(w, fmt.Sprintf("Error creating user for input: %+v", *createAppUserInput), http.StatusInternalServerError, err)
+		failLogAndResponse(w, r, fmt.Sprintf("Error creating user for input: %+v", *createAppUserInput), http.StatusInternalServerError, err)
+		createappuser.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	auditEvent.PolicyName = createAppUserResult.PolicyName
+	auditEvent.Group = createAppUserResult.Group
+
+	// The path is only changed once the user is created, so a failed request leaves the path as it was
+	if createAppUserInput.Lifecycle != nil {
+		if err := createappuser.LifecycleManager.SetPathLifecycle(r.Context(), createAppUserInput.Bucketname, createAppUserInput.Path, createAppUserInput.Lifecycle); err != nil {
+			failLogAndResponse(w, r, "User created, but the lifecycle rules could not be set. Retry to generate new credentials", http.StatusInternalServerError, err)
+			createappuser.Auditor.Record(auditEvent.Failed(err))
+			return
+		}
+	}
+
+	if createAppUserInput.InitializePath || createAppUserInput.SeedPrefix != "" {
+		createAppUserResult.SeededObjects, err = createappuser.PathInitializer.InitializePath(r.Context(), createAppUserInput.Bucketname, createAppUserInput.Path, createAppUserInput.SeedPrefix)
+		if err != nil {
+			failLogAndResponse(w, r, "User created, but the path could not be initialized. Retry to generate new credentials", http.StatusInternalServerError, err)
+			createappuser.Auditor.Record(auditEvent.Failed(err))
+			return
+		}
+	}
+
+	auditEvent.SecretSink, err = createappuser.SecretSinks.deliver(r.Context(), ClusterName(r), createAppUserInput, createAppUserResult)
+	if err != nil {
+		failLogAndResponse(w, r, "User created, but the credentials could not be delivered. Retry to generate new credentials", secretSinkStatus(err, http.StatusBadGateway), err)
+		createappuser.Auditor.Record(auditEvent.Failed(err))
 		return
 	}
 	responseJSON, err := json.Marshal(createAppUserResult)
 	if err != nil {
-		failLogAndResponse(w, "Failed marshalling result for return, aborted", http.StatusInternalServerError, err)
+		failLogAndResponse(w, r, "Failed marshalling result for return, aborted", http.StatusInternalServerError, err)
+		createappuser.Auditor.Record(auditEvent.Failed(err))
 		return
 	}
+	createappuser.Auditor.Record(auditEvent.Succeeded())
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusCreated)
 	_, _ = fmt.Fprintf(w, "%s", responseJSON)
-	logrus.Infof("StatusCreated: createuser %s", createAppUserInput.Username)
+	logging.FromContext(r.Context()).Infof("StatusCreated: createuser %s", createAppUserInput.Username)
+}
+
+// recordQuota records the quota for the path before any user is created, keeping the users disabled for exceeding it
+func (createappuser *CreateAppUserHandler) recordQuota(r *http.Request, createAppUserInput *s3.CreateAppUserInput) error {
+	return createappuser.QuotaRegistry.UpdateQuota(r.Context(), createAppUserInput.Bucketname, createAppUserInput.Path, func(quota *s3.PathQuota) {
+		quota.Bytes = createAppUserInput.QuotaBytes
+	})
 }
 
-func getCreateAppUserInput(w http.ResponseWriter, r *http.Request) (*s3.CreateAppUserInput, bool) {
+func getCreateAppUserInput(w http.ResponseWriter, r *http.Request, seedTemplatePrefix string) (*s3.CreateAppUserInput, bool) {
 	params := mux.Vars(r)
 	var createAppUserInput s3.CreateAppUserInput
 	body, err := readRequestBody(r.Body)
 	if err != nil {
-		failLogAndResponse(w, "Could not read request body", http.StatusBadRequest, err)
+		failLogAndResponse(w, r, "Could not read request body", http.StatusBadRequest, err)
 		return nil, true
 	}
 	if err := json.Unmarshal(body, &createAppUserInput); err != nil {
-		failLogAndResponse(w, "Could not unmarshal body", http.StatusUnprocessableEntity, err)
+		failLogAndResponse(w, r, "Could not unmarshal body", http.StatusUnprocessableEntity, err)
 		return nil, true
 	}
 	if bucketname, ok := params["bucketname"]; ok {
@@ -100,8 +168,18 @@ func getCreateAppUserInput(w http.ResponseWriter, r *http.Request) (*s3.CreateAp
 	if username, ok := params["username"]; ok {
 		createAppUserInput.Username = username
 	}
-	if createAppUserInput.Path == "" || createAppUserInput.Username == "" || createAppUserInput.Bucketname == "" || len(createAppUserInput.Access) <= 0 {
-		failLogAndResponse(w, "Missing required input to create user.", http.StatusBadRequest, err)
+	if createAppUserInput.Path == "" || createAppUserInput.Username == "" || createAppUserInput.Bucketname == "" || len(createAppUserInput.Access) <= 0 || createAppUserInput.QuotaBytes < 0 {
+		failLogAndResponse(w, r, "Missing required input to create user.", http.StatusBadRequest, err)
+		return nil, true
+	}
+	if createAppUserInput.Lifecycle != nil {
+		if err := s3.ValidatePathLifecycle(createAppUserInput.Lifecycle); err != nil {
+			failLogAndResponse(w, r, "Invalid lifecycle rules", http.StatusBadRequest, err)
+			return nil, true
+		}
+	}
+	if err := s3.ValidateSeedPrefix(seedTemplatePrefix, createAppUserInput.SeedPrefix); err != nil {
+		failLogAndResponse(w, r, "Invalid seed prefix", http.StatusBadRequest, err)
 		return nil, true
 	}
 	return &createAppUserInput, false
@@ -1,11 +1,23 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/kubernetes"
+	"github.com/skatteetaten/fiona/pkg/logging"
 	"github.com/skatteetaten/fiona/pkg/s3"
+	"github.com/skatteetaten/fiona/pkg/vault"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -17,21 +29,22 @@ const validtestbucketname = "testbucketname"
 type testAppUserCreator struct {
 }
 
-func (tuc testAppUserCreator) CreateAppUser(createAppUserInput *s3.CreateAppUserInput) (*s3.CreateAppUserResult, error) {
+func (tuc testAppUserCreator) CreateAppUser(ctx context.Context, createAppUserInput *s3.CreateAppUserInput) (*s3.CreateAppUserResult, error) {
 	mockCreateAppUserResult := s3.CreateAppUserResult{
-		AccessKey: "testuser",
-		SecretKey: "S3userpass",
-		HostURL:   "http://localhost:9000",
+		AccessKey:  "testuser",
+		SecretKey:  "S3userpass",
+		HostURL:    "http://localhost:9000",
+		PolicyName: "testbucketnametestpath_testuser_RWD",
 	}
 	return &mockCreateAppUserResult, nil
 }
-func (tuc testAppUserCreator) CreateUser(userName string, path string) (*s3.CreateUserResult, error) {
+func (tuc testAppUserCreator) CreateUser(ctx context.Context, userName string, path string) (*s3.CreateUserResult, error) {
 	return nil, nil
 }
-func (tuc testAppUserCreator) BucketNameExists(bucketName string) (bool, error) {
+func (tuc testAppUserCreator) BucketNameExists(ctx context.Context, bucketName string) (bool, error) {
 	return (bucketName == validtestbucketname), nil
 }
-func (tuc testAppUserCreator) MakeSureBucketExists() error {
+func (tuc testAppUserCreator) MakeSureBucketExists(ctx context.Context) error {
 	return nil
 }
 
@@ -39,7 +52,7 @@ func TestCreateAppUser(t *testing.T) {
 	t.Run("Should create new CreateAppUserHandler", func(t *testing.T) {
 		dummyAdmClient, _ := s3.NewAdmClient(&getTestAppConfig().S3Config)
 		dummyClient, _ := s3.NewClient(&getTestAppConfig().S3Config)
-		createAppUserHandler, err := NewCreateAppUserHandler(&getTestAppConfig().S3Config, dummyAdmClient, dummyClient)
+		createAppUserHandler, err := NewCreateAppUserHandler(&getTestAppConfig().S3Config, dummyAdmClient, dummyClient, &testAuditor{}, SecretSinks{})
 		assert.Nil(t, err)
 		assert.NotNil(t, createAppUserHandler)
 	})
@@ -59,6 +72,32 @@ func TestCreateAppUser(t *testing.T) {
 		assert.Contains(t, response.Body.String(), getTestAppConfig().S3Config.DefaultUserpass)
 	})
 
+	t.Run("Should record audit event without secret when user is created", func(t *testing.T) {
+		reader := strings.NewReader("{\"username\":\"testuser\", \"access\":[\"READ\", \"WRITE\", \"DELETE\"]}")
+		request, _ := http.NewRequest("POST", "http://localhost:8080/buckets/testbucketname/paths/testpath/userprofiles/", reader)
+		request = mux.SetURLVars(request, map[string]string{"bucketname": validtestbucketname, "path": "testpath"})
+		request.RemoteAddr = "10.0.0.1:41234"
+		request.Header.Set("X-Forwarded-For", "192.0.2.1")
+		response := httptest.NewRecorder()
+		auditor := &testAuditor{}
+		createAppUserHandler := createTestAppUserHandler(testAppUserCreator{})
+		createAppUserHandler.Auditor = auditor
+
+		createAppUserHandler.ServeHTTP(response, request)
+
+		assert.Equal(t, 1, len(auditor.events))
+		event := auditor.events[0]
+		assert.Equal(t, audit.OperationCreateAppUser, event.Operation)
+		assert.Equal(t, audit.OutcomeSuccess, event.Outcome)
+		assert.Equal(t, "10.0.0.1", event.SourceIP)
+		assert.Equal(t, validtestbucketname, event.Bucket)
+		assert.Equal(t, "testpath", event.Path)
+		assert.Equal(t, "testuser", event.Username)
+		assert.Equal(t, []string{"READ", "WRITE", "DELETE"}, event.Access)
+		assert.Equal(t, "testbucketnametestpath_testuser_RWD", event.PolicyName)
+		assert.NotContains(t, fmt.Sprintf("%+v", event), "S3userpass")
+	})
+
 	t.Run("Should fail to create user when body is not valid JSON", func(t *testing.T) {
 		reader := strings.NewReader("{\"Not valid JSON\"}")
 		request, _ := http.NewRequest("POST", "http://localhost:8080/buckets/testbucketname/paths/testpath/userprofiles/", reader)
@@ -96,15 +135,310 @@ func TestCreateAppUser(t *testing.T) {
 		assert.Equal(t, logrus.ErrorLevel, hook.LastEntry().Level)
 		assert.Contains(t, hook.LastEntry().Message, "Bucket does not exist")
 		assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+		assert.Equal(t, audit.OutcomeFailure, createUserHandler.Auditor.(*testAuditor).events[0].Outcome)
 
 		hook.Reset()
 		assert.Nil(t, hook.LastEntry())
 	})
 }
 
+type testSecretWriter struct {
+	secrets  map[string]map[string]string
+	checkErr error
+	err      error
+}
+
+func (tsw *testSecretWriter) CheckSecret(ctx context.Context, ref kubernetes.SecretReference) error {
+	return tsw.checkErr
+}
+
+func (tsw *testSecretWriter) WriteSecret(ctx context.Context, ref kubernetes.SecretReference, data map[string]string) error {
+	if tsw.err != nil {
+		return tsw.err
+	}
+	tsw.secrets[ref.String()] = data
+	return nil
+}
+
+func TestCreateAppUserWithKubernetesSecret(t *testing.T) {
+	createAppUser := func(handler CreateAppUserHandler, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("POST", "http://localhost:8080/buckets/testbucketname/paths/testpath/userpolicies/", strings.NewReader(body))
+		request = mux.SetURLVars(request, map[string]string{"bucketname": validtestbucketname, "path": "testpath"})
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+	body := `{"username":"testuser", "access":["READ"], "kubernetesSecret":{"namespace":"appx","name":"s3-credentials"}}`
+
+	t.Run("Should write credentials to the secret and leave out the secret key", func(t *testing.T) {
+		secretWriter := &testSecretWriter{secrets: map[string]map[string]string{}}
+		handler := createTestAppUserHandler(testAppUserCreator{})
+		handler.SecretSinks.Kubernetes = secretWriter
+
+		response := createAppUser(handler, body)
+
+		assert.Equal(t, http.StatusCreated, response.Code)
+		assert.NotContains(t, response.Body.String(), "S3userpass")
+		assert.NotContains(t, response.Body.String(), "secretKey")
+		assert.Contains(t, response.Body.String(), `"kubernetesSecret":{"namespace":"appx","name":"s3-credentials"}`)
+		secret := secretWriter.secrets["appx/s3-credentials"]
+		assert.Equal(t, "testuser", secret["accessKey"])
+		assert.Equal(t, "S3userpass", secret["secretKey"])
+		assert.Equal(t, "http://localhost:9000", secret["host"])
+		assert.Equal(t, validtestbucketname, secret["bucket"])
+		assert.Equal(t, "testpath", secret["path"])
+		assert.Equal(t, "kubernetes:appx/s3-credentials", handler.Auditor.(*testAuditor).events[0].SecretSink)
+	})
+
+	t.Run("Should refuse when Kubernetes delivery is not enabled", func(t *testing.T) {
+		response := createAppUser(createTestAppUserHandler(testAppUserCreator{}), body)
+
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+
+	t.Run("Should refuse invalid secret names", func(t *testing.T) {
+		handler := createTestAppUserHandler(testAppUserCreator{})
+		handler.SecretSinks.Kubernetes = &testSecretWriter{secrets: map[string]map[string]string{}}
+
+		response := createAppUser(handler, `{"username":"testuser", "access":["READ"], "kubernetesSecret":{"namespace":"Appx","name":"s3"}}`)
+
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+
+	t.Run("Should refuse secrets not managed by Fiona before creating the user", func(t *testing.T) {
+		handler := createTestAppUserHandler(testAppUserCreator{})
+		handler.SecretSinks.Kubernetes = &testSecretWriter{checkErr: fmt.Errorf("%w: appx/s3-credentials", kubernetes.ErrSecretNotManaged)}
+
+		response := createAppUser(handler, body)
+
+		assert.Equal(t, http.StatusConflict, response.Code)
+		assert.NotContains(t, response.Body.String(), "S3userpass")
+		assert.Empty(t, handler.Auditor.(*testAuditor).events[0].PolicyName)
+	})
+
+	t.Run("Should forbid namespaces that are not allowed", func(t *testing.T) {
+		handler := createTestAppUserHandler(testAppUserCreator{})
+		handler.SecretSinks.Kubernetes = &testSecretWriter{checkErr: fmt.Errorf("%w: appx", kubernetes.ErrNamespaceNotAllowed)}
+
+		response := createAppUser(handler, body)
+
+		assert.Equal(t, http.StatusForbidden, response.Code)
+	})
+
+	t.Run("Should fail without secret key when the secret cannot be written", func(t *testing.T) {
+		handler := createTestAppUserHandler(testAppUserCreator{})
+		handler.SecretSinks.Kubernetes = &testSecretWriter{err: errors.New("secrets is forbidden")}
+
+		response := createAppUser(handler, body)
+
+		assert.Equal(t, http.StatusBadGateway, response.Code)
+		assert.NotContains(t, response.Body.String(), "S3userpass")
+		assert.Equal(t, audit.OutcomeFailure, handler.Auditor.(*testAuditor).events[0].Outcome)
+	})
+}
+
+func TestCreateAppUserPathSettings(t *testing.T) {
+	createAppUser := func(handler CreateAppUserHandler, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("POST", "http://localhost:8080/buckets/testbucketname/paths/testpath/userpolicies/", strings.NewReader(body))
+		request = mux.SetURLVars(request, map[string]string{"bucketname": validtestbucketname, "path": "testpath"})
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("Should record the quota and keep users disabled for exceeding it", func(t *testing.T) {
+		registry := &testQuotaRegistry{quotas: map[string]*s3.PathQuota{
+			validtestbucketname + "/testpath": {Bucket: validtestbucketname, Path: "testpath", Bytes: 10, DisabledUsers: []string{"olduser"}},
+		}}
+		handler := createTestAppUserHandler(testAppUserCreator{})
+		handler.QuotaRegistry = registry
+
+		response := createAppUser(handler, `{"username":"testuser", "access":["READ"], "quotaBytes":1073741824}`)
+
+		assert.Equal(t, http.StatusCreated, response.Code)
+		quota := registry.quotas[validtestbucketname+"/testpath"]
+		assert.Equal(t, int64(1073741824), quota.Bytes)
+		assert.Equal(t, []string{"olduser"}, quota.DisabledUsers)
+	})
+
+	t.Run("Should set lifecycle rules for the path", func(t *testing.T) {
+		lifecycleManager := &testLifecycleManager{lifecycles: map[string]*s3.PathLifecycle{}}
+		handler := createTestAppUserHandler(testAppUserCreator{})
+		handler.LifecycleManager = lifecycleManager
+
+		response := createAppUser(handler, `{"username":"testuser", "access":["READ"], "lifecycle":{"expireAfterDays":30}}`)
+
+		assert.Equal(t, http.StatusCreated, response.Code)
+		assert.Equal(t, &s3.PathLifecycle{ExpireAfterDays: 30}, lifecycleManager.lifecycles[validtestbucketname+"/testpath"])
+		assert.Equal(t, http.StatusBadRequest, createAppUser(handler, `{"username":"testuser", "access":["READ"], "lifecycle":{"expireAfterDays":-30}}`).Code)
+	})
+
+	t.Run("Should initialize the path with seed objects", func(t *testing.T) {
+		pathInitializer := &testPathInitializer{}
+		handler := createTestAppUserHandler(testAppUserCreator{})
+		handler.PathInitializer = pathInitializer
+		handler.SeedTemplatePrefix = ".fiona/templates/"
+
+		response := createAppUser(handler, `{"username":"testuser", "access":["READ"], "seedPrefix":".fiona/templates/app"}`)
+
+		assert.Equal(t, http.StatusCreated, response.Code)
+		assert.Contains(t, response.Body.String(), `"seededObjects":2`)
+		assert.Equal(t, []string{validtestbucketname + "/testpath<-.fiona/templates/app"}, pathInitializer.paths)
+		assert.Equal(t, http.StatusCreated, createAppUser(handler, `{"username":"testuser", "access":["READ"], "initializePath":true}`).Code)
+		assert.Equal(t, validtestbucketname+"/testpath<-", pathInitializer.paths[1])
+		assert.Equal(t, http.StatusCreated, createAppUser(handler, `{"username":"testuser", "access":["READ"]}`).Code)
+		assert.Len(t, pathInitializer.paths, 2)
+		assert.Equal(t, http.StatusBadRequest, createAppUser(handler, `{"username":"testuser", "access":["READ"], "seedPrefix":"otherpath/secrets"}`).Code)
+		assert.Len(t, pathInitializer.paths, 2)
+	})
+
+	t.Run("Should leave the path unchanged when the user cannot be created", func(t *testing.T) {
+		lifecycleManager := &testLifecycleManager{lifecycles: map[string]*s3.PathLifecycle{}}
+		pathInitializer := &testPathInitializer{}
+		handler := createTestAppUserHandler(testAppUserCreator{})
+		handler.UserManager = failingAppUserCreator{}
+		handler.LifecycleManager = lifecycleManager
+		handler.PathInitializer = pathInitializer
+
+		response := createAppUser(handler, `{"username":"testuser", "access":["READ"], "lifecycle":{"expireAfterDays":30}, "initializePath":true}`)
+
+		assert.Equal(t, http.StatusInternalServerError, response.Code)
+		assert.Empty(t, lifecycleManager.lifecycles)
+		assert.Empty(t, pathInitializer.paths)
+	})
+
+	t.Run("Should refuse seed prefixes when seeding is disabled", func(t *testing.T) {
+		pathInitializer := &testPathInitializer{}
+		handler := createTestAppUserHandler(testAppUserCreator{})
+		handler.PathInitializer = pathInitializer
+
+		response := createAppUser(handler, `{"username":"testuser", "access":["READ"], "seedPrefix":".fiona/templates/app"}`)
+
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Empty(t, pathInitializer.paths)
+	})
+
+	t.Run("Should refuse negative quotas", func(t *testing.T) {
+		response := createAppUser(createTestAppUserHandler(testAppUserCreator{}), `{"username":"testuser", "access":["READ"], "quotaBytes":-1}`)
+
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+}
+
+type failingAppUserCreator struct {
+	testAppUserCreator
+}
+
+func (fuc failingAppUserCreator) CreateAppUser(ctx context.Context, createAppUserInput *s3.CreateAppUserInput) (*s3.CreateAppUserResult, error) {
+	return nil, errors.New("minio is unavailable")
+}
+
+type testPathInitializer struct {
+	paths []string
+}
+
+func (tpi *testPathInitializer) InitializePath(ctx context.Context, bucket, path, seedPrefix string) (int, error) {
+	tpi.paths = append(tpi.paths, bucket+"/"+path+"<-"+seedPrefix)
+	if seedPrefix == "" {
+		return 0, nil
+	}
+	return 2, nil
+}
+
+type testVaultWriter struct {
+	params vault.PathParams
+	data   map[string]string
+}
+
+func (tvw *testVaultWriter) WriteSecret(ctx context.Context, params vault.PathParams, data map[string]string) (string, error) {
+	tvw.params, tvw.data = params, data
+	return "secret/s3/" + params.Bucket + "/" + params.Path + "/" + params.Username, nil
+}
+
+func TestCreateAppUserWithVault(t *testing.T) {
+	t.Run("Should write credentials to Vault and return only the path", func(t *testing.T) {
+		reader := strings.NewReader(`{"username":"testuser", "access":["READ"], "vault":true}`)
+		request, _ := http.NewRequest("POST", "http://localhost:8080/buckets/testbucketname/paths/testpath/userpolicies/", reader)
+		request = mux.SetURLVars(request, map[string]string{"bucketname": validtestbucketname, "path": "testpath"})
+		response := httptest.NewRecorder()
+		vaultWriter := &testVaultWriter{}
+		handler := createTestAppUserHandler(testAppUserCreator{})
+		handler.SecretSinks.Vault = vaultWriter
+
+		handler.ServeHTTP(response, request)
+
+		assert.Equal(t, http.StatusCreated, response.Code)
+		assert.JSONEq(t, `{"vaultPath":"secret/s3/testbucketname/testpath/testuser"}`, response.Body.String())
+		assert.Equal(t, "S3userpass", vaultWriter.data["secretKey"])
+		assert.Equal(t, "default", vaultWriter.params.Cluster)
+		assert.Equal(t, "vault:secret/s3/testbucketname/testpath/testuser", handler.Auditor.(*testAuditor).events[0].SecretSink)
+	})
+
+	t.Run("Should refuse both Vault and Kubernetes delivery", func(t *testing.T) {
+		reader := strings.NewReader(`{"username":"testuser", "access":["READ"], "vault":true, "kubernetesSecret":{"namespace":"appx","name":"s3"}}`)
+		request, _ := http.NewRequest("POST", "http://localhost:8080/buckets/testbucketname/paths/testpath/userpolicies/", reader)
+		request = mux.SetURLVars(request, map[string]string{"bucketname": validtestbucketname, "path": "testpath"})
+		response := httptest.NewRecorder()
+		handler := createTestAppUserHandler(testAppUserCreator{})
+		handler.SecretSinks = SecretSinks{Vault: &testVaultWriter{}, Kubernetes: &testSecretWriter{}}
+
+		handler.ServeHTTP(response, request)
+
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+}
+
+func TestCreateAppUserWithPublicKey(t *testing.T) {
+	createAppUser := func(publicKey string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{"username": "testuser", "access": []string{"READ"}, "publicKey": publicKey})
+		request, _ := http.NewRequest("POST", "http://localhost:8080/buckets/testbucketname/paths/testpath/userpolicies/", bytes.NewReader(body))
+		request = mux.SetURLVars(request, map[string]string{"bucketname": validtestbucketname, "path": "testpath"})
+		response := httptest.NewRecorder()
+		handler := createTestAppUserHandler(testAppUserCreator{})
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("Should return the secret key encrypted", func(t *testing.T) {
+		identity, _ := age.GenerateX25519Identity()
+
+		response := createAppUser(identity.Recipient().String())
+
+		assert.Equal(t, http.StatusCreated, response.Code)
+		assert.NotContains(t, response.Body.String(), "S3userpass")
+		var result s3.CreateAppUserResult
+		assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &result))
+		assert.Equal(t, "age", result.SecretKeyScheme)
+		reader, err := age.Decrypt(armor.NewReader(strings.NewReader(result.SecretKey)), identity)
+		assert.Nil(t, err)
+		secretKey, _ := ioutil.ReadAll(reader)
+		assert.Equal(t, "S3userpass", string(secretKey))
+	})
+
+	t.Run("Should refuse an invalid public key before creating the user", func(t *testing.T) {
+		response := createAppUser("ssh-ed25519 AAAA")
+
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+}
+
+func TestFailResponse(t *testing.T) {
+	t.Run("Should return request id in error body", func(t *testing.T) {
+		request, _ := http.NewRequest("POST", "http://localhost:8080/buckets/testbucketname/paths/testpath/userprofiles/", strings.NewReader("{}"))
+		request = request.WithContext(logging.WithRequestInfo(request.Context(), &logging.RequestInfo{ID: "abc-123"}))
+		response := httptest.NewRecorder()
+
+		failLogAndResponse(response, request, "Error creating user", http.StatusUnprocessableEntity, nil)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+		assert.Contains(t, response.Body.String(), "\"requestId\":\"abc-123\"")
+	})
+}
+
 func createTestAppUserHandler(testAppUserCreator testAppUserCreator) CreateAppUserHandler {
 	return CreateAppUserHandler{
 		BucketManager: testAppUserCreator,
 		UserManager:   testAppUserCreator,
+		Auditor:       &testAuditor{},
 	}
 }
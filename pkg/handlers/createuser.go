@@ -5,8 +5,8 @@ import (
 	"fmt"
 	"github.com/minio/minio-go/v6"
 	"github.com/minio/minio/pkg/madmin"
-	"github.com/sirupsen/logrus"
 	"github.com/skatteetaten/fiona/pkg/config"
+	"github.com/skatteetaten/fiona/pkg/logging"
 	"github.com/skatteetaten/fiona/pkg/s3"
 	"net/http"
 )
@@ -34,26 +34,26 @@ func (createuser *CreateUserHandler) ServeHTTP(w http.ResponseWriter, r *http.Re
 	var user User
 	body, err := readRequestBody(r.Body)
 	if err != nil {
-		failLogAndResponse(w, "Could not read request body", http.StatusBadRequest, err)
+		failLogAndResponse(w, r, "Could not read request body", http.StatusBadRequest, err)
 		return
 	}
 	if err := json.Unmarshal(body, &user); err != nil {
-		failLogAndResponse(w, "Could not unmarshal body", http.StatusUnprocessableEntity, err)
+		failLogAndResponse(w, r, "Could not unmarshal body", http.StatusUnprocessableEntity, err)
 		return
 	}
 	if user.Basepath == "" || user.Username == "" {
-		failLogAndResponse(w, "Missing required input", http.StatusForbidden, err)
+		failLogAndResponse(w, r, "Missing required input", http.StatusForbidden, err)
 		return
 	}
 
-	if err := createuser.BucketManager.MakeSureBucketExists(); err != nil {
-		failLogAndResponse(w, "Error when making sure bucket exists", http.StatusInternalServerError, err)
+	if err := createuser.BucketManager.MakeSureBucketExists(r.Context()); err != nil {
+		failLogAndResponse(w, r, "Error when making sure bucket exists", http.StatusInternalServerError, err)
 		return
 	}
 
-	result, err := createuser.UserManager.CreateUser(user.Username, user.Basepath)
+	result, err := createuser.UserManager.CreateUser(r.Context(), user.Username, user.Basepath)
 	if err != nil {
-		failLogAndResponse(w, "Error creating user", http.StatusInternalServerError, err)
+		failLogAndResponse(w, r, "Error creating user", http.StatusInternalServerError, err)
 		return
 	}
 	responseJSON, err := json.Marshal(map[string]string{
@@ -63,12 +63,12 @@ func (createuser *CreateUserHandler) ServeHTTP(w http.ResponseWriter, r *http.Re
 		"bucketRegion":    result.BucketRegion,
 	})
 	if err != nil {
-		failLogAndResponse(w, "Failed marshalling secret for return, aborted", http.StatusInternalServerError, err)
+		failLogAndResponse(w, r, "Failed marshalling secret for return, aborted", http.StatusInternalServerError, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusCreated)
 	_, _ = fmt.Fprintf(w, "%s", responseJSON)
-	logrus.Infof("StatusCreated: createuser %s", user.Username)
+	logging.FromContext(r.Context()).Infof("StatusCreated: createuser %s", user.Username)
 }
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/skatteetaten/fiona/pkg/s3"
@@ -14,7 +15,7 @@ import (
 type testUserCreator struct {
 }
 
-func (tuc testUserCreator) CreateUser(userName string, path string) (*s3.CreateUserResult, error) {
+func (tuc testUserCreator) CreateUser(ctx context.Context, userName string, path string) (*s3.CreateUserResult, error) {
 	mockCreateUserResult := s3.CreateUserResult{
 		SecretKey:       "S3userpass",
 		ServiceEndpoint: "http://localhost:9000",
@@ -23,13 +24,13 @@ func (tuc testUserCreator) CreateUser(userName string, path string) (*s3.CreateU
 	}
 	return &mockCreateUserResult, nil
 }
-func (tuc testUserCreator) CreateAppUser(createAppUserInput *s3.CreateAppUserInput) (*s3.CreateAppUserResult, error) {
+func (tuc testUserCreator) CreateAppUser(ctx context.Context, createAppUserInput *s3.CreateAppUserInput) (*s3.CreateAppUserResult, error) {
 	return nil, nil
 }
-func (tuc testUserCreator) MakeSureBucketExists() error {
+func (tuc testUserCreator) MakeSureBucketExists(ctx context.Context) error {
 	return nil
 }
-func (tuc testUserCreator) BucketNameExists(bucketName string) (bool, error) {
+func (tuc testUserCreator) BucketNameExists(ctx context.Context, bucketName string) (bool, error) {
 	return true, nil
 }
 
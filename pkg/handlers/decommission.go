@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v6"
+	"github.com/minio/minio/pkg/madmin"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/jobs"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"net/http"
+)
+
+// JobDecommissionPath is the kind of the jobs decommissioning paths
+const JobDecommissionPath = "decommission-path"
+
+// decommissionParams are the params of a decommission job, with the audit event recorded when it is done
+type decommissionParams struct {
+	Input s3.DecommissionInput `json:"input"`
+	Audit audit.Event          `json:"audit"`
+}
+
+// DecommissionHandler submits a job decommissioning a path
+type DecommissionHandler struct {
+	BucketManager  s3.BucketManager
+	Decommissioner s3.PathDecommissioner
+	Jobs           *jobs.Manager
+	Auditor        audit.Logger
+}
+
+// NewDecommissionHandler is a factory for DecommissionHandler, registering it as the runner of decommission jobs
+func NewDecommissionHandler(config *s3.Config, minioClient *minio.Client, adminClient *madmin.AdminClient, jobManager *jobs.Manager, auditor audit.Logger) *DecommissionHandler {
+	handler := &DecommissionHandler{
+		BucketManager:  s3.NewMinioBucketManager(config, minioClient),
+		Decommissioner: s3.NewMinioPathDecommissioner(minioClient, adminClient),
+		Jobs:           jobManager,
+		Auditor:        auditor,
+	}
+	jobManager.Register(JobDecommissionPath, handler.run)
+	return handler
+}
+
+// ServeHTTP handles the requests for DecommissionHandler, refusing unless the path is named in the confirm parameter
+func (decommission *DecommissionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	auditEvent := newAuditEvent(r, audit.OperationDecommissionPath)
+	auditEvent.Bucket, auditEvent.Path = params["bucketname"], params["path"]
+	query := r.URL.Query()
+	input := &s3.DecommissionInput{
+		Bucketname:    auditEvent.Bucket,
+		Path:          auditEvent.Path,
+		Disposal:      query.Get("disposal"),
+		ArchiveBucket: query.Get("archiveBucket"),
+		ArchivePrefix: query.Get("archivePrefix"),
+	}
+
+	if query.Get("confirm") != input.Path {
+		err := errors.New("the confirm parameter must name the path")
+		failLogAndResponse(w, r, "Decommissioning must be confirmed with confirm={path}", http.StatusBadRequest, err)
+		decommission.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	if err := s3.ValidateDecommissionInput(input); err != nil {
+		failLogAndResponse(w, r, "Invalid input to decommission path", http.StatusBadRequest, err)
+		decommission.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	buckets := []string{input.Bucketname}
+	if input.Disposal == s3.DisposalArchive {
+		archiveBucket, _ := s3.ArchiveLocation(input)
+		buckets = append(buckets, archiveBucket)
+	}
+	for _, bucket := range buckets {
+		bucketExists, err := decommission.BucketManager.BucketNameExists(r.Context(), bucket)
+		if err != nil {
+			failLogAndResponse(w, r, "Error decommissioning path. Could not verify existing bucket", http.StatusInternalServerError, err)
+			decommission.Auditor.Record(auditEvent.Failed(err))
+			return
+		}
+		if !bucketExists {
+			err = fmt.Errorf("Bucket %s does not exist", bucket)
+			failLogAndResponse(w, r, "Error decommissioning path", http.StatusUnprocessableEntity, err)
+			decommission.Auditor.Record(auditEvent.Failed(err))
+			return
+		}
+	}
+
+	job, err := decommission.Jobs.Submit(r.Context(), JobDecommissionPath, decommissionParams{Input: *input, Audit: auditEvent})
+	if err != nil {
+		failLogAndResponse(w, r, "Error decommissioning path. Could not submit job", http.StatusInternalServerError, err)
+		decommission.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	writeJobAccepted(w, r, job)
+	logging.FromContext(r.Context()).Infof("StatusAccepted: decommission job %s for %s/%s", job.ID, input.Bucketname, input.Path)
+}
+
+// run decommissions the path of a job, recording the audit event of the request when it is done. Nothing is recorded
+// when Fiona is stopping, as the job is run again after restart.
+func (decommission *DecommissionHandler) run(ctx context.Context, job *jobs.Job, report func(progress interface{})) error {
+	var params decommissionParams
+	if err := json.Unmarshal(job.Params, &params); err != nil {
+		return err
+	}
+	params.Audit.Job = job.ID
+	err := decommission.Decommissioner.DecommissionPath(ctx, &params.Input, func(progress s3.DecommissionProgress) {
+		report(progress)
+	})
+	if err != nil {
+		if !jobs.Stopping(ctx) {
+			decommission.Auditor.Record(params.Audit.Failed(err))
+		}
+		return err
+	}
+	decommission.Auditor.Record(params.Audit.Succeeded())
+	return nil
+}
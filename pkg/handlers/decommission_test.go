@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/jobs"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type testDecommissioner struct {
+	input   *s3.DecommissionInput
+	release chan error
+}
+
+func (td *testDecommissioner) DecommissionPath(ctx context.Context, input *s3.DecommissionInput, report func(s3.DecommissionProgress)) error {
+	td.input = input
+	report(s3.DecommissionProgress{RemovedUsers: []string{"testuser"}, Objects: 2})
+	select {
+	case err := <-td.release:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// testJobAuditor receives the events recorded when background jobs finish
+type testJobAuditor struct {
+	events chan audit.Event
+}
+
+func (tja *testJobAuditor) Record(event audit.Event) {
+	tja.events <- event
+}
+
+func TestDecommission(t *testing.T) {
+	decommission := func(handler http.Handler, query string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("DELETE", "http://localhost:8080/buckets/testbucketname/paths/appx?"+query, nil)
+		request = mux.SetURLVars(request, map[string]string{"bucketname": validtestbucketname, "path": "appx"})
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+	newHandler := func(t *testing.T, decommissioner *testDecommissioner, auditor audit.Logger) (*DecommissionHandler, *JobsHandler) {
+		manager := runTestJobs(t)
+		handler := &DecommissionHandler{BucketManager: testAppUserCreator{}, Decommissioner: decommissioner, Jobs: manager, Auditor: auditor}
+		manager.Register(JobDecommissionPath, handler.run)
+		return handler, &JobsHandler{Jobs: manager, Auditor: auditor}
+	}
+
+	t.Run("Should decommission the path in a job and report progress", func(t *testing.T) {
+		decommissioner := &testDecommissioner{release: make(chan error)}
+		auditor := &testJobAuditor{events: make(chan audit.Event, 1)}
+		handler, jobsHandler := newHandler(t, decommissioner, auditor)
+
+		response := decommission(handler, "confirm=appx&disposal=delete")
+
+		assert.Equal(t, http.StatusAccepted, response.Code)
+		var accepted jobs.Job
+		assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &accepted))
+		assert.Equal(t, JobDecommissionPath, accepted.Kind)
+		assert.Equal(t, "/jobs/"+accepted.ID, response.Header().Get("Location"))
+		assert.Eventually(t, func() bool {
+			_, job := getTestJob(jobsHandler, accepted.ID)
+			return job.State == jobs.StateRunning && job.Progress != nil
+		}, time.Second, 10*time.Millisecond)
+		_, running := getTestJob(jobsHandler, accepted.ID)
+		assert.Contains(t, string(running.Progress), `"removedUsers":["testuser"]`)
+
+		decommissioner.release <- nil
+		event := <-auditor.events
+		assert.Equal(t, audit.OperationDecommissionPath, event.Operation)
+		assert.Equal(t, audit.OutcomeSuccess, event.Outcome)
+		assert.Equal(t, accepted.ID, event.Job)
+		assert.Equal(t, validtestbucketname, event.Bucket)
+		assert.Eventually(t, func() bool {
+			_, job := getTestJob(jobsHandler, accepted.ID)
+			return job.State == jobs.StateSucceeded
+		}, time.Second, 10*time.Millisecond)
+		assert.Equal(t, &s3.DecommissionInput{Bucketname: validtestbucketname, Path: "appx", Disposal: s3.DisposalDelete}, decommissioner.input)
+	})
+
+	t.Run("Should report failed jobs", func(t *testing.T) {
+		decommissioner := &testDecommissioner{release: make(chan error, 1)}
+		decommissioner.release <- errors.New("minio is down")
+		auditor := &testJobAuditor{events: make(chan audit.Event, 1)}
+		handler, jobsHandler := newHandler(t, decommissioner, auditor)
+
+		response := decommission(handler, "confirm=appx&disposal=archive&archivePrefix=retired")
+
+		assert.Equal(t, http.StatusAccepted, response.Code)
+		assert.Equal(t, audit.OutcomeFailure, (<-auditor.events).Outcome)
+		var accepted jobs.Job
+		_ = json.Unmarshal(response.Body.Bytes(), &accepted)
+		assert.Eventually(t, func() bool {
+			_, job := getTestJob(jobsHandler, accepted.ID)
+			return job.State == jobs.StateFailed && job.Error == "minio is down"
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Should not record a failure when Fiona stops during the job", func(t *testing.T) {
+		decommissioner := &testDecommissioner{release: make(chan error)}
+		auditor := &testJobAuditor{events: make(chan audit.Event, 1)}
+		manager, _ := jobs.NewManagerWithStore(&jobs.Config{Workers: 1}, "default", jobs.NewMemoryStore())
+		handler := &DecommissionHandler{BucketManager: testAppUserCreator{}, Decommissioner: decommissioner, Jobs: manager, Auditor: auditor}
+		manager.Register(JobDecommissionPath, handler.run)
+		ctx, stop := context.WithCancel(context.Background())
+		stopped := make(chan struct{})
+		go func() {
+			manager.Run(ctx)
+			close(stopped)
+		}()
+
+		var accepted jobs.Job
+		_ = json.Unmarshal(decommission(handler, "confirm=appx&disposal=delete").Body.Bytes(), &accepted)
+		assert.Eventually(t, func() bool {
+			job, _ := manager.Get(accepted.ID)
+			return job.State == jobs.StateRunning
+		}, time.Second, 10*time.Millisecond)
+		stop()
+		<-stopped
+
+		job, _ := manager.Get(accepted.ID)
+		assert.Equal(t, jobs.StateQueued, job.State)
+		assert.Empty(t, auditor.events)
+	})
+
+	t.Run("Should refuse unless confirmed", func(t *testing.T) {
+		auditor := &testAuditor{}
+		handler, _ := newHandler(t, &testDecommissioner{}, auditor)
+
+		for _, query := range []string{"disposal=delete", "confirm=true&disposal=delete", "confirm=appx", "confirm=appx&disposal=archive&archivePrefix=/appx"} {
+			assert.Equal(t, http.StatusBadRequest, decommission(handler, query).Code, query)
+		}
+		assert.Equal(t, http.StatusUnprocessableEntity, decommission(handler, "confirm=appx&disposal=archive&archiveBucket=missing").Code)
+		assert.Len(t, auditor.events, 5)
+		assert.Equal(t, audit.OutcomeFailure, auditor.events[0].Outcome)
+	})
+}
@@ -3,17 +3,21 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/sirupsen/logrus"
+	"github.com/skatteetaten/fiona/pkg/logging"
 	"net/http"
 )
 
-func failLogAndResponse(w http.ResponseWriter, message string, status int, err error) {
-	logrus.Errorf("%s: %s", message, err)
+func failLogAndResponse(w http.ResponseWriter, r *http.Request, message string, status int, err error) {
+	logging.FromContext(r.Context()).Errorf("%s: %s", message, err)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	responseJSON, err := json.Marshal(map[string]string{
+	responseBody := map[string]string{
 		"error": message,
 		"cause": fmt.Sprintf("%v", err),
-	})
+	}
+	if requestID := logging.RequestID(r.Context()); requestID != "" {
+		responseBody["requestId"] = requestID
+	}
+	responseJSON, err := json.Marshal(responseBody)
 	_, _ = fmt.Fprintf(w, "%s", responseJSON)
 }
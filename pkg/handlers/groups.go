@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v6"
+	"github.com/minio/minio/pkg/madmin"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"net/http"
+)
+
+// CreateGroupInput provides input for creating an access group
+type CreateGroupInput struct {
+	Access  []string `json:"access"`
+	Members []string `json:"members"`
+}
+
+// GroupResult describes an access group
+type GroupResult struct {
+	Group   string   `json:"group"`
+	Members []string `json:"members"`
+	Policy  string   `json:"policy,omitempty"`
+	Status  string   `json:"status,omitempty"`
+}
+
+// CreateGroupHandler creates the access group for a bucket path and adds members to it
+type CreateGroupHandler struct {
+	BucketManager s3.BucketManager
+	GroupManager  s3.GroupManager
+	Auditor       audit.Logger
+}
+
+// NewCreateGroupHandler is a factory for CreateGroupHandler
+func NewCreateGroupHandler(config *s3.Config, adminClient *madmin.AdminClient, minioClient *minio.Client, auditor audit.Logger) *CreateGroupHandler {
+	return &CreateGroupHandler{
+		BucketManager: s3.NewMinioBucketManager(config, minioClient),
+		GroupManager:  s3.NewMinioGroupManager(adminClient),
+		Auditor:       auditor,
+	}
+}
+
+// ServeHTTP handles the requests for CreateGroupHandler
+func (creategroup *CreateGroupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auditEvent := newAuditEvent(r, audit.OperationCreateGroup)
+	params := mux.Vars(r)
+	auditEvent.Bucket = params["bucketname"]
+	auditEvent.Path = params["path"]
+
+	var input CreateGroupInput
+	body, err := readRequestBody(r.Body)
+	if err != nil {
+		failLogAndResponse(w, r, "Could not read request body", http.StatusBadRequest, err)
+		creategroup.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	if err := json.Unmarshal(body, &input); err != nil {
+		failLogAndResponse(w, r, "Could not unmarshal body", http.StatusUnprocessableEntity, err)
+		creategroup.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	auditEvent.Access = input.Access
+	group, err := s3.AccessGroupName(auditEvent.Bucket, auditEvent.Path, input.Access)
+	if err == nil && len(input.Members) == 0 {
+		err = errors.New("a group needs at least one member")
+	}
+	if err != nil {
+		failLogAndResponse(w, r, "Missing required input to create group.", http.StatusBadRequest, err)
+		creategroup.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	auditEvent.Group = group
+
+	bucketExists, err := creategroup.BucketManager.BucketNameExists(r.Context(), auditEvent.Bucket)
+	if err != nil {
+		failLogAndResponse(w, r, "Error creating group. Could not verify existing bucket", http.StatusInternalServerError, err)
+		creategroup.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	if !bucketExists {
+		err = errors.New("Bucket does not exist")
+		failLogAndResponse(w, r, "Error creating group", http.StatusUnprocessableEntity, err)
+		creategroup.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+
+	if _, err := creategroup.GroupManager.CreateAccessGroup(r.Context(), auditEvent.Bucket, auditEvent.Path, input.Access, input.Members); err != nil {
+		status := http.StatusInternalServerError
+		if s3.IsNotFound(err) {
+			status = http.StatusUnprocessableEntity
+		}
+		failLogAndResponse(w, r, "Error creating group", status, err)
+		creategroup.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	auditEvent.PolicyName = group
+	creategroup.Auditor.Record(auditEvent.Succeeded())
+
+	writeJSON(w, r, http.StatusCreated, GroupResult{Group: group, Members: input.Members, Policy: group})
+	logging.FromContext(r.Context()).Infof("StatusCreated: group %s", group)
+}
+
+// GroupHandler describes an access group
+type GroupHandler struct {
+	GroupManager s3.GroupManager
+}
+
+// NewGroupHandler is a factory for GroupHandler
+func NewGroupHandler(adminClient *madmin.AdminClient) *GroupHandler {
+	return &GroupHandler{GroupManager: s3.NewMinioGroupManager(adminClient)}
+}
+
+// ServeHTTP handles the requests for GroupHandler
+func (grouphandler *GroupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	group := mux.Vars(r)["group"]
+	if !s3.IsManagedGroup(group) {
+		failLogAndResponse(w, r, "Group is not managed by Fiona", http.StatusNotFound, fmt.Errorf("group %s", group))
+		return
+	}
+	description, err := grouphandler.GroupManager.DescribeGroup(r.Context(), group)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if s3.IsNotFound(err) {
+			status = http.StatusNotFound
+		}
+		failLogAndResponse(w, r, "Error describing group", status, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, GroupResult{
+		Group:   group,
+		Members: description.Members,
+		Policy:  description.Policy,
+		Status:  description.Status,
+	})
+}
+
+// GroupMemberHandler adds a user to or removes a user from an access group
+type GroupMemberHandler struct {
+	GroupManager s3.GroupManager
+	Auditor      audit.Logger
+}
+
+// NewGroupMemberHandler is a factory for GroupMemberHandler
+func NewGroupMemberHandler(adminClient *madmin.AdminClient, auditor audit.Logger) *GroupMemberHandler {
+	return &GroupMemberHandler{GroupManager: s3.NewMinioGroupManager(adminClient), Auditor: auditor}
+}
+
+// ServeHTTP handles the requests for GroupMemberHandler, PUT adds and DELETE removes the member
+func (groupmember *GroupMemberHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	remove := r.Method == http.MethodDelete
+	operation := audit.OperationAddGroupMember
+	if remove {
+		operation = audit.OperationRemoveGroupMember
+	}
+	auditEvent := newAuditEvent(r, operation)
+	params := mux.Vars(r)
+	auditEvent.Group = params["group"]
+	auditEvent.Username = params["username"]
+
+	if !s3.IsManagedGroup(auditEvent.Group) {
+		err := fmt.Errorf("group %s", auditEvent.Group)
+		failLogAndResponse(w, r, "Group is not managed by Fiona", http.StatusNotFound, err)
+		groupmember.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	// Adding a member to a group that does not exist would create it without a policy
+	if !remove {
+		if _, err := groupmember.GroupManager.DescribeGroup(r.Context(), auditEvent.Group); err != nil {
+			status := http.StatusInternalServerError
+			if s3.IsNotFound(err) {
+				status = http.StatusNotFound
+			}
+			failLogAndResponse(w, r, "Error updating group", status, err)
+			groupmember.Auditor.Record(auditEvent.Failed(err))
+			return
+		}
+	}
+	if err := groupmember.GroupManager.UpdateGroupMembers(r.Context(), auditEvent.Group, []string{auditEvent.Username}, remove); err != nil {
+		status := http.StatusInternalServerError
+		if s3.IsNotFound(err) {
+			status = http.StatusNotFound
+		}
+		failLogAndResponse(w, r, "Error updating group", status, err)
+		groupmember.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	groupmember.Auditor.Record(auditEvent.Succeeded())
+
+	w.WriteHeader(http.StatusNoContent)
+	logging.FromContext(r.Context()).Infof("StatusNoContent: %s %s in group %s", operation, auditEvent.Username, auditEvent.Group)
+}
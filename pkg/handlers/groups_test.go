@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/minio/minio/pkg/madmin"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testGroupManager struct {
+	groups map[string][]string
+}
+
+func (tgm *testGroupManager) CreateAccessGroup(ctx context.Context, bucket, path string, access []string, members []string) (string, error) {
+	group, err := s3.AccessGroupName(bucket, path, access)
+	if err != nil {
+		return "", err
+	}
+	tgm.groups[group] = append(tgm.groups[group], members...)
+	return group, nil
+}
+func (tgm *testGroupManager) UpdateGroupMembers(ctx context.Context, group string, members []string, remove bool) error {
+	if remove {
+		tgm.groups[group] = nil
+		return nil
+	}
+	tgm.groups[group] = append(tgm.groups[group], members...)
+	return nil
+}
+func (tgm *testGroupManager) DescribeGroup(ctx context.Context, group string) (*madmin.GroupDesc, error) {
+	members, ok := tgm.groups[group]
+	if !ok {
+		return nil, madmin.ErrorResponse{Code: "XMinioAdminNoSuchGroup"}
+	}
+	return &madmin.GroupDesc{Name: group, Members: members, Policy: group, Status: "enabled"}, nil
+}
+
+func TestGroups(t *testing.T) {
+	t.Run("Should create the access group for a path", func(t *testing.T) {
+		groupManager := &testGroupManager{groups: map[string][]string{}}
+		auditor := &testAuditor{}
+		handler := &CreateGroupHandler{BucketManager: testAppUserCreator{}, GroupManager: groupManager, Auditor: auditor}
+		request, _ := http.NewRequest("POST", "http://localhost:8080/buckets/testbucketname/paths/appx/groups/", strings.NewReader(`{"access":["READ"], "members":["appxuser"]}`))
+		request = mux.SetURLVars(request, map[string]string{"bucketname": validtestbucketname, "path": "appx"})
+		response := httptest.NewRecorder()
+
+		handler.ServeHTTP(response, request)
+
+		assert.Equal(t, http.StatusCreated, response.Code)
+		assert.JSONEq(t, `{"group":"fiona-testbucketname-appx-c5309481-r","members":["appxuser"],"policy":"fiona-testbucketname-appx-c5309481-r"}`, response.Body.String())
+		assert.Equal(t, audit.OperationCreateGroup, auditor.events[0].Operation)
+		assert.Equal(t, "fiona-testbucketname-appx-c5309481-r", auditor.events[0].Group)
+	})
+
+	t.Run("Should refuse groups without members or with unknown access", func(t *testing.T) {
+		handler := &CreateGroupHandler{BucketManager: testAppUserCreator{}, GroupManager: &testGroupManager{groups: map[string][]string{}}, Auditor: &testAuditor{}}
+		for _, body := range []string{`{"access":["READ"]}`, `{"access":["EXECUTE"], "members":["appxuser"]}`} {
+			request, _ := http.NewRequest("POST", "http://localhost:8080/buckets/testbucketname/paths/appx/groups/", strings.NewReader(body))
+			request = mux.SetURLVars(request, map[string]string{"bucketname": validtestbucketname, "path": "appx"})
+			response := httptest.NewRecorder()
+
+			handler.ServeHTTP(response, request)
+
+			assert.Equal(t, http.StatusBadRequest, response.Code, body)
+		}
+	})
+
+	t.Run("Should describe managed groups only", func(t *testing.T) {
+		handler := &GroupHandler{GroupManager: &testGroupManager{groups: map[string][]string{"fiona-utv-appx-3030f118-r": {"appxuser"}}}}
+		describe := func(group string) *httptest.ResponseRecorder {
+			request, _ := http.NewRequest("GET", "http://localhost:8080/groups/"+group, nil)
+			request = mux.SetURLVars(request, map[string]string{"group": group})
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, request)
+			return response
+		}
+
+		response := describe("fiona-utv-appx-3030f118-r")
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Contains(t, response.Body.String(), `"members":["appxuser"]`)
+		assert.Equal(t, http.StatusNotFound, describe("fiona-utv-appy-bdf2ae03-r").Code)
+		assert.Equal(t, http.StatusNotFound, describe("admins").Code)
+	})
+
+	t.Run("Should add and remove members of existing groups", func(t *testing.T) {
+		groupManager := &testGroupManager{groups: map[string][]string{"fiona-utv-appx-3030f118-r": {"appxuser"}}}
+		auditor := &testAuditor{}
+		handler := &GroupMemberHandler{GroupManager: groupManager, Auditor: auditor}
+		update := func(method, group string) *httptest.ResponseRecorder {
+			request, _ := http.NewRequest(method, "http://localhost:8080/groups/"+group+"/members/appyuser", nil)
+			request = mux.SetURLVars(request, map[string]string{"group": group, "username": "appyuser"})
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, request)
+			return response
+		}
+
+		assert.Equal(t, http.StatusNoContent, update("PUT", "fiona-utv-appx-3030f118-r").Code)
+		assert.Equal(t, []string{"appxuser", "appyuser"}, groupManager.groups["fiona-utv-appx-3030f118-r"])
+		assert.Equal(t, http.StatusNotFound, update("PUT", "fiona-utv-appy-bdf2ae03-r").Code)
+		assert.NotContains(t, groupManager.groups, "fiona-utv-appy-bdf2ae03-r")
+		assert.Equal(t, http.StatusNoContent, update("DELETE", "fiona-utv-appx-3030f118-r").Code)
+
+		assert.Equal(t, audit.OperationAddGroupMember, auditor.events[0].Operation)
+		assert.Equal(t, "appyuser", auditor.events[0].Username)
+		assert.Equal(t, audit.OperationRemoveGroupMember, auditor.events[2].Operation)
+	})
+}
@@ -1,15 +1,22 @@
 package healthcheck
 
 import (
+	"context"
 	"fmt"
 	"github.com/minio/minio/pkg/madmin"
 	"github.com/sirupsen/logrus"
 	"github.com/skatteetaten/aurora-management-interface-go/health"
+	"github.com/skatteetaten/fiona/pkg/metrics"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"sync"
 	"time"
 )
 
 const timeoutSeconds = 2
 
+// minioComponent is the health component of the default cluster. Named clusters are reported as minio-<name>.
+const minioComponent = "minio"
+
 type serverInfoRetriever interface {
 	ServerInfo() (madmin.InfoMessage, error)
 }
@@ -17,19 +24,63 @@ type serverInfoRetriever interface {
 // FionaHealthRetriever retreives health status information
 type FionaHealthRetriever struct {
 	serverInfoRetriever
+	clusters map[string]serverInfoRetriever
 }
 
 // NewFionaHealthRetriever is a factory for HealthHandler
 func NewFionaHealthRetriever(admClient serverInfoRetriever) *FionaHealthRetriever {
-	return &FionaHealthRetriever{admClient}
+	return &FionaHealthRetriever{serverInfoRetriever: admClient, clusters: map[string]serverInfoRetriever{}}
+}
+
+// AddCluster includes a named minio cluster in the health check
+func (fhh *FionaHealthRetriever) AddCluster(name string, admClient serverInfoRetriever) {
+	fhh.clusters[name] = admClient
 }
 
-// GetApplicationHealth returns a health.ApplicationHealth structure for fiona
+// GetApplicationHealth returns a health.ApplicationHealth structure for fiona. The status follows the default
+// cluster, and is at most OBSERVE when one of the named clusters is not up.
 func (fhh *FionaHealthRetriever) GetApplicationHealth() *health.ApplicationHealth {
+	retrievers := map[string]serverInfoRetriever{minioComponent: fhh.serverInfoRetriever}
+	for name, retriever := range fhh.clusters {
+		retrievers[minioComponent+"-"+name] = retriever
+	}
+
+	components := map[string]health.ComponentHealth{}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for component, retriever := range retrievers {
+		wg.Add(1)
+		go func(component string, retriever serverInfoRetriever) {
+			defer wg.Done()
+			componentHealth := minioHealth(component, retriever)
+			mutex.Lock()
+			components[component] = componentHealth
+			mutex.Unlock()
+		}(component, retriever)
+	}
+	wg.Wait()
+
+	status := components[minioComponent].Status
+	for component, componentHealth := range components {
+		if component != minioComponent && componentHealth.Status != health.Up && status == health.Up {
+			status = health.Observe
+		}
+	}
+
+	fionaHealth := health.ApplicationHealth{
+		Status:     status,
+		Components: components,
+	}
+	metrics.CountHealthCheck(fionaHealth.Status)
+
+	return &fionaHealth
+}
+
+func minioHealth(component string, retriever serverInfoRetriever) health.ComponentHealth {
 	minioHealth := health.ComponentHealth{}
-	serverInfoMessage, err := serverInfoWithTimeoutAfter2sec(fhh)
+	serverInfoMessage, err := serverInfoWithTimeoutAfter2sec(retriever)
 	if err != nil {
-		logrus.Errorf("Failed during health check call to minio: %s", err)
+		logrus.Errorf("Failed during health check call to %s: %s", component, err)
 		minioHealth.Status = health.Observe
 	} else {
 		if serverInfoMessage.Mode == "online" {
@@ -38,13 +89,7 @@ func (fhh *FionaHealthRetriever) GetApplicationHealth() *health.ApplicationHealt
 			minioHealth.Status = health.Down
 		}
 	}
-
-	fionaHealth := health.ApplicationHealth{
-		Status:     minioHealth.Status,
-		Components: map[string]health.ComponentHealth{"minio": minioHealth},
-	}
-
-	return &fionaHealth
+	return minioHealth
 }
 
 func serverInfoWithTimeoutAfter2sec(retriever serverInfoRetriever) (madmin.InfoMessage, error) {
@@ -53,9 +98,13 @@ func serverInfoWithTimeoutAfter2sec(retriever serverInfoRetriever) (madmin.InfoM
 		InfoMessage madmin.InfoMessage
 		Error       error
 	}
-	serverInfoChan := make(chan ChanResult)
+	serverInfoChan := make(chan ChanResult, 1)
 	go func() {
-		infoMsg, err := retriever.ServerInfo()
+		var infoMsg madmin.InfoMessage
+		err := s3.Instrument(context.Background(), "ServerInfo", func() (err error) {
+			infoMsg, err = retriever.ServerInfo()
+			return err
+		})
 		if err != nil {
 			serverInfoChan <- ChanResult{
 				InfoMessage: madmin.InfoMessage{},
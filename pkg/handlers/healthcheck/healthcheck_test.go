@@ -39,6 +39,45 @@ func TestHealthCheckHandler(t *testing.T) {
 	})
 }
 
+func TestClusterHealth(t *testing.T) {
+	t.Run("Should report each cluster as a component", func(t *testing.T) {
+		fhr := NewFionaHealthRetriever(mockServerInfoRetriever{})
+		fhr.AddCluster("archive", mockServerInfoRetriever{})
+
+		healthResult := fhr.GetApplicationHealth()
+
+		assert.Equal(t, "UP", healthResult.Status)
+		assert.Equal(t, 2, len(healthResult.Components))
+		assert.Equal(t, "UP", healthResult.Components["minio-archive"].Status)
+	})
+
+	t.Run("Should observe when a named cluster is down", func(t *testing.T) {
+		fhr := NewFionaHealthRetriever(mockServerInfoRetriever{})
+		fhr.AddCluster("archive", mockOfflineServerInfoRetriever{})
+
+		healthResult := fhr.GetApplicationHealth()
+
+		assert.Equal(t, "OBSERVE", healthResult.Status)
+		assert.Equal(t, "UP", healthResult.Components["minio"].Status)
+		assert.Equal(t, "DOWN", healthResult.Components["minio-archive"].Status)
+	})
+
+	t.Run("Should be down when the default cluster is down", func(t *testing.T) {
+		fhr := NewFionaHealthRetriever(mockOfflineServerInfoRetriever{})
+		fhr.AddCluster("archive", mockServerInfoRetriever{})
+
+		assert.Equal(t, "DOWN", fhr.GetApplicationHealth().Status)
+	})
+}
+
+type mockOfflineServerInfoRetriever struct{}
+
+func (msir mockOfflineServerInfoRetriever) ServerInfo() (madmin.InfoMessage, error) {
+	return madmin.InfoMessage{
+		Mode: "offline",
+	}, nil
+}
+
 type mockServerInfoRetriever struct{}
 
 func (msir mockServerInfoRetriever) ServerInfo() (madmin.InfoMessage, error) {
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/minio/minio-go/v6"
+	"github.com/minio/minio/pkg/madmin"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/inventory"
+	"github.com/skatteetaten/fiona/pkg/jobs"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"net/http"
+)
+
+// JobReconcileInventory is the kind of the jobs comparing the inventory of a cluster with minio
+const JobReconcileInventory = "reconcile-inventory"
+
+// reconcileParams are the params of a reconcile job, with the audit event recorded when it rebuilds the inventory
+type reconcileParams struct {
+	Rebuild bool        `json:"rebuild"`
+	Audit   audit.Event `json:"audit"`
+}
+
+// reconcileProgress is the drift found by a reconcile job
+type reconcileProgress struct {
+	*inventory.Drift
+	Rebuilt bool `json:"rebuilt"`
+}
+
+// InventoryHandler lists the resources recorded for a cluster on GET, and submits a job reconciling them with minio
+// on POST
+type InventoryHandler struct {
+	Inventory  *inventory.Inventory
+	Discoverer inventory.Discoverer
+	Jobs       *jobs.Manager
+	Auditor    audit.Logger
+}
+
+// NewInventoryHandler is a factory for InventoryHandler, registering it as the runner of reconcile jobs
+func NewInventoryHandler(cluster string, minioClient *minio.Client, adminClient *madmin.AdminClient, resources *inventory.Inventory, jobManager *jobs.Manager, auditor audit.Logger) *InventoryHandler {
+	handler := &InventoryHandler{
+		Inventory:  resources,
+		Discoverer: inventory.NewMinioDiscoverer(cluster, minioClient, adminClient),
+		Jobs:       jobManager,
+		Auditor:    auditor,
+	}
+	jobManager.Register(JobReconcileInventory, handler.run)
+	return handler
+}
+
+// ServeHTTP handles the requests for InventoryHandler
+func (inventoryhandler *InventoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if r.Method == http.MethodGet {
+		writeJSON(w, r, http.StatusOK, inventoryhandler.Inventory.List(inventory.Filter{
+			Cluster: ClusterName(r),
+			Kind:    query.Get("kind"),
+			Bucket:  query.Get("bucket"),
+			Path:    query.Get("path"),
+		}))
+		return
+	}
+
+	params := reconcileParams{Rebuild: query.Get("rebuild") == "true", Audit: newAuditEvent(r, audit.OperationRebuildInventory)}
+	job, err := inventoryhandler.Jobs.Submit(r.Context(), JobReconcileInventory, params)
+	if err != nil {
+		failLogAndResponse(w, r, "Error reconciling inventory. Could not submit job", http.StatusInternalServerError, err)
+		if params.Rebuild {
+			inventoryhandler.Auditor.Record(params.Audit.Failed(err))
+		}
+		return
+	}
+	writeJobAccepted(w, r, job)
+	logging.FromContext(r.Context()).Infof("StatusAccepted: reconcile job %s, rebuild %t", job.ID, params.Rebuild)
+}
+
+// run compares the inventory of the cluster with the resources found in minio, reporting the drift as its progress,
+// and replaces the inventory with the resources found when asked to rebuild it
+func (inventoryhandler *InventoryHandler) run(ctx context.Context, job *jobs.Job, report func(progress interface{})) error {
+	var params reconcileParams
+	if err := json.Unmarshal(job.Params, &params); err != nil {
+		return err
+	}
+	params.Audit.Job = job.ID
+	discovered, err := inventoryhandler.Discoverer.Discover(ctx)
+	if err != nil {
+		if params.Rebuild {
+			inventoryhandler.Auditor.Record(params.Audit.Failed(err))
+		}
+		return err
+	}
+	drift := inventory.Compare(inventoryhandler.Inventory.List(inventory.Filter{Cluster: job.Cluster}), discovered)
+	report(reconcileProgress{Drift: drift})
+	if !params.Rebuild {
+		return nil
+	}
+	if err := inventoryhandler.Inventory.Rebuild(job.Cluster, discovered); err != nil {
+		inventoryhandler.Auditor.Record(params.Audit.Failed(err))
+		return err
+	}
+	inventoryhandler.Auditor.Record(params.Audit.Succeeded())
+	report(reconcileProgress{Drift: drift, Rebuilt: true})
+	logging.FromContext(ctx).Infof("Success: Rebuilt the inventory of cluster %s, %d missing, %d untracked and %d changed resources corrected", job.Cluster, len(drift.Missing), len(drift.Untracked), len(drift.Changed))
+	return nil
+}
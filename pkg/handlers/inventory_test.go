@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/inventory"
+	"github.com/skatteetaten/fiona/pkg/jobs"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type testDiscoverer struct{}
+
+func (td testDiscoverer) Discover(ctx context.Context) ([]*inventory.Resource, error) {
+	return []*inventory.Resource{
+		{Kind: inventory.KindUser, Name: "appuser", Cluster: "default", Bucket: validtestbucketname, Path: "appx", Access: []string{"READ"}, Policy: "validtestbucketnameappx_appuser_R"},
+		{Kind: inventory.KindPath, Name: validtestbucketname + "/appx", Cluster: "default", Bucket: validtestbucketname, Path: "appx"},
+	}, nil
+}
+
+func TestInventory(t *testing.T) {
+	newHandler := func(t *testing.T, auditor audit.Logger) (*InventoryHandler, *jobs.Manager) {
+		resources, _ := inventory.New(inventory.NewMemoryStore())
+		_ = resources.Put(&inventory.Resource{Kind: inventory.KindUser, Name: "removed", Cluster: "default", Bucket: validtestbucketname, Path: "appy", Creator: "boober"})
+		_ = resources.Put(&inventory.Resource{Kind: inventory.KindUser, Name: "archived", Cluster: "archive"})
+		manager := runTestJobs(t)
+		handler := &InventoryHandler{Inventory: resources, Discoverer: testDiscoverer{}, Jobs: manager, Auditor: auditor}
+		manager.Register(JobReconcileInventory, handler.run)
+		return handler, manager
+	}
+	reconcile := func(handler http.Handler, query string) jobs.Job {
+		request, _ := http.NewRequest("POST", "http://localhost:8080/inventory/reconcile?"+query, nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		assert.Equal(t, http.StatusAccepted, response.Code)
+		var job jobs.Job
+		_ = json.Unmarshal(response.Body.Bytes(), &job)
+		return job
+	}
+	waitForJob := func(t *testing.T, manager *jobs.Manager, id string) *jobs.Job {
+		var job *jobs.Job
+		assert.Eventually(t, func() bool {
+			job, _ = manager.Get(id)
+			return job.State == jobs.StateSucceeded
+		}, time.Second, 5*time.Millisecond)
+		return job
+	}
+
+	t.Run("Should list the resources of the cluster", func(t *testing.T) {
+		handler, _ := newHandler(t, &testAuditor{})
+		request, _ := http.NewRequest("GET", "http://localhost:8080/inventory?kind=user", nil)
+		response := httptest.NewRecorder()
+
+		handler.ServeHTTP(response, request)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		var resources []inventory.Resource
+		assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &resources))
+		assert.Len(t, resources, 1)
+		assert.Equal(t, "removed", resources[0].Name)
+		assert.Equal(t, "boober", resources[0].Creator)
+	})
+
+	t.Run("Should report drift without changing the inventory", func(t *testing.T) {
+		auditor := &testAuditor{}
+		handler, manager := newHandler(t, auditor)
+
+		job := waitForJob(t, manager, reconcile(handler, "").ID)
+
+		var progress struct {
+			Missing   []inventory.Resource `json:"missing"`
+			Untracked []inventory.Resource `json:"untracked"`
+			Rebuilt   bool                 `json:"rebuilt"`
+		}
+		assert.Nil(t, json.Unmarshal(job.Progress, &progress))
+		assert.Equal(t, "removed", progress.Missing[0].Name)
+		assert.Len(t, progress.Untracked, 2)
+		assert.False(t, progress.Rebuilt)
+		assert.Len(t, handler.Inventory.List(inventory.Filter{Cluster: "default"}), 1)
+		assert.Empty(t, auditor.events)
+	})
+
+	t.Run("Should rebuild the inventory from minio", func(t *testing.T) {
+		auditor := &testJobAuditor{events: make(chan audit.Event, 1)}
+		handler, manager := newHandler(t, auditor)
+
+		job := waitForJob(t, manager, reconcile(handler, "rebuild=true").ID)
+
+		assert.Contains(t, string(job.Progress), `"rebuilt":true`)
+		event := <-auditor.events
+		assert.Equal(t, audit.OperationRebuildInventory, event.Operation)
+		assert.Equal(t, audit.OutcomeSuccess, event.Outcome)
+		assert.Equal(t, job.ID, event.Job)
+		var names []string
+		for _, resource := range handler.Inventory.List(inventory.Filter{}) {
+			names = append(names, resource.Cluster+" "+resource.Name)
+		}
+		assert.Equal(t, []string{"archive archived", "default " + validtestbucketname + "/appx", "default appuser"}, names)
+	})
+}
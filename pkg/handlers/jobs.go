@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/jobs"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"net/http"
+)
+
+// JobsHandler lists jobs and reports a job on GET, and cancels a job on DELETE
+type JobsHandler struct {
+	Jobs    *jobs.Manager
+	Auditor audit.Logger
+}
+
+// NewJobsHandler is a factory for JobsHandler
+func NewJobsHandler(jobManager *jobs.Manager, auditor audit.Logger) *JobsHandler {
+	return &JobsHandler{Jobs: jobManager, Auditor: auditor}
+}
+
+// ServeHTTP handles the requests for JobsHandler
+func (jobshandler *JobsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, found := mux.Vars(r)["id"]
+	if !found {
+		writeJSON(w, r, http.StatusOK, jobshandler.Jobs.List())
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		job, err := jobshandler.Jobs.Get(id)
+		if err != nil {
+			failLogAndResponse(w, r, "Job not found", http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, job)
+		return
+	}
+
+	auditEvent := newAuditEvent(r, audit.OperationCancelJob)
+	auditEvent.Job = id
+	job, err := jobshandler.Jobs.Cancel(id)
+	switch err {
+	case nil:
+	case jobs.ErrNotFound:
+		failLogAndResponse(w, r, "Job not found", http.StatusNotFound, err)
+		jobshandler.Auditor.Record(auditEvent.Failed(err))
+		return
+	case jobs.ErrFinished:
+		failLogAndResponse(w, r, "Job has already finished", http.StatusConflict, err)
+		jobshandler.Auditor.Record(auditEvent.Failed(err))
+		return
+	default:
+		failLogAndResponse(w, r, "Error cancelling job", http.StatusInternalServerError, err)
+		jobshandler.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	jobshandler.Auditor.Record(auditEvent.Succeeded())
+
+	writeJSON(w, r, http.StatusOK, job)
+	logging.FromContext(r.Context()).Infof("StatusOK: cancelled %s job %s", job.Kind, job.ID)
+}
+
+// writeJobAccepted responds that the job was submitted, telling where it is reported
+func writeJobAccepted(w http.ResponseWriter, r *http.Request, job *jobs.Job) {
+	location := "/jobs/" + job.ID
+	if cluster := ClusterName(r); cluster != s3.DefaultClusterName {
+		location = "/clusters/" + cluster + location
+	}
+	w.Header().Set("Location", location)
+	writeJSON(w, r, http.StatusAccepted, job)
+}
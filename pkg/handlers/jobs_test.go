@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/jobs"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// runTestJobs runs a job manager keeping jobs in memory until the test is done
+func runTestJobs(t *testing.T) *jobs.Manager {
+	manager, _ := jobs.NewManagerWithStore(&jobs.Config{Workers: 1}, "default", jobs.NewMemoryStore())
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go manager.Run(ctx)
+	return manager
+}
+
+func getTestJob(handler http.Handler, id string) (int, jobs.Job) {
+	request, _ := http.NewRequest("GET", "http://localhost:8080/jobs/"+id, nil)
+	request = mux.SetURLVars(request, map[string]string{"id": id})
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	var job jobs.Job
+	_ = json.Unmarshal(response.Body.Bytes(), &job)
+	return response.Code, job
+}
+
+func TestJobs(t *testing.T) {
+	cancelJob := func(handler http.Handler, id string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("DELETE", "http://localhost:8080/jobs/"+id, nil)
+		request = mux.SetURLVars(request, map[string]string{"id": id})
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("Should list, report and cancel jobs", func(t *testing.T) {
+		manager := runTestJobs(t)
+		manager.Register("test", func(ctx context.Context, job *jobs.Job, report func(progress interface{})) error {
+			report(map[string]int{"objectsDone": 10})
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		auditor := &testAuditor{}
+		handler := &JobsHandler{Jobs: manager, Auditor: auditor}
+		submitted, _ := manager.Submit(context.Background(), "test", nil)
+
+		assert.Eventually(t, func() bool {
+			_, job := getTestJob(handler, submitted.ID)
+			return job.State == jobs.StateRunning
+		}, time.Second, 5*time.Millisecond)
+		_, job := getTestJob(handler, submitted.ID)
+		assert.JSONEq(t, `{"objectsDone":10}`, string(job.Progress))
+		request, _ := http.NewRequest("GET", "http://localhost:8080/jobs", nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		assert.Contains(t, response.Body.String(), `"id":"`+submitted.ID+`"`)
+
+		assert.Equal(t, http.StatusOK, cancelJob(handler, submitted.ID).Code)
+		assert.Eventually(t, func() bool {
+			_, job := getTestJob(handler, submitted.ID)
+			return job.State == jobs.StateCancelled
+		}, time.Second, 5*time.Millisecond)
+		assert.Equal(t, http.StatusConflict, cancelJob(handler, submitted.ID).Code)
+		assert.Equal(t, audit.OperationCancelJob, auditor.events[0].Operation)
+		assert.Equal(t, audit.OutcomeSuccess, auditor.events[0].Outcome)
+		assert.Equal(t, submitted.ID, auditor.events[0].Job)
+	})
+
+	t.Run("Should tell when the job is not found", func(t *testing.T) {
+		handler := &JobsHandler{Jobs: runTestJobs(t), Auditor: &testAuditor{}}
+
+		code, _ := getTestJob(handler, "unknown")
+		assert.Equal(t, http.StatusNotFound, code)
+		assert.Equal(t, http.StatusNotFound, cancelJob(handler, "unknown").Code)
+	})
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v6"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"net/http"
+)
+
+// LifecycleHandler sets the lifecycle rules of a path on PUT, and reports them on GET
+type LifecycleHandler struct {
+	BucketManager    s3.BucketManager
+	LifecycleManager s3.LifecycleManager
+	Auditor          audit.Logger
+}
+
+// NewLifecycleHandler is a factory for LifecycleHandler
+func NewLifecycleHandler(config *s3.Config, minioClient *minio.Client, auditor audit.Logger) *LifecycleHandler {
+	return &LifecycleHandler{
+		BucketManager:    s3.NewMinioBucketManager(config, minioClient),
+		LifecycleManager: s3.NewMinioLifecycleManager(minioClient),
+		Auditor:          auditor,
+	}
+}
+
+// ServeHTTP handles the requests for LifecycleHandler
+func (lifecyclehandler *LifecycleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	bucket, path := params["bucketname"], params["path"]
+
+	if r.Method == http.MethodGet {
+		if !lifecyclehandler.requireBucket(w, r, bucket) {
+			return
+		}
+		lifecycle, err := lifecyclehandler.LifecycleManager.GetPathLifecycle(r.Context(), bucket, path)
+		if err != nil {
+			failLogAndResponse(w, r, "Error reading lifecycle rules", http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, lifecycle)
+		return
+	}
+
+	auditEvent := newAuditEvent(r, audit.OperationSetLifecycle)
+	auditEvent.Bucket, auditEvent.Path = bucket, path
+
+	var lifecycle s3.PathLifecycle
+	body, err := readRequestBody(r.Body)
+	if err != nil {
+		failLogAndResponse(w, r, "Could not read request body", http.StatusBadRequest, err)
+		lifecyclehandler.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	if err := json.Unmarshal(body, &lifecycle); err != nil {
+		failLogAndResponse(w, r, "Could not unmarshal body", http.StatusUnprocessableEntity, err)
+		lifecyclehandler.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	if err := s3.ValidatePathLifecycle(&lifecycle); err != nil {
+		failLogAndResponse(w, r, "Invalid lifecycle rules", http.StatusBadRequest, err)
+		lifecyclehandler.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	if !lifecyclehandler.requireBucket(w, r, bucket) {
+		lifecyclehandler.Auditor.Record(auditEvent.Failed(errors.New("Bucket does not exist")))
+		return
+	}
+
+	if err := lifecyclehandler.LifecycleManager.SetPathLifecycle(r.Context(), bucket, path, &lifecycle); err != nil {
+		failLogAndResponse(w, r, "Error setting lifecycle rules", http.StatusInternalServerError, err)
+		lifecyclehandler.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	lifecyclehandler.Auditor.Record(auditEvent.Succeeded())
+
+	writeJSON(w, r, http.StatusOK, lifecycle)
+	logging.FromContext(r.Context()).Infof("StatusOK: lifecycle rules for %s/%s", bucket, path)
+}
+
+// requireBucket responds and returns false unless the bucket exists
+func (lifecyclehandler *LifecycleHandler) requireBucket(w http.ResponseWriter, r *http.Request, bucket string) bool {
+	bucketExists, err := lifecyclehandler.BucketManager.BucketNameExists(r.Context(), bucket)
+	if err != nil {
+		failLogAndResponse(w, r, "Could not verify existing bucket", http.StatusInternalServerError, err)
+		return false
+	}
+	if !bucketExists {
+		failLogAndResponse(w, r, "Error managing lifecycle rules", http.StatusUnprocessableEntity, errors.New("Bucket does not exist"))
+		return false
+	}
+	return true
+}
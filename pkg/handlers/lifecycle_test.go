@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testLifecycleManager struct {
+	lifecycles map[string]*s3.PathLifecycle
+}
+
+func (tlm *testLifecycleManager) SetPathLifecycle(ctx context.Context, bucket, path string, lifecycle *s3.PathLifecycle) error {
+	tlm.lifecycles[bucket+"/"+path] = lifecycle
+	return nil
+}
+
+func (tlm *testLifecycleManager) GetPathLifecycle(ctx context.Context, bucket, path string) (*s3.PathLifecycle, error) {
+	if lifecycle, found := tlm.lifecycles[bucket+"/"+path]; found {
+		return lifecycle, nil
+	}
+	return &s3.PathLifecycle{}, nil
+}
+
+func TestLifecycle(t *testing.T) {
+	serve := func(handler http.Handler, method, bucket, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, "http://localhost:8080/buckets/"+bucket+"/paths/appx/lifecycle", strings.NewReader(body))
+		request = mux.SetURLVars(request, map[string]string{"bucketname": bucket, "path": "appx"})
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("Should set and report the lifecycle rules of a path", func(t *testing.T) {
+		lifecycleManager := &testLifecycleManager{lifecycles: map[string]*s3.PathLifecycle{}}
+		auditor := &testAuditor{}
+		handler := &LifecycleHandler{BucketManager: testAppUserCreator{}, LifecycleManager: lifecycleManager, Auditor: auditor}
+
+		response := serve(handler, "PUT", validtestbucketname, `{"expireAfterDays":30}`)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, &s3.PathLifecycle{ExpireAfterDays: 30}, lifecycleManager.lifecycles[validtestbucketname+"/appx"])
+		assert.Equal(t, audit.OperationSetLifecycle, auditor.events[0].Operation)
+		assert.JSONEq(t, `{"expireAfterDays":30}`, serve(handler, "GET", validtestbucketname, "").Body.String())
+	})
+
+	t.Run("Should refuse negative days and unknown buckets", func(t *testing.T) {
+		handler := &LifecycleHandler{BucketManager: testAppUserCreator{}, LifecycleManager: &testLifecycleManager{lifecycles: map[string]*s3.PathLifecycle{}}, Auditor: &testAuditor{}}
+
+		assert.Equal(t, http.StatusBadRequest, serve(handler, "PUT", validtestbucketname, `{"expireAfterDays":-1}`).Code)
+		assert.Equal(t, http.StatusUnprocessableEntity, serve(handler, "PUT", "nosuchbucket", `{"expireAfterDays":1}`).Code)
+		assert.Equal(t, http.StatusUnprocessableEntity, serve(handler, "GET", "nosuchbucket", "").Code)
+	})
+}
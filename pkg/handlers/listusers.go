@@ -5,7 +5,8 @@ import (
 	"fmt"
 	"github.com/minio/minio/pkg/madmin"
 	"github.com/secure-io/sio-go"
-	"github.com/sirupsen/logrus"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"github.com/skatteetaten/fiona/pkg/s3"
 	"net/http"
 )
 
@@ -26,24 +27,28 @@ func NewListUsersHandler(admClient *madmin.AdminClient) *ListUsersHandler {
 // ServeHTTP handles the requests for ListUsersHandler
 func (listusers *ListUsersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
-	users, err := listusers.ListUsers()
+	var users map[string]madmin.UserInfo
+	err := s3.Instrument(r.Context(), "ListUsers", func() (err error) {
+		users, err = listusers.ListUsers()
+		return err
+	})
 	if err != nil {
 		message := "Error calling ListUsers on S3AdmClient"
 		if err == sio.NotAuthentic {
 			message += ". Decryption failed. Is the secret key incorrect?"
 		}
-		failLogAndResponse(w, message, http.StatusInternalServerError, err)
+		failLogAndResponse(w, r, message, http.StatusInternalServerError, err)
 		return
 	}
 
 	usersJSON, err := json.Marshal(users)
 	if err != nil {
-		failLogAndResponse(w, "Could not create json for users", http.StatusInternalServerError, err)
+		failLogAndResponse(w, r, "Could not create json for users", http.StatusInternalServerError, err)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	_, _ = fmt.Fprintf(w, "%s", usersJSON)
 
-	logrus.Info("StatusOK: listusers")
+	logging.FromContext(r.Context()).Info("StatusOK: listusers")
 }
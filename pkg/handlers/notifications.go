@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v6"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"net/http"
+)
+
+// NotificationInput provides input for notifying a target of events in a path
+type NotificationInput struct {
+	Events []string `json:"events"`
+	Suffix string   `json:"suffix,omitempty"`
+}
+
+// NotificationsHandler lists the notifications of a path on GET, and sets or deletes the notification to a target
+// on PUT and DELETE
+type NotificationsHandler struct {
+	BucketManager       s3.BucketManager
+	NotificationManager s3.NotificationManager
+	Auditor             audit.Logger
+}
+
+// NewNotificationsHandler is a factory for NotificationsHandler
+func NewNotificationsHandler(config *s3.Config, minioClient *minio.Client, auditor audit.Logger) *NotificationsHandler {
+	return &NotificationsHandler{
+		BucketManager:       s3.NewMinioBucketManager(config, minioClient),
+		NotificationManager: s3.NewMinioNotificationManager(config, minioClient),
+		Auditor:             auditor,
+	}
+}
+
+// ServeHTTP handles the requests for NotificationsHandler
+func (notifications *NotificationsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	bucket, path := params["bucketname"], params["path"]
+
+	bucketExists, err := notifications.BucketManager.BucketNameExists(r.Context(), bucket)
+	if err != nil {
+		failLogAndResponse(w, r, "Could not verify existing bucket", http.StatusInternalServerError, err)
+		return
+	}
+	if !bucketExists {
+		failLogAndResponse(w, r, "Error managing notifications", http.StatusUnprocessableEntity, errors.New("Bucket does not exist"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		notifications.set(w, r, bucket, path, params["target"])
+	case http.MethodDelete:
+		notifications.delete(w, r, bucket, path, params["target"])
+	default:
+		list, err := notifications.NotificationManager.ListPathNotifications(r.Context(), bucket, path)
+		if err != nil {
+			failLogAndResponse(w, r, "Error listing notifications", http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, list)
+	}
+}
+
+func (notifications *NotificationsHandler) set(w http.ResponseWriter, r *http.Request, bucket, path, target string) {
+	auditEvent := newAuditEvent(r, audit.OperationSetNotification)
+	auditEvent.Bucket, auditEvent.Path, auditEvent.Target = bucket, path, target
+
+	var input NotificationInput
+	body, err := readRequestBody(r.Body)
+	if err != nil {
+		failLogAndResponse(w, r, "Could not read request body", http.StatusBadRequest, err)
+		notifications.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	if err := json.Unmarshal(body, &input); err != nil {
+		failLogAndResponse(w, r, "Could not unmarshal body", http.StatusUnprocessableEntity, err)
+		notifications.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	notification := &s3.PathNotification{Target: target, Events: input.Events, Suffix: input.Suffix}
+	if err := s3.ValidatePathNotification(notification); err != nil {
+		failLogAndResponse(w, r, "Invalid notification", http.StatusBadRequest, err)
+		notifications.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+
+	err = notifications.NotificationManager.SetPathNotification(r.Context(), bucket, path, notification)
+	if err != nil {
+		var unknownTarget *s3.UnknownNotificationTargetError
+		if errors.As(err, &unknownTarget) {
+			failLogAndResponse(w, r, "Unknown notification target", http.StatusNotFound, err)
+		} else {
+			failLogAndResponse(w, r, "Error setting notification", http.StatusInternalServerError, err)
+		}
+		notifications.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	notifications.Auditor.Record(auditEvent.Succeeded())
+
+	writeJSON(w, r, http.StatusOK, notification)
+	logging.FromContext(r.Context()).Infof("StatusOK: notification of %s/%s to %s", bucket, path, target)
+}
+
+func (notifications *NotificationsHandler) delete(w http.ResponseWriter, r *http.Request, bucket, path, target string) {
+	auditEvent := newAuditEvent(r, audit.OperationDeleteNotification)
+	auditEvent.Bucket, auditEvent.Path, auditEvent.Target = bucket, path, target
+
+	deleted, err := notifications.NotificationManager.DeletePathNotification(r.Context(), bucket, path, target)
+	if err == nil && !deleted {
+		err = fmt.Errorf("no notification of %s/%s to %s", bucket, path, target)
+		failLogAndResponse(w, r, "Notification does not exist", http.StatusNotFound, err)
+		notifications.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	if err != nil {
+		failLogAndResponse(w, r, "Error deleting notification", http.StatusInternalServerError, err)
+		notifications.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	notifications.Auditor.Record(auditEvent.Succeeded())
+
+	w.WriteHeader(http.StatusNoContent)
+	logging.FromContext(r.Context()).Infof("StatusNoContent: deleted notification of %s/%s to %s", bucket, path, target)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testNotificationManager struct {
+	notifications map[string]s3.PathNotification
+}
+
+func (tnm *testNotificationManager) SetPathNotification(ctx context.Context, bucket, path string, notification *s3.PathNotification) error {
+	if notification.Target != "webhook" {
+		return &s3.UnknownNotificationTargetError{Target: notification.Target}
+	}
+	tnm.notifications[notification.Target] = *notification
+	return nil
+}
+
+func (tnm *testNotificationManager) ListPathNotifications(ctx context.Context, bucket, path string) ([]s3.PathNotification, error) {
+	var notifications []s3.PathNotification
+	for _, notification := range tnm.notifications {
+		notifications = append(notifications, notification)
+	}
+	return notifications, nil
+}
+
+func (tnm *testNotificationManager) DeletePathNotification(ctx context.Context, bucket, path, target string) (bool, error) {
+	_, found := tnm.notifications[target]
+	delete(tnm.notifications, target)
+	return found, nil
+}
+
+func TestNotifications(t *testing.T) {
+	serve := func(handler http.Handler, method, target, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, "http://localhost:8080/buckets/testbucketname/paths/appx/notifications/"+target, strings.NewReader(body))
+		request = mux.SetURLVars(request, map[string]string{"bucketname": validtestbucketname, "path": "appx", "target": target})
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("Should set, list and delete notifications of a path", func(t *testing.T) {
+		auditor := &testAuditor{}
+		handler := &NotificationsHandler{BucketManager: testAppUserCreator{}, NotificationManager: &testNotificationManager{notifications: map[string]s3.PathNotification{}}, Auditor: auditor}
+
+		assert.Equal(t, http.StatusOK, serve(handler, "PUT", "webhook", `{"events":["put"], "suffix":".csv"}`).Code)
+		assert.JSONEq(t, `[{"target":"webhook","events":["put"],"suffix":".csv"}]`, serve(handler, "GET", "", "").Body.String())
+		assert.Equal(t, http.StatusNoContent, serve(handler, "DELETE", "webhook", "").Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler, "DELETE", "webhook", "").Code)
+
+		assert.Equal(t, audit.OperationSetNotification, auditor.events[0].Operation)
+		assert.Equal(t, "webhook", auditor.events[0].Target)
+		assert.Equal(t, audit.OperationDeleteNotification, auditor.events[1].Operation)
+	})
+
+	t.Run("Should refuse unknown targets and events", func(t *testing.T) {
+		handler := &NotificationsHandler{BucketManager: testAppUserCreator{}, NotificationManager: &testNotificationManager{notifications: map[string]s3.PathNotification{}}, Auditor: &testAuditor{}}
+
+		assert.Equal(t, http.StatusNotFound, serve(handler, "PUT", "sms", `{"events":["put"]}`).Code)
+		assert.Equal(t, http.StatusBadRequest, serve(handler, "PUT", "webhook", `{"events":["get"]}`).Code)
+	})
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v6"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"net/http"
+	"time"
+)
+
+// PresignInput provides input for presigning a request for an object
+type PresignInput struct {
+	Key    string `json:"key"`              // Object key relative to the path
+	Method string `json:"method"`           // GET, PUT or DELETE
+	Expiry string `json:"expiry,omitempty"` // Duration like "15m" or "2h"
+}
+
+// PresignHandler issues presigned URLs for single objects in a path
+type PresignHandler struct {
+	BucketManager s3.BucketManager
+	Presigner     s3.Presigner
+	Auditor       audit.Logger
+}
+
+// NewPresignHandler is a factory for PresignHandler
+func NewPresignHandler(config *s3.Config, minioClient *minio.Client, auditor audit.Logger) *PresignHandler {
+	return &PresignHandler{
+		BucketManager: s3.NewMinioBucketManager(config, minioClient),
+		Presigner:     s3.NewMinioPresigner(minioClient),
+		Auditor:       auditor,
+	}
+}
+
+// ServeHTTP handles the requests for PresignHandler
+func (presign *PresignHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auditEvent := newAuditEvent(r, audit.OperationPresignURL)
+	params := mux.Vars(r)
+	auditEvent.Bucket = params["bucketname"]
+	auditEvent.Path = params["path"]
+
+	var input PresignInput
+	body, err := readRequestBody(r.Body)
+	if err != nil {
+		failLogAndResponse(w, r, "Could not read request body", http.StatusBadRequest, err)
+		presign.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	if err := json.Unmarshal(body, &input); err != nil {
+		failLogAndResponse(w, r, "Could not unmarshal body", http.StatusUnprocessableEntity, err)
+		presign.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	auditEvent.Object = input.Key
+
+	var requestedExpiry time.Duration
+	if input.Expiry != "" {
+		if requestedExpiry, err = time.ParseDuration(input.Expiry); err != nil {
+			failLogAndResponse(w, r, "Invalid expiry", http.StatusBadRequest, err)
+			presign.Auditor.Record(auditEvent.Failed(err))
+			return
+		}
+	}
+	method, err := s3.PresignMethod(input.Method)
+	if err == nil {
+		_, err = s3.PathObjectName(auditEvent.Path, input.Key)
+	}
+	if err == nil {
+		_, err = s3.PresignExpiry(requestedExpiry)
+	}
+	if err != nil {
+		failLogAndResponse(w, r, "Missing or invalid input to presign URL.", http.StatusBadRequest, err)
+		presign.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	auditEvent.Access = []string{method}
+
+	bucketExists, err := presign.BucketManager.BucketNameExists(r.Context(), auditEvent.Bucket)
+	if err != nil {
+		failLogAndResponse(w, r, "Error presigning URL. Could not verify existing bucket", http.StatusInternalServerError, err)
+		presign.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	if !bucketExists {
+		err = errors.New("Bucket does not exist")
+		failLogAndResponse(w, r, "Error presigning URL", http.StatusUnprocessableEntity, err)
+		presign.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+
+	presigned, err := presign.Presigner.PresignURL(r.Context(), &s3.PresignInput{
+		Bucketname: auditEvent.Bucket,
+		Path:       auditEvent.Path,
+		Key:        input.Key,
+		Method:     method,
+		Expiry:     requestedExpiry,
+	})
+	if err != nil {
+		failLogAndResponse(w, r, "Error presigning URL", http.StatusInternalServerError, err)
+		presign.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	// The URL is a credential on its own, so only the object is audited and logged
+	presign.Auditor.Record(auditEvent.Succeeded())
+
+	writeJSON(w, r, http.StatusCreated, presigned)
+	logging.FromContext(r.Context()).Infof("StatusCreated: presigned %s for %s/%s/%s expiring %s", method, auditEvent.Bucket, auditEvent.Path, input.Key, presigned.Expiration)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testPresigner struct {
+	input *s3.PresignInput
+}
+
+func (tp *testPresigner) PresignURL(ctx context.Context, input *s3.PresignInput) (*s3.PresignedURL, error) {
+	tp.input = input
+	return &s3.PresignedURL{URL: "https://minio.example.com/" + input.Bucketname + "/" + input.Path + "/" + input.Key + "?X-Amz-Signature=abc", Method: input.Method, Expiration: time.Now().Add(time.Hour)}, nil
+}
+
+func TestPresign(t *testing.T) {
+	presign := func(handler http.Handler, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("POST", "http://localhost:8080/buckets/testbucketname/paths/appx/presign", strings.NewReader(body))
+		request = mux.SetURLVars(request, map[string]string{"bucketname": validtestbucketname, "path": "appx"})
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("Should presign a URL for the object without auditing the URL", func(t *testing.T) {
+		presigner := &testPresigner{}
+		auditor := &testAuditor{}
+		handler := &PresignHandler{BucketManager: testAppUserCreator{}, Presigner: presigner, Auditor: auditor}
+
+		response := presign(handler, `{"key":"reports/2021.csv", "method":"get", "expiry":"1h"}`)
+
+		assert.Equal(t, http.StatusCreated, response.Code)
+		assert.Contains(t, response.Body.String(), `"url":"https://minio.example.com/`)
+		assert.Equal(t, &s3.PresignInput{Bucketname: validtestbucketname, Path: "appx", Key: "reports/2021.csv", Method: "GET", Expiry: time.Hour}, presigner.input)
+		assert.Equal(t, audit.OperationPresignURL, auditor.events[0].Operation)
+		assert.Equal(t, "reports/2021.csv", auditor.events[0].Object)
+		assert.Equal(t, audit.OutcomeSuccess, auditor.events[0].Outcome)
+	})
+
+	t.Run("Should refuse keys outside the path, unknown methods and invalid expiry", func(t *testing.T) {
+		presigner := &testPresigner{}
+		handler := &PresignHandler{BucketManager: testAppUserCreator{}, Presigner: presigner, Auditor: &testAuditor{}}
+
+		for _, body := range []string{`{"key":"../appy/a", "method":"GET"}`, `{"key":"/a", "method":"GET"}`, `{"method":"GET"}`, `{"key":"a", "method":"POST"}`, `{"key":"a", "method":"GET", "expiry":"30d"}`, `{"key":"a", "method":"GET", "expiry":"200h"}`} {
+			assert.Equal(t, http.StatusBadRequest, presign(handler, body).Code, body)
+		}
+		assert.Nil(t, presigner.input)
+	})
+}
@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, value interface{}) {
+	responseJSON, err := json.Marshal(value)
+	if err != nil {
+		failLogAndResponse(w, r, "Failed marshalling result for return, aborted", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, "%s", responseJSON)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/skatteetaten/fiona/pkg/encryption"
+	"github.com/skatteetaten/fiona/pkg/kubernetes"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"github.com/skatteetaten/fiona/pkg/vault"
+	"net/http"
+)
+
+// SecretSinks are the optional destinations app user credentials are written to instead of the response.
+// The secret key can also be returned encrypted with a public key from the caller.
+type SecretSinks struct {
+	Kubernetes kubernetes.SecretWriter
+	Vault      vault.SecretWriter
+}
+
+// validate checks that the sink requested in the input is enabled and correctly named
+func (sinks *SecretSinks) validate(input *s3.CreateAppUserInput) error {
+	requested := 0
+	for _, given := range []bool{input.KubernetesSecret != nil, input.Vault, input.PublicKey != ""} {
+		if given {
+			requested++
+		}
+	}
+	if requested > 1 {
+		return errors.New("only one of kubernetesSecret, vault and publicKey may be given")
+	}
+	if input.PublicKey != "" {
+		_, err := encryption.ParseRecipient(input.PublicKey)
+		return err
+	}
+	if input.Vault && sinks.Vault == nil {
+		return errors.New("Vault delivery is not enabled")
+	}
+	if input.KubernetesSecret == nil {
+		return nil
+	}
+	if sinks.Kubernetes == nil {
+		return errors.New("Kubernetes secret delivery is not enabled")
+	}
+	return input.KubernetesSecret.Validate()
+}
+
+// check asks the sink requested in the input whether the credentials may be written, before the user is created
+func (sinks *SecretSinks) check(ctx context.Context, input *s3.CreateAppUserInput) error {
+	if input.KubernetesSecret == nil {
+		return nil
+	}
+	return sinks.Kubernetes.CheckSecret(ctx, *input.KubernetesSecret)
+}
+
+// secretSinkStatus returns the status for a secret the sink refuses to write, or fallback for other errors
+func secretSinkStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, kubernetes.ErrNamespaceNotAllowed):
+		return http.StatusForbidden
+	case errors.Is(err, kubernetes.ErrSecretNotManaged):
+		return http.StatusConflict
+	}
+	return fallback
+}
+
+// deliver writes the credentials to the sink requested in the input, and removes the secret key from the result.
+// It returns a description of the sink for the audit log, or "" when the credentials are returned in the response.
+// The cluster is only used to render the Vault path.
+func (sinks *SecretSinks) deliver(ctx context.Context, cluster string, input *s3.CreateAppUserInput, result *s3.CreateAppUserResult) (string, error) {
+	data := map[string]string{
+		"accessKey": result.AccessKey,
+		"secretKey": result.SecretKey,
+		"host":      result.HostURL,
+		"bucket":    input.Bucketname,
+		"path":      input.Path,
+	}
+	switch {
+	case input.KubernetesSecret != nil:
+		if err := sinks.Kubernetes.WriteSecret(ctx, *input.KubernetesSecret, data); err != nil {
+			return "", err
+		}
+		result.SecretKey = ""
+		result.KubernetesSecret = input.KubernetesSecret
+		return "kubernetes:" + input.KubernetesSecret.String(), nil
+	case input.Vault:
+		params := vault.PathParams{Cluster: cluster, Bucket: input.Bucketname, Path: input.Path, Username: input.Username}
+		path, err := sinks.Vault.WriteSecret(ctx, params, data)
+		if err != nil {
+			return "", err
+		}
+		*result = s3.CreateAppUserResult{VaultPath: path, PolicyName: result.PolicyName}
+		return "vault:" + path, nil
+	case input.PublicKey != "":
+		recipient, err := encryption.ParseRecipient(input.PublicKey)
+		if err != nil {
+			return "", err
+		}
+		encrypted, err := recipient.Encrypt([]byte(result.SecretKey))
+		if err != nil {
+			return "", err
+		}
+		result.SecretKey = encrypted
+		result.SecretKeyScheme = recipient.Scheme()
+		return "encrypted:" + recipient.Scheme(), nil
+	}
+	return "", nil
+}
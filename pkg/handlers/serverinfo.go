@@ -4,7 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/minio/minio/pkg/madmin"
-	"github.com/sirupsen/logrus"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"github.com/skatteetaten/fiona/pkg/s3"
 	"net/http"
 )
 
@@ -25,20 +26,24 @@ func NewServerInfoHandler(admClient *madmin.AdminClient) *ServerInfoHandler {
 // ServeHTTP handles the requests for ServerInfoHandler
 func (serverinfo *ServerInfoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
-	infoMessage, err := serverinfo.ServerInfo()
+	var infoMessage madmin.InfoMessage
+	err := s3.Instrument(r.Context(), "ServerInfo", func() (err error) {
+		infoMessage, err = serverinfo.ServerInfo()
+		return err
+	})
 	if err != nil {
-		failLogAndResponse(w, "Error calling ServerInfo on S3AdmClient", http.StatusNoContent, err)
+		failLogAndResponse(w, r, "Error calling ServerInfo on S3AdmClient", http.StatusNoContent, err)
 		return
 	}
 
 	infoJSON, err := json.Marshal(infoMessage)
 	if err != nil {
-		failLogAndResponse(w, "Unable to parse server info", http.StatusInternalServerError, err)
+		failLogAndResponse(w, r, "Unable to parse server info", http.StatusInternalServerError, err)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	_, _ = fmt.Fprintf(w, "%s", infoJSON)
 
-	logrus.Info("StatusOK: serverinfo")
+	logging.FromContext(r.Context()).Info("StatusOK: serverinfo")
 }
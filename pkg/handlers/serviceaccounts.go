@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/minio/minio/pkg/madmin"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"net/http"
+)
+
+// CreateServiceAccountInput provides input for creating a service account
+type CreateServiceAccountInput struct {
+	// Policy is an optional session policy narrowing the access of the app user
+	Policy json.RawMessage `json:"policy,omitempty"`
+}
+
+// ServiceAccountResult provides the credentials of a new service account
+type ServiceAccountResult struct {
+	AccessKey  string `json:"accessKey"`
+	SecretKey  string `json:"secretKey"`
+	HostURL    string `json:"host"`
+	ParentUser string `json:"parentUser"`
+}
+
+// ServiceAccountsHandler creates, lists and deletes the service accounts of an app user
+type ServiceAccountsHandler struct {
+	ServiceAccountManager s3.ServiceAccountManager
+	Auditor               audit.Logger
+	HostURL               string
+}
+
+// NewServiceAccountsHandler is a factory for ServiceAccountsHandler
+func NewServiceAccountsHandler(config *s3.Config, adminClient *madmin.AdminClient, adminAPI *s3.AdminAPI, auditor audit.Logger) *ServiceAccountsHandler {
+	return &ServiceAccountsHandler{
+		ServiceAccountManager: s3.NewMinioServiceAccountManager(adminClient, adminAPI),
+		Auditor:               auditor,
+		HostURL:               config.ServiceEndpoint(),
+	}
+}
+
+// ServeHTTP handles the requests for ServiceAccountsHandler. POST creates, GET lists and DELETE deletes.
+func (serviceaccounts *ServiceAccountsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var auditEvent *audit.Event
+	switch r.Method {
+	case http.MethodPost:
+		auditEvent = serviceaccounts.newAuditEvent(r, audit.OperationCreateServiceAccount)
+	case http.MethodDelete:
+		auditEvent = serviceaccounts.newAuditEvent(r, audit.OperationDeleteServiceAccount)
+		auditEvent.ServiceAccount = mux.Vars(r)["accesskey"]
+	}
+
+	if err := serviceaccounts.requireAppUser(w, r); err != nil {
+		if auditEvent != nil {
+			serviceaccounts.Auditor.Record(auditEvent.Failed(err))
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		serviceaccounts.create(w, r, auditEvent)
+	case http.MethodDelete:
+		serviceaccounts.delete(w, r, auditEvent)
+	default:
+		serviceaccounts.list(w, r)
+	}
+}
+
+// requireAppUser responds with an error unless the user in the route is an app user with access to the path
+func (serviceaccounts *ServiceAccountsHandler) requireAppUser(w http.ResponseWriter, r *http.Request) error {
+	params := mux.Vars(r)
+	bucket, path, username := params["bucketname"], params["path"], params["username"]
+	hasAccess, err := serviceaccounts.ServiceAccountManager.HasPathAccess(r.Context(), username, bucket, path)
+	if err != nil {
+		failLogAndResponse(w, r, "Error looking up app user", http.StatusInternalServerError, err)
+		return err
+	}
+	if !hasAccess {
+		err = fmt.Errorf("user %s has no access to %s/%s", username, bucket, path)
+		failLogAndResponse(w, r, "Unknown app user for path", http.StatusNotFound, err)
+		return err
+	}
+	return nil
+}
+
+func (serviceaccounts *ServiceAccountsHandler) create(w http.ResponseWriter, r *http.Request, auditEvent *audit.Event) {
+	var input CreateServiceAccountInput
+	body, err := readRequestBody(r.Body)
+	if err != nil {
+		failLogAndResponse(w, r, "Could not read request body", http.StatusBadRequest, err)
+		serviceaccounts.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &input); err != nil {
+			failLogAndResponse(w, r, "Could not unmarshal body", http.StatusUnprocessableEntity, err)
+			serviceaccounts.Auditor.Record(auditEvent.Failed(err))
+			return
+		}
+	}
+	if len(input.Policy) > 0 {
+		if err := s3.ValidateSessionPolicy(input.Policy); err != nil {
+			failLogAndResponse(w, r, "Invalid session policy", http.StatusBadRequest, err)
+			serviceaccounts.Auditor.Record(auditEvent.Failed(err))
+			return
+		}
+	}
+
+	serviceAccount, err := serviceaccounts.ServiceAccountManager.CreateServiceAccount(r.Context(), auditEvent.Username, input.Policy)
+	if err != nil {
+		failLogAndResponse(w, r, "Error creating service account", http.StatusInternalServerError, err)
+		serviceaccounts.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	auditEvent.ServiceAccount = serviceAccount.AccessKey
+	serviceaccounts.Auditor.Record(auditEvent.Succeeded())
+
+	writeJSON(w, r, http.StatusCreated, ServiceAccountResult{
+		AccessKey:  serviceAccount.AccessKey,
+		SecretKey:  serviceAccount.SecretKey,
+		HostURL:    serviceaccounts.HostURL,
+		ParentUser: auditEvent.Username,
+	})
+	logging.FromContext(r.Context()).Infof("StatusCreated: service account %s for %s", serviceAccount.AccessKey, auditEvent.Username)
+}
+
+func (serviceaccounts *ServiceAccountsHandler) list(w http.ResponseWriter, r *http.Request) {
+	accessKeys, err := serviceaccounts.ServiceAccountManager.ListServiceAccounts(r.Context(), mux.Vars(r)["username"])
+	if err != nil {
+		failLogAndResponse(w, r, "Error listing service accounts", http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, map[string][]string{"serviceAccounts": accessKeys})
+}
+
+func (serviceaccounts *ServiceAccountsHandler) delete(w http.ResponseWriter, r *http.Request, auditEvent *audit.Event) {
+	// Only service accounts of the app user in the route may be deleted
+	accessKeys, err := serviceaccounts.ServiceAccountManager.ListServiceAccounts(r.Context(), auditEvent.Username)
+	if err != nil {
+		failLogAndResponse(w, r, "Error deleting service account", http.StatusInternalServerError, err)
+		serviceaccounts.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	if !contains(accessKeys, auditEvent.ServiceAccount) {
+		err = errors.New("no such service account for the app user")
+		failLogAndResponse(w, r, "Unknown service account", http.StatusNotFound, err)
+		serviceaccounts.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	if err := serviceaccounts.ServiceAccountManager.DeleteServiceAccount(r.Context(), auditEvent.ServiceAccount); err != nil {
+		failLogAndResponse(w, r, "Error deleting service account", http.StatusInternalServerError, err)
+		serviceaccounts.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	serviceaccounts.Auditor.Record(auditEvent.Succeeded())
+
+	w.WriteHeader(http.StatusNoContent)
+	logging.FromContext(r.Context()).Infof("StatusNoContent: deleted service account %s", auditEvent.ServiceAccount)
+}
+
+func (serviceaccounts *ServiceAccountsHandler) newAuditEvent(r *http.Request, operation string) *audit.Event {
+	auditEvent := newAuditEvent(r, operation)
+	params := mux.Vars(r)
+	auditEvent.Bucket = params["bucketname"]
+	auditEvent.Path = params["path"]
+	auditEvent.Username = params["username"]
+	return &auditEvent
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
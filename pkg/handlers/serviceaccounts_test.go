@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testServiceAccountManager struct {
+	accounts map[string][]string
+	policy   json.RawMessage
+}
+
+func (tsam *testServiceAccountManager) HasPathAccess(ctx context.Context, username, bucket, path string) (bool, error) {
+	return username == "appxuser" && bucket == "utv" && path == "appx", nil
+}
+func (tsam *testServiceAccountManager) CreateServiceAccount(ctx context.Context, parentUser string, policy json.RawMessage) (*s3.ServiceAccount, error) {
+	tsam.policy = policy
+	tsam.accounts[parentUser] = append(tsam.accounts[parentUser], "SVCACCOUNT1")
+	return &s3.ServiceAccount{AccessKey: "SVCACCOUNT1", SecretKey: "s3cret"}, nil
+}
+func (tsam *testServiceAccountManager) ListServiceAccounts(ctx context.Context, parentUser string) ([]string, error) {
+	return append([]string{}, tsam.accounts[parentUser]...), nil
+}
+func (tsam *testServiceAccountManager) DeleteServiceAccount(ctx context.Context, accessKey string) error {
+	for user, accessKeys := range tsam.accounts {
+		for i, key := range accessKeys {
+			if key == accessKey {
+				tsam.accounts[user] = append(accessKeys[:i], accessKeys[i+1:]...)
+			}
+		}
+	}
+	return nil
+}
+
+func TestServiceAccounts(t *testing.T) {
+	serve := func(handler http.Handler, method, username, accessKey, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, "http://localhost:8080/buckets/utv/paths/appx/userpolicies/"+username+"/serviceaccounts", strings.NewReader(body))
+		request = mux.SetURLVars(request, map[string]string{"bucketname": "utv", "path": "appx", "username": username, "accesskey": accessKey})
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("Should create service accounts with an optional session policy", func(t *testing.T) {
+		manager := &testServiceAccountManager{accounts: map[string][]string{}}
+		auditor := &testAuditor{}
+		handler := &ServiceAccountsHandler{ServiceAccountManager: manager, Auditor: auditor, HostURL: "http://minio:9000"}
+
+		response := serve(handler, "POST", "appxuser", "", `{"policy":{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:GetObject"],"Resource":["arn:aws:s3:::utv/appx/*"]}]}}`)
+
+		assert.Equal(t, http.StatusCreated, response.Code)
+		assert.JSONEq(t, `{"accessKey":"SVCACCOUNT1","secretKey":"s3cret","host":"http://minio:9000","parentUser":"appxuser"}`, response.Body.String())
+		assert.Contains(t, string(manager.policy), "s3:GetObject")
+		assert.Equal(t, audit.OperationCreateServiceAccount, auditor.events[0].Operation)
+		assert.Equal(t, "SVCACCOUNT1", auditor.events[0].ServiceAccount)
+		assert.NotContains(t, auditor.events[0].Error, "s3cret")
+
+		assert.Equal(t, http.StatusCreated, serve(handler, "POST", "appxuser", "", "").Code)
+		assert.Nil(t, manager.policy)
+		assert.Equal(t, http.StatusBadRequest, serve(handler, "POST", "appxuser", "", `{"policy":{"Version":"2012-10-17"}}`).Code)
+	})
+
+	t.Run("Should only manage service accounts of app users with access to the path", func(t *testing.T) {
+		manager := &testServiceAccountManager{accounts: map[string][]string{"appyuser": {"SVCACCOUNT2"}}}
+		auditor := &testAuditor{}
+		handler := &ServiceAccountsHandler{ServiceAccountManager: manager, Auditor: auditor}
+
+		assert.Equal(t, http.StatusNotFound, serve(handler, "POST", "appyuser", "", "").Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler, "GET", "appyuser", "", "").Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler, "DELETE", "appxuser", "SVCACCOUNT2", "").Code)
+		assert.Equal(t, []string{"SVCACCOUNT2"}, manager.accounts["appyuser"])
+		assert.Equal(t, audit.OutcomeFailure, auditor.events[0].Outcome)
+	})
+
+	t.Run("Should list and delete service accounts", func(t *testing.T) {
+		manager := &testServiceAccountManager{accounts: map[string][]string{"appxuser": {"SVCACCOUNT1"}}}
+		handler := &ServiceAccountsHandler{ServiceAccountManager: manager, Auditor: &testAuditor{}}
+
+		response := serve(handler, "GET", "appxuser", "", "")
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.JSONEq(t, `{"serviceAccounts":["SVCACCOUNT1"]}`, response.Body.String())
+
+		assert.Equal(t, http.StatusNoContent, serve(handler, "DELETE", "appxuser", "SVCACCOUNT1", "").Code)
+		assert.Empty(t, manager.accounts["appxuser"])
+	})
+}
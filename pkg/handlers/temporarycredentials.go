@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v6"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"net/http"
+	"time"
+)
+
+// TemporaryCredentialsInput provides input for issuing temporary credentials
+type TemporaryCredentialsInput struct {
+	Access []string `json:"access"`
+	TTL    string   `json:"ttl,omitempty"` // Duration like "15m" or "2h"
+}
+
+// TemporaryCredentialsHandler issues short-lived credentials for a path
+type TemporaryCredentialsHandler struct {
+	BucketManager    s3.BucketManager
+	CredentialIssuer s3.CredentialIssuer // Nil when temporary credentials are not enabled for the cluster
+	STSConfig        s3.STSConfig
+	Auditor          audit.Logger
+}
+
+// NewTemporaryCredentialsHandler is a factory for TemporaryCredentialsHandler
+func NewTemporaryCredentialsHandler(config *s3.Config, minioClient *minio.Client, auditor audit.Logger) (*TemporaryCredentialsHandler, error) {
+	handler := &TemporaryCredentialsHandler{
+		BucketManager: s3.NewMinioBucketManager(config, minioClient),
+		STSConfig:     config.STS,
+		Auditor:       auditor,
+	}
+	if config.STS.Enabled() {
+		credentialIssuer, err := s3.NewMinioCredentialIssuer(config)
+		if err != nil {
+			return nil, err
+		}
+		handler.CredentialIssuer = credentialIssuer
+	}
+	return handler, nil
+}
+
+// ServeHTTP handles the requests for TemporaryCredentialsHandler
+func (tempcredentials *TemporaryCredentialsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auditEvent := newAuditEvent(r, audit.OperationCreateTemporaryCredentials)
+	params := mux.Vars(r)
+	auditEvent.Bucket = params["bucketname"]
+	auditEvent.Path = params["path"]
+
+	if tempcredentials.CredentialIssuer == nil {
+		err := errors.New("no STS user is configured for the cluster")
+		failLogAndResponse(w, r, "Temporary credentials are not enabled", http.StatusNotImplemented, err)
+		tempcredentials.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+
+	var input TemporaryCredentialsInput
+	body, err := readRequestBody(r.Body)
+	if err != nil {
+		failLogAndResponse(w, r, "Could not read request body", http.StatusBadRequest, err)
+		tempcredentials.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	if err := json.Unmarshal(body, &input); err != nil {
+		failLogAndResponse(w, r, "Could not unmarshal body", http.StatusUnprocessableEntity, err)
+		tempcredentials.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	auditEvent.Access = input.Access
+
+	var requestedTTL time.Duration
+	if input.TTL != "" {
+		if requestedTTL, err = time.ParseDuration(input.TTL); err != nil {
+			failLogAndResponse(w, r, "Invalid ttl", http.StatusBadRequest, err)
+			tempcredentials.Auditor.Record(auditEvent.Failed(err))
+			return
+		}
+	}
+	ttl, err := tempcredentials.STSConfig.TTL(requestedTTL)
+	if err == nil && len(input.Access) == 0 {
+		err = errors.New("access must be given")
+	}
+	if err != nil {
+		failLogAndResponse(w, r, "Missing or invalid input to issue credentials.", http.StatusBadRequest, err)
+		tempcredentials.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+
+	bucketExists, err := tempcredentials.BucketManager.BucketNameExists(r.Context(), auditEvent.Bucket)
+	if err != nil {
+		failLogAndResponse(w, r, "Error issuing credentials. Could not verify existing bucket", http.StatusInternalServerError, err)
+		tempcredentials.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	if !bucketExists {
+		err = errors.New("Bucket does not exist")
+		failLogAndResponse(w, r, "Error issuing credentials", http.StatusUnprocessableEntity, err)
+		tempcredentials.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+
+	credentials, err := tempcredentials.CredentialIssuer.AssumeRole(r.Context(), &s3.TemporaryCredentialsInput{
+		Bucketname: auditEvent.Bucket,
+		Path:       auditEvent.Path,
+		Access:     input.Access,
+		TTL:        ttl,
+	})
+	if err != nil {
+		failLogAndResponse(w, r, "Error issuing credentials", http.StatusBadGateway, err)
+		tempcredentials.Auditor.Record(auditEvent.Failed(err))
+		return
+	}
+	tempcredentials.Auditor.Record(auditEvent.Succeeded())
+
+	writeJSON(w, r, http.StatusCreated, credentials)
+	logging.FromContext(r.Context()).Infof("StatusCreated: temporary credentials for %s/%s expiring %s", auditEvent.Bucket, auditEvent.Path, credentials.Expiration)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testCredentialIssuer struct {
+	input *s3.TemporaryCredentialsInput
+}
+
+func (tci *testCredentialIssuer) AssumeRole(ctx context.Context, input *s3.TemporaryCredentialsInput) (*s3.TemporaryCredentials, error) {
+	tci.input = input
+	return &s3.TemporaryCredentials{AccessKey: "TEMPACCESSKEY", SecretKey: "s3cret", SessionToken: "sessiontoken", Expiration: time.Now().Add(input.TTL)}, nil
+}
+
+func TestTemporaryCredentials(t *testing.T) {
+	stsConfig := s3.STSConfig{AccessKey: "fiona-sts", SecretKey: "s3cret", DefaultTTL: time.Hour, MaxTTL: 12 * time.Hour}
+	issue := func(handler http.Handler, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("POST", "http://localhost:8080/buckets/testbucketname/paths/appx/credentials", strings.NewReader(body))
+		request = mux.SetURLVars(request, map[string]string{"bucketname": validtestbucketname, "path": "appx"})
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("Should issue credentials for the path with the requested ttl", func(t *testing.T) {
+		issuer := &testCredentialIssuer{}
+		auditor := &testAuditor{}
+		handler := &TemporaryCredentialsHandler{BucketManager: testAppUserCreator{}, CredentialIssuer: issuer, STSConfig: stsConfig, Auditor: auditor}
+
+		response := issue(handler, `{"access":["READ"], "ttl":"15m"}`)
+
+		assert.Equal(t, http.StatusCreated, response.Code)
+		assert.Contains(t, response.Body.String(), `"sessionToken":"sessiontoken"`)
+		assert.Equal(t, &s3.TemporaryCredentialsInput{Bucketname: validtestbucketname, Path: "appx", Access: []string{"READ"}, TTL: 15 * time.Minute}, issuer.input)
+		assert.Equal(t, audit.OperationCreateTemporaryCredentials, auditor.events[0].Operation)
+		assert.Equal(t, audit.OutcomeSuccess, auditor.events[0].Outcome)
+
+		assert.Equal(t, http.StatusCreated, issue(handler, `{"access":["READ", "WRITE"]}`).Code)
+		assert.Equal(t, time.Hour, issuer.input.TTL)
+	})
+
+	t.Run("Should refuse invalid ttl and missing access", func(t *testing.T) {
+		handler := &TemporaryCredentialsHandler{BucketManager: testAppUserCreator{}, CredentialIssuer: &testCredentialIssuer{}, STSConfig: stsConfig, Auditor: &testAuditor{}}
+
+		for _, body := range []string{`{"access":["READ"], "ttl":"1m"}`, `{"access":["READ"], "ttl":"48h"}`, `{"access":["READ"], "ttl":"soon"}`, `{"ttl":"1h"}`} {
+			assert.Equal(t, http.StatusBadRequest, issue(handler, body).Code, body)
+		}
+	})
+
+	t.Run("Should tell when temporary credentials are not enabled", func(t *testing.T) {
+		handler := &TemporaryCredentialsHandler{BucketManager: testAppUserCreator{}, Auditor: &testAuditor{}}
+
+		assert.Equal(t, http.StatusNotImplemented, issue(handler, `{"access":["READ"]}`).Code)
+	})
+}
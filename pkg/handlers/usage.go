@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v6"
+	"github.com/skatteetaten/fiona/pkg/jobs"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"net/http"
+)
+
+// JobScanUsage is the kind of the jobs scanning the usage of a path
+const JobScanUsage = "scan-usage"
+
+// scanUsageParams are the params of a usage scan job
+type scanUsageParams struct {
+	Bucket string `json:"bucket"`
+	Path   string `json:"path"`
+}
+
+// UsageHandler reports the storage used by a path and its quota on GET, and submits a job scanning it on POST
+type UsageHandler struct {
+	BucketManager s3.BucketManager
+	UsageReporter s3.UsageReporter
+	Jobs          *jobs.Manager
+}
+
+// NewUsageHandler is a factory for UsageHandler, registering it as the runner of usage scan jobs
+func NewUsageHandler(config *s3.Config, minioClient *minio.Client, usageReporter s3.UsageReporter, jobManager *jobs.Manager) *UsageHandler {
+	handler := &UsageHandler{
+		BucketManager: s3.NewMinioBucketManager(config, minioClient),
+		UsageReporter: usageReporter,
+		Jobs:          jobManager,
+	}
+	jobManager.Register(JobScanUsage, handler.run)
+	return handler
+}
+
+// ServeHTTP handles the requests for UsageHandler
+func (usagehandler *UsageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	bucket, path := params["bucketname"], params["path"]
+
+	bucketExists, err := usagehandler.BucketManager.BucketNameExists(r.Context(), bucket)
+	if err != nil {
+		failLogAndResponse(w, r, "Error reporting usage. Could not verify existing bucket", http.StatusInternalServerError, err)
+		return
+	}
+	if !bucketExists {
+		failLogAndResponse(w, r, "Error reporting usage", http.StatusUnprocessableEntity, errors.New("Bucket does not exist"))
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		usagehandler.submitScan(w, r, bucket, path)
+		return
+	}
+
+	usage, err := usagehandler.UsageReporter.Usage(r.Context(), bucket, path)
+	if err == s3.ErrUsageNotScanned {
+		// Listing a path can take long, so it is never done while the request waits
+		usagehandler.submitScan(w, r, bucket, path)
+		return
+	}
+	if err != nil {
+		failLogAndResponse(w, r, "Error reporting usage", http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, usage)
+}
+
+func (usagehandler *UsageHandler) submitScan(w http.ResponseWriter, r *http.Request, bucket, path string) {
+	job, err := usagehandler.Jobs.Submit(r.Context(), JobScanUsage, scanUsageParams{Bucket: bucket, Path: path})
+	if err != nil {
+		failLogAndResponse(w, r, "Error scanning usage. Could not submit job", http.StatusInternalServerError, err)
+		return
+	}
+	writeJobAccepted(w, r, job)
+	logging.FromContext(r.Context()).Infof("StatusAccepted: usage scan job %s for %s/%s", job.ID, bucket, path)
+}
+
+// run scans the path of a job, reporting the usage found as its progress
+func (usagehandler *UsageHandler) run(ctx context.Context, job *jobs.Job, report func(progress interface{})) error {
+	var params scanUsageParams
+	if err := json.Unmarshal(job.Params, &params); err != nil {
+		return err
+	}
+	usage, err := usagehandler.UsageReporter.Scan(ctx, params.Bucket, params.Path)
+	if err != nil {
+		return err
+	}
+	report(usage)
+	return nil
+}
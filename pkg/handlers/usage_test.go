@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/skatteetaten/fiona/pkg/jobs"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testUsageReporter struct{}
+
+func (tur testUsageReporter) Usage(ctx context.Context, bucket, path string) (*s3.PathUsage, error) {
+	if path == "unscanned" {
+		return nil, s3.ErrUsageNotScanned
+	}
+	return &s3.PathUsage{Bucket: bucket, Path: path, Bytes: 1100, Objects: 2, QuotaBytes: 1000, Exceeded: true}, nil
+}
+
+func (tur testUsageReporter) Scan(ctx context.Context, bucket, path string) (*s3.PathUsage, error) {
+	return &s3.PathUsage{Bucket: bucket, Path: path, Bytes: 1200, Objects: 3, QuotaBytes: 1000, Exceeded: true}, nil
+}
+
+type testQuotaRegistry struct {
+	quotas map[string]*s3.PathQuota
+}
+
+func (tqr *testQuotaRegistry) UpdateQuota(ctx context.Context, bucket, path string, update func(quota *s3.PathQuota)) error {
+	quota, found := tqr.quotas[bucket+"/"+path]
+	if !found {
+		quota = &s3.PathQuota{Bucket: bucket, Path: path}
+		tqr.quotas[bucket+"/"+path] = quota
+	}
+	update(quota)
+	return nil
+}
+
+func (tqr *testQuotaRegistry) GetQuota(ctx context.Context, bucket, path string) (*s3.PathQuota, error) {
+	return tqr.quotas[bucket+"/"+path], nil
+}
+
+func (tqr *testQuotaRegistry) ListQuotas(ctx context.Context) ([]*s3.PathQuota, error) {
+	return nil, nil
+}
+
+func TestUsage(t *testing.T) {
+	usage := func(bucket string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("GET", "http://localhost:8080/buckets/testbucketname/paths/appx/usage", nil)
+		request = mux.SetURLVars(request, map[string]string{"bucketname": bucket, "path": "appx"})
+		response := httptest.NewRecorder()
+		handler := &UsageHandler{BucketManager: testAppUserCreator{}, UsageReporter: testUsageReporter{}}
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("Should report usage and quota of the path", func(t *testing.T) {
+		response := usage(validtestbucketname)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Contains(t, response.Body.String(), `"bytes":1100`)
+		assert.Contains(t, response.Body.String(), `"quotaBytes":1000`)
+		assert.Contains(t, response.Body.String(), `"exceeded":true`)
+	})
+
+	t.Run("Should refuse unknown buckets", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnprocessableEntity, usage("nosuchbucket").Code)
+	})
+
+	t.Run("Should scan the usage of a path not scanned yet in a job", func(t *testing.T) {
+		manager := runTestJobs(t)
+		handler := &UsageHandler{BucketManager: testAppUserCreator{}, UsageReporter: testUsageReporter{}, Jobs: manager}
+		manager.Register(JobScanUsage, handler.run)
+		request, _ := http.NewRequest("GET", "http://localhost:8080/buckets/testbucketname/paths/unscanned/usage", nil)
+		request = mux.SetURLVars(request, map[string]string{"bucketname": validtestbucketname, "path": "unscanned"})
+		response := httptest.NewRecorder()
+
+		handler.ServeHTTP(response, request)
+
+		assert.Equal(t, http.StatusAccepted, response.Code)
+		var accepted jobs.Job
+		assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &accepted))
+		assert.Equal(t, JobScanUsage, accepted.Kind)
+	})
+
+	t.Run("Should scan usage in a job", func(t *testing.T) {
+		manager := runTestJobs(t)
+		handler := &UsageHandler{BucketManager: testAppUserCreator{}, UsageReporter: testUsageReporter{}, Jobs: manager}
+		manager.Register(JobScanUsage, handler.run)
+		request, _ := http.NewRequest("POST", "http://localhost:8080/clusters/archive/buckets/testbucketname/paths/appx/usage", nil)
+		request = mux.SetURLVars(request, map[string]string{"cluster": "archive", "bucketname": validtestbucketname, "path": "appx"})
+		response := httptest.NewRecorder()
+
+		handler.ServeHTTP(response, request)
+
+		assert.Equal(t, http.StatusAccepted, response.Code)
+		var accepted jobs.Job
+		assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &accepted))
+		assert.Equal(t, "/clusters/archive/jobs/"+accepted.ID, response.Header().Get("Location"))
+		assert.Eventually(t, func() bool {
+			job, _ := manager.Get(accepted.ID)
+			return job.State == jobs.StateSucceeded && strings.Contains(string(job.Progress), `"bytes":1200`)
+		}, time.Second, 5*time.Millisecond)
+	})
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"github.com/skatteetaten/fiona/pkg/audit"
 	"github.com/skatteetaten/fiona/pkg/config"
 	"github.com/skatteetaten/fiona/pkg/s3"
 )
@@ -11,6 +12,14 @@ func isJSON(s string) bool {
 	return json.Unmarshal([]byte(s), &js) == nil
 }
 
+type testAuditor struct {
+	events []audit.Event
+}
+
+func (ta *testAuditor) Record(event audit.Event) {
+	ta.events = append(ta.events, event)
+}
+
 func getTestAppConfig() *config.Config {
 	return &config.Config{
 		S3Config: s3.Config{
@@ -0,0 +1,220 @@
+package inventory
+
+import (
+	"context"
+	"github.com/minio/minio-go/v6"
+	"github.com/minio/minio/pkg/madmin"
+	"github.com/skatteetaten/fiona/pkg/s3"
+	"sort"
+	"strings"
+)
+
+// accessLetters maps the letters ending the names of policies and groups to the access they grant
+var accessLetters = map[string]string{"r": "READ", "w": "WRITE", "d": "DELETE"}
+
+// Discoverer finds the resources Fiona has provisioned in a cluster
+type Discoverer interface {
+	Discover(ctx context.Context) ([]*Resource, error)
+}
+
+type discoverAdminClient interface {
+	ListUsers() (map[string]madmin.UserInfo, error)
+	ListGroups() ([]string, error)
+}
+
+type bucketLister interface {
+	ListBucketsWithContext(ctx context.Context) ([]minio.BucketInfo, error)
+}
+
+// MinioDiscoverer finds resources by the names Fiona gives app user policies and access groups in minio
+type MinioDiscoverer struct {
+	cluster string
+	admin   discoverAdminClient
+	buckets bucketLister
+}
+
+// NewMinioDiscoverer is a factory for MinioDiscoverer
+func NewMinioDiscoverer(cluster string, minioClient *minio.Client, adminClient *madmin.AdminClient) *MinioDiscoverer {
+	return &MinioDiscoverer{cluster: cluster, admin: adminClient, buckets: minioClient}
+}
+
+// Discover returns every bucket, and the users, policies, groups and paths named like Fiona names them. Users with
+// neither an app user policy nor an access group are not managed by Fiona, and are left out.
+func (discoverer *MinioDiscoverer) Discover(ctx context.Context) ([]*Resource, error) {
+	var bucketInfos []minio.BucketInfo
+	err := s3.Instrument(ctx, "ListBuckets", func() (err error) {
+		bucketInfos, err = discoverer.buckets.ListBucketsWithContext(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var groups []string
+	err = s3.Instrument(ctx, "ListGroups", func() (err error) {
+		groups, err = discoverer.admin.ListGroups()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var users map[string]madmin.UserInfo
+	err = s3.Instrument(ctx, "ListUsers", func() (err error) {
+		users, err = discoverer.admin.ListUsers()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[string]*Resource{}
+	add := func(resource *Resource) {
+		resource.Cluster = discoverer.cluster
+		found[resource.key()] = resource
+	}
+	var buckets []string
+	for _, bucketInfo := range bucketInfos {
+		buckets = append(buckets, bucketInfo.Name)
+		add(&Resource{Kind: KindBucket, Name: bucketInfo.Name})
+	}
+	addAccess := func(kind, name, bucket, path string, access []string) {
+		add(&Resource{Kind: kind, Name: name, Bucket: bucket, Path: path, Access: access, Policy: policyOf(kind, name)})
+		add(&Resource{Kind: KindPolicy, Name: name, Bucket: bucket, Path: path, Access: access})
+		add(&Resource{Kind: KindPath, Name: bucket + "/" + path, Bucket: bucket, Path: path})
+	}
+	for _, group := range groups {
+		if bucket, path, access, ok := parseGroupName(group, buckets); ok {
+			addAccess(KindGroup, group, bucket, path, access)
+		}
+	}
+	for username, userInfo := range users {
+		user := &Resource{Kind: KindUser, Name: username}
+		if bucket, path, access, ok := parsePolicyName(userInfo.PolicyName, username, buckets); ok {
+			add(&Resource{Kind: KindPolicy, Name: userInfo.PolicyName, Bucket: bucket, Path: path, Access: access})
+			add(&Resource{Kind: KindPath, Name: bucket + "/" + path, Bucket: bucket, Path: path})
+			user.Bucket, user.Path, user.Access, user.Policy = bucket, path, access, userInfo.PolicyName
+		}
+		for _, group := range userInfo.MemberOf {
+			bucket, path, access, ok := parseGroupName(group, buckets)
+			if !ok {
+				continue
+			}
+			addAccess(KindGroup, group, bucket, path, access)
+			user.Groups = append(user.Groups, group)
+		}
+		sort.Strings(user.Groups)
+		if user.Policy == "" && len(user.Groups) > 0 {
+			// A user added to an access group is provisioned for the path of its first group
+			group := found[(&Resource{Cluster: discoverer.cluster, Kind: KindGroup, Name: user.Groups[0]}).key()]
+			user.Bucket, user.Path, user.Access = group.Bucket, group.Path, group.Access
+		}
+		if user.Policy != "" || len(user.Groups) > 0 {
+			add(user)
+		}
+	}
+
+	var resources []*Resource
+	for _, resource := range found {
+		resources = append(resources, resource)
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].key() < resources[j].key() })
+	return resources, nil
+}
+
+// policyOf returns the policy of a group, which is named after the group
+func policyOf(kind, name string) string {
+	if kind == KindGroup {
+		return name
+	}
+	return ""
+}
+
+// parsePolicyName finds the bucket, path and access in the name of an app user policy, <bucket><path>_<user>_<access>
+func parsePolicyName(policyName, username string, buckets []string) (string, string, []string, bool) {
+	infix := "_" + username + "_"
+	i := strings.LastIndex(policyName, infix)
+	if i <= 0 {
+		return "", "", nil, false
+	}
+	access, ok := parseAccess(policyName[i+len(infix):])
+	if !ok {
+		return "", "", nil, false
+	}
+	bucket, path, ok := splitBucketPath(policyName[:i], "", buckets)
+	return bucket, path, access, ok
+}
+
+// parseGroupName finds the bucket, path and access in the name of an access group,
+// fiona-<bucket>-<path>-<hash>-<access>, checking that the name is the one Fiona gives the group
+func parseGroupName(group string, buckets []string) (string, string, []string, bool) {
+	if !s3.IsManagedGroup(group) {
+		return "", "", nil, false
+	}
+	name := strings.TrimPrefix(group, s3.GroupPrefix)
+	i := strings.LastIndex(name, "-")
+	if i <= 0 {
+		return "", "", nil, false
+	}
+	access, ok := parseAccess(name[i+1:])
+	if !ok {
+		return "", "", nil, false
+	}
+	j := strings.LastIndex(name[:i], "-")
+	if j <= 0 {
+		return "", "", nil, false
+	}
+	for _, bucket := range buckets {
+		if !strings.HasPrefix(name[:j], bucket+"-") {
+			continue
+		}
+		path := name[len(bucket)+1 : j]
+		if path != "" && s3.IsPathAccessGroup(group, bucket, path) {
+			return bucket, path, access, true
+		}
+	}
+	return "", "", nil, false
+}
+
+// splitBucketPath splits name into the longest bucket it starts with, the separator and a path
+func splitBucketPath(name, separator string, buckets []string) (string, string, bool) {
+	bucket := ""
+	for _, candidate := range buckets {
+		if len(candidate) > len(bucket) && len(name) > len(candidate+separator) && strings.HasPrefix(name, candidate+separator) {
+			bucket = candidate
+		}
+	}
+	if bucket == "" {
+		return "", "", false
+	}
+	return bucket, name[len(bucket+separator):], true
+}
+
+// parseAccess returns the access granted by letters like rw
+func parseAccess(letters string) ([]string, bool) {
+	if letters == "" {
+		return nil, false
+	}
+	var access []string
+	for _, letter := range strings.ToLower(letters) {
+		granted, ok := accessLetters[string(letter)]
+		if !ok {
+			return nil, false
+		}
+		access = append(access, granted)
+	}
+	return normalizedAccess(access), true
+}
+
+// normalizedAccess returns the access list in upper case, ordered READ, WRITE, DELETE without duplicates
+func normalizedAccess(access []string) []string {
+	granted := map[string]bool{}
+	for _, a := range access {
+		granted[strings.ToUpper(a)] = true
+	}
+	var normalized []string
+	for _, a := range []string{"READ", "WRITE", "DELETE"} {
+		if granted[a] {
+			normalized = append(normalized, a)
+		}
+	}
+	return normalized
+}
@@ -0,0 +1,100 @@
+package inventory
+
+import (
+	"context"
+	"github.com/minio/minio-go/v6"
+	"github.com/minio/minio/pkg/madmin"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type testDiscoverClient struct {
+	buckets []string
+	users   map[string]madmin.UserInfo
+	groups  []string
+}
+
+func (tdc *testDiscoverClient) ListBucketsWithContext(ctx context.Context) ([]minio.BucketInfo, error) {
+	var buckets []minio.BucketInfo
+	for _, bucket := range tdc.buckets {
+		buckets = append(buckets, minio.BucketInfo{Name: bucket})
+	}
+	return buckets, nil
+}
+
+func (tdc *testDiscoverClient) ListUsers() (map[string]madmin.UserInfo, error) {
+	return tdc.users, nil
+}
+
+func (tdc *testDiscoverClient) ListGroups() ([]string, error) {
+	return tdc.groups, nil
+}
+
+func newTestDiscoverer() *MinioDiscoverer {
+	client := &testDiscoverClient{
+		buckets: []string{"utv", "utv-archive"},
+		users: map[string]madmin.UserInfo{
+			"appuser":   {PolicyName: "utvappx_appuser_RW"},
+			"groupuser": {MemberOf: []string{"fiona-utv-archive-appy-2be9ea36-r", "other-group"}},
+			"admin":     {PolicyName: "readwrite"},
+		},
+		groups: []string{"fiona-utv-archive-appy-2be9ea36-r", "other-group"},
+	}
+	return &MinioDiscoverer{cluster: "default", admin: client, buckets: client}
+}
+
+func TestDiscover(t *testing.T) {
+	t.Run("Should find the resources named like Fiona names them", func(t *testing.T) {
+		discovered, err := newTestDiscoverer().Discover(context.Background())
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{
+			"bucket utv", "bucket utv-archive",
+			"group fiona-utv-archive-appy-2be9ea36-r",
+			"path utv-archive/appy", "path utv/appx",
+			"policy fiona-utv-archive-appy-2be9ea36-r", "policy utvappx_appuser_RW",
+			"user appuser", "user groupuser",
+		}, resourceNames(discovered))
+		users := map[string]*Resource{}
+		for _, resource := range discovered {
+			if resource.Kind == KindUser {
+				users[resource.Name] = resource
+			}
+		}
+		assert.Equal(t, &Resource{Kind: KindUser, Name: "appuser", Cluster: "default", Bucket: "utv", Path: "appx", Access: []string{"READ", "WRITE"}, Policy: "utvappx_appuser_RW"}, users["appuser"])
+		assert.Equal(t, []string{"fiona-utv-archive-appy-2be9ea36-r"}, users["groupuser"].Groups)
+		assert.Equal(t, "utv-archive", users["groupuser"].Bucket)
+	})
+
+	t.Run("Should not parse names of other policies and groups", func(t *testing.T) {
+		buckets := []string{"utv"}
+		_, _, _, ok := parsePolicyName("utvappx_appuser_RX", "appuser", buckets)
+		assert.False(t, ok)
+		_, _, _, ok = parsePolicyName("testappx_appuser_R", "appuser", buckets)
+		assert.False(t, ok)
+		_, _, _, ok = parseGroupName("fiona-utv-r", buckets)
+		assert.False(t, ok)
+		_, _, _, ok = parseGroupName("fiona-utv-appx-00000000-r", buckets)
+		assert.False(t, ok)
+	})
+}
+
+func TestCompare(t *testing.T) {
+	t.Run("Should report missing, untracked and changed resources", func(t *testing.T) {
+		recorded := []*Resource{
+			{Kind: KindBucket, Name: "utv", Cluster: "default"},
+			{Kind: KindUser, Name: "appuser", Cluster: "default", Bucket: "utv", Path: "appx", Access: []string{"read", "write"}, Policy: "utvappx_appuser_RW", Creator: "boober"},
+			{Kind: KindUser, Name: "groupuser", Cluster: "default", Bucket: "utv-archive", Path: "appy", Access: []string{"READ"}},
+			{Kind: KindUser, Name: "removed", Cluster: "default", Policy: "utvappx_removed_R"},
+		}
+		discovered, _ := newTestDiscoverer().Discover(context.Background())
+
+		drift := Compare(recorded, discovered)
+
+		assert.False(t, drift.Empty())
+		assert.Equal(t, []string{"user removed"}, resourceNames(drift.Missing))
+		assert.Equal(t, []string{"user groupuser"}, resourceNames(drift.Changed))
+		assert.Equal(t, []string{"group fiona-utv-archive-appy-2be9ea36-r", "path utv-archive/appy", "path utv/appx", "policy fiona-utv-archive-appy-2be9ea36-r", "policy utvappx_appuser_RW"}, resourceNames(drift.Untracked))
+		assert.True(t, Compare(discovered, discovered).Empty())
+	})
+}
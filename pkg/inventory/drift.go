@@ -0,0 +1,64 @@
+package inventory
+
+import (
+	"reflect"
+	"sort"
+)
+
+// Drift tells how the recorded resources of a cluster differ from the resources discovered in minio
+type Drift struct {
+	Missing   []*Resource `json:"missing"`   // Recorded, but not found in minio
+	Untracked []*Resource `json:"untracked"` // Found in minio, but not recorded
+	Changed   []*Resource `json:"changed"`   // Found in minio with other access, policy or groups than recorded
+}
+
+// Empty tells whether the recorded and discovered resources agree
+func (drift *Drift) Empty() bool {
+	return len(drift.Missing) == 0 && len(drift.Untracked) == 0 && len(drift.Changed) == 0
+}
+
+// Compare finds the drift between recorded and discovered resources. Buckets not recorded are not untracked, since
+// Fiona cannot tell its buckets from others by name. Changed resources are reported as discovered.
+func Compare(recorded, discovered []*Resource) *Drift {
+	drift := &Drift{Missing: []*Resource{}, Untracked: []*Resource{}, Changed: []*Resource{}}
+	found := map[string]*Resource{}
+	for _, resource := range discovered {
+		found[resource.key()] = resource
+	}
+	known := map[string]bool{}
+	for _, resource := range recorded {
+		known[resource.key()] = true
+		discoveredResource, ok := found[resource.key()]
+		switch {
+		case !ok:
+			drift.Missing = append(drift.Missing, resource)
+		case changed(resource, discoveredResource):
+			drift.Changed = append(drift.Changed, discoveredResource)
+		}
+	}
+	for _, resource := range discovered {
+		if !known[resource.key()] && resource.Kind != KindBucket {
+			drift.Untracked = append(drift.Untracked, resource)
+		}
+	}
+	for _, resources := range [][]*Resource{drift.Missing, drift.Untracked, drift.Changed} {
+		sort.Slice(resources, func(i, j int) bool { return resources[i].key() < resources[j].key() })
+	}
+	return drift
+}
+
+func changed(recorded, discovered *Resource) bool {
+	recordedGroups := append([]string(nil), recorded.Groups...)
+	discoveredGroups := append([]string(nil), discovered.Groups...)
+	sort.Strings(recordedGroups)
+	sort.Strings(discoveredGroups)
+	if recorded.Kind == KindUser && recorded.Policy == "" && discovered.Policy == "" {
+		// The access of users without a policy of their own is given by their groups
+		return !reflect.DeepEqual(recordedGroups, discoveredGroups)
+	}
+	return recorded.Bucket != discovered.Bucket ||
+		recorded.Path != discovered.Path ||
+		recorded.Policy != discovered.Policy ||
+		!reflect.DeepEqual(normalizedAccess(recorded.Access), normalizedAccess(discovered.Access)) ||
+		!reflect.DeepEqual(recordedGroups, discoveredGroups)
+}
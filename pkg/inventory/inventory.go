@@ -0,0 +1,201 @@
+package inventory
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kinds of resources
+const (
+	KindBucket = "bucket"
+	KindPath   = "path"
+	KindUser   = "user"
+	KindPolicy = "policy"
+	KindGroup  = "group"
+)
+
+// Config for the inventory
+type Config struct {
+	Store string // StoreBolt, the default, or StoreJSON
+	File  string // File the inventory is kept in. The inventory is lost on restart when empty
+}
+
+// Stores the inventory may be kept in
+const (
+	StoreBolt = "bolt" // A bbolt database, writing only the resources changed
+	StoreJSON = "json" // A JSON file, rewritten on every change
+)
+
+// Resource is something Fiona has provisioned in a cluster
+type Resource struct {
+	Kind    string    `json:"kind"`
+	Name    string    `json:"name"`
+	Cluster string    `json:"cluster"`
+	Bucket  string    `json:"bucket,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	Access  []string  `json:"access,omitempty"`
+	Policy  string    `json:"policy,omitempty"`  // The policy of a user or group
+	Groups  []string  `json:"groups,omitempty"`  // The access groups of a user
+	Creator string    `json:"creator,omitempty"` // The caller provisioning it, empty when found in minio
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+func (resource *Resource) key() string {
+	return resource.Cluster + "/" + resource.Kind + "/" + resource.Name
+}
+
+// copy returns a copy of the resource not sharing its lists
+func (resource *Resource) copy() *Resource {
+	copied := *resource
+	copied.Access = append([]string(nil), resource.Access...)
+	copied.Groups = append([]string(nil), resource.Groups...)
+	return &copied
+}
+
+// Filter selects resources. Empty fields match every resource.
+type Filter struct {
+	Cluster string
+	Kind    string
+	Bucket  string
+	Path    string
+}
+
+func (filter Filter) matches(resource *Resource) bool {
+	return (filter.Cluster == "" || filter.Cluster == resource.Cluster) &&
+		(filter.Kind == "" || filter.Kind == resource.Kind) &&
+		(filter.Bucket == "" || filter.Bucket == resource.Bucket) &&
+		(filter.Path == "" || filter.Path == resource.Path)
+}
+
+// Inventory records the resources Fiona has provisioned in every cluster, keeping them in a Store
+type Inventory struct {
+	mutex     sync.Mutex
+	store     Store
+	resources map[string]*Resource
+}
+
+// Open opens the inventory kept in the file of config by the store of config, or an inventory in memory when there is
+// no file
+func Open(config *Config) (*Inventory, error) {
+	if config.File == "" {
+		return New(NewMemoryStore())
+	}
+	var store Store
+	var err error
+	if config.Store == StoreJSON {
+		store, err = NewFileStore(config.File)
+	} else {
+		store, err = NewBoltStore(config.File)
+	}
+	if err != nil {
+		return nil, err
+	}
+	inventory, err := New(store)
+	if err != nil {
+		_ = store.(io.Closer).Close()
+		return nil, err
+	}
+	return inventory, nil
+}
+
+// New creates an inventory loading the resources kept in store
+func New(store Store) (*Inventory, error) {
+	stored, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("could not load inventory: %v", err)
+	}
+	inventory := &Inventory{store: store, resources: map[string]*Resource{}}
+	for _, resource := range stored {
+		inventory.resources[resource.key()] = resource
+	}
+	return inventory, nil
+}
+
+// Close releases the store of the inventory, letting another process open it
+func (inventory *Inventory) Close() error {
+	if closer, ok := inventory.store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Put records a resource. The creator and creation time of a resource already recorded are kept.
+func (inventory *Inventory) Put(resource *Resource) error {
+	inventory.mutex.Lock()
+	defer inventory.mutex.Unlock()
+	return inventory.update([]*Resource{resource.copy()}, nil)
+}
+
+// List returns copies of the resources selected by filter, ordered by cluster, kind and name
+func (inventory *Inventory) List(filter Filter) []*Resource {
+	inventory.mutex.Lock()
+	defer inventory.mutex.Unlock()
+	resources := []*Resource{}
+	for _, resource := range inventory.resources {
+		if filter.matches(resource) {
+			resources = append(resources, resource.copy())
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].key() < resources[j].key() })
+	return resources
+}
+
+// Rebuild replaces the resources recorded for a cluster with those discovered in minio. Buckets are only kept when
+// they are recorded already or hold a discovered path, since Fiona cannot tell its buckets from others by name.
+func (inventory *Inventory) Rebuild(cluster string, discovered []*Resource) error {
+	inventory.mutex.Lock()
+	defer inventory.mutex.Unlock()
+	pathBuckets := map[string]bool{}
+	for _, resource := range discovered {
+		if resource.Kind == KindPath {
+			pathBuckets[resource.Bucket] = true
+		}
+	}
+	var saved, deleted []*Resource
+	kept := map[string]bool{}
+	for _, resource := range discovered {
+		resource = resource.copy()
+		resource.Cluster = cluster
+		_, recorded := inventory.resources[resource.key()]
+		if resource.Kind == KindBucket && !recorded && !pathBuckets[resource.Name] {
+			continue
+		}
+		kept[resource.key()] = true
+		saved = append(saved, resource)
+	}
+	for key, resource := range inventory.resources {
+		if resource.Cluster == cluster && !kept[key] {
+			deleted = append(deleted, resource)
+		}
+	}
+	return inventory.update(saved, deleted)
+}
+
+// update stamps the saved resources and applies the changes to the store and then to the inventory. The caller
+// must hold the mutex.
+func (inventory *Inventory) update(saved, deleted []*Resource) error {
+	now := time.Now().UTC()
+	for _, resource := range saved {
+		resource.Created, resource.Updated = now, now
+		if recorded, found := inventory.resources[resource.key()]; found {
+			resource.Created = recorded.Created
+			if recorded.Creator != "" {
+				resource.Creator = recorded.Creator
+			}
+		}
+	}
+	if err := inventory.store.Update(saved, deleted); err != nil {
+		return err
+	}
+	for _, resource := range deleted {
+		delete(inventory.resources, resource.key())
+	}
+	for _, resource := range saved {
+		inventory.resources[resource.key()] = resource
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package inventory
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestInventory(t *testing.T) *Inventory {
+	inventory, err := New(NewMemoryStore())
+	assert.Nil(t, err)
+	return inventory
+}
+
+func TestInventory(t *testing.T) {
+	t.Run("Should keep the creator and creation time when a resource is recorded again", func(t *testing.T) {
+		inventory := newTestInventory(t)
+
+		assert.Nil(t, inventory.Put(&Resource{Kind: KindUser, Name: "appuser", Cluster: "default", Access: []string{"READ"}, Creator: "boober"}))
+		created := inventory.List(Filter{})[0]
+		assert.Nil(t, inventory.Put(&Resource{Kind: KindUser, Name: "appuser", Cluster: "default", Access: []string{"READ", "WRITE"}, Creator: "admin"}))
+
+		resources := inventory.List(Filter{})
+		assert.Len(t, resources, 1)
+		assert.Equal(t, "boober", resources[0].Creator)
+		assert.Equal(t, created.Created, resources[0].Created)
+		assert.Equal(t, []string{"READ", "WRITE"}, resources[0].Access)
+	})
+
+	t.Run("Should list the resources selected by the filter in order", func(t *testing.T) {
+		inventory := newTestInventory(t)
+		_ = inventory.Put(&Resource{Kind: KindUser, Name: "b", Cluster: "default", Bucket: "utv", Path: "appx"})
+		_ = inventory.Put(&Resource{Kind: KindUser, Name: "a", Cluster: "default", Bucket: "utv", Path: "appx"})
+		_ = inventory.Put(&Resource{Kind: KindUser, Name: "c", Cluster: "default", Bucket: "utv", Path: "appy"})
+		_ = inventory.Put(&Resource{Kind: KindUser, Name: "a", Cluster: "archive", Bucket: "utv", Path: "appx"})
+
+		resources := inventory.List(Filter{Cluster: "default", Kind: KindUser, Path: "appx"})
+
+		assert.Len(t, resources, 2)
+		assert.Equal(t, "a", resources[0].Name)
+		assert.Equal(t, "b", resources[1].Name)
+		assert.Empty(t, inventory.List(Filter{Kind: KindGroup}))
+	})
+
+	t.Run("Should replace the resources of a cluster when rebuilt", func(t *testing.T) {
+		inventory := newTestInventory(t)
+		_ = inventory.Put(&Resource{Kind: KindUser, Name: "gone", Cluster: "default"})
+		_ = inventory.Put(&Resource{Kind: KindUser, Name: "kept", Cluster: "default", Creator: "boober"})
+		_ = inventory.Put(&Resource{Kind: KindBucket, Name: "empty", Cluster: "default"})
+		_ = inventory.Put(&Resource{Kind: KindUser, Name: "gone", Cluster: "archive"})
+
+		err := inventory.Rebuild("default", []*Resource{
+			{Kind: KindUser, Name: "kept", Cluster: "default"},
+			{Kind: KindUser, Name: "found", Cluster: "default", Bucket: "utv", Path: "appx"},
+			{Kind: KindPath, Name: "utv/appx", Cluster: "default", Bucket: "utv", Path: "appx"},
+			{Kind: KindBucket, Name: "utv", Cluster: "default"},
+			{Kind: KindBucket, Name: "empty", Cluster: "default"},
+			{Kind: KindBucket, Name: "other", Cluster: "default"},
+		})
+
+		assert.Nil(t, err)
+		var names []string
+		for _, resource := range inventory.List(Filter{Cluster: "default"}) {
+			names = append(names, resource.Kind+" "+resource.Name)
+		}
+		assert.Equal(t, []string{"bucket empty", "bucket utv", "path utv/appx", "user found", "user kept"}, names)
+		assert.Equal(t, "boober", inventory.List(Filter{Cluster: "default", Kind: KindUser})[1].Creator)
+		assert.Len(t, inventory.List(Filter{Cluster: "archive"}), 1)
+	})
+}
+
+func TestBoltStore(t *testing.T) {
+	t.Run("Should keep the inventory in the database across restarts", func(t *testing.T) {
+		dir, _ := ioutil.TempDir("", "fiona-inventory")
+		defer os.RemoveAll(dir)
+		config := &Config{Store: StoreBolt, File: filepath.Join(dir, "state", "inventory.db")}
+		inventory, err := Open(config)
+		assert.Nil(t, err)
+		assert.Nil(t, inventory.Put(&Resource{Kind: KindUser, Name: "appuser", Cluster: "default", Groups: []string{"fiona-utv-appx-3030f118-r"}}))
+		assert.Nil(t, inventory.Put(&Resource{Kind: KindBucket, Name: "utv", Cluster: "default"}))
+		assert.Nil(t, inventory.Put(&Resource{Kind: KindBucket, Name: "prod", Cluster: "archive"}))
+		assert.Nil(t, inventory.Rebuild("default", []*Resource{{Kind: KindBucket, Name: "utv", Cluster: "default"}}))
+		assert.Nil(t, inventory.Close())
+
+		reopened, err := Open(config)
+
+		assert.Nil(t, err)
+		defer reopened.Close()
+		assert.Equal(t, inventory.List(Filter{}), reopened.List(Filter{}))
+		assert.Len(t, reopened.List(Filter{}), 2)
+	})
+
+	t.Run("Should refuse a database locked by another store", func(t *testing.T) {
+		dir, _ := ioutil.TempDir("", "fiona-inventory")
+		defer os.RemoveAll(dir)
+		config := &Config{File: filepath.Join(dir, "inventory.db")}
+		inventory, err := Open(config)
+		assert.Nil(t, err)
+
+		_, err = Open(config)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "locked by another process")
+
+		assert.Nil(t, inventory.Close())
+		reopened, err := Open(config)
+		assert.Nil(t, err)
+		assert.Nil(t, reopened.Close())
+	})
+
+	t.Run("Should refuse a file that is not a database", func(t *testing.T) {
+		file, _ := ioutil.TempFile("", "fiona-inventory")
+		defer os.Remove(file.Name())
+		_, _ = file.WriteString(strings.Repeat(`{"resources":[]}`, 1024))
+		_ = file.Close()
+
+		_, err := Open(&Config{Store: StoreJSON, File: file.Name()})
+
+		assert.Error(t, err)
+	})
+}
+
+func TestFileStore(t *testing.T) {
+	t.Run("Should keep the inventory in the file across restarts", func(t *testing.T) {
+		dir, _ := ioutil.TempDir("", "fiona-inventory")
+		defer os.RemoveAll(dir)
+		config := &Config{Store: StoreJSON, File: filepath.Join(dir, "state", "inventory.json")}
+		inventory, err := Open(config)
+		assert.Nil(t, err)
+		assert.Nil(t, inventory.Put(&Resource{Kind: KindUser, Name: "appuser", Cluster: "default", Groups: []string{"fiona-utv-appx-3030f118-r"}}))
+		assert.Nil(t, inventory.Put(&Resource{Kind: KindBucket, Name: "utv", Cluster: "default"}))
+		assert.Nil(t, inventory.Rebuild("default", []*Resource{{Kind: KindBucket, Name: "utv", Cluster: "default"}}))
+		assert.Nil(t, inventory.Close())
+
+		reopened, err := Open(config)
+
+		assert.Nil(t, err)
+		defer reopened.Close()
+		assert.Equal(t, inventory.List(Filter{}), reopened.List(Filter{}))
+		assert.Len(t, reopened.List(Filter{}), 1)
+		_, err = os.Stat(config.File + ".tmp")
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("Should refuse a file locked by another store", func(t *testing.T) {
+		dir, _ := ioutil.TempDir("", "fiona-inventory")
+		defer os.RemoveAll(dir)
+		config := &Config{Store: StoreJSON, File: filepath.Join(dir, "inventory.json")}
+		inventory, err := Open(config)
+		assert.Nil(t, err)
+
+		_, err = Open(config)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "locked by another process")
+
+		assert.Nil(t, inventory.Close())
+		reopened, err := Open(config)
+		assert.Nil(t, err)
+		assert.Nil(t, reopened.Close())
+	})
+
+	t.Run("Should refuse a corrupt file", func(t *testing.T) {
+		file, _ := ioutil.TempFile("", "fiona-inventory")
+		defer os.Remove(file.Name())
+		defer os.Remove(file.Name() + ".lock")
+		_, _ = file.WriteString("{not json")
+		_ = file.Close()
+
+		_, err := Open(&Config{Store: StoreJSON, File: file.Name()})
+
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,126 @@
+package inventory
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/skatteetaten/fiona/pkg/s3"
+)
+
+// Recorder is an audit.Logger recording the resources provisioned by successful operations in the inventory, before
+// passing the events on
+type Recorder struct {
+	inventory *Inventory
+	next      audit.Logger
+}
+
+// NewRecorder is a factory for Recorder
+func NewRecorder(inventory *Inventory, next audit.Logger) *Recorder {
+	return &Recorder{inventory: inventory, next: next}
+}
+
+// Record passes the event on, and records its resources. Failures are logged, never returned, so that the inventory
+// does not break provisioning. Drift is found by reconciling the inventory.
+func (recorder *Recorder) Record(event audit.Event) {
+	recorder.next.Record(event)
+	if event.Outcome != audit.OutcomeSuccess {
+		return
+	}
+	if err := recorder.inventory.Apply(event); err != nil {
+		logrus.Errorf("Could not record %s in the inventory: %s", event.Operation, err)
+	}
+}
+
+// Apply records the resources provisioned, changed or removed by a successful operation. Other operations are
+// ignored.
+func (inventory *Inventory) Apply(event audit.Event) error {
+	inventory.mutex.Lock()
+	defer inventory.mutex.Unlock()
+	resource := func(kind, name string) *Resource {
+		return &Resource{Kind: kind, Name: name, Cluster: event.Cluster, Bucket: event.Bucket, Path: event.Path, Creator: event.Caller}
+	}
+	path := resource(KindPath, event.Bucket+"/"+event.Path)
+	access := normalizedAccess(event.Access)
+
+	switch event.Operation {
+	case audit.OperationCreateBucket, audit.OperationUpdateBucket:
+		bucket := resource(KindBucket, event.Bucket)
+		bucket.Bucket = ""
+		return inventory.update([]*Resource{bucket}, nil)
+	case audit.OperationCreateAppUser:
+		user := resource(KindUser, event.Username)
+		user.Access = access
+		saved := []*Resource{path, user}
+		if event.Group != "" {
+			user.Groups = []string{event.Group}
+			saved = append(saved, accessGroup(resource, event.Group, access)...)
+		} else {
+			user.Policy = event.PolicyName
+			policy := resource(KindPolicy, event.PolicyName)
+			policy.Access = access
+			saved = append(saved, policy)
+		}
+		return inventory.update(saved, nil)
+	case audit.OperationCreateGroup:
+		return inventory.update(append(accessGroup(resource, event.Group, access), path), nil)
+	case audit.OperationAddGroupMember, audit.OperationRemoveGroupMember:
+		recorded, found := inventory.resources[resource(KindUser, event.Username).key()]
+		if !found {
+			return nil
+		}
+		user := recorded.copy()
+		user.Groups = withoutGroup(user.Groups, event.Group)
+		if event.Operation == audit.OperationAddGroupMember {
+			user.Groups = append(user.Groups, event.Group)
+		}
+		return inventory.update([]*Resource{user}, nil)
+	case audit.OperationDecommissionPath:
+		return inventory.decommission(event.Cluster, event.Bucket, event.Path)
+	}
+	return nil
+}
+
+// accessGroup returns an access group and its policy, which is named after the group
+func accessGroup(resource func(kind, name string) *Resource, name string, access []string) []*Resource {
+	group, policy := resource(KindGroup, name), resource(KindPolicy, name)
+	group.Access, group.Policy, policy.Access = access, name, access
+	return []*Resource{group, policy}
+}
+
+// decommission forgets the path with its users, groups and policies, and removes its groups from other users. The
+// caller must hold the mutex.
+func (inventory *Inventory) decommission(cluster, bucket, path string) error {
+	var saved, deleted []*Resource
+	for _, resource := range inventory.resources {
+		if resource.Cluster != cluster || resource.Kind == KindBucket {
+			continue
+		}
+		if resource.Bucket == bucket && resource.Path == path {
+			deleted = append(deleted, resource)
+			continue
+		}
+		for _, group := range resource.Groups {
+			if s3.IsPathAccessGroup(group, bucket, path) {
+				user := resource.copy()
+				user.Groups = nil
+				for _, group := range resource.Groups {
+					if !s3.IsPathAccessGroup(group, bucket, path) {
+						user.Groups = append(user.Groups, group)
+					}
+				}
+				saved = append(saved, user)
+				break
+			}
+		}
+	}
+	return inventory.update(saved, deleted)
+}
+
+func withoutGroup(groups []string, group string) []string {
+	var kept []string
+	for _, g := range groups {
+		if g != group {
+			kept = append(kept, g)
+		}
+	}
+	return kept
+}
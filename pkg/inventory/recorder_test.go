@@ -0,0 +1,84 @@
+package inventory
+
+import (
+	"errors"
+	"github.com/skatteetaten/fiona/pkg/audit"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type testAuditor struct {
+	events []audit.Event
+}
+
+func (ta *testAuditor) Record(event audit.Event) {
+	ta.events = append(ta.events, event)
+}
+
+// resourceNames returns the kind and name of the resources
+func resourceNames(resources []*Resource) []string {
+	names := []string{}
+	for _, resource := range resources {
+		names = append(names, resource.Kind+" "+resource.Name)
+	}
+	return names
+}
+
+func TestRecorder(t *testing.T) {
+	appUser := audit.Event{Operation: audit.OperationCreateAppUser, Caller: "boober", Cluster: "default", Bucket: "utv", Path: "appx", Username: "appuser", Access: []string{"write", "READ"}, PolicyName: "utvappx_appuser_wR"}
+
+	t.Run("Should record the app users created and pass the events on", func(t *testing.T) {
+		inventory := newTestInventory(t)
+		auditor := &testAuditor{}
+		recorder := NewRecorder(inventory, auditor)
+
+		recorder.Record(appUser.Succeeded())
+		recorder.Record(audit.Event{Operation: audit.OperationCreateAppUser, Cluster: "default", Bucket: "utv", Path: "appy", Username: "failed"}.Failed(errors.New("minio is down")))
+
+		assert.Len(t, auditor.events, 2)
+		assert.Equal(t, []string{"path utv/appx", "policy utvappx_appuser_wR", "user appuser"}, resourceNames(inventory.List(Filter{})))
+		user := inventory.List(Filter{Kind: KindUser})[0]
+		assert.Equal(t, "boober", user.Creator)
+		assert.Equal(t, "utvappx_appuser_wR", user.Policy)
+		assert.Equal(t, []string{"READ", "WRITE"}, user.Access)
+		assert.False(t, user.Created.IsZero())
+	})
+
+	t.Run("Should record access groups and their members", func(t *testing.T) {
+		inventory := newTestInventory(t)
+		recorder := NewRecorder(inventory, &testAuditor{})
+		grouped := appUser
+		grouped.PolicyName, grouped.Group = "fiona-utv-appx-3030f118-rw", "fiona-utv-appx-3030f118-rw"
+
+		recorder.Record(grouped.Succeeded())
+		recorder.Record(audit.Event{Operation: audit.OperationCreateGroup, Cluster: "default", Bucket: "utv", Path: "appx", Access: []string{"READ"}, Group: "fiona-utv-appx-3030f118-r"}.Succeeded())
+		recorder.Record(audit.Event{Operation: audit.OperationAddGroupMember, Cluster: "default", Group: "fiona-utv-appx-3030f118-r", Username: "appuser"}.Succeeded())
+		recorder.Record(audit.Event{Operation: audit.OperationRemoveGroupMember, Cluster: "default", Group: "fiona-utv-appx-3030f118-rw", Username: "appuser"}.Succeeded())
+		recorder.Record(audit.Event{Operation: audit.OperationAddGroupMember, Cluster: "default", Group: "fiona-utv-appx-3030f118-r", Username: "unknown"}.Succeeded())
+
+		assert.Equal(t, []string{"group fiona-utv-appx-3030f118-r", "group fiona-utv-appx-3030f118-rw", "path utv/appx", "policy fiona-utv-appx-3030f118-r", "policy fiona-utv-appx-3030f118-rw", "user appuser"}, resourceNames(inventory.List(Filter{})))
+		user := inventory.List(Filter{Kind: KindUser})[0]
+		assert.Equal(t, []string{"fiona-utv-appx-3030f118-r"}, user.Groups)
+		assert.Empty(t, user.Policy)
+		assert.Equal(t, "fiona-utv-appx-3030f118-r", inventory.List(Filter{Kind: KindGroup})[0].Policy)
+	})
+
+	t.Run("Should forget decommissioned paths", func(t *testing.T) {
+		inventory := newTestInventory(t)
+		recorder := NewRecorder(inventory, &testAuditor{})
+		recorder.Record(audit.Event{Operation: audit.OperationCreateBucket, Cluster: "default", Bucket: "utv"}.Succeeded())
+		recorder.Record(appUser.Succeeded())
+		other := appUser
+		other.Path, other.Username, other.PolicyName = "appy", "otheruser", "utvappy_otheruser_R"
+		recorder.Record(other.Succeeded())
+		recorder.Record(audit.Event{Operation: audit.OperationCreateGroup, Cluster: "default", Bucket: "utv", Path: "appx", Access: []string{"READ"}, Group: "fiona-utv-appx-3030f118-r"}.Succeeded())
+		recorder.Record(audit.Event{Operation: audit.OperationAddGroupMember, Cluster: "default", Group: "fiona-utv-appx-3030f118-r", Username: "otheruser"}.Succeeded())
+		recorder.Record(audit.Event{Operation: audit.OperationCreateGroup, Cluster: "default", Bucket: "utv", Path: "appx-y", Access: []string{"READ"}, Group: "fiona-utv-appx-y-873522a1-r"}.Succeeded())
+		recorder.Record(audit.Event{Operation: audit.OperationAddGroupMember, Cluster: "default", Group: "fiona-utv-appx-y-873522a1-r", Username: "otheruser"}.Succeeded())
+
+		recorder.Record(audit.Event{Operation: audit.OperationDecommissionPath, Cluster: "default", Bucket: "utv", Path: "appx"}.Succeeded())
+
+		assert.Equal(t, []string{"bucket utv", "group fiona-utv-appx-y-873522a1-r", "path utv/appx-y", "path utv/appy", "policy fiona-utv-appx-y-873522a1-r", "policy utvappy_otheruser_R", "user otheruser"}, resourceNames(inventory.List(Filter{})))
+		assert.Equal(t, []string{"fiona-utv-appx-y-873522a1-r"}, inventory.List(Filter{Kind: KindUser})[0].Groups)
+	})
+}
@@ -0,0 +1,282 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Store keeps the inventory. Update must apply all of its changes or none of them.
+type Store interface {
+	Load() ([]*Resource, error)
+	Update(saved, deleted []*Resource) error
+}
+
+// MemoryStore keeps the inventory in memory only
+type MemoryStore struct {
+	mutex     sync.Mutex
+	resources map[string]*Resource
+}
+
+// NewMemoryStore is a factory for MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{resources: map[string]*Resource{}}
+}
+
+// Load returns copies of the resources kept
+func (store *MemoryStore) Load() ([]*Resource, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	var resources []*Resource
+	for _, resource := range store.resources {
+		resources = append(resources, resource.copy())
+	}
+	return resources, nil
+}
+
+// Update keeps copies of the saved resources and forgets the deleted
+func (store *MemoryStore) Update(saved, deleted []*Resource) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for _, resource := range deleted {
+		delete(store.resources, resource.key())
+	}
+	for _, resource := range saved {
+		store.resources[resource.key()] = resource.copy()
+	}
+	return nil
+}
+
+// resourcesBucket is the bucket of a BoltStore the resources are kept in, as JSON keyed by kind, cluster and name
+var resourcesBucket = []byte("resources")
+
+// BoltStore keeps the inventory in a bbolt database file, writing only the resources changed by an update. bbolt
+// holds an exclusive lock on the file until closed, so a single process updates it.
+type BoltStore struct {
+	db *bbolt.DB
+}
+
+// NewBoltStore opens the database file of a BoltStore, creating it and its directory when they do not exist. It
+// fails when another process holds the lock.
+func NewBoltStore(file string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return nil, err
+	}
+	db, err := bbolt.Open(file, 0600, &bbolt.Options{Timeout: time.Second})
+	if err == bbolt.ErrTimeout {
+		return nil, fmt.Errorf("%s is locked by another process, such as a running Fiona server", file)
+	} else if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(resourcesBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Load reads the resources in the database
+func (store *BoltStore) Load() ([]*Resource, error) {
+	var resources []*Resource
+	err := store.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(resourcesBucket).ForEach(func(key, encoded []byte) error {
+			var resource Resource
+			if err := json.Unmarshal(encoded, &resource); err != nil {
+				return fmt.Errorf("invalid resource %s: %v", key, err)
+			}
+			resources = append(resources, &resource)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
+
+// Update writes the saved resources and removes the deleted in a single transaction, which is synced to disk before
+// Update returns
+func (store *BoltStore) Update(saved, deleted []*Resource) error {
+	return store.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(resourcesBucket)
+		for _, resource := range deleted {
+			if err := bucket.Delete([]byte(resource.key())); err != nil {
+				return err
+			}
+		}
+		for _, resource := range saved {
+			encoded, err := json.Marshal(resource)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(resource.key()), encoded); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close closes the database, releasing its lock
+func (store *BoltStore) Close() error {
+	return store.db.Close()
+}
+
+// FileStore keeps the inventory as a single JSON file, which is rewritten on every update. The store holds an
+// exclusive lock on the file until closed, so a single process updates it.
+type FileStore struct {
+	mutex     sync.Mutex
+	file      string
+	lock      *os.File
+	resources map[string]*Resource
+}
+
+// storedInventory is the content of the file of a FileStore
+type storedInventory struct {
+	Resources []*Resource `json:"resources"`
+}
+
+// NewFileStore locks and reads the file of a FileStore, creating its directory when it does not exist. It fails when
+// another process holds the lock.
+func NewFileStore(file string) (*FileStore, error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return nil, err
+	}
+	lock, err := lockFile(file + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	store := &FileStore{file: file, lock: lock, resources: map[string]*Resource{}}
+	encoded, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return store, nil
+	} else if err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+	var stored storedInventory
+	if err := json.Unmarshal(encoded, &stored); err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+	for _, resource := range stored.Resources {
+		store.resources[resource.key()] = resource
+	}
+	return store, nil
+}
+
+// Load returns copies of the resources in the file
+func (store *FileStore) Load() ([]*Resource, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	var resources []*Resource
+	for _, resource := range store.resources {
+		resources = append(resources, resource.copy())
+	}
+	return resources, nil
+}
+
+// Update writes the changed inventory to a temporary file which replaces the file, so a crash never leaves a
+// partial file. The file and its directory are synced before Update returns.
+func (store *FileStore) Update(saved, deleted []*Resource) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	resources := map[string]*Resource{}
+	for key, resource := range store.resources {
+		resources[key] = resource
+	}
+	for _, resource := range deleted {
+		delete(resources, resource.key())
+	}
+	for _, resource := range saved {
+		resources[resource.key()] = resource.copy()
+	}
+
+	stored := storedInventory{Resources: []*Resource{}}
+	for _, resource := range resources {
+		stored.Resources = append(stored.Resources, resource)
+	}
+	sort.Slice(stored.Resources, func(i, j int) bool { return stored.Resources[i].key() < stored.Resources[j].key() })
+	encoded, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	temporary := store.file + ".tmp"
+	if err := writeSynced(temporary, encoded); err != nil {
+		return err
+	}
+	if err := os.Rename(temporary, store.file); err != nil {
+		return err
+	}
+	if err := syncDir(filepath.Dir(store.file)); err != nil {
+		return err
+	}
+	store.resources = resources
+	return nil
+}
+
+// Close releases the lock on the file
+func (store *FileStore) Close() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.lock == nil {
+		return nil
+	}
+	err := store.lock.Close()
+	store.lock = nil
+	return err
+}
+
+// lockFile takes an exclusive lock on file, without waiting for another process to release it
+func lockFile(file string) (*os.File, error) {
+	lock, err := os.OpenFile(file, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		_ = lock.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, fmt.Errorf("%s is locked by another process, such as a running Fiona server", file)
+		}
+		return nil, err
+	}
+	return lock, nil
+}
+
+// writeSynced writes data to file and syncs it to disk
+func writeSynced(file string, data []byte) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir syncs a directory to disk, making a rename in it durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,399 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// States of a job
+const (
+	StateQueued    = "queued"
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+	StateCancelled = "cancelled"
+)
+
+type contextKey int
+
+// managerContextKey carries the context the manager runs in, which is cancelled when Fiona is stopping
+const managerContextKey contextKey = iota
+
+// Errors returned by Manager
+var (
+	ErrNotFound = errors.New("job not found")
+	ErrFinished = errors.New("job has already finished")
+)
+
+// Config for the background jobs
+type Config struct {
+	Dir       string        // Directory job state is kept in, one subdirectory per cluster, default "./fiona-jobs". Jobs are lost on restart when empty
+	Workers   int           // Jobs run at the same time in each cluster, default 2
+	Retention time.Duration // How long finished jobs are kept, default 168h
+}
+
+// Job is an operation running in the background
+type Job struct {
+	ID        string          `json:"id"`
+	Kind      string          `json:"kind"`
+	Cluster   string          `json:"cluster"`
+	RequestID string          `json:"requestId,omitempty"` // The request submitting the job
+	State     string          `json:"state"`
+	Params    json.RawMessage `json:"-"` // Kept by the store, never reported
+	Progress  json.RawMessage `json:"progress,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Created   time.Time       `json:"created"`
+	Started   *time.Time      `json:"started,omitempty"`
+	Finished  *time.Time      `json:"finished,omitempty"`
+}
+
+// finished tells whether the job will not run again
+func (job *Job) finished() bool {
+	return job.State == StateSucceeded || job.State == StateFailed || job.State == StateCancelled
+}
+
+// Runner carries out jobs of a kind. It reports progress with values marshalled to JSON, and must return when ctx
+// is done. Jobs interrupted by a restart are run again, so runners must be safe to repeat.
+type Runner func(ctx context.Context, job *Job, report func(progress interface{})) error
+
+// Manager queues jobs and runs them with a bounded number of workers, keeping their state in a Store
+type Manager struct {
+	config  Config
+	cluster string
+	store   Store
+	mutex   sync.Mutex
+	runners map[string]Runner
+	jobs    map[string]*Job
+	pending []string
+	stopped []*Job // Jobs that were queued or running when Fiona stopped
+	cancels map[string]context.CancelFunc
+	wake    chan struct{}
+}
+
+// NewManager creates the job manager of a cluster, loading the jobs kept in its directory
+func NewManager(config *Config, cluster string) (*Manager, error) {
+	var store Store = NewMemoryStore()
+	if config.Dir != "" {
+		fileStore, err := NewFileStore(filepath.Join(config.Dir, cluster))
+		if err != nil {
+			return nil, err
+		}
+		store = fileStore
+	}
+	return NewManagerWithStore(config, cluster, store)
+}
+
+// NewManagerWithStore creates a job manager keeping jobs in store
+func NewManagerWithStore(config *Config, cluster string, store Store) (*Manager, error) {
+	stored, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("could not load jobs of cluster %s: %v", cluster, err)
+	}
+	manager := &Manager{
+		config:  *config,
+		cluster: cluster,
+		store:   store,
+		runners: map[string]Runner{},
+		jobs:    map[string]*Job{},
+		cancels: map[string]context.CancelFunc{},
+		wake:    make(chan struct{}, 1),
+	}
+	if manager.config.Workers <= 0 {
+		manager.config.Workers = 2
+	}
+	for _, job := range stored {
+		manager.jobs[job.ID] = job
+		if !job.finished() {
+			manager.stopped = append(manager.stopped, job)
+		}
+	}
+	sort.Slice(manager.stopped, func(i, j int) bool { return manager.stopped[i].Created.Before(manager.stopped[j].Created) })
+	return manager, nil
+}
+
+// Register sets the runner of a kind of jobs. Runners must be registered before Run.
+func (manager *Manager) Register(kind string, runner Runner) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	manager.runners[kind] = runner
+}
+
+// Submit queues a job of a registered kind with params marshalled to JSON
+func (manager *Manager) Submit(ctx context.Context, kind string, params interface{}) (*Job, error) {
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	if _, registered := manager.runners[kind]; !registered {
+		return nil, fmt.Errorf("no runner for jobs of kind %s", kind)
+	}
+	job := &Job{
+		ID:        newID(),
+		Kind:      kind,
+		Cluster:   manager.cluster,
+		RequestID: logging.RequestID(ctx),
+		State:     StateQueued,
+		Params:    encoded,
+		Created:   time.Now().UTC(),
+	}
+	if err := manager.store.Save(job); err != nil {
+		return nil, fmt.Errorf("could not save job: %v", err)
+	}
+	manager.jobs[job.ID] = job
+	manager.enqueue(job.ID)
+	copied := *job
+	return &copied, nil
+}
+
+// Get returns a copy of the job with the id
+func (manager *Manager) Get(id string) (*Job, error) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	job, found := manager.jobs[id]
+	if !found {
+		return nil, ErrNotFound
+	}
+	copied := *job
+	return &copied, nil
+}
+
+// List returns copies of all jobs, newest first
+func (manager *Manager) List() []*Job {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	jobs := []*Job{}
+	for _, job := range manager.jobs {
+		copied := *job
+		jobs = append(jobs, &copied)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Created.After(jobs[j].Created) })
+	return jobs
+}
+
+// Cancel cancels a queued job at once, and asks a running job to stop. A running job is cancelled when its runner
+// returns.
+func (manager *Manager) Cancel(id string) (*Job, error) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	job, found := manager.jobs[id]
+	if !found {
+		return nil, ErrNotFound
+	}
+	switch {
+	case job.finished():
+		return nil, ErrFinished
+	case job.State == StateQueued:
+		for i, pending := range manager.pending {
+			if pending == id {
+				manager.pending = append(manager.pending[:i], manager.pending[i+1:]...)
+				break
+			}
+		}
+		manager.finish(job, StateCancelled, nil)
+	default:
+		if cancel, running := manager.cancels[id]; running {
+			cancel()
+		}
+	}
+	copied := *job
+	return &copied, nil
+}
+
+// Run queues the jobs interrupted by the last stop again, and runs jobs until ctx is done. Running jobs are then
+// stopped and queued to run after restart.
+func (manager *Manager) Run(ctx context.Context) {
+	manager.resume(ctx)
+
+	var workers sync.WaitGroup
+	for i := 0; i < manager.config.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				id, ok := manager.next(ctx)
+				if !ok {
+					return
+				}
+				manager.run(ctx, id)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		manager.prune(ctx)
+		select {
+		case <-ctx.Done():
+			workers.Wait()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resume queues the jobs that were queued or running when Fiona stopped, oldest first
+func (manager *Manager) resume(ctx context.Context) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	for _, job := range manager.stopped {
+		if _, registered := manager.runners[job.Kind]; !registered {
+			manager.finish(job, StateFailed, fmt.Errorf("no runner for jobs of kind %s", job.Kind))
+			continue
+		}
+		logging.FromContext(ctx).Infof("Resuming %s job %s in cluster %s", job.Kind, job.ID, manager.cluster)
+		job.State, job.Started = StateQueued, nil
+		manager.save(job)
+		manager.enqueue(job.ID)
+	}
+	manager.stopped = nil
+}
+
+// enqueue adds a job to the pending jobs and wakes a worker. The caller must hold the mutex.
+func (manager *Manager) enqueue(id string) {
+	manager.pending = append(manager.pending, id)
+	select {
+	case manager.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next waits for a pending job, and returns false when ctx is done
+func (manager *Manager) next(ctx context.Context) (string, bool) {
+	for {
+		manager.mutex.Lock()
+		if ctx.Err() != nil {
+			manager.mutex.Unlock()
+			return "", false
+		}
+		if len(manager.pending) > 0 {
+			id := manager.pending[0]
+			manager.pending = manager.pending[1:]
+			if len(manager.pending) > 0 {
+				// Pass the wake up on to another worker
+				select {
+				case manager.wake <- struct{}{}:
+				default:
+				}
+			}
+			manager.mutex.Unlock()
+			return id, true
+		}
+		manager.mutex.Unlock()
+		select {
+		case <-ctx.Done():
+			return "", false
+		case <-manager.wake:
+		}
+	}
+}
+
+// Stopping tells whether the job running in ctx was interrupted because Fiona is stopping. Such a job is run again
+// after restart, so it has neither failed nor been cancelled.
+func Stopping(ctx context.Context) bool {
+	managerCtx, ok := ctx.Value(managerContextKey).(context.Context)
+	return ok && managerCtx.Err() != nil
+}
+
+func (manager *Manager) run(ctx context.Context, id string) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	manager.mutex.Lock()
+	job := manager.jobs[id]
+	if job == nil || job.State != StateQueued {
+		manager.mutex.Unlock()
+		return
+	}
+	started := time.Now().UTC()
+	job.State, job.Started = StateRunning, &started
+	manager.cancels[id] = cancel
+	manager.save(job)
+	runner := manager.runners[job.Kind]
+	snapshot := *job
+	manager.mutex.Unlock()
+
+	logCtx := logging.WithRequestInfo(context.WithValue(jobCtx, managerContextKey, ctx), &logging.RequestInfo{ID: snapshot.RequestID, Route: "job " + snapshot.Kind + " " + id})
+	err := runner(logCtx, &snapshot, func(progress interface{}) {
+		encoded, err := json.Marshal(progress)
+		if err != nil {
+			logging.FromContext(logCtx).Warnf("Could not marshal progress of job %s: %s", id, err)
+			return
+		}
+		manager.mutex.Lock()
+		defer manager.mutex.Unlock()
+		job.Progress = encoded
+		manager.save(job)
+	})
+
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	delete(manager.cancels, id)
+	switch {
+	case ctx.Err() != nil:
+		// Fiona is stopping, the job is run again after restart
+		job.State, job.Started = StateQueued, nil
+		manager.save(job)
+	case jobCtx.Err() != nil:
+		manager.finish(job, StateCancelled, nil)
+	case err != nil:
+		logging.FromContext(logCtx).Errorf("Job %s failed: %s", id, err)
+		manager.finish(job, StateFailed, err)
+	default:
+		manager.finish(job, StateSucceeded, nil)
+	}
+}
+
+// finish records the final state of a job. The caller must hold the mutex.
+func (manager *Manager) finish(job *Job, state string, err error) {
+	finished := time.Now().UTC()
+	job.State, job.Finished = state, &finished
+	if err != nil {
+		job.Error = err.Error()
+	}
+	manager.save(job)
+}
+
+// save keeps the job in the store, logging failures since the job itself is not affected. The caller must hold the
+// mutex.
+func (manager *Manager) save(job *Job) {
+	if err := manager.store.Save(job); err != nil {
+		logging.FromContext(context.Background()).Warnf("Could not save job %s: %s", job.ID, err)
+	}
+}
+
+// prune forgets finished jobs older than the retention
+func (manager *Manager) prune(ctx context.Context) {
+	if manager.config.Retention <= 0 {
+		return
+	}
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	for id, job := range manager.jobs {
+		if job.finished() && time.Since(*job.Finished) > manager.config.Retention {
+			if err := manager.store.Delete(id); err != nil {
+				logging.FromContext(ctx).Warnf("Could not delete job %s: %s", id, err)
+				continue
+			}
+			delete(manager.jobs, id)
+		}
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
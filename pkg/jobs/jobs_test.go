@@ -0,0 +1,200 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingRunner runs jobs until released, or until cancelled
+type blockingRunner struct {
+	mutex    sync.Mutex
+	running  int
+	most     int
+	params   []string
+	release  chan error
+	stopping bool
+}
+
+func (br *blockingRunner) run(ctx context.Context, job *Job, report func(progress interface{})) error {
+	br.mutex.Lock()
+	br.running++
+	if br.running > br.most {
+		br.most = br.running
+	}
+	br.params = append(br.params, string(job.Params))
+	br.mutex.Unlock()
+	defer func() {
+		br.mutex.Lock()
+		br.running--
+		br.mutex.Unlock()
+	}()
+
+	report(map[string]int{"done": 1})
+	select {
+	case err := <-br.release:
+		return err
+	case <-ctx.Done():
+		br.mutex.Lock()
+		br.stopping = Stopping(ctx)
+		br.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+func waitForState(t *testing.T, manager *Manager, id, state string) *Job {
+	var job *Job
+	assert.Eventually(t, func() bool {
+		job, _ = manager.Get(id)
+		return job.State == state
+	}, time.Second, 5*time.Millisecond, "job %s never got state %s", id, state)
+	return job
+}
+
+func TestManager(t *testing.T) {
+	t.Run("Should run jobs and report their progress", func(t *testing.T) {
+		manager, _ := NewManagerWithStore(&Config{Workers: 1}, "default", NewMemoryStore())
+		runner := &blockingRunner{release: make(chan error, 2)}
+		manager.Register("test", runner.run)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go manager.Run(ctx)
+
+		job, err := manager.Submit(ctx, "test", map[string]string{"path": "appx"})
+		assert.Nil(t, err)
+		assert.Equal(t, StateQueued, job.State)
+		assert.Equal(t, "default", job.Cluster)
+		running := waitForState(t, manager, job.ID, StateRunning)
+		assert.NotNil(t, running.Started)
+
+		runner.release <- nil
+		succeeded := waitForState(t, manager, job.ID, StateSucceeded)
+		assert.JSONEq(t, `{"done":1}`, string(succeeded.Progress))
+		assert.NotNil(t, succeeded.Finished)
+		assert.Equal(t, []string{`{"path":"appx"}`}, runner.params)
+
+		failing, _ := manager.Submit(ctx, "test", nil)
+		runner.release <- errors.New("minio is down")
+		assert.Equal(t, "minio is down", waitForState(t, manager, failing.ID, StateFailed).Error)
+		assert.Len(t, manager.List(), 2)
+	})
+
+	t.Run("Should bound the jobs running at the same time", func(t *testing.T) {
+		manager, _ := NewManagerWithStore(&Config{Workers: 2}, "default", NewMemoryStore())
+		runner := &blockingRunner{release: make(chan error)}
+		manager.Register("test", runner.run)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go manager.Run(ctx)
+
+		var ids []string
+		for i := 0; i < 4; i++ {
+			job, _ := manager.Submit(ctx, "test", i)
+			ids = append(ids, job.ID)
+		}
+		waitForState(t, manager, ids[1], StateRunning)
+		queued, _ := manager.Get(ids[3])
+		assert.Equal(t, StateQueued, queued.State)
+
+		for range ids {
+			runner.release <- nil
+		}
+		for _, id := range ids {
+			waitForState(t, manager, id, StateSucceeded)
+		}
+		assert.Equal(t, 2, runner.most)
+	})
+
+	t.Run("Should cancel queued and running jobs", func(t *testing.T) {
+		manager, _ := NewManagerWithStore(&Config{Workers: 1}, "default", NewMemoryStore())
+		runner := &blockingRunner{release: make(chan error)}
+		manager.Register("test", runner.run)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go manager.Run(ctx)
+
+		running, _ := manager.Submit(ctx, "test", nil)
+		queued, _ := manager.Submit(ctx, "test", nil)
+		waitForState(t, manager, running.ID, StateRunning)
+
+		cancelled, err := manager.Cancel(queued.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, StateCancelled, cancelled.State)
+		_, err = manager.Cancel(running.ID)
+		assert.Nil(t, err)
+		waitForState(t, manager, running.ID, StateCancelled)
+		assert.False(t, runner.stopping)
+
+		_, err = manager.Cancel(running.ID)
+		assert.Equal(t, ErrFinished, err)
+		_, err = manager.Cancel("unknown")
+		assert.Equal(t, ErrNotFound, err)
+		assert.Len(t, runner.params, 1)
+	})
+
+	t.Run("Should refuse jobs without a runner", func(t *testing.T) {
+		manager, _ := NewManagerWithStore(&Config{}, "default", NewMemoryStore())
+
+		_, err := manager.Submit(context.Background(), "unknown", nil)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Should resume jobs interrupted by a restart", func(t *testing.T) {
+		dir, _ := ioutil.TempDir("", "fiona-jobs")
+		defer os.RemoveAll(dir)
+		config := &Config{Dir: dir, Workers: 1}
+		manager, err := NewManager(config, "default")
+		assert.Nil(t, err)
+		runner := &blockingRunner{release: make(chan error)}
+		manager.Register("test", runner.run)
+		manager.Register("retired", runner.run)
+		ctx, stop := context.WithCancel(context.Background())
+		stopped := make(chan struct{})
+		go func() {
+			manager.Run(ctx)
+			close(stopped)
+		}()
+		interrupted, _ := manager.Submit(ctx, "test", "appx")
+		retired, _ := manager.Submit(ctx, "retired", "appy")
+		waitForState(t, manager, interrupted.ID, StateRunning)
+		stop()
+		<-stopped
+		assert.True(t, runner.stopping)
+
+		restarted, err := NewManager(config, "default")
+		assert.Nil(t, err)
+		restarted.Register("test", runner.run)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go restarted.Run(ctx)
+
+		waitForState(t, restarted, interrupted.ID, StateRunning)
+		assert.Equal(t, "no runner for jobs of kind retired", waitForState(t, restarted, retired.ID, StateFailed).Error)
+		runner.release <- nil
+		waitForState(t, restarted, interrupted.ID, StateSucceeded)
+		assert.Equal(t, []string{`"appx"`, `"appx"`}, runner.params)
+	})
+
+	t.Run("Should forget finished jobs after the retention", func(t *testing.T) {
+		store := NewMemoryStore()
+		finished := time.Now().Add(-2 * time.Hour)
+		_ = store.Save(&Job{ID: "old", State: StateSucceeded, Finished: &finished})
+		_ = store.Save(&Job{ID: "queued", State: StateQueued})
+		manager, _ := NewManagerWithStore(&Config{Retention: time.Hour}, "default", store)
+
+		manager.prune(context.Background())
+
+		_, err := manager.Get("old")
+		assert.Equal(t, ErrNotFound, err)
+		_, err = manager.Get("queued")
+		assert.Nil(t, err)
+		stored, _ := store.Load()
+		assert.Len(t, stored, 1)
+	})
+}
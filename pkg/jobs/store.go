@@ -0,0 +1,137 @@
+package jobs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Store keeps the state of jobs
+type Store interface {
+	Save(job *Job) error
+	Load() ([]*Job, error)
+	Delete(id string) error
+}
+
+// storedJob is a job with the params it is run with
+type storedJob struct {
+	*Job
+	Params json.RawMessage `json:"params"`
+}
+
+// MemoryStore keeps jobs in memory only
+type MemoryStore struct {
+	mutex sync.Mutex
+	jobs  map[string][]byte
+}
+
+// NewMemoryStore is a factory for MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: map[string][]byte{}}
+}
+
+// Save keeps a copy of the job
+func (store *MemoryStore) Save(job *Job) error {
+	encoded, err := json.Marshal(storedJob{Job: job, Params: job.Params})
+	if err != nil {
+		return err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.jobs[job.ID] = encoded
+	return nil
+}
+
+// Load returns copies of the jobs kept
+func (store *MemoryStore) Load() ([]*Job, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	var jobs []*Job
+	for _, encoded := range store.jobs {
+		job, err := decodeJob(encoded)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Delete forgets the job
+func (store *MemoryStore) Delete(id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	delete(store.jobs, id)
+	return nil
+}
+
+// FileStore keeps each job as a JSON file in a directory
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates the directory of a FileStore when it does not exist
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Save writes the job to a temporary file which replaces the file of the job, so a crash never leaves a partial file
+func (store *FileStore) Save(job *Job) error {
+	encoded, err := json.Marshal(storedJob{Job: job, Params: job.Params})
+	if err != nil {
+		return err
+	}
+	temporary := filepath.Join(store.dir, job.ID+".json.tmp")
+	if err := ioutil.WriteFile(temporary, encoded, 0600); err != nil {
+		return err
+	}
+	return os.Rename(temporary, filepath.Join(store.dir, job.ID+".json"))
+}
+
+// Load reads every job in the directory
+func (store *FileStore) Load() ([]*Job, error) {
+	files, err := ioutil.ReadDir(store.dir)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []*Job
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		encoded, err := ioutil.ReadFile(filepath.Join(store.dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		job, err := decodeJob(encoded)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Delete removes the file of the job
+func (store *FileStore) Delete(id string) error {
+	err := os.Remove(filepath.Join(store.dir, id+".json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func decodeJob(encoded []byte) (*Job, error) {
+	stored := storedJob{Job: &Job{}}
+	if err := json.Unmarshal(encoded, &stored); err != nil {
+		return nil, err
+	}
+	stored.Job.Params = stored.Params
+	return stored.Job, nil
+}
@@ -0,0 +1,293 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/skatteetaten/fiona/pkg/tracing"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	managedByLabel    = "app.kubernetes.io/managed-by"
+	managedByFiona    = "fiona"
+)
+
+var (
+	namespacePattern  = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+	secretNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]{0,251}[a-z0-9])?$`)
+)
+
+var (
+	// ErrNamespaceNotAllowed is returned for secrets in a namespace Fiona is not configured to write to
+	ErrNamespaceNotAllowed = errors.New("namespace is not allowed")
+	// ErrSecretNotManaged is returned for an existing secret without the label of the secrets Fiona manages
+	ErrSecretNotManaged = errors.New("secret exists and is not managed by Fiona")
+)
+
+// Config for writing secrets through the Kubernetes API
+type Config struct {
+	Enabled    bool
+	APIURL     string   // Default from KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT
+	TokenFile  string   // Default the service account token
+	CAFile     string   // Default the service account CA
+	Namespaces []string // The namespaces secrets may be written to
+}
+
+// InClusterDefaults fills in the API URL, token and CA of the pod's service account where they are not set
+func (config *Config) InClusterDefaults() {
+	if config.APIURL == "" {
+		if host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT"); host != "" && port != "" {
+			config.APIURL = "https://" + host + ":" + port
+		}
+	}
+	if config.TokenFile == "" {
+		config.TokenFile = serviceAccountDir + "/token"
+	}
+	if config.CAFile == "" {
+		config.CAFile = serviceAccountDir + "/ca.crt"
+	}
+}
+
+// SecretReference names a Kubernetes secret
+type SecretReference struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// Validate checks that the reference is a valid namespace and secret name
+func (ref *SecretReference) Validate() error {
+	if !namespacePattern.MatchString(ref.Namespace) {
+		return fmt.Errorf("invalid namespace %q", ref.Namespace)
+	}
+	if !secretNamePattern.MatchString(ref.Name) {
+		return fmt.Errorf("invalid secret name %q", ref.Name)
+	}
+	return nil
+}
+
+func (ref SecretReference) String() string {
+	return ref.Namespace + "/" + ref.Name
+}
+
+// SecretWriter writes string data into secrets. CheckSecret tells before writing whether the secret may be written.
+type SecretWriter interface {
+	CheckSecret(ctx context.Context, ref SecretReference) error
+	WriteSecret(ctx context.Context, ref SecretReference, data map[string]string) error
+}
+
+// Client is a minimal Kubernetes API client writing secrets
+type Client struct {
+	apiURL     string
+	tokenFile  string
+	namespaces map[string]bool
+	httpClient *http.Client
+}
+
+// secretMetadata is the metadata of an existing secret
+type secretMetadata struct {
+	ResourceVersion string            `json:"resourceVersion"`
+	Labels          map[string]string `json:"labels"`
+}
+
+// NewClient creates a Client for the API server in config
+func NewClient(config *Config) (*Client, error) {
+	if config.APIURL == "" {
+		return nil, errors.New("the Kubernetes API URL is not set and Fiona is not running in a pod")
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.CAFile != "" {
+		caPEM, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read Kubernetes CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	namespaces := map[string]bool{}
+	for _, namespace := range config.Namespaces {
+		namespaces[namespace] = true
+	}
+	return &Client{
+		apiURL:     strings.TrimSuffix(config.APIURL, "/"),
+		tokenFile:  config.TokenFile,
+		namespaces: namespaces,
+		httpClient: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		},
+	}, nil
+}
+
+// CheckSecret checks that the reference is valid and in an allowed namespace, and that the secret does not exist or
+// is managed by Fiona
+func (client *Client) CheckSecret(ctx context.Context, ref SecretReference) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "kubernetes.CheckSecret")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	if err := client.validate(ref); err != nil {
+		return err
+	}
+	metadata, err := client.getSecretMetadata(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if metadata != nil && metadata.Labels[managedByLabel] != managedByFiona {
+		return fmt.Errorf("%w: %s", ErrSecretNotManaged, ref)
+	}
+	return nil
+}
+
+// WriteSecret creates the secret, or merges data into it when it exists and is managed by Fiona. Other keys in an
+// existing secret are kept.
+func (client *Client) WriteSecret(ctx context.Context, ref SecretReference, data map[string]string) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "kubernetes.WriteSecret")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	if err := client.validate(ref); err != nil {
+		return err
+	}
+	secret := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"type":       "Opaque",
+		"metadata": map[string]interface{}{
+			"name":      ref.Name,
+			"namespace": ref.Namespace,
+			"labels":    map[string]string{managedByLabel: managedByFiona},
+		},
+		"stringData": data,
+	}
+	secretsURL := fmt.Sprintf("%s/api/v1/namespaces/%s/secrets", client.apiURL, url.PathEscape(ref.Namespace))
+	status, err := client.send(ctx, http.MethodPost, secretsURL, "application/json", secret)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusConflict {
+		return nil
+	}
+
+	metadata, err := client.getSecretMetadata(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if metadata == nil || metadata.Labels[managedByLabel] != managedByFiona {
+		return fmt.Errorf("%w: %s", ErrSecretNotManaged, ref)
+	}
+	// The resource version makes the API server refuse the patch if the secret changed since it was read
+	patch := map[string]interface{}{
+		"metadata":   map[string]interface{}{"resourceVersion": metadata.ResourceVersion},
+		"stringData": data,
+	}
+	status, err = client.send(ctx, http.MethodPatch, secretsURL+"/"+url.PathEscape(ref.Name), "application/merge-patch+json", patch)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusConflict {
+		return fmt.Errorf("secret %s was changed while being written", ref)
+	}
+	return nil
+}
+
+// validate checks the reference and that its namespace is allowed
+func (client *Client) validate(ref SecretReference) error {
+	if err := ref.Validate(); err != nil {
+		return err
+	}
+	if !client.namespaces[ref.Namespace] {
+		return fmt.Errorf("%w: %s", ErrNamespaceNotAllowed, ref.Namespace)
+	}
+	return nil
+}
+
+// getSecretMetadata returns the metadata of the secret, or nil when it does not exist
+func (client *Client) getSecretMetadata(ctx context.Context, ref SecretReference) (*secretMetadata, error) {
+	secretURL := fmt.Sprintf("%s/api/v1/namespaces/%s/secrets/%s", client.apiURL, url.PathEscape(ref.Namespace), url.PathEscape(ref.Name))
+	request, err := client.newRequest(ctx, http.MethodGet, secretURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kubernetes API responded %s to GET: %s", response.Status, apiMessage(response))
+	}
+	var secret struct {
+		Metadata secretMetadata `json:"metadata"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&secret); err != nil {
+		return nil, err
+	}
+	return &secret.Metadata, nil
+}
+
+// send returns the status code for successful requests and conflicts, and an error for other responses
+func (client *Client) send(ctx context.Context, method, target, contentType string, body interface{}) (int, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return 0, err
+	}
+	request, err := client.newRequest(ctx, method, target, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", contentType)
+
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 == 2 || response.StatusCode == http.StatusConflict {
+		return response.StatusCode, nil
+	}
+	return response.StatusCode, fmt.Errorf("kubernetes API responded %s to %s: %s", response.Status, method, apiMessage(response))
+}
+
+// newRequest creates a request authorized with the service account token
+func (client *Client) newRequest(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+	token, err := ioutil.ReadFile(client.tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read Kubernetes token: %v", err)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	return request, nil
+}
+
+// apiMessage returns the message of a Kubernetes Status response
+func apiMessage(response *http.Response) string {
+	var status struct {
+		Message string `json:"message"`
+	}
+	body, _ := ioutil.ReadAll(response.Body)
+	if json.Unmarshal(body, &status) == nil && status.Message != "" {
+		return status.Message
+	}
+	return strings.TrimSpace(string(body))
+}
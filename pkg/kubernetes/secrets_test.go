@@ -0,0 +1,179 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// fakeAPIServer stores secrets like the Kubernetes API server does for create, get and merge patch
+type fakeAPIServer struct {
+	mutex    sync.Mutex
+	secrets  map[string]map[string]interface{}
+	labels   map[string]interface{}
+	requests []string
+	token    string
+}
+
+func (api *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	api.requests = append(api.requests, r.Method+" "+r.URL.Path)
+	if r.Header.Get("Authorization") != "Bearer "+api.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"kind":"Status","message":"Unauthorized"}`))
+		return
+	}
+	var body map[string]interface{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/namespaces/appx/secrets":
+		name := body["metadata"].(map[string]interface{})["name"].(string)
+		if _, exists := api.secrets["appx/"+name]; exists {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		api.secrets["appx/"+name] = body["stringData"].(map[string]interface{})
+		api.labels["appx/"+name] = body["metadata"].(map[string]interface{})["labels"]
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/namespaces/appx/secrets/s3-credentials":
+		if _, exists := api.secrets["appx/s3-credentials"]; !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"metadata": map[string]interface{}{"resourceVersion": "42", "labels": api.labels["appx/s3-credentials"]}})
+	case r.Method == http.MethodPatch && r.URL.Path == "/api/v1/namespaces/appx/secrets/s3-credentials":
+		if r.Header.Get("Content-Type") != "application/merge-patch+json" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		if body["metadata"].(map[string]interface{})["resourceVersion"] != "42" {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		for key, value := range body["stringData"].(map[string]interface{}) {
+			api.secrets["appx/s3-credentials"][key] = value
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"kind":"Status","message":"secrets is forbidden"}`))
+	}
+}
+
+func newTestClient(t *testing.T) (*Client, *fakeAPIServer) {
+	api := &fakeAPIServer{secrets: map[string]map[string]interface{}{}, labels: map[string]interface{}{}, token: "sa-token"}
+	server := httptest.NewTLSServer(api)
+	t.Cleanup(server.Close)
+
+	dir, err := ioutil.TempDir("", "kubernetes")
+	assert.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	tokenFile := filepath.Join(dir, "token")
+	caFile := filepath.Join(dir, "ca.crt")
+	assert.Nil(t, ioutil.WriteFile(tokenFile, []byte("sa-token\n"), 0600))
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.Nil(t, ioutil.WriteFile(caFile, caPEM, 0600))
+
+	client, err := NewClient(&Config{Enabled: true, APIURL: server.URL, TokenFile: tokenFile, CAFile: caFile, Namespaces: []string{"appx", "other"}})
+	assert.Nil(t, err)
+	return client, api
+}
+
+func TestWriteSecret(t *testing.T) {
+	ref := SecretReference{Namespace: "appx", Name: "s3-credentials"}
+
+	t.Run("Should create the secret", func(t *testing.T) {
+		client, api := newTestClient(t)
+
+		err := client.WriteSecret(context.Background(), ref, map[string]string{"accessKey": "appxuser", "secretKey": "s3cret"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "s3cret", api.secrets["appx/s3-credentials"]["secretKey"])
+		assert.Equal(t, []string{"POST /api/v1/namespaces/appx/secrets"}, api.requests)
+	})
+
+	t.Run("Should merge into an existing secret managed by Fiona", func(t *testing.T) {
+		client, api := newTestClient(t)
+		api.secrets["appx/s3-credentials"] = map[string]interface{}{"other": "kept", "secretKey": "old"}
+		api.labels["appx/s3-credentials"] = map[string]interface{}{managedByLabel: managedByFiona}
+
+		assert.Nil(t, client.CheckSecret(context.Background(), ref))
+		err := client.WriteSecret(context.Background(), ref, map[string]string{"secretKey": "new"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "new", api.secrets["appx/s3-credentials"]["secretKey"])
+		assert.Equal(t, "kept", api.secrets["appx/s3-credentials"]["other"])
+		assert.Equal(t, []string{
+			"GET /api/v1/namespaces/appx/secrets/s3-credentials",
+			"POST /api/v1/namespaces/appx/secrets",
+			"GET /api/v1/namespaces/appx/secrets/s3-credentials",
+			"PATCH /api/v1/namespaces/appx/secrets/s3-credentials",
+		}, api.requests)
+	})
+
+	t.Run("Should refuse an existing secret not managed by Fiona", func(t *testing.T) {
+		client, api := newTestClient(t)
+		api.secrets["appx/s3-credentials"] = map[string]interface{}{"secretKey": "theirs"}
+
+		checkErr := client.CheckSecret(context.Background(), ref)
+		err := client.WriteSecret(context.Background(), ref, map[string]string{"secretKey": "new"})
+
+		assert.True(t, errors.Is(checkErr, ErrSecretNotManaged))
+		assert.True(t, errors.Is(err, ErrSecretNotManaged))
+		assert.Equal(t, "theirs", api.secrets["appx/s3-credentials"]["secretKey"])
+		assert.NotContains(t, api.requests, "PATCH /api/v1/namespaces/appx/secrets/s3-credentials")
+	})
+
+	t.Run("Should refuse namespaces that are not allowed without calling the API", func(t *testing.T) {
+		client, api := newTestClient(t)
+
+		checkErr := client.CheckSecret(context.Background(), SecretReference{Namespace: "kube-system", Name: "s3"})
+		err := client.WriteSecret(context.Background(), SecretReference{Namespace: "kube-system", Name: "s3"}, map[string]string{})
+
+		assert.True(t, errors.Is(checkErr, ErrNamespaceNotAllowed))
+		assert.True(t, errors.Is(err, ErrNamespaceNotAllowed))
+		assert.Empty(t, api.requests)
+	})
+
+	t.Run("Should return the API error message", func(t *testing.T) {
+		client, _ := newTestClient(t)
+
+		err := client.WriteSecret(context.Background(), SecretReference{Namespace: "other", Name: "s3"}, map[string]string{})
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "secrets is forbidden")
+	})
+
+	t.Run("Should reject invalid names without calling the API", func(t *testing.T) {
+		client, api := newTestClient(t)
+
+		err := client.WriteSecret(context.Background(), SecretReference{Namespace: "appx", Name: "../configmaps/x"}, map[string]string{})
+
+		assert.Error(t, err)
+		assert.Empty(t, api.requests)
+	})
+}
+
+func TestInClusterDefaults(t *testing.T) {
+	os.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+	os.Setenv("KUBERNETES_SERVICE_PORT", "443")
+	defer os.Unsetenv("KUBERNETES_SERVICE_HOST")
+	defer os.Unsetenv("KUBERNETES_SERVICE_PORT")
+
+	config := &Config{Enabled: true}
+	config.InClusterDefaults()
+
+	assert.Equal(t, "https://10.0.0.1:443", config.APIURL)
+	assert.Equal(t, "/var/run/secrets/kubernetes.io/serviceaccount/token", config.TokenFile)
+}
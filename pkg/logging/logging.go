@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"github.com/sirupsen/logrus"
+)
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+type contextKey int
+
+const requestInfoKey contextKey = iota
+
+// RequestInfo holds the request scoped values that are added to every log line
+type RequestInfo struct {
+	ID     string
+	Route  string
+	Caller string
+}
+
+// Configure sets the format of the global logger
+func Configure(format string) error {
+	switch format {
+	case FormatText, "":
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	case FormatJSON:
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	return nil
+}
+
+// WithRequestInfo returns a copy of ctx carrying info
+func WithRequestInfo(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey, info)
+}
+
+func requestInfo(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(requestInfoKey).(*RequestInfo)
+	return info
+}
+
+// RequestID returns the id of the request handled in ctx, or an empty string
+func RequestID(ctx context.Context) string {
+	if info := requestInfo(ctx); info != nil {
+		return info.ID
+	}
+	return ""
+}
+
+// Route returns the template of the route matched for the request handled in ctx, or an empty string
+func Route(ctx context.Context) string {
+	if info := requestInfo(ctx); info != nil {
+		return info.Route
+	}
+	return ""
+}
+
+// SetCaller records the authenticated caller for the request handled in ctx
+func SetCaller(ctx context.Context, caller string) {
+	if info := requestInfo(ctx); info != nil {
+		info.Caller = caller
+	}
+}
+
+// FromContext returns a log entry carrying request id, route and caller of the request handled in ctx
+func FromContext(ctx context.Context) *logrus.Entry {
+	info := requestInfo(ctx)
+	if info == nil {
+		return logrus.NewEntry(logrus.StandardLogger())
+	}
+	fields := logrus.Fields{"requestId": info.ID, "route": info.Route}
+	if info.Caller != "" {
+		fields["caller"] = info.Caller
+	}
+	return logrus.WithFields(fields)
+}
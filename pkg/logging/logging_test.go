@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	t.Run("Should generate request id when none is supplied", func(t *testing.T) {
+		var idInHandler string
+		handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idInHandler = RequestID(r.Context())
+		}))
+		request, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+		response := httptest.NewRecorder()
+
+		handler.ServeHTTP(response, request)
+
+		assert.NotEmpty(t, idInHandler)
+		assert.Equal(t, idInHandler, response.Header().Get(RequestIDHeader))
+	})
+
+	t.Run("Should accept supplied request id and log route, caller and latency", func(t *testing.T) {
+		hook := test.NewGlobal()
+		router := mux.NewRouter()
+		router.Use(RouteMiddleware)
+		router.HandleFunc("/buckets/{bucketname}", func(w http.ResponseWriter, r *http.Request) {
+			SetCaller(r.Context(), "aurora-token")
+			w.WriteHeader(http.StatusCreated)
+		})
+		request, _ := http.NewRequest("POST", "http://localhost:8080/buckets/utv", nil)
+		request.Header.Set(RequestIDHeader, "abc-123")
+		response := httptest.NewRecorder()
+
+		Middleware(router).ServeHTTP(response, request)
+
+		assert.Equal(t, "abc-123", response.Header().Get(RequestIDHeader))
+		entry := hook.LastEntry()
+		assert.Equal(t, "abc-123", entry.Data["requestId"])
+		assert.Equal(t, "/buckets/{bucketname}", entry.Data["route"])
+		assert.Equal(t, "aurora-token", entry.Data["caller"])
+		assert.Equal(t, http.StatusCreated, entry.Data["status"])
+		assert.Contains(t, entry.Data, "latencyMs")
+		hook.Reset()
+	})
+
+	t.Run("Should log requests no route matches", func(t *testing.T) {
+		hook := test.NewGlobal()
+		request, _ := http.NewRequest("GET", "http://localhost:8080/nosuchroute", nil)
+		response := httptest.NewRecorder()
+
+		Middleware(mux.NewRouter()).ServeHTTP(response, request)
+
+		assert.Equal(t, http.StatusNotFound, response.Code)
+		assert.NotEmpty(t, response.Header().Get(RequestIDHeader))
+		assert.Equal(t, http.StatusNotFound, hook.LastEntry().Data["status"])
+		assert.Equal(t, "", hook.LastEntry().Data["route"])
+		hook.Reset()
+	})
+
+	t.Run("Should reject unknown log format", func(t *testing.T) {
+		assert.NotNil(t, Configure("xml"))
+		assert.Nil(t, Configure(FormatJSON))
+		assert.Nil(t, Configure(FormatText))
+	})
+}
@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gorilla/mux"
+	"net/http"
+	"time"
+)
+
+// RequestIDHeader carries the request id in both requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// Middleware accepts or generates a request id, returns it in the response and writes an access log line. It wraps
+// the whole router, so requests no route matches are logged too.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &RequestInfo{ID: requestIDFrom(r)}
+		w.Header().Set(RequestIDHeader, info.ID)
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		ctx := WithRequestInfo(r.Context(), info)
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		FromContext(ctx).WithFields(map[string]interface{}{
+			"method":    r.Method,
+			"path":      r.URL.Path,
+			"status":    recorder.status,
+			"latencyMs": time.Since(start).Milliseconds(),
+		}).Info("Request handled")
+	})
+}
+
+// RouteMiddleware records the template of the matched route for Middleware and later log lines. It is used inside
+// the router, where the route is known.
+func RouteMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info := requestInfo(r.Context()); info != nil {
+			if route := mux.CurrentRoute(r); route != nil {
+				info.Route, _ = route.GetPathTemplate()
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func requestIDFrom(r *http.Request) string {
+	if id := r.Header.Get(RequestIDHeader); id != "" && len(id) <= maxRequestIDLength {
+		return id
+	}
+	return newRequestID()
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().UTC().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+const namespace = "fiona"
+
+// Actions counted for users and policies
+const (
+	ActionCreated = "created"
+	ActionDeleted = "deleted"
+	ActionRotated = "rotated"
+)
+
+// Registry holds all fiona metrics together with the go and process collectors
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of handled API requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of API requests by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	users = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "users_total",
+		Help:      "Number of minio users created, deleted and rotated, a rotation giving an existing user a new secret.",
+	}, []string{"action"})
+
+	policies = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "policies_total",
+		Help:      "Number of minio policies created and deleted.",
+	}, []string{"action"})
+
+	minioCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "minio_call_duration_seconds",
+		Help:      "Latency of calls to minio by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	minioCallErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "minio_call_errors_total",
+		Help:      "Number of failed calls to minio by operation.",
+	}, []string{"operation"})
+
+	authenticationFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "authentication_failures_total",
+		Help:      "Number of rejected API requests.",
+	})
+
+	healthChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "health_checks_total",
+		Help:      "Number of health checks by resulting status.",
+	}, []string{"status"})
+)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		httpRequests,
+		httpRequestDuration,
+		users,
+		policies,
+		minioCallDuration,
+		minioCallErrors,
+		authenticationFailures,
+		healthChecks,
+	)
+}
+
+// Handler serves the metrics in the prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveMinioCall records latency and outcome of a call to minio
+func ObserveMinioCall(operation string, start time.Time, err error) {
+	minioCallDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		minioCallErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// CountUser counts a user action
+func CountUser(action string) {
+	users.WithLabelValues(action).Inc()
+}
+
+// CountPolicy counts a policy action
+func CountPolicy(action string) {
+	policies.WithLabelValues(action).Inc()
+}
+
+// CountAuthenticationFailure counts a rejected request
+func CountAuthenticationFailure() {
+	authenticationFailures.Inc()
+}
+
+// CountHealthCheck counts a health check outcome
+func CountHealthCheck(status string) {
+	healthChecks.WithLabelValues(status).Inc()
+}
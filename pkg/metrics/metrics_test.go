@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Run("Should count minio call errors per operation", func(t *testing.T) {
+		before := testutil.ToFloat64(minioCallErrors.WithLabelValues("AddUser"))
+
+		ObserveMinioCall("AddUser", time.Now(), nil)
+		ObserveMinioCall("AddUser", time.Now(), errors.New("minio is down"))
+
+		assert.Equal(t, before+1, testutil.ToFloat64(minioCallErrors.WithLabelValues("AddUser")))
+	})
+
+	t.Run("Should count requests per route template and status code", func(t *testing.T) {
+		router := mux.NewRouter()
+		router.Use(logging.RouteMiddleware)
+		router.HandleFunc("/buckets/{bucketname}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+		})
+		counter := httpRequests.WithLabelValues("/buckets/{bucketname}", "POST", "201")
+		before := testutil.ToFloat64(counter)
+
+		request, _ := http.NewRequest("POST", "http://localhost:8080/buckets/utv", nil)
+		logging.Middleware(Middleware(router)).ServeHTTP(httptest.NewRecorder(), request)
+
+		assert.Equal(t, before+1, testutil.ToFloat64(counter))
+	})
+
+	t.Run("Should count requests no route matches", func(t *testing.T) {
+		counter := httpRequests.WithLabelValues("unknown", "GET", "404")
+		before := testutil.ToFloat64(counter)
+
+		request, _ := http.NewRequest("GET", "http://localhost:8080/nosuchroute", nil)
+		logging.Middleware(Middleware(mux.NewRouter())).ServeHTTP(httptest.NewRecorder(), request)
+
+		assert.Equal(t, before+1, testutil.ToFloat64(counter))
+	})
+
+	t.Run("Should expose metrics in prometheus format", func(t *testing.T) {
+		CountAuthenticationFailure()
+		request, _ := http.NewRequest("GET", "http://localhost:8081/metrics", nil)
+		response := httptest.NewRecorder()
+
+		Handler().ServeHTTP(response, request)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Contains(t, response.Body.String(), "fiona_authentication_failures_total")
+	})
+}
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// Middleware counts and times requests per route template, method and status code. The route template is the one
+// logging.RouteMiddleware recorded, so it must be wrapped by logging.Middleware. Requests no route matches are counted
+// as route "unknown".
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		route := logging.Route(r.Context())
+		if route == "" {
+			route = "unknown"
+		}
+		code := strconv.Itoa(recorder.status)
+		httpRequests.WithLabelValues(route, r.Method, code).Inc()
+		httpRequestDuration.WithLabelValues(route, r.Method, code).Observe(time.Since(start).Seconds())
+	})
+}
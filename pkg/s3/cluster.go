@@ -0,0 +1,152 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"github.com/minio/minio-go/v6"
+	"github.com/minio/minio/pkg/madmin"
+	"github.com/skatteetaten/fiona/pkg/jobs"
+	"sort"
+	"sync"
+)
+
+// DefaultClusterName is the name of the cluster configured with the FIONA_S3_* settings
+const DefaultClusterName = "default"
+
+// ClusterConfig describes a named minio cluster in the clusters file
+type ClusterConfig struct {
+	Name   string `json:"name" yaml:"name"`
+	Host   string `json:"host" yaml:"host"`
+	Port   string `json:"port" yaml:"port"`
+	UseSSL bool   `json:"useSsl" yaml:"useSsl"`
+	Region string `json:"region" yaml:"region"`
+	// CredentialsFile is a YAML or JSON file with accessKey and secretKey for the cluster admin
+	CredentialsFile string `json:"credentialsFile" yaml:"credentialsFile"`
+	// STSCredentialsFile is an optional file with accessKey and secretKey of the user temporary credentials are assumed from
+	STSCredentialsFile string `json:"stsCredentialsFile" yaml:"stsCredentialsFile"`
+}
+
+// Cluster holds the clients of a named minio cluster
+type Cluster struct {
+	Name        string
+	Config      *Config
+	AdminClient *madmin.AdminClient
+	AdminAPI    *AdminAPI
+	Client      *minio.Client
+	Usage       *UsageMonitor
+	Jobs        *jobs.Manager
+}
+
+// ClusterPool holds the clients of every configured minio cluster, keyed by name
+type ClusterPool struct {
+	clusters map[string]*Cluster
+	running  sync.WaitGroup
+}
+
+// NewClusterPool creates clients for the default cluster and each of the named clusters
+func NewClusterPool(defaultConfig *Config, clusterConfigs map[string]Config) (*ClusterPool, error) {
+	pool := &ClusterPool{clusters: map[string]*Cluster{}}
+	if err := pool.add(DefaultClusterName, defaultConfig); err != nil {
+		return nil, err
+	}
+	for name := range clusterConfigs {
+		clusterConfig := clusterConfigs[name]
+		if err := pool.add(name, &clusterConfig); err != nil {
+			return nil, err
+		}
+	}
+	return pool, nil
+}
+
+func (pool *ClusterPool) add(name string, config *Config) error {
+	if _, exists := pool.clusters[name]; exists {
+		return fmt.Errorf("cluster %s is configured more than once", name)
+	}
+	adminClient, err := NewAdmClient(config)
+	if err != nil {
+		return fmt.Errorf("could not create admin client for cluster %s: %v", name, err)
+	}
+	adminAPI, err := NewAdminAPI(config)
+	if err != nil {
+		return fmt.Errorf("could not create admin API client for cluster %s: %v", name, err)
+	}
+	client, err := NewClient(config)
+	if err != nil {
+		return fmt.Errorf("could not create client for cluster %s: %v", name, err)
+	}
+	jobManager, err := jobs.NewManager(&config.Jobs, name)
+	if err != nil {
+		return err
+	}
+	pool.clusters[name] = &Cluster{
+		Name:        name,
+		Config:      config,
+		AdminClient: adminClient,
+		AdminAPI:    adminAPI,
+		Client:      client,
+		Usage:       NewUsageMonitor(config, client, adminClient),
+		Jobs:        jobManager,
+	}
+	return nil
+}
+
+// Get returns the named cluster
+func (pool *ClusterPool) Get(name string) (*Cluster, bool) {
+	cluster, ok := pool.clusters[name]
+	return cluster, ok
+}
+
+// Default returns the cluster configured with the FIONA_S3_* settings
+func (pool *ClusterPool) Default() *Cluster {
+	return pool.clusters[DefaultClusterName]
+}
+
+// Clusters returns all clusters ordered by name
+func (pool *ClusterPool) Clusters() []*Cluster {
+	var clusters []*Cluster
+	for _, cluster := range pool.clusters {
+		clusters = append(clusters, cluster)
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].Name < clusters[j].Name })
+	return clusters
+}
+
+// CheckAdminAPIs checks that every cluster serves the admin APIs Fiona calls
+func (pool *ClusterPool) CheckAdminAPIs(ctx context.Context) error {
+	for _, cluster := range pool.Clusters() {
+		if err := CheckAdminAPIs(ctx, cluster.AdminClient, cluster.AdminAPI); err != nil {
+			return fmt.Errorf("cluster %s: %v", cluster.Name, err)
+		}
+	}
+	return nil
+}
+
+// MonitorUsage scans the paths with a quota in every cluster in the background until ctx is done
+func (pool *ClusterPool) MonitorUsage(ctx context.Context) {
+	for _, cluster := range pool.Clusters() {
+		cluster := cluster
+		pool.start(func() { cluster.Usage.Run(ctx) })
+	}
+}
+
+// RunJobs runs the background jobs of every cluster until ctx is done. The runners of every kind of job must be
+// registered first.
+func (pool *ClusterPool) RunJobs(ctx context.Context) {
+	for _, cluster := range pool.Clusters() {
+		cluster := cluster
+		pool.start(func() { cluster.Jobs.Run(ctx) })
+	}
+}
+
+// Wait waits until the usage monitors and job runners started have stopped
+func (pool *ClusterPool) Wait() {
+	pool.running.Wait()
+}
+
+func (pool *ClusterPool) start(run func()) {
+	pool.running.Add(1)
+	go func() {
+		defer pool.running.Done()
+		run()
+	}()
+}
@@ -0,0 +1,317 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"github.com/minio/minio-go/v6"
+	"github.com/minio/minio/pkg/madmin"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"github.com/skatteetaten/fiona/pkg/metrics"
+	"sort"
+	"strings"
+)
+
+// DecommissionBatchSize is the number of objects archived or deleted between progress reports
+const DecommissionBatchSize = 1000
+
+// ArchiveRoot is the reserved prefix archived paths are moved below, so archives never mix with the paths of tenants
+const ArchiveRoot = ".fiona/archive/"
+
+// Ways of disposing of the objects in a decommissioned path
+const (
+	DisposalArchive = "archive"
+	DisposalDelete  = "delete"
+)
+
+// DecommissionInput provides input for decommissioning a path
+type DecommissionInput struct {
+	Bucketname    string `json:"bucketname"`
+	Path          string `json:"path"`
+	Disposal      string `json:"disposal"`                // DisposalArchive or DisposalDelete
+	ArchiveBucket string `json:"archiveBucket,omitempty"` // Defaults to Bucketname
+	ArchivePrefix string `json:"archivePrefix,omitempty"` // Below ArchiveRoot
+}
+
+// DecommissionProgress reports what has been done decommissioning a path
+type DecommissionProgress struct {
+	RemovedUsers    []string `json:"removedUsers"`
+	RemovedGroups   []string `json:"removedGroups"`
+	RemovedPolicies []string `json:"removedPolicies"`
+	Objects         int      `json:"objects"`     // Objects found in the path
+	ObjectsDone     int      `json:"objectsDone"` // Objects archived or deleted so far
+	ArchivedTo      string   `json:"archivedTo,omitempty"`
+}
+
+// PathDecommissioner retires a path, removing the access to it and archiving or deleting its objects
+type PathDecommissioner interface {
+	DecommissionPath(ctx context.Context, input *DecommissionInput, report func(DecommissionProgress)) error
+}
+
+type decommissionAdminClient interface {
+	policyInfoClient
+	ListUsers() (map[string]madmin.UserInfo, error)
+	SetUserStatus(accessKey string, status madmin.AccountStatus) error
+	RemoveUser(accessKey string) error
+	RemoveCannedPolicy(policyName string) error
+	ListGroups() ([]string, error)
+	GetGroupDescription(group string) (*madmin.GroupDesc, error)
+	UpdateGroupMembers(g madmin.GroupAddRemove) error
+}
+
+type decommissionObjectClient interface {
+	objectLister
+	CopyObject(dst minio.DestinationInfo, src minio.SourceInfo) error
+	RemoveObjects(bucketName string, objectsCh <-chan string) <-chan minio.RemoveObjectError
+}
+
+// MinioPathDecommissioner decommissions paths with the minio clients
+type MinioPathDecommissioner struct {
+	admin   decommissionAdminClient
+	objects decommissionObjectClient
+}
+
+// NewMinioPathDecommissioner is a factory for MinioPathDecommissioner
+func NewMinioPathDecommissioner(minioClient *minio.Client, adminClient *madmin.AdminClient) *MinioPathDecommissioner {
+	return &MinioPathDecommissioner{admin: adminClient, objects: minioClient}
+}
+
+// ArchiveLocation returns the bucket and prefix the objects of the path are archived to, below ArchiveRoot
+func ArchiveLocation(input *DecommissionInput) (string, string) {
+	bucket, prefix := input.ArchiveBucket, ArchiveRoot
+	if bucket == "" {
+		bucket = input.Bucketname
+	}
+	if input.ArchivePrefix != "" {
+		prefix += normalizedPrefix(input.ArchivePrefix)
+	}
+	return bucket, prefix + input.Path + "/"
+}
+
+// ValidateDecommissionInput checks the disposal and the archive prefix
+func ValidateDecommissionInput(input *DecommissionInput) error {
+	switch input.Disposal {
+	case DisposalDelete:
+		return nil
+	case DisposalArchive:
+	default:
+		return fmt.Errorf("disposal must be %s or %s", DisposalArchive, DisposalDelete)
+	}
+	if strings.HasPrefix(input.ArchivePrefix, "/") {
+		return fmt.Errorf("archive prefix %q must be relative to %s", input.ArchivePrefix, ArchiveRoot)
+	}
+	return nil
+}
+
+// DecommissionPath disables and removes the app users, access groups and policies of the path, and then archives or
+// deletes its objects in batches. Users with access to other paths are only removed from the groups of the path.
+// report is called after every step, and DecommissionPath stops between batches when ctx is done.
+func (decommissioner *MinioPathDecommissioner) DecommissionPath(ctx context.Context, input *DecommissionInput, report func(DecommissionProgress)) error {
+	if err := ValidateDecommissionInput(input); err != nil {
+		return err
+	}
+	progress := DecommissionProgress{}
+	if err := decommissioner.removeAccess(ctx, input.Bucketname, input.Path, &progress); err != nil {
+		return err
+	}
+	report(progress)
+
+	names, err := listObjectNames(ctx, decommissioner.objects, input.Bucketname, input.Path+"/")
+	if err != nil {
+		return err
+	}
+	progress.Objects = len(names)
+	var archiveBucket, archivePrefix string
+	if input.Disposal == DisposalArchive {
+		archiveBucket, archivePrefix = ArchiveLocation(input)
+		progress.ArchivedTo = archiveBucket + "/" + archivePrefix
+	}
+	report(progress)
+
+	for start := 0; start < len(names); start += DecommissionBatchSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end := start + DecommissionBatchSize
+		if end > len(names) {
+			end = len(names)
+		}
+		batch := names[start:end]
+		if input.Disposal == DisposalArchive {
+			if err := decommissioner.copyObjects(ctx, input.Bucketname, input.Path+"/", archiveBucket, archivePrefix, batch); err != nil {
+				return err
+			}
+		}
+		if err := decommissioner.removeObjects(ctx, input.Bucketname, batch); err != nil {
+			return err
+		}
+		progress.ObjectsDone = end
+		report(progress)
+	}
+	logging.FromContext(ctx).Infof("Success: Decommissioned %s/%s, %d objects disposed of by %s", input.Bucketname, input.Path, len(names), input.Disposal)
+	return nil
+}
+
+// removeAccess disables every app user of the path before removing users, groups and policies
+func (decommissioner *MinioPathDecommissioner) removeAccess(ctx context.Context, bucket, path string, progress *DecommissionProgress) error {
+	var users map[string]madmin.UserInfo
+	err := Instrument(ctx, "ListUsers", func() (err error) {
+		users, err = decommissioner.admin.ListUsers()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	var groups []string
+	err = Instrument(ctx, "ListGroups", func() (err error) {
+		groups, err = decommissioner.admin.ListGroups()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	var pathUsers []string
+	for username, userInfo := range users {
+		granted, err := grantsPathAccess(ctx, decommissioner.admin, userInfo, username, bucket, path)
+		if err != nil {
+			return err
+		}
+		if !granted {
+			continue
+		}
+		only, err := onlyGrantsPathAccess(ctx, decommissioner.admin, userInfo, username, bucket, path)
+		if err != nil {
+			return err
+		}
+		if only {
+			pathUsers = append(pathUsers, username)
+		}
+	}
+	sort.Strings(pathUsers)
+	for _, username := range pathUsers {
+		err := Instrument(ctx, "SetUserStatus", func() error {
+			return decommissioner.admin.SetUserStatus(username, madmin.AccountDisabled)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, group := range groups {
+		if !IsPathAccessGroup(group, bucket, path) {
+			continue
+		}
+		if err := decommissioner.removeGroup(ctx, group); err != nil {
+			return err
+		}
+		progress.RemovedGroups = append(progress.RemovedGroups, group)
+		progress.RemovedPolicies = append(progress.RemovedPolicies, group)
+	}
+	for _, username := range pathUsers {
+		err := Instrument(ctx, "RemoveUser", func() error {
+			return decommissioner.admin.RemoveUser(username)
+		})
+		if err != nil && !IsNotFound(err) {
+			return err
+		}
+		metrics.CountUser(metrics.ActionDeleted)
+		progress.RemovedUsers = append(progress.RemovedUsers, username)
+		if policyName := users[username].PolicyName; policyName != "" {
+			if err := decommissioner.removePolicy(ctx, policyName); err != nil {
+				return err
+			}
+			progress.RemovedPolicies = append(progress.RemovedPolicies, policyName)
+		}
+	}
+	return nil
+}
+
+// onlyGrantsPathAccess tells whether every policy and group of the user grants access to bucket/path only
+func onlyGrantsPathAccess(ctx context.Context, policies policyInfoClient, userInfo madmin.UserInfo, username, bucket, path string) (bool, error) {
+	for _, group := range userInfo.MemberOf {
+		if !IsPathAccessGroup(group, bucket, path) {
+			return false, nil
+		}
+	}
+	if userInfo.PolicyName == "" {
+		return true, nil
+	}
+	return policyGrantsPathAccess(ctx, policies, userInfo.PolicyName, username, bucket, path)
+}
+
+// removeGroup removes all members from the group, which removes the group, and then its policy
+func (decommissioner *MinioPathDecommissioner) removeGroup(ctx context.Context, group string) error {
+	var description *madmin.GroupDesc
+	err := Instrument(ctx, "GetGroupDescription", func() (err error) {
+		description, err = decommissioner.admin.GetGroupDescription(group)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(description.Members) > 0 {
+		err = Instrument(ctx, "UpdateGroupMembers", func() error {
+			return decommissioner.admin.UpdateGroupMembers(madmin.GroupAddRemove{Group: group, Members: description.Members, IsRemove: true})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	err = Instrument(ctx, "UpdateGroupMembers", func() error {
+		return decommissioner.admin.UpdateGroupMembers(madmin.GroupAddRemove{Group: group, IsRemove: true})
+	})
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	return decommissioner.removePolicy(ctx, group)
+}
+
+func (decommissioner *MinioPathDecommissioner) removePolicy(ctx context.Context, policyName string) error {
+	err := Instrument(ctx, "RemoveCannedPolicy", func() error {
+		return decommissioner.admin.RemoveCannedPolicy(policyName)
+	})
+	if err != nil {
+		return err
+	}
+	metrics.CountPolicy(metrics.ActionDeleted)
+	return nil
+}
+
+// copyObjects copies the objects below prefix to the same names below archivePrefix in archiveBucket
+func (decommissioner *MinioPathDecommissioner) copyObjects(ctx context.Context, bucket, prefix, archiveBucket, archivePrefix string, names []string) error {
+	for _, name := range names {
+		destination, err := minio.NewDestinationInfo(archiveBucket, archivePrefix+strings.TrimPrefix(name, prefix), nil, nil)
+		if err != nil {
+			return err
+		}
+		err = Instrument(ctx, "CopyObject", func() error {
+			return decommissioner.objects.CopyObject(destination, minio.NewSourceInfo(bucket, name, nil))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (decommissioner *MinioPathDecommissioner) removeObjects(ctx context.Context, bucket string, names []string) error {
+	return Instrument(ctx, "RemoveObjects", func() error {
+		namesCh := make(chan string, len(names))
+		for _, name := range names {
+			namesCh <- name
+		}
+		close(namesCh)
+		failed := 0
+		var err error
+		for removeErr := range decommissioner.objects.RemoveObjects(bucket, namesCh) {
+			if failed == 0 {
+				err = fmt.Errorf("could not remove %s. %v", removeErr.ObjectName, removeErr.Err)
+			}
+			failed++
+		}
+		if failed > 1 {
+			err = fmt.Errorf("%v, and %d more objects", err, failed-1)
+		}
+		return err
+	})
+}
@@ -0,0 +1,208 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"github.com/minio/minio-go/v6"
+	"github.com/minio/minio/pkg/madmin"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type testDecommissionAdminClient struct {
+	testPolicies
+	users           map[string]madmin.UserInfo
+	groups          map[string][]string
+	disabled        []string
+	removedPolicies []string
+}
+
+func (tdac *testDecommissionAdminClient) ListUsers() (map[string]madmin.UserInfo, error) {
+	users := map[string]madmin.UserInfo{}
+	for username, userInfo := range tdac.users {
+		users[username] = userInfo
+	}
+	return users, nil
+}
+
+func (tdac *testDecommissionAdminClient) SetUserStatus(accessKey string, status madmin.AccountStatus) error {
+	tdac.disabled = append(tdac.disabled, accessKey)
+	return nil
+}
+
+func (tdac *testDecommissionAdminClient) RemoveUser(accessKey string) error {
+	delete(tdac.users, accessKey)
+	return nil
+}
+
+func (tdac *testDecommissionAdminClient) RemoveCannedPolicy(policyName string) error {
+	tdac.removedPolicies = append(tdac.removedPolicies, policyName)
+	return nil
+}
+
+func (tdac *testDecommissionAdminClient) ListGroups() ([]string, error) {
+	var groups []string
+	for group := range tdac.groups {
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+func (tdac *testDecommissionAdminClient) GetGroupDescription(group string) (*madmin.GroupDesc, error) {
+	return &madmin.GroupDesc{Name: group, Members: tdac.groups[group]}, nil
+}
+
+func (tdac *testDecommissionAdminClient) UpdateGroupMembers(g madmin.GroupAddRemove) error {
+	if len(g.Members) == 0 {
+		delete(tdac.groups, g.Group)
+	} else {
+		tdac.groups[g.Group] = nil
+	}
+	return nil
+}
+
+type testDecommissionObjectClient struct {
+	testObjectLister
+	copies  []string
+	removed []string
+}
+
+func (tdoc *testDecommissionObjectClient) CopyObject(dst minio.DestinationInfo, src minio.SourceInfo) error {
+	tdoc.copies = append(tdoc.copies, fmt.Sprintf("%+v", dst))
+	return nil
+}
+
+func (tdoc *testDecommissionObjectClient) RemoveObjects(bucketName string, objectsCh <-chan string) <-chan minio.RemoveObjectError {
+	for name := range objectsCh {
+		tdoc.removed = append(tdoc.removed, bucketName+"/"+name)
+	}
+	errors := make(chan minio.RemoveObjectError)
+	close(errors)
+	return errors
+}
+
+func newTestDecommissioner() (*MinioPathDecommissioner, *testDecommissionAdminClient, *testDecommissionObjectClient) {
+	admin := &testDecommissionAdminClient{
+		testPolicies: testPolicies{"utvappx_appuser_RW": "utv/appx", "utvappy_otheruser_R": "utv/appy"},
+		users: map[string]madmin.UserInfo{
+			"appuser":    {PolicyName: "utvappx_appuser_RW"},
+			"groupuser":  {MemberOf: []string{"fiona-utv-appx-3030f118-r"}},
+			"shareduser": {MemberOf: []string{"fiona-utv-appx-3030f118-r", "fiona-utv-appy-bdf2ae03-r"}},
+			"otheruser":  {PolicyName: "utvappy_otheruser_R"},
+		},
+		groups: map[string][]string{
+			"fiona-utv-appx-3030f118-r": {"groupuser", "shareduser"},
+			"fiona-utv-appy-bdf2ae03-r": {"shareduser"},
+		},
+	}
+	var objects []minio.ObjectInfo
+	for i := 0; i < DecommissionBatchSize+1; i++ {
+		objects = append(objects, minio.ObjectInfo{Key: fmt.Sprintf("appx/data/%d.json", i)})
+	}
+	objectClient := &testDecommissionObjectClient{testObjectLister: testObjectLister{objects: map[string][]minio.ObjectInfo{"utv/appx/": objects}}}
+	return &MinioPathDecommissioner{admin: admin, objects: objectClient}, admin, objectClient
+}
+
+func TestDecommissionPath(t *testing.T) {
+	t.Run("Should remove the users, groups and policies of the path only", func(t *testing.T) {
+		decommissioner, admin, _ := newTestDecommissioner()
+		var reports []DecommissionProgress
+
+		err := decommissioner.DecommissionPath(context.Background(), &DecommissionInput{Bucketname: "utv", Path: "appx", Disposal: DisposalDelete}, func(progress DecommissionProgress) {
+			reports = append(reports, progress)
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"appuser", "groupuser"}, admin.disabled)
+		assert.Len(t, admin.users, 2)
+		assert.Contains(t, admin.users, "shareduser")
+		assert.Equal(t, map[string][]string{"fiona-utv-appy-bdf2ae03-r": {"shareduser"}}, admin.groups)
+		assert.Equal(t, []string{"fiona-utv-appx-3030f118-r", "utvappx_appuser_RW"}, admin.removedPolicies)
+		progress := reports[len(reports)-1]
+		assert.Equal(t, []string{"appuser", "groupuser"}, progress.RemovedUsers)
+		assert.Equal(t, []string{"fiona-utv-appx-3030f118-r"}, progress.RemovedGroups)
+	})
+
+	t.Run("Should leave the users and groups of paths starting with the path name", func(t *testing.T) {
+		admin := &testDecommissionAdminClient{
+			testPolicies: testPolicies{"utvapp_appuser_R": "utv/app", "utvapp-x_dashuser_R": "utv/app-x"},
+			users: map[string]madmin.UserInfo{
+				"appuser":    {PolicyName: "utvapp_appuser_R"},
+				"dashuser":   {PolicyName: "utvapp-x_dashuser_R"},
+				"groupuser":  {MemberOf: []string{"fiona-utv-app-5326db46-r"}},
+				"dashgroups": {MemberOf: []string{"fiona-utv-app-x-d8556038-r"}},
+			},
+			groups: map[string][]string{
+				"fiona-utv-app-5326db46-r":   {"groupuser"},
+				"fiona-utv-app-x-d8556038-r": {"dashgroups"},
+			},
+		}
+		decommissioner := &MinioPathDecommissioner{admin: admin, objects: &testDecommissionObjectClient{}}
+
+		err := decommissioner.DecommissionPath(context.Background(), &DecommissionInput{Bucketname: "utv", Path: "app", Disposal: DisposalDelete}, func(DecommissionProgress) {})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"appuser", "groupuser"}, admin.disabled)
+		assert.Equal(t, map[string][]string{"fiona-utv-app-x-d8556038-r": {"dashgroups"}}, admin.groups)
+		assert.Equal(t, []string{"fiona-utv-app-5326db46-r", "utvapp_appuser_R"}, admin.removedPolicies)
+		assert.Contains(t, admin.users, "dashuser")
+		assert.Contains(t, admin.users, "dashgroups")
+	})
+
+	t.Run("Should delete the objects in batches", func(t *testing.T) {
+		decommissioner, _, objectClient := newTestDecommissioner()
+		var reports []DecommissionProgress
+
+		err := decommissioner.DecommissionPath(context.Background(), &DecommissionInput{Bucketname: "utv", Path: "appx", Disposal: DisposalDelete}, func(progress DecommissionProgress) {
+			reports = append(reports, progress)
+		})
+
+		assert.Nil(t, err)
+		assert.Len(t, objectClient.removed, DecommissionBatchSize+1)
+		assert.Empty(t, objectClient.copies)
+		assert.Len(t, reports, 4)
+		assert.Equal(t, DecommissionBatchSize, reports[2].ObjectsDone)
+		assert.Equal(t, DecommissionBatchSize+1, reports[3].ObjectsDone)
+		assert.Equal(t, DecommissionBatchSize+1, reports[3].Objects)
+	})
+
+	t.Run("Should archive the objects before removing them", func(t *testing.T) {
+		decommissioner, _, objectClient := newTestDecommissioner()
+		var progress DecommissionProgress
+
+		err := decommissioner.DecommissionPath(context.Background(), &DecommissionInput{Bucketname: "utv", Path: "appx", Disposal: DisposalArchive, ArchiveBucket: "archive", ArchivePrefix: "retired"}, func(reported DecommissionProgress) {
+			progress = reported
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "archive/.fiona/archive/retired/appx/", progress.ArchivedTo)
+		assert.Len(t, objectClient.copies, DecommissionBatchSize+1)
+		assert.Contains(t, objectClient.copies[0], "{bucket:archive object:.fiona/archive/retired/appx/data/0.json ")
+		assert.Len(t, objectClient.removed, DecommissionBatchSize+1)
+	})
+
+	t.Run("Should stop between batches when cancelled", func(t *testing.T) {
+		decommissioner, _, objectClient := newTestDecommissioner()
+		ctx, cancel := context.WithCancel(context.Background())
+
+		err := decommissioner.DecommissionPath(ctx, &DecommissionInput{Bucketname: "utv", Path: "appx", Disposal: DisposalDelete}, func(progress DecommissionProgress) {
+			if progress.ObjectsDone > 0 {
+				cancel()
+			}
+		})
+
+		assert.Equal(t, context.Canceled, err)
+		assert.Len(t, objectClient.removed, DecommissionBatchSize)
+	})
+
+	t.Run("Should archive below the reserved archive root only", func(t *testing.T) {
+		assert.Error(t, ValidateDecommissionInput(&DecommissionInput{Bucketname: "utv", Path: "appx", Disposal: DisposalArchive, ArchivePrefix: "/appy"}))
+		assert.Error(t, ValidateDecommissionInput(&DecommissionInput{Bucketname: "utv", Path: "appx", Disposal: "move"}))
+		assert.Nil(t, ValidateDecommissionInput(&DecommissionInput{Bucketname: "utv", Path: "appx", Disposal: DisposalArchive}))
+
+		_, prefix := ArchiveLocation(&DecommissionInput{Bucketname: "utv", Path: "appx", Disposal: DisposalArchive})
+		assert.Equal(t, ".fiona/archive/appx/", prefix)
+		_, prefix = ArchiveLocation(&DecommissionInput{Bucketname: "utv", Path: "appx", Disposal: DisposalArchive, ArchivePrefix: "appy"})
+		assert.Equal(t, ".fiona/archive/appy/appx/", prefix, "an archive prefix named like a path stays out of that path")
+	})
+}
@@ -0,0 +1,20 @@
+package s3
+
+import (
+	"context"
+	"github.com/skatteetaten/fiona/pkg/metrics"
+	"github.com/skatteetaten/fiona/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"time"
+)
+
+// Instrument traces a call to minio as a child span of ctx and records its latency and outcome in the metrics. Every
+// call Fiona makes to minio goes through it, so calls are traced and measured the same way in all packages.
+func Instrument(ctx context.Context, operation string, call func() error) error {
+	_, span := tracing.StartSpan(ctx, "minio."+operation, attribute.String("minio.operation", operation))
+	start := time.Now()
+	err := call()
+	metrics.ObserveMinioCall(operation, start, err)
+	tracing.EndSpan(span, err)
+	return err
+}
@@ -0,0 +1,189 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"github.com/minio/minio-go/v6"
+	"sync"
+)
+
+// LifecycleRulePrefix starts the ID of the lifecycle rule Fiona owns for a path
+const LifecycleRulePrefix = "fiona-"
+
+// PathLifecycle are the lifecycle rules for the objects in a path. Zero days means no rule.
+type PathLifecycle struct {
+	ExpireAfterDays           int `json:"expireAfterDays,omitempty"`
+	NoncurrentExpireAfterDays int `json:"noncurrentExpireAfterDays,omitempty"` // Only for versioned buckets
+}
+
+// LifecycleManager manages the lifecycle rules of paths
+type LifecycleManager interface {
+	SetPathLifecycle(ctx context.Context, bucket, path string, lifecycle *PathLifecycle) error
+	GetPathLifecycle(ctx context.Context, bucket, path string) (*PathLifecycle, error)
+}
+
+type lifecycleClient interface {
+	GetBucketLifecycle(bucketName string) (string, error)
+	SetBucketLifecycle(bucketName, lifecycle string) error
+}
+
+// MinioLifecycleManager merges the rule of a path into the bucket lifecycle configuration, keeping the rules of
+// other paths and rules not made by Fiona as they are
+type MinioLifecycleManager struct {
+	lifecycleClient
+}
+
+// lifecycleMutex serializes the read, merge and write of bucket lifecycle configurations within Fiona
+var lifecycleMutex sync.Mutex
+
+type lifecycleConfiguration struct {
+	XMLName xml.Name        `xml:"LifecycleConfiguration"`
+	Rules   []lifecycleRule `xml:"Rule"`
+}
+
+// lifecycleRule keeps the XML of a rule as is, so rules Fiona does not know are written back unchanged
+type lifecycleRule struct {
+	Content []byte `xml:",innerxml"`
+}
+
+type pathLifecycleRule struct {
+	XMLName xml.Name `xml:"Rule"`
+	ID      string   `xml:"ID"`
+	Status  string   `xml:"Status"`
+	Filter  struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"Filter"`
+	Expiration *struct {
+		Days int `xml:"Days"`
+	} `xml:"Expiration,omitempty"`
+	NoncurrentVersionExpiration *struct {
+		NoncurrentDays int `xml:"NoncurrentDays"`
+	} `xml:"NoncurrentVersionExpiration,omitempty"`
+}
+
+// NewMinioLifecycleManager is a factory for MinioLifecycleManager
+func NewMinioLifecycleManager(minioClient *minio.Client) *MinioLifecycleManager {
+	return &MinioLifecycleManager{minioClient}
+}
+
+// LifecycleRuleID is the ID of the lifecycle rule for a path
+func LifecycleRuleID(path string) string {
+	return LifecycleRulePrefix + path
+}
+
+// ValidatePathLifecycle checks the number of days
+func ValidatePathLifecycle(lifecycle *PathLifecycle) error {
+	if lifecycle.ExpireAfterDays < 0 || lifecycle.NoncurrentExpireAfterDays < 0 {
+		return errors.New("days must not be negative")
+	}
+	return nil
+}
+
+// SetPathLifecycle replaces the lifecycle rule of a path, or removes it when no days are given
+func (lifecycleman *MinioLifecycleManager) SetPathLifecycle(ctx context.Context, bucket, path string, lifecycle *PathLifecycle) error {
+	if err := ValidatePathLifecycle(lifecycle); err != nil {
+		return err
+	}
+	lifecycleMutex.Lock()
+	defer lifecycleMutex.Unlock()
+
+	configuration, err := lifecycleman.getConfiguration(ctx, bucket)
+	if err != nil {
+		return err
+	}
+	var rules []lifecycleRule
+	for _, rule := range configuration.Rules {
+		if parsed, err := rule.parse(); err != nil || parsed.ID != LifecycleRuleID(path) {
+			rules = append(rules, rule)
+		}
+	}
+	if lifecycle.ExpireAfterDays > 0 || lifecycle.NoncurrentExpireAfterDays > 0 {
+		rule, err := newPathLifecycleRule(path, lifecycle)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, rule)
+	}
+	configuration.Rules = rules
+
+	content := ""
+	if len(rules) > 0 {
+		marshalled, err := xml.Marshal(configuration)
+		if err != nil {
+			return err
+		}
+		content = string(marshalled)
+	}
+	return Instrument(ctx, "SetBucketLifecycle", func() error {
+		return lifecycleman.SetBucketLifecycle(bucket, content)
+	})
+}
+
+// GetPathLifecycle returns the lifecycle rule of a path, with zero days when there is none
+func (lifecycleman *MinioLifecycleManager) GetPathLifecycle(ctx context.Context, bucket, path string) (*PathLifecycle, error) {
+	configuration, err := lifecycleman.getConfiguration(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	lifecycle := &PathLifecycle{}
+	for _, rule := range configuration.Rules {
+		parsed, err := rule.parse()
+		if err != nil || parsed.ID != LifecycleRuleID(path) {
+			continue
+		}
+		if parsed.Expiration != nil {
+			lifecycle.ExpireAfterDays = parsed.Expiration.Days
+		}
+		if parsed.NoncurrentVersionExpiration != nil {
+			lifecycle.NoncurrentExpireAfterDays = parsed.NoncurrentVersionExpiration.NoncurrentDays
+		}
+	}
+	return lifecycle, nil
+}
+
+func (lifecycleman *MinioLifecycleManager) getConfiguration(ctx context.Context, bucket string) (*lifecycleConfiguration, error) {
+	var content string
+	err := Instrument(ctx, "GetBucketLifecycle", func() (err error) {
+		content, err = lifecycleman.GetBucketLifecycle(bucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	configuration := &lifecycleConfiguration{}
+	if content == "" {
+		return configuration, nil
+	}
+	if err := xml.Unmarshal([]byte(content), configuration); err != nil {
+		return nil, err
+	}
+	return configuration, nil
+}
+
+func (rule lifecycleRule) parse() (*pathLifecycleRule, error) {
+	var parsed pathLifecycleRule
+	err := xml.Unmarshal(append(append([]byte("<Rule>"), rule.Content...), "</Rule>"...), &parsed)
+	return &parsed, err
+}
+
+func newPathLifecycleRule(path string, lifecycle *PathLifecycle) (lifecycleRule, error) {
+	rule := pathLifecycleRule{ID: LifecycleRuleID(path), Status: "Enabled"}
+	rule.Filter.Prefix = path + "/"
+	if lifecycle.ExpireAfterDays > 0 {
+		rule.Expiration = &struct {
+			Days int `xml:"Days"`
+		}{lifecycle.ExpireAfterDays}
+	}
+	if lifecycle.NoncurrentExpireAfterDays > 0 {
+		rule.NoncurrentVersionExpiration = &struct {
+			NoncurrentDays int `xml:"NoncurrentDays"`
+		}{lifecycle.NoncurrentExpireAfterDays}
+	}
+	content, err := xml.Marshal(rule)
+	if err != nil {
+		return lifecycleRule{}, err
+	}
+	// Only the content inside <Rule> is kept, as for rules read from minio
+	return lifecycleRule{Content: content[len("<Rule>") : len(content)-len("</Rule>")]}, nil
+}
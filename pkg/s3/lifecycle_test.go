@@ -0,0 +1,56 @@
+package s3
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const foreignLifecycleRule = `<Rule><ID>cleanup-tmp</ID><Status>Enabled</Status><Filter><And><Prefix>tmp/</Prefix><Tag><Key>a</Key><Value>b</Value></Tag></And></Filter><Expiration><Days>1</Days></Expiration></Rule>`
+
+type testLifecycleClient struct {
+	lifecycle string
+}
+
+func (tlc *testLifecycleClient) GetBucketLifecycle(bucketName string) (string, error) {
+	return tlc.lifecycle, nil
+}
+
+func (tlc *testLifecycleClient) SetBucketLifecycle(bucketName, lifecycle string) error {
+	tlc.lifecycle = lifecycle
+	return nil
+}
+
+func TestLifecycle(t *testing.T) {
+	t.Run("Should merge the rule of a path without changing other rules", func(t *testing.T) {
+		client := &testLifecycleClient{lifecycle: `<LifecycleConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">` + foreignLifecycleRule + `</LifecycleConfiguration>`}
+		lifecycleman := &MinioLifecycleManager{client}
+
+		err := lifecycleman.SetPathLifecycle(context.Background(), "utv", "appx", &PathLifecycle{ExpireAfterDays: 30})
+		assert.Nil(t, err)
+		err = lifecycleman.SetPathLifecycle(context.Background(), "utv", "appy", &PathLifecycle{NoncurrentExpireAfterDays: 7})
+		assert.Nil(t, err)
+		err = lifecycleman.SetPathLifecycle(context.Background(), "utv", "appx", &PathLifecycle{ExpireAfterDays: 14, NoncurrentExpireAfterDays: 2})
+		assert.Nil(t, err)
+
+		assert.Contains(t, client.lifecycle, foreignLifecycleRule)
+		assert.Contains(t, client.lifecycle, `<Rule><ID>fiona-appx</ID><Status>Enabled</Status><Filter><Prefix>appx/</Prefix></Filter><Expiration><Days>14</Days></Expiration><NoncurrentVersionExpiration><NoncurrentDays>2</NoncurrentDays></NoncurrentVersionExpiration></Rule>`)
+		assert.Equal(t, 3, strings.Count(client.lifecycle, "<Rule>"))
+		lifecycle, err := lifecycleman.GetPathLifecycle(context.Background(), "utv", "appy")
+		assert.Nil(t, err)
+		assert.Equal(t, &PathLifecycle{NoncurrentExpireAfterDays: 7}, lifecycle)
+	})
+
+	t.Run("Should remove the rule of a path, and the configuration when no rules remain", func(t *testing.T) {
+		client := &testLifecycleClient{}
+		lifecycleman := &MinioLifecycleManager{client}
+
+		assert.Nil(t, lifecycleman.SetPathLifecycle(context.Background(), "utv", "appx", &PathLifecycle{ExpireAfterDays: 30}))
+		assert.Equal(t, 1, strings.Count(client.lifecycle, "<Rule>"))
+		assert.Nil(t, lifecycleman.SetPathLifecycle(context.Background(), "utv", "appx", &PathLifecycle{}))
+		assert.Equal(t, "", client.lifecycle)
+
+		assert.Error(t, lifecycleman.SetPathLifecycle(context.Background(), "utv", "appx", &PathLifecycle{ExpireAfterDays: -1}))
+	})
+}
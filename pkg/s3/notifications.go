@@ -0,0 +1,199 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/minio/minio-go/v6"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Events callers may be notified of
+const (
+	NotificationEventPut    = "put"
+	NotificationEventDelete = "delete"
+)
+
+var notificationEvents = map[string]minio.NotificationEventType{
+	NotificationEventPut:    minio.ObjectCreatedAll,
+	NotificationEventDelete: minio.ObjectRemovedAll,
+}
+
+// PathNotification sends the events for objects in a path to a named notification target
+type PathNotification struct {
+	Target string   `json:"target"`
+	Events []string `json:"events"`           // put and delete
+	Suffix string   `json:"suffix,omitempty"` // Only objects with names ending in suffix
+}
+
+// UnknownNotificationTargetError tells that a target is not configured for the cluster
+type UnknownNotificationTargetError struct {
+	Target string
+}
+
+func (err *UnknownNotificationTargetError) Error() string {
+	return fmt.Sprintf("notification target %s is not configured", err.Target)
+}
+
+// NotificationManager manages the bucket notifications of paths
+type NotificationManager interface {
+	SetPathNotification(ctx context.Context, bucket, path string, notification *PathNotification) error
+	ListPathNotifications(ctx context.Context, bucket, path string) ([]PathNotification, error)
+	DeletePathNotification(ctx context.Context, bucket, path, target string) (bool, error)
+}
+
+type notificationClient interface {
+	GetBucketNotification(bucketName string) (minio.BucketNotification, error)
+	SetBucketNotification(bucketName string, bucketNotification minio.BucketNotification) error
+}
+
+// MinioNotificationManager merges the notifications of a path into the bucket notification configuration, keeping
+// the notifications of other paths and notifications not made by Fiona as they are
+type MinioNotificationManager struct {
+	notificationClient
+	targets map[string]string
+}
+
+// notificationMutex serializes the read, merge and write of bucket notification configurations within Fiona
+var notificationMutex sync.Mutex
+
+// NewMinioNotificationManager is a factory for MinioNotificationManager
+func NewMinioNotificationManager(s3config *Config, minioClient *minio.Client) *MinioNotificationManager {
+	return &MinioNotificationManager{notificationClient: minioClient, targets: s3config.NotificationTargets}
+}
+
+// ValidatePathNotification checks the events
+func ValidatePathNotification(notification *PathNotification) error {
+	if notification.Target == "" {
+		return errors.New("target must be given")
+	}
+	if len(notification.Events) == 0 {
+		return errors.New("events must be given")
+	}
+	for _, event := range notification.Events {
+		if _, ok := notificationEvents[event]; !ok {
+			return fmt.Errorf("events must be %s or %s, was %q", NotificationEventPut, NotificationEventDelete, event)
+		}
+	}
+	return nil
+}
+
+// NotificationID is the ID of the notification for a path and target
+func NotificationID(path, target string) string {
+	return fmt.Sprintf("fiona-%s-%s", path, target)
+}
+
+// SetPathNotification replaces the notification of a path to the target
+func (notificationman *MinioNotificationManager) SetPathNotification(ctx context.Context, bucket, path string, notification *PathNotification) error {
+	if err := ValidatePathNotification(notification); err != nil {
+		return err
+	}
+	arn, ok := notificationman.targets[notification.Target]
+	if !ok {
+		return &UnknownNotificationTargetError{Target: notification.Target}
+	}
+	queueConfig := minio.QueueConfig{NotificationConfig: minio.NotificationConfig{ID: NotificationID(path, notification.Target)}, Queue: arn}
+	for _, event := range notification.Events {
+		queueConfig.AddEvents(notificationEvents[event])
+	}
+	queueConfig.AddFilterPrefix(path + "/")
+	if notification.Suffix != "" {
+		queueConfig.AddFilterSuffix(notification.Suffix)
+	}
+
+	notificationMutex.Lock()
+	defer notificationMutex.Unlock()
+	bucketNotification, err := notificationman.getBucketNotification(ctx, bucket)
+	if err != nil {
+		return err
+	}
+	bucketNotification.QueueConfigs, _ = withoutQueueConfig(bucketNotification.QueueConfigs, path, notification.Target)
+	bucketNotification.QueueConfigs = append(bucketNotification.QueueConfigs, queueConfig)
+	return notificationman.setBucketNotification(ctx, bucket, bucketNotification)
+}
+
+// ListPathNotifications returns the notifications of a path, ordered by target
+func (notificationman *MinioNotificationManager) ListPathNotifications(ctx context.Context, bucket, path string) ([]PathNotification, error) {
+	bucketNotification, err := notificationman.getBucketNotification(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	notifications := []PathNotification{}
+	for _, queueConfig := range bucketNotification.QueueConfigs {
+		target := strings.TrimPrefix(queueConfig.ID, NotificationID(path, ""))
+		if target == queueConfig.ID || filterValue(queueConfig.Filter, "prefix") != path+"/" {
+			continue
+		}
+		notification := PathNotification{Target: target, Suffix: filterValue(queueConfig.Filter, "suffix")}
+		for _, eventType := range queueConfig.Events {
+			for event, configured := range notificationEvents {
+				if eventType == configured {
+					notification.Events = append(notification.Events, event)
+				}
+			}
+		}
+		notifications = append(notifications, notification)
+	}
+	sort.Slice(notifications, func(i, j int) bool { return notifications[i].Target < notifications[j].Target })
+	return notifications, nil
+}
+
+// DeletePathNotification removes the notification of a path to the target, and tells whether there was one
+func (notificationman *MinioNotificationManager) DeletePathNotification(ctx context.Context, bucket, path, target string) (bool, error) {
+	notificationMutex.Lock()
+	defer notificationMutex.Unlock()
+	bucketNotification, err := notificationman.getBucketNotification(ctx, bucket)
+	if err != nil {
+		return false, err
+	}
+	var found bool
+	bucketNotification.QueueConfigs, found = withoutQueueConfig(bucketNotification.QueueConfigs, path, target)
+	if !found {
+		return false, nil
+	}
+	return true, notificationman.setBucketNotification(ctx, bucket, bucketNotification)
+}
+
+func (notificationman *MinioNotificationManager) getBucketNotification(ctx context.Context, bucket string) (minio.BucketNotification, error) {
+	var bucketNotification minio.BucketNotification
+	err := Instrument(ctx, "GetBucketNotification", func() (err error) {
+		bucketNotification, err = notificationman.GetBucketNotification(bucket)
+		return err
+	})
+	return bucketNotification, err
+}
+
+func (notificationman *MinioNotificationManager) setBucketNotification(ctx context.Context, bucket string, bucketNotification minio.BucketNotification) error {
+	return Instrument(ctx, "SetBucketNotification", func() error {
+		return notificationman.SetBucketNotification(bucket, bucketNotification)
+	})
+}
+
+// withoutQueueConfig removes the notification of a path to the target. The prefix is checked as well, since the ID
+// of a path containing a dash may equal the ID of another path.
+func withoutQueueConfig(queueConfigs []minio.QueueConfig, path, target string) ([]minio.QueueConfig, bool) {
+	var kept []minio.QueueConfig
+	found := false
+	for _, queueConfig := range queueConfigs {
+		if queueConfig.ID == NotificationID(path, target) && filterValue(queueConfig.Filter, "prefix") == path+"/" {
+			found = true
+			continue
+		}
+		kept = append(kept, queueConfig)
+	}
+	return kept, found
+}
+
+func filterValue(filter *minio.Filter, name string) string {
+	if filter == nil {
+		return ""
+	}
+	for _, rule := range filter.S3Key.FilterRules {
+		if rule.Name == name {
+			return rule.Value
+		}
+	}
+	return ""
+}
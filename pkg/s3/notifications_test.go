@@ -0,0 +1,77 @@
+package s3
+
+import (
+	"context"
+	"github.com/minio/minio-go/v6"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type testNotificationClient struct {
+	notification minio.BucketNotification
+}
+
+func (tnc *testNotificationClient) GetBucketNotification(bucketName string) (minio.BucketNotification, error) {
+	return tnc.notification, nil
+}
+
+func (tnc *testNotificationClient) SetBucketNotification(bucketName string, bucketNotification minio.BucketNotification) error {
+	tnc.notification = bucketNotification
+	return nil
+}
+
+func TestNotifications(t *testing.T) {
+	newManager := func() (*MinioNotificationManager, *testNotificationClient) {
+		foreign := minio.QueueConfig{NotificationConfig: minio.NotificationConfig{ID: "audit", Events: []minio.NotificationEventType{minio.ObjectCreatedAll}}, Queue: "arn:minio:sqs::2:kafka"}
+		client := &testNotificationClient{notification: minio.BucketNotification{QueueConfigs: []minio.QueueConfig{foreign}}}
+		targets := map[string]string{"webhook": "arn:minio:sqs::1:webhook", "amqp": "arn:minio:sqs::1:amqp"}
+		return &MinioNotificationManager{notificationClient: client, targets: targets}, client
+	}
+
+	t.Run("Should merge notifications of a path filtered by its prefix", func(t *testing.T) {
+		notificationman, client := newManager()
+
+		assert.Nil(t, notificationman.SetPathNotification(context.Background(), "utv", "appx", &PathNotification{Target: "webhook", Events: []string{"put"}}))
+		assert.Nil(t, notificationman.SetPathNotification(context.Background(), "utv", "appx", &PathNotification{Target: "amqp", Events: []string{"put", "delete"}, Suffix: ".csv"}))
+		assert.Nil(t, notificationman.SetPathNotification(context.Background(), "utv", "appx", &PathNotification{Target: "webhook", Events: []string{"delete"}}))
+		assert.Nil(t, notificationman.SetPathNotification(context.Background(), "utv", "appy", &PathNotification{Target: "webhook", Events: []string{"put"}}))
+
+		assert.Len(t, client.notification.QueueConfigs, 4)
+		assert.Equal(t, "audit", client.notification.QueueConfigs[0].ID)
+		notifications, err := notificationman.ListPathNotifications(context.Background(), "utv", "appx")
+		assert.Nil(t, err)
+		assert.Equal(t, []PathNotification{
+			{Target: "amqp", Events: []string{"put", "delete"}, Suffix: ".csv"},
+			{Target: "webhook", Events: []string{"delete"}},
+		}, notifications)
+		for _, queueConfig := range client.notification.QueueConfigs {
+			if queueConfig.ID == "fiona-appx-webhook" {
+				assert.Equal(t, "arn:minio:sqs::1:webhook", queueConfig.Queue)
+				assert.Equal(t, "appx/", filterValue(queueConfig.Filter, "prefix"))
+			}
+		}
+	})
+
+	t.Run("Should delete only the notification of the path to the target", func(t *testing.T) {
+		notificationman, client := newManager()
+		assert.Nil(t, notificationman.SetPathNotification(context.Background(), "utv", "appx", &PathNotification{Target: "webhook", Events: []string{"put"}}))
+
+		deleted, err := notificationman.DeletePathNotification(context.Background(), "utv", "appx", "webhook")
+		assert.Nil(t, err)
+		assert.True(t, deleted)
+		assert.Len(t, client.notification.QueueConfigs, 1)
+
+		deleted, err = notificationman.DeletePathNotification(context.Background(), "utv", "appx", "webhook")
+		assert.Nil(t, err)
+		assert.False(t, deleted)
+	})
+
+	t.Run("Should refuse unknown targets and events", func(t *testing.T) {
+		notificationman, _ := newManager()
+
+		err := notificationman.SetPathNotification(context.Background(), "utv", "appx", &PathNotification{Target: "sms", Events: []string{"put"}})
+		assert.IsType(t, &UnknownNotificationTargetError{}, err)
+		assert.Error(t, ValidatePathNotification(&PathNotification{Target: "webhook", Events: []string{"get"}}))
+		assert.Error(t, ValidatePathNotification(&PathNotification{Target: "webhook"}))
+	})
+}
@@ -0,0 +1,126 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/minio/minio-go/v6"
+	"io"
+	"strings"
+)
+
+// KeepObjectName is the placeholder object making a path visible to tools listing the bucket
+const KeepObjectName = ".keep"
+
+// PathInitializer creates the placeholder object of a path and copies seed objects into it
+type PathInitializer interface {
+	InitializePath(ctx context.Context, bucket, path, seedPrefix string) (int, error)
+}
+
+type pathObjectClient interface {
+	PutObject(bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (int64, error)
+	ListObjectsV2(bucketName, objectPrefix string, recursive bool, doneCh <-chan struct{}) <-chan minio.ObjectInfo
+	CopyObject(dst minio.DestinationInfo, src minio.SourceInfo) error
+}
+
+// MinioPathInitializer initializes paths with the minio client
+type MinioPathInitializer struct {
+	pathObjectClient
+	templatePrefix string
+}
+
+// NewMinioPathInitializer is a factory for MinioPathInitializer
+func NewMinioPathInitializer(config *Config, minioClient *minio.Client) *MinioPathInitializer {
+	return &MinioPathInitializer{minioClient, config.SeedTemplatePrefix}
+}
+
+// ValidateSeedTemplatePrefix checks that the template prefix is reserved, so tenants can not write seeds for
+// others, and that it does not overlap the other prefixes Fiona reserves
+func ValidateSeedTemplatePrefix(templatePrefix string) error {
+	if templatePrefix == "" {
+		return nil
+	}
+	if !strings.HasPrefix(templatePrefix, ".") {
+		return fmt.Errorf("template prefix %q must start with a dot to be reserved", templatePrefix)
+	}
+	templatePrefix = normalizedPrefix(templatePrefix)
+	for _, reserved := range []string{QuotaPrefix, ArchiveRoot} {
+		if strings.HasPrefix(templatePrefix, reserved) || strings.HasPrefix(reserved, templatePrefix) {
+			return fmt.Errorf("template prefix %q must not overlap %s", templatePrefix, reserved)
+		}
+	}
+	return nil
+}
+
+// ValidateSeedPrefix checks that the seed prefix is below the template prefix. Seeding is disabled when the
+// template prefix is empty.
+func ValidateSeedPrefix(templatePrefix, seedPrefix string) error {
+	if seedPrefix == "" {
+		return nil
+	}
+	if templatePrefix == "" {
+		return fmt.Errorf("seeding is disabled, seed prefix %q is not allowed", seedPrefix)
+	}
+	templatePrefix = normalizedPrefix(templatePrefix)
+	seedPrefix = normalizedPrefix(seedPrefix)
+	if seedPrefix == templatePrefix || !strings.HasPrefix(seedPrefix, templatePrefix) {
+		return fmt.Errorf("seed prefix %q must be a prefix below %s", seedPrefix, templatePrefix)
+	}
+	return nil
+}
+
+// InitializePath puts the placeholder object in the path, and copies the objects below seedPrefix in the same bucket
+// into the path when it is given. Objects already in the path are kept, so seeding a path in use never replaces the
+// files of the tenant. Returns the number of objects copied.
+func (initializer *MinioPathInitializer) InitializePath(ctx context.Context, bucket, path, seedPrefix string) (int, error) {
+	if err := ValidateSeedPrefix(initializer.templatePrefix, seedPrefix); err != nil {
+		return 0, err
+	}
+	err := Instrument(ctx, "PutObject", func() error {
+		_, err := initializer.PutObject(bucket, path+"/"+KeepObjectName, bytes.NewReader(nil), 0, minio.PutObjectOptions{})
+		return err
+	})
+	if err != nil || seedPrefix == "" {
+		return 0, err
+	}
+
+	existing, err := listObjectNames(ctx, initializer, bucket, path+"/")
+	if err != nil {
+		return 0, err
+	}
+	inPath := map[string]bool{}
+	for _, name := range existing {
+		inPath[name] = true
+	}
+	seedPrefix = normalizedPrefix(seedPrefix)
+	seeds, err := listObjectNames(ctx, initializer, bucket, seedPrefix)
+	if err != nil {
+		return 0, err
+	}
+	copied := 0
+	for _, seed := range seeds {
+		name := path + "/" + strings.TrimPrefix(seed, seedPrefix)
+		if seed == seedPrefix || inPath[name] {
+			continue
+		}
+		destination, err := minio.NewDestinationInfo(bucket, name, nil, nil)
+		if err != nil {
+			return copied, err
+		}
+		err = Instrument(ctx, "CopyObject", func() error {
+			return initializer.CopyObject(destination, minio.NewSourceInfo(bucket, seed, nil))
+		})
+		if err != nil {
+			return copied, err
+		}
+		copied++
+	}
+	return copied, nil
+}
+
+func normalizedPrefix(prefix string) string {
+	if strings.HasSuffix(prefix, "/") {
+		return prefix
+	}
+	return prefix + "/"
+}
@@ -0,0 +1,103 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"github.com/minio/minio-go/v6"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+)
+
+type testPathObjectClient struct {
+	testObjectLister
+	puts   []string
+	copies []string
+}
+
+func (tpoc *testPathObjectClient) PutObject(bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (int64, error) {
+	tpoc.puts = append(tpoc.puts, bucketName+"/"+objectName)
+	return objectSize, nil
+}
+
+func (tpoc *testPathObjectClient) CopyObject(dst minio.DestinationInfo, src minio.SourceInfo) error {
+	// The minio-go v6 info types keep their names unexported, so they are compared as formatted
+	tpoc.copies = append(tpoc.copies, fmt.Sprintf("%+v <- %+v", dst, src))
+	return nil
+}
+
+func TestPathInitializer(t *testing.T) {
+	t.Run("Should put the keep object in the path", func(t *testing.T) {
+		client := &testPathObjectClient{}
+		initializer := &MinioPathInitializer{client, ".fiona/templates/"}
+
+		seeded, err := initializer.InitializePath(context.Background(), "utv", "appx", "")
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, seeded)
+		assert.Equal(t, []string{"utv/appx/.keep"}, client.puts)
+		assert.Equal(t, 0, client.testObjectLister.scans)
+	})
+
+	t.Run("Should copy the objects below the seed prefix into the path", func(t *testing.T) {
+		client := &testPathObjectClient{
+			testObjectLister: testObjectLister{objects: map[string][]minio.ObjectInfo{
+				"utv/.fiona/templates/app/": {{Key: ".fiona/templates/app/config.json"}, {Key: ".fiona/templates/app/data/readme.txt"}},
+			}},
+		}
+		initializer := &MinioPathInitializer{client, ".fiona/templates/"}
+
+		seeded, err := initializer.InitializePath(context.Background(), "utv", "appx", ".fiona/templates/app")
+
+		assert.Nil(t, err)
+		assert.Equal(t, 2, seeded)
+		assert.Len(t, client.copies, 2)
+		assert.Contains(t, client.copies[0], "{bucket:utv object:appx/config.json ")
+		assert.Contains(t, client.copies[0], "{bucket:utv object:.fiona/templates/app/config.json ")
+		assert.Contains(t, client.copies[1], "{bucket:utv object:appx/data/readme.txt ")
+	})
+
+	t.Run("Should keep the objects already in the path", func(t *testing.T) {
+		client := &testPathObjectClient{
+			testObjectLister: testObjectLister{objects: map[string][]minio.ObjectInfo{
+				"utv/.fiona/templates/app/": {{Key: ".fiona/templates/app/config.json"}, {Key: ".fiona/templates/app/data/readme.txt"}},
+				"utv/appx/":                 {{Key: "appx/.keep"}, {Key: "appx/config.json"}},
+			}},
+		}
+		initializer := &MinioPathInitializer{client, ".fiona/templates/"}
+
+		seeded, err := initializer.InitializePath(context.Background(), "utv", "appx", ".fiona/templates/app")
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, seeded)
+		assert.Len(t, client.copies, 1)
+		assert.Contains(t, client.copies[0], "{bucket:utv object:appx/data/readme.txt ")
+	})
+
+	t.Run("Should only seed from below the template prefix", func(t *testing.T) {
+		for _, seedPrefix := range []string{"appy", "appx/templates/", "/templates", ".fiona/quotas/", ".fiona/templates", ".fiona/templatesx/app"} {
+			assert.Error(t, ValidateSeedPrefix(".fiona/templates/", seedPrefix), seedPrefix)
+		}
+		assert.Nil(t, ValidateSeedPrefix(".fiona/templates/", ".fiona/templates/app"))
+		assert.Nil(t, ValidateSeedPrefix(".fiona/templates/", ""))
+		assert.Error(t, ValidateSeedPrefix("", ".fiona/templates/app"))
+	})
+
+	t.Run("Should refuse seeding from outside the template prefix", func(t *testing.T) {
+		client := &testPathObjectClient{}
+		initializer := &MinioPathInitializer{client, ".fiona/templates/"}
+
+		_, err := initializer.InitializePath(context.Background(), "utv", "appx", "appy")
+
+		assert.Error(t, err)
+		assert.Empty(t, client.puts)
+	})
+
+	t.Run("Should only accept reserved template prefixes", func(t *testing.T) {
+		for _, templatePrefix := range []string{"templates/", ".fiona/", ".fiona/quotas/", ".fiona/archive/old/"} {
+			assert.Error(t, ValidateSeedTemplatePrefix(templatePrefix), templatePrefix)
+		}
+		assert.Nil(t, ValidateSeedTemplatePrefix(".fiona/templates/"))
+		assert.Nil(t, ValidateSeedTemplatePrefix(""))
+	})
+}
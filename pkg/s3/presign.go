@@ -0,0 +1,115 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// Bounds for the expiry of presigned URLs. Seven days is the longest AWS signature version 4 allows.
+const (
+	DefaultPresignExpiry = 15 * time.Minute
+	MaxPresignExpiry     = 7 * 24 * time.Hour
+)
+
+// PresignInput provides input for presigning a request for a single object in a path
+type PresignInput struct {
+	Bucketname string
+	Path       string
+	Key        string // Object key relative to the path
+	Method     string
+	Expiry     time.Duration
+}
+
+// PresignedURL is a URL granting a single operation on a single object until it expires
+type PresignedURL struct {
+	URL        string    `json:"url"`
+	Method     string    `json:"method"`
+	Expiration time.Time `json:"expiration"`
+}
+
+// Presigner presigns requests for objects
+type Presigner interface {
+	PresignURL(ctx context.Context, input *PresignInput) (*PresignedURL, error)
+}
+
+type presignClient interface {
+	Presign(method string, bucketName string, objectName string, expires time.Duration, reqParams url.Values) (*url.URL, error)
+}
+
+// MinioPresigner presigns requests with the credentials of the minio client
+type MinioPresigner struct {
+	presignClient
+}
+
+// NewMinioPresigner is a factory for MinioPresigner
+func NewMinioPresigner(client presignClient) *MinioPresigner {
+	return &MinioPresigner{client}
+}
+
+// PresignURL presigns a GET, PUT or DELETE request for the key in the path
+func (presigner *MinioPresigner) PresignURL(ctx context.Context, input *PresignInput) (*PresignedURL, error) {
+	objectName, err := PathObjectName(input.Path, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	method, err := PresignMethod(input.Method)
+	if err != nil {
+		return nil, err
+	}
+	expiry, err := PresignExpiry(input.Expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	var presigned *url.URL
+	err = Instrument(ctx, "Presign", func() (err error) {
+		presigned, err = presigner.Presign(method, input.Bucketname, objectName, expiry, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &PresignedURL{URL: presigned.String(), Method: method, Expiration: time.Now().Add(expiry).UTC()}, nil
+}
+
+// PathObjectName joins path and key to an object name, and fails when the key could escape the path
+func PathObjectName(bucketPath string, key string) (string, error) {
+	if key == "" {
+		return "", errors.New("key must be given")
+	}
+	if strings.HasPrefix(key, "/") || strings.Contains(key, "\\") || path.Clean(key) != key {
+		return "", fmt.Errorf("key %q must be a clean relative key", key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "." || segment == ".." {
+			return "", fmt.Errorf("key %q must stay inside the path", key)
+		}
+	}
+	return bucketPath + "/" + key, nil
+}
+
+// PresignExpiry returns the requested expiry, or the default when none is requested, and fails when it is out of bounds
+func PresignExpiry(requested time.Duration) (time.Duration, error) {
+	if requested == 0 {
+		return DefaultPresignExpiry, nil
+	}
+	if requested < time.Second || requested > MaxPresignExpiry {
+		return 0, fmt.Errorf("expiry must be between 1s and %s", MaxPresignExpiry)
+	}
+	return requested, nil
+}
+
+// PresignMethod normalizes the method, and fails for methods that can not be presigned
+func PresignMethod(method string) (string, error) {
+	method = strings.ToUpper(method)
+	switch method {
+	case "GET", "PUT", "DELETE":
+		return method, nil
+	}
+	return "", fmt.Errorf("method must be GET, PUT or DELETE, not %q", method)
+}
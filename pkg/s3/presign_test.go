@@ -0,0 +1,55 @@
+package s3
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type testPresignClient struct {
+	method     string
+	objectName string
+	expires    time.Duration
+}
+
+func (tpc *testPresignClient) Presign(method string, bucketName string, objectName string, expires time.Duration, reqParams url.Values) (*url.URL, error) {
+	tpc.method, tpc.objectName, tpc.expires = method, objectName, expires
+	return url.Parse("https://minio.example.com/" + bucketName + "/" + objectName + "?X-Amz-Signature=abc")
+}
+
+func TestPresign(t *testing.T) {
+	t.Run("Should presign a request for the key inside the path", func(t *testing.T) {
+		client := &testPresignClient{}
+		presigner := NewMinioPresigner(client)
+
+		presigned, err := presigner.PresignURL(context.Background(), &PresignInput{Bucketname: "utv", Path: "appx", Key: "reports/2021.csv", Method: "put", Expiry: time.Hour})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "https://minio.example.com/utv/appx/reports/2021.csv?X-Amz-Signature=abc", presigned.URL)
+		assert.Equal(t, "PUT", presigned.Method)
+		assert.Equal(t, "appx/reports/2021.csv", client.objectName)
+		assert.Equal(t, time.Hour, client.expires)
+	})
+
+	t.Run("Should refuse keys escaping the path", func(t *testing.T) {
+		for _, key := range []string{"", "/etc", "../appy/secret", "a/../../appy", "a//b", "./a", "a/", "a\\..\\b"} {
+			_, err := PathObjectName("appx", key)
+			assert.Error(t, err, key)
+		}
+	})
+
+	t.Run("Should refuse other methods and expiries out of bounds", func(t *testing.T) {
+		presigner := NewMinioPresigner(&testPresignClient{})
+
+		_, err := presigner.PresignURL(context.Background(), &PresignInput{Bucketname: "utv", Path: "appx", Key: "a", Method: "POST"})
+		assert.Error(t, err)
+		_, err = presigner.PresignURL(context.Background(), &PresignInput{Bucketname: "utv", Path: "appx", Key: "a", Method: "GET", Expiry: 8 * 24 * time.Hour})
+		assert.Error(t, err)
+
+		expiry, err := PresignExpiry(0)
+		assert.Nil(t, err)
+		assert.Equal(t, DefaultPresignExpiry, expiry)
+	})
+}
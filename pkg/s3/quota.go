@@ -0,0 +1,167 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/minio/minio-go/v6"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// QuotaPrefix is where quotas are recorded in a bucket, one object per path. App user policies only grant object
+// access below their own path, so tenants can not change them.
+const QuotaPrefix = ".fiona/quotas/"
+
+// ValidatePath checks that path may belong to a tenant. Paths starting with a dot are reserved for Fiona, which
+// keeps quotas and archives below .fiona/.
+func ValidatePath(path string) error {
+	if strings.HasPrefix(path, ".") {
+		return fmt.Errorf("path %s is reserved", path)
+	}
+	return nil
+}
+
+// PathQuota is the quota recorded for a path
+type PathQuota struct {
+	Bucket string `json:"bucket"`
+	Path   string `json:"path"`
+	Bytes  int64  `json:"bytes"`
+	// DisabledUsers are the users disabled for exceeding the quota, the only ones enabled again when under
+	DisabledUsers []string `json:"disabledUsers,omitempty"`
+	// RemovedMembers are the users with access to other paths removed from the access groups of the path instead
+	RemovedMembers []GroupMember `json:"removedMembers,omitempty"`
+}
+
+// GroupMember is the membership of a user in a group
+type GroupMember struct {
+	Group    string `json:"group"`
+	Username string `json:"username"`
+}
+
+// QuotaRegistry records quotas for paths
+type QuotaRegistry interface {
+	// UpdateQuota changes the quota recorded for a path with update, which gets an empty quota when there is none
+	UpdateQuota(ctx context.Context, bucket, path string, update func(quota *PathQuota)) error
+	GetQuota(ctx context.Context, bucket, path string) (*PathQuota, error) // Nil when the path has no quota
+	ListQuotas(ctx context.Context) ([]*PathQuota, error)
+}
+
+type quotaObjectClient interface {
+	ListBuckets() ([]minio.BucketInfo, error)
+	ListObjectsV2(bucketName, objectPrefix string, recursive bool, doneCh <-chan struct{}) <-chan minio.ObjectInfo
+	GetObject(bucketName, objectName string, opts minio.GetObjectOptions) (*minio.Object, error)
+	PutObject(bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (int64, error)
+}
+
+// MinioQuotaRegistry records quotas as objects under QuotaPrefix in the bucket of the path
+type MinioQuotaRegistry struct {
+	quotaObjectClient
+}
+
+// NewMinioQuotaRegistry is a factory for MinioQuotaRegistry
+func NewMinioQuotaRegistry(minioClient *minio.Client) *MinioQuotaRegistry {
+	return &MinioQuotaRegistry{minioClient}
+}
+
+// quotaMutex serializes the read, update and write of quotas within Fiona, so no update is lost
+var quotaMutex sync.Mutex
+
+// UpdateQuota reads the quota recorded for a path, updates it and records it again
+func (registry *MinioQuotaRegistry) UpdateQuota(ctx context.Context, bucket, path string, update func(quota *PathQuota)) error {
+	quotaMutex.Lock()
+	defer quotaMutex.Unlock()
+
+	quota, err := registry.GetQuota(ctx, bucket, path)
+	if err != nil {
+		return err
+	}
+	if quota == nil {
+		quota = &PathQuota{Bucket: bucket, Path: path}
+	}
+	update(quota)
+	content, err := json.Marshal(quota)
+	if err != nil {
+		return err
+	}
+	return Instrument(ctx, "PutObject", func() error {
+		_, err := registry.PutObject(quota.Bucket, QuotaPrefix+quota.Path, bytes.NewReader(content), int64(len(content)), minio.PutObjectOptions{ContentType: "application/json"})
+		return err
+	})
+}
+
+// GetQuota returns the quota recorded for a path, or nil when there is none
+func (registry *MinioQuotaRegistry) GetQuota(ctx context.Context, bucket, path string) (*PathQuota, error) {
+	var content []byte
+	err := Instrument(ctx, "GetObject", func() error {
+		object, err := registry.GetObject(bucket, QuotaPrefix+path, minio.GetObjectOptions{})
+		if err != nil {
+			return err
+		}
+		defer object.Close()
+		content, err = ioutil.ReadAll(object)
+		return err
+	})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var quota PathQuota
+	if err := json.Unmarshal(content, &quota); err != nil {
+		return nil, fmt.Errorf("invalid quota for %s/%s: %v", bucket, path, err)
+	}
+	return &quota, nil
+}
+
+// ListQuotas returns the quotas recorded in all buckets
+func (registry *MinioQuotaRegistry) ListQuotas(ctx context.Context) ([]*PathQuota, error) {
+	var buckets []minio.BucketInfo
+	err := Instrument(ctx, "ListBuckets", func() (err error) {
+		buckets, err = registry.ListBuckets()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var quotas []*PathQuota
+	for _, bucket := range buckets {
+		paths, err := listObjectNames(ctx, registry, bucket.Name, QuotaPrefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			quota, err := registry.GetQuota(ctx, bucket.Name, strings.TrimPrefix(path, QuotaPrefix))
+			if err != nil {
+				return nil, err
+			}
+			if quota != nil {
+				quotas = append(quotas, quota)
+			}
+		}
+	}
+	return quotas, nil
+}
+
+func listObjectNames(ctx context.Context, client objectLister, bucket, prefix string) ([]string, error) {
+	var names []string
+	err := Instrument(ctx, "ListObjectsV2", func() error {
+		doneCh := make(chan struct{})
+		defer close(doneCh)
+		for object := range client.ListObjectsV2(bucket, prefix, true, doneCh) {
+			if object.Err != nil {
+				return object.Err
+			}
+			names = append(names, object.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
@@ -1,9 +1,15 @@
 package s3
 
 import (
+	"context"
+	"crypto/tls"
+	"github.com/minio/minio/pkg/madmin"
 	"github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/skatteetaten/fiona/pkg/metrics"
 	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
 	"testing"
 )
 
@@ -12,7 +18,7 @@ func TestS3endpoint(t *testing.T) {
 
 		conf := getTestAppConfig()
 		endpoint := endpoint(conf)
-		serviceEndpoint := conf.getServiceEndpoint()
+		serviceEndpoint := conf.ServiceEndpoint()
 
 		assert.Equal(t, "minio:9000", endpoint)
 		assert.Equal(t, "http://minio:9000", serviceEndpoint)
@@ -39,6 +45,64 @@ func TestS3admclient(t *testing.T) {
 	})
 }
 
+func TestS3transport(t *testing.T) {
+	t.Run("Should create plain transport when not using ssl", func(t *testing.T) {
+		transport, err := newTransport(getTestAppConfig())
+
+		assert.Nil(t, err)
+		assert.Nil(t, transport.(*http.Transport).TLSClientConfig)
+	})
+
+	t.Run("Should apply TLS options when using ssl", func(t *testing.T) {
+		conf := getTestAppConfig()
+		conf.S3UseSSL = true
+		conf.TLS = TLSConfig{ServerName: "minio.internal", MinVersion: "1.3"}
+
+		transport, err := newTransport(conf)
+
+		assert.Nil(t, err)
+		tlsConfig := transport.(*http.Transport).TLSClientConfig
+		assert.Equal(t, "minio.internal", tlsConfig.ServerName)
+		assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+		assert.False(t, tlsConfig.InsecureSkipVerify)
+	})
+
+	t.Run("Should warn loudly when certificate verification is disabled", func(t *testing.T) {
+		hook := test.NewGlobal()
+		conf := getTestAppConfig()
+		conf.S3UseSSL = true
+		conf.TLS = TLSConfig{InsecureSkipVerify: true}
+
+		_, err := NewClient(conf)
+
+		assert.Nil(t, err)
+		assertLogged(t, hook, logrus.WarnLevel, "DISABLED")
+		hook.Reset()
+	})
+
+	t.Run("Should fail on missing CA bundle or unknown TLS version", func(t *testing.T) {
+		conf := getTestAppConfig()
+		conf.S3UseSSL = true
+		conf.TLS = TLSConfig{CABundle: "testdata/nofile.pem"}
+		_, err := NewAdmClient(conf)
+		assert.NotNil(t, err)
+
+		conf.TLS = TLSConfig{MinVersion: "1.0"}
+		_, err = NewClient(conf)
+		assert.NotNil(t, err)
+	})
+}
+
+// assertLogged checks that some entry was logged at level with a message containing message, whatever the order
+func assertLogged(t *testing.T, hook *test.Hook, level logrus.Level, message string) {
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == level && strings.Contains(entry.Message, message) {
+			return
+		}
+	}
+	t.Errorf("no %s entry containing %q was logged", level, message)
+}
+
 type testBucketClient struct {
 }
 
@@ -68,7 +132,7 @@ func TestS3bucketmanager(t *testing.T) {
 
 		hook := test.NewGlobal()
 
-		bucketmanager.MakeSureBucketExists()
+		bucketmanager.MakeSureBucketExists(context.Background())
 
 		assert.Equal(t, 2, len(hook.Entries))
 		assert.Equal(t, logrus.InfoLevel, hook.Entries[0].Level)
@@ -87,7 +151,7 @@ func TestS3bucketmanager(t *testing.T) {
 		}
 		hook := test.NewGlobal()
 
-		bucketmanager.MakeSureBucketExists()
+		bucketmanager.MakeSureBucketExists(context.Background())
 
 		assert.Equal(t, 2, len(hook.Entries))
 		assert.Equal(t, logrus.InfoLevel, hook.Entries[0].Level)
@@ -123,6 +187,183 @@ func TestS3bucketmanager(t *testing.T) {
 	})
 }
 
+// testAdminClient records the calls made to the minio admin API
+type testAdminClient struct {
+	calls    []string
+	users    map[string]string
+	policies map[string]string
+	groups   map[string][]string
+}
+
+func newTestAdminClient() *testAdminClient {
+	return &testAdminClient{users: map[string]string{}, policies: map[string]string{}, groups: map[string][]string{}}
+}
+
+func (tac *testAdminClient) GetUserInfo(name string) (madmin.UserInfo, error) {
+	if _, ok := tac.users[name]; !ok {
+		return madmin.UserInfo{}, madmin.ErrorResponse{Code: "XMinioAdminNoSuchUser"}
+	}
+	return madmin.UserInfo{Status: madmin.AccountEnabled}, nil
+}
+func (tac *testAdminClient) AddUser(accessKey, secretKey string) error {
+	tac.calls = append(tac.calls, "AddUser "+accessKey)
+	tac.users[accessKey] = secretKey
+	return nil
+}
+func (tac *testAdminClient) AddCannedPolicy(policyName, policy string) error {
+	tac.calls = append(tac.calls, "AddCannedPolicy "+policyName)
+	tac.policies[policyName] = policy
+	return nil
+}
+func (tac *testAdminClient) SetPolicy(policyName, entityName string, isGroup bool) error {
+	if isGroup {
+		tac.calls = append(tac.calls, "SetPolicy "+policyName+" group "+entityName)
+	} else {
+		tac.calls = append(tac.calls, "SetPolicy "+policyName+" user "+entityName)
+	}
+	return nil
+}
+func (tac *testAdminClient) UpdateGroupMembers(g madmin.GroupAddRemove) error {
+	tac.calls = append(tac.calls, "UpdateGroupMembers "+g.Group+" "+strings.Join(g.Members, ","))
+	tac.groups[g.Group] = append(tac.groups[g.Group], g.Members...)
+	return nil
+}
+func (tac *testAdminClient) GetGroupDescription(group string) (*madmin.GroupDesc, error) {
+	members, ok := tac.groups[group]
+	if !ok {
+		return nil, madmin.ErrorResponse{Code: "XMinioAdminNoSuchGroup"}
+	}
+	return &madmin.GroupDesc{Name: group, Members: members, Policy: group, Status: "enabled"}, nil
+}
+
+func TestS3groupmanager(t *testing.T) {
+	t.Run("Should name groups by bucket, path and access", func(t *testing.T) {
+		group, err := AccessGroupName("utv", "appx", []string{"WRITE", "read"})
+		assert.Nil(t, err)
+		assert.Equal(t, "fiona-utv-appx-3030f118-rw", group)
+
+		_, err = AccessGroupName("utv", "appx", []string{"READ", "EXECUTE"})
+		assert.Error(t, err)
+		_, err = AccessGroupName("utv", "appx", nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("Should give bucket and path pairs joining to the same name different groups", func(t *testing.T) {
+		group, _ := AccessGroupName("a-b", "c", []string{"READ"})
+		other, _ := AccessGroupName("a", "b-c", []string{"READ"})
+
+		assert.NotEqual(t, group, other)
+		assert.True(t, IsPathAccessGroup(group, "a-b", "c"))
+		assert.False(t, IsPathAccessGroup(group, "a", "b-c"))
+	})
+
+	t.Run("Should add members before attaching the policy to the group", func(t *testing.T) {
+		adminClient := newTestAdminClient()
+		groupmanager := MinioGroupManager{adminClient}
+
+		group, err := groupmanager.CreateAccessGroup(context.Background(), "utv", "appx", []string{"READ"}, []string{"appxuser"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "fiona-utv-appx-3030f118-r", group)
+		assert.Equal(t, []string{
+			"UpdateGroupMembers fiona-utv-appx-3030f118-r appxuser",
+			"AddCannedPolicy fiona-utv-appx-3030f118-r",
+			"SetPolicy fiona-utv-appx-3030f118-r group fiona-utv-appx-3030f118-r",
+		}, adminClient.calls)
+		assert.Contains(t, adminClient.policies[group], "arn:aws:s3:::utv/appx/*")
+		assert.Contains(t, adminClient.policies[group], "s3:GetObject")
+		assert.NotContains(t, adminClient.policies[group], "s3:PutObject")
+	})
+
+	t.Run("Should refuse groups without members", func(t *testing.T) {
+		adminClient := newTestAdminClient()
+		groupmanager := MinioGroupManager{adminClient}
+
+		_, err := groupmanager.CreateAccessGroup(context.Background(), "utv", "appx", []string{"READ"}, nil)
+
+		assert.Error(t, err)
+		assert.Empty(t, adminClient.calls)
+	})
+
+	t.Run("Should detect missing groups", func(t *testing.T) {
+		groupmanager := MinioGroupManager{newTestAdminClient()}
+
+		_, err := groupmanager.DescribeGroup(context.Background(), "fiona-utv-appx-3030f118-r")
+
+		assert.True(t, IsNotFound(err))
+		assert.True(t, IsManagedGroup("fiona-utv-appx-3030f118-r"))
+		assert.False(t, IsManagedGroup("admins"))
+	})
+}
+
+func TestS3usermanager(t *testing.T) {
+	newUserManager := func(adminClient *testAdminClient, useGroups bool) *MinioUserManager {
+		return &MinioUserManager{
+			userClient:      adminClient,
+			groups:          &MinioGroupManager{adminClient},
+			useGroups:       useGroups,
+			defaultUserpass: "S3userpass",
+			serviceEndpoint: "http://minio:9000",
+		}
+	}
+	input := &CreateAppUserInput{Bucketname: "utv", Path: "appx", Username: "appxuser", Access: []string{"READ", "WRITE"}}
+
+	t.Run("Should give app users a policy of their own", func(t *testing.T) {
+		adminClient := newTestAdminClient()
+
+		result, err := newUserManager(adminClient, false).CreateAppUser(context.Background(), input)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "utvappx_appxuser_RW", result.PolicyName)
+		assert.Empty(t, result.Group)
+		assert.Contains(t, adminClient.calls, "SetPolicy utvappx_appxuser_RW user appxuser")
+	})
+
+	t.Run("Should add app users to the access group when using groups", func(t *testing.T) {
+		adminClient := newTestAdminClient()
+
+		result, err := newUserManager(adminClient, true).CreateAppUser(context.Background(), input)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "fiona-utv-appx-3030f118-rw", result.Group)
+		assert.Equal(t, "fiona-utv-appx-3030f118-rw", result.PolicyName)
+		assert.Equal(t, []string{"appxuser"}, adminClient.groups["fiona-utv-appx-3030f118-rw"])
+		assert.NotContains(t, adminClient.policies, "utvappx_appxuser_RW")
+	})
+
+	t.Run("Should count creating an existing app user again as a rotation", func(t *testing.T) {
+		adminClient := newTestAdminClient()
+		userManager := newUserManager(adminClient, false)
+		created, rotated := countedUsers(t, metrics.ActionCreated), countedUsers(t, metrics.ActionRotated)
+
+		_, err := userManager.CreateAppUser(context.Background(), input)
+		assert.Nil(t, err)
+		_, err = userManager.CreateAppUser(context.Background(), input)
+		assert.Nil(t, err)
+
+		assert.Equal(t, created+1, countedUsers(t, metrics.ActionCreated))
+		assert.Equal(t, rotated+1, countedUsers(t, metrics.ActionRotated))
+	})
+}
+
+func countedUsers(t *testing.T, action string) float64 {
+	families, err := metrics.Registry.Gather()
+	assert.Nil(t, err)
+	for _, family := range families {
+		if family.GetName() != "fiona_users_total" {
+			continue
+		}
+		for _, metric := range family.Metric {
+			for _, label := range metric.Label {
+				if label.GetName() == "action" && label.GetValue() == action {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
 func getTestAppConfig() *Config {
 	return &Config{
 		S3Host:          "minio",
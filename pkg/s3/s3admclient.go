@@ -15,19 +15,12 @@ func NewAdmClient(s3config *Config) (*madmin.AdminClient, error) {
 		logrus.Errorf("Could not create S3 admin client %v", err)
 		return nil, err
 	}
-
-	return adminclient, nil
-}
-
-// NewAdmClientForExternalAccess creates the S3 admin client for externally supplied access parameters
-func NewAdmClientForExternalAccess(minioAccessConfig *MinioAccessConfig) (*madmin.AdminClient, error) {
-	endpoint := minioAccessConfig.Host + ":" + minioAccessConfig.Port
-	logrus.Infof("Creating minio adminclient to %s using ssl=%t", endpoint, minioAccessConfig.UseSsl)
-	adminclient, err := madmin.New(endpoint, minioAccessConfig.AccessKey, minioAccessConfig.SecretKey, minioAccessConfig.UseSsl)
+	transport, err := newTransport(s3config)
 	if err != nil {
-		logrus.Errorf("Could not create minio admin client %v", err)
+		logrus.Errorf("Could not create transport for S3 admin client %v", err)
 		return nil, err
 	}
+	adminclient.SetCustomTransport(transport)
 
 	return adminclient, nil
 }
@@ -0,0 +1,153 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/minio/minio-go/v6"
+	"github.com/minio/minio-go/v6/pkg/s3signer"
+	"github.com/minio/minio/pkg/madmin"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// adminAPIPrefix is the admin API of minio releases with service accounts and bucket quotas. The madmin version
+// Fiona builds with only speaks v2, so these calls are signed and sent by AdminAPI. Fiona thus supports the minio
+// releases serving both, which CheckAdminAPIs checks.
+const adminAPIPrefix = "/minio/admin/v3"
+
+type serverInfoClient interface {
+	ServerInfo() (madmin.InfoMessage, error)
+}
+
+// CheckAdminAPIs checks that minio serves both admin API v2, spoken by madmin, and admin API v3, spoken by AdminAPI.
+// Only minio refusing the version of a call fails the check, as minio being unavailable is reported by the health
+// check. Admin API v3 is called first, as madmin keeps retrying a minio that does not answer.
+func CheckAdminAPIs(ctx context.Context, adminClient serverInfoClient, adminAPI *AdminAPI) error {
+	_, err := adminAPI.call(ctx, http.MethodGet, "/info", nil, nil)
+	if isVersionMismatch(err) {
+		return fmt.Errorf("minio does not serve admin API v3, releases serving both admin API %s and v3 are supported: %v", madmin.AdminAPIVersion, err)
+	}
+	if _, answered := err.(madmin.ErrorResponse); err != nil && !answered {
+		return nil
+	}
+	err = Instrument(ctx, "ServerInfo", func() error {
+		_, err := adminClient.ServerInfo()
+		return err
+	})
+	if isVersionMismatch(err) {
+		return fmt.Errorf("minio does not serve admin API %s, releases serving both admin API %s and v3 are supported: %v", madmin.AdminAPIVersion, madmin.AdminAPIVersion, err)
+	}
+	return nil
+}
+
+func isVersionMismatch(err error) bool {
+	return err != nil && madmin.ToErrorResponse(err).Code == "XMinioAdminVersionMismatch"
+}
+
+// AdminAPI calls the minio admin APIs not covered by madmin
+type AdminAPI struct {
+	endpoint   string
+	accessKey  string
+	secretKey  string
+	region     string
+	httpClient *http.Client
+}
+
+// NewAdminAPI creates an AdminAPI for the minio server in s3config
+func NewAdminAPI(s3config *Config) (*AdminAPI, error) {
+	transport, err := newTransport(s3config)
+	if err != nil {
+		return nil, err
+	}
+	return &AdminAPI{
+		endpoint:   s3config.ServiceEndpoint(),
+		accessKey:  s3config.AccessKey,
+		secretKey:  s3config.SecretKey,
+		region:     s3config.S3Region,
+		httpClient: &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}, nil
+}
+
+// call sends a signed request to the admin API and returns the body of a successful response.
+// Errors from minio are returned as madmin.ErrorResponse.
+func (api *AdminAPI) call(ctx context.Context, method, relPath string, query url.Values, content []byte) ([]byte, error) {
+	target := fmt.Sprintf("%s%s%s", api.endpoint, adminAPIPrefix, relPath)
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	status, body, err := api.send(ctx, method, target, content)
+	if err != nil {
+		return nil, err
+	}
+	if status/100 != 2 {
+		var errorResponse madmin.ErrorResponse
+		if err := json.Unmarshal(body, &errorResponse); err != nil || errorResponse.Code == "" {
+			return nil, madmin.ErrorResponse{Code: fmt.Sprintf("%d %s", status, http.StatusText(status)), Message: "Failed to parse server response."}
+		}
+		return nil, errorResponse
+	}
+	return body, nil
+}
+
+// getBucketVersioning returns the versioning status of a bucket, "Enabled", "Suspended" or empty when never enabled.
+// The minio-go version Fiona builds with can only set it.
+func (api *AdminAPI) getBucketVersioning(ctx context.Context, bucket string) (string, error) {
+	status, body, err := api.send(ctx, http.MethodGet, fmt.Sprintf("%s/%s?versioning=", api.endpoint, url.PathEscape(bucket)), nil)
+	if err != nil {
+		return "", err
+	}
+	if status/100 != 2 {
+		var errorResponse minio.ErrorResponse
+		if err := xml.Unmarshal(body, &errorResponse); err != nil || errorResponse.Code == "" {
+			return "", minio.ErrorResponse{Code: fmt.Sprintf("%d %s", status, http.StatusText(status)), Message: "Failed to parse server response."}
+		}
+		return "", errorResponse
+	}
+	var configuration struct {
+		Status string `xml:"Status"`
+	}
+	if err := xml.Unmarshal(body, &configuration); err != nil {
+		return "", err
+	}
+	return configuration.Status, nil
+}
+
+// send signs and sends a request to minio, returning the status and body of the response
+func (api *AdminAPI) send(ctx context.Context, method, target string, content []byte) (int, []byte, error) {
+	request, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(content))
+	if err != nil {
+		return 0, nil, err
+	}
+	request.ContentLength = int64(len(content))
+	contentHash := sha256.Sum256(content)
+	request.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(contentHash[:]))
+	request = s3signer.SignV4(*request, api.accessKey, api.secretKey, "", api.region)
+
+	response, err := api.httpClient.Do(request)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	return response.StatusCode, body, nil
+}
+
+// encrypt encrypts a request body the way minio expects for calls carrying credentials
+func (api *AdminAPI) encrypt(data []byte) ([]byte, error) {
+	return madmin.EncryptData(api.secretKey, data)
+}
+
+// decrypt decrypts a response body carrying credentials
+func (api *AdminAPI) decrypt(data []byte) ([]byte, error) {
+	return madmin.DecryptData(api.secretKey, bytes.NewReader(data))
+}
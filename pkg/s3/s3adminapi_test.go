@@ -0,0 +1,200 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/minio/minio/pkg/madmin"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// stubAdminAPI serves the service account and bucket quota calls of the minio admin API v3, and bucket versioning
+type stubAdminAPI struct {
+	t          *testing.T
+	accounts   map[string][]string
+	quotas     map[string][]byte
+	versioning string
+	refusedAPI string // The admin API version refused, as by minio releases not serving it
+}
+
+func (stub *stubAdminAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	assert.True(stub.t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/"))
+	if _, ok := r.URL.Query()["versioning"]; ok {
+		_, _ = w.Write([]byte(`<VersioningConfiguration><Status>` + stub.versioning + `</Status></VersioningConfiguration>`))
+		return
+	}
+	if stub.refusedAPI != "" && strings.HasPrefix(r.URL.Path, "/minio/admin/"+stub.refusedAPI+"/") {
+		w.WriteHeader(http.StatusUpgradeRequired)
+		_, _ = w.Write([]byte(`{"Code":"XMinioAdminVersionMismatch","Message":"Server expects client requests with 'admin' API version"}`))
+		return
+	}
+	switch r.URL.Path {
+	case "/minio/admin/v2/info", "/minio/admin/v3/info":
+		_, _ = w.Write([]byte(`{"mode":"online"}`))
+	case "/minio/admin/v3/set-bucket-quota":
+		stub.quotas[r.URL.Query().Get("bucket")], _ = ioutil.ReadAll(r.Body)
+	case "/minio/admin/v3/get-bucket-quota":
+		quota, ok := stub.quotas[r.URL.Query().Get("bucket")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"Code":"XMinioAdminNoSuchQuotaConfiguration","Message":"The quota configuration does not exist"}`))
+			return
+		}
+		_, _ = w.Write(quota)
+	case "/minio/admin/v3/add-service-account":
+		body, _ := ioutil.ReadAll(r.Body)
+		decrypted, err := madmin.DecryptData("minio", bytes.NewReader(body))
+		assert.Nil(stub.t, err)
+		var request struct {
+			Policy     json.RawMessage `json:"policy"`
+			TargetUser string          `json:"targetUser"`
+		}
+		_ = json.Unmarshal(decrypted, &request)
+		stub.accounts[request.TargetUser] = append(stub.accounts[request.TargetUser], "SVCACCOUNT1")
+		response, _ := json.Marshal(map[string]interface{}{"credentials": map[string]string{"accessKey": "SVCACCOUNT1", "secretKey": "s3cret"}})
+		encrypted, _ := madmin.EncryptData("minio", response)
+		_, _ = w.Write(encrypted)
+	case "/minio/admin/v3/list-service-accounts":
+		response, _ := json.Marshal(map[string][]string{"accounts": stub.accounts[r.URL.Query().Get("user")]})
+		encrypted, _ := madmin.EncryptData("minio", response)
+		_, _ = w.Write(encrypted)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"Code":"XMinioAdminNoSuchUser","Message":"The specified user does not exist."}`))
+	}
+}
+
+type testUserInfoClient struct {
+	testPolicies
+	users map[string]madmin.UserInfo
+}
+
+func (tuic testUserInfoClient) GetUserInfo(name string) (madmin.UserInfo, error) {
+	userInfo, ok := tuic.users[name]
+	if !ok {
+		return userInfo, madmin.ErrorResponse{Code: "XMinioAdminNoSuchUser"}
+	}
+	return userInfo, nil
+}
+
+// testPolicies serves the documents of app user policies, mapping their names to the bucket/path they grant access to
+type testPolicies map[string]string
+
+func (tp testPolicies) InfoCannedPolicy(policyName string) ([]byte, error) {
+	location, ok := tp[policyName]
+	if !ok {
+		return nil, madmin.ErrorResponse{Code: "XMinioAdminNoSuchPolicy"}
+	}
+	bucketPath := strings.SplitN(location, "/", 2)
+	policy, _ := generateAppUserPolicy(&CreateAppUserInput{Bucketname: bucketPath[0], Path: bucketPath[1], Access: []string{"READ"}})
+	return json.Marshal(policy)
+}
+
+func newTestAdminAPI(t *testing.T) (*stubAdminAPI, *AdminAPI) {
+	stub := &stubAdminAPI{t: t, accounts: map[string][]string{}, quotas: map[string][]byte{}}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	conf := getTestAppConfig()
+	serverURL, _ := url.Parse(server.URL)
+	conf.S3Host, conf.S3Port = serverURL.Hostname(), serverURL.Port()
+	adminAPI, err := NewAdminAPI(conf)
+	assert.Nil(t, err)
+	return stub, adminAPI
+}
+
+func TestCheckAdminAPIs(t *testing.T) {
+	newClients := func(t *testing.T, refusedAPI string) (*madmin.AdminClient, *AdminAPI) {
+		stub, adminAPI := newTestAdminAPI(t)
+		stub.refusedAPI = refusedAPI
+		endpoint, _ := url.Parse(adminAPI.endpoint)
+		adminClient, err := madmin.New(endpoint.Host, "minio", "minio", false)
+		assert.Nil(t, err)
+		return adminClient, adminAPI
+	}
+
+	t.Run("Should accept minio serving both admin APIs", func(t *testing.T) {
+		adminClient, adminAPI := newClients(t, "")
+
+		assert.Nil(t, CheckAdminAPIs(context.Background(), adminClient, adminAPI))
+	})
+
+	t.Run("Should refuse minio not serving one of the admin APIs", func(t *testing.T) {
+		for _, refused := range []string{"v2", "v3"} {
+			adminClient, adminAPI := newClients(t, refused)
+
+			err := CheckAdminAPIs(context.Background(), adminClient, adminAPI)
+
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), "does not serve admin API "+refused)
+		}
+	})
+
+	t.Run("Should leave unavailable minio to the health check", func(t *testing.T) {
+		adminClient, adminAPI := newClients(t, "")
+		adminAPI.endpoint = "http://127.0.0.1:1"
+
+		assert.Nil(t, CheckAdminAPIs(context.Background(), adminClient, adminAPI))
+	})
+}
+
+func TestS3serviceaccountmanager(t *testing.T) {
+	t.Run("Should create and list service accounts through the signed admin API", func(t *testing.T) {
+		stub, adminAPI := newTestAdminAPI(t)
+		saman := MinioServiceAccountManager{adminAPI: adminAPI}
+
+		serviceAccount, err := saman.CreateServiceAccount(context.Background(), "appxuser", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, &ServiceAccount{AccessKey: "SVCACCOUNT1", SecretKey: "s3cret"}, serviceAccount)
+		assert.Equal(t, []string{"SVCACCOUNT1"}, stub.accounts["appxuser"])
+
+		accessKeys, err := saman.ListServiceAccounts(context.Background(), "appxuser")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"SVCACCOUNT1"}, accessKeys)
+	})
+
+	t.Run("Should return minio errors", func(t *testing.T) {
+		_, adminAPI := newTestAdminAPI(t)
+		saman := MinioServiceAccountManager{adminAPI: adminAPI}
+
+		err := saman.DeleteServiceAccount(context.Background(), "SVCACCOUNT1")
+
+		assert.True(t, IsNotFound(err))
+	})
+
+	t.Run("Should find app users by their policy or access group", func(t *testing.T) {
+		saman := MinioServiceAccountManager{userInfoClient: testUserInfoClient{
+			testPolicies: testPolicies{"utvappx_appxuser_RW": "utv/appx", "utvapp_appuser_R": "utv/app", "utvapp_otheruser_R": "utva/pp"},
+			users: map[string]madmin.UserInfo{
+				"appxuser":  {PolicyName: "utvappx_appxuser_RW"},
+				"appyuser":  {MemberOf: []string{"fiona-utv-appy-bdf2ae03-r"}},
+				"appuser":   {PolicyName: "utvapp_appuser_R"},
+				"dashuser":  {MemberOf: []string{"fiona-utv-app-x-d8556038-r"}},
+				"otheruser": {PolicyName: "utvapp_otheruser_R"},
+			},
+		}}
+
+		for _, check := range []struct {
+			username, path string
+			expected       bool
+		}{
+			{"appxuser", "appx", true}, {"appxuser", "appy", false}, {"appyuser", "appy", true}, {"nosuchuser", "appx", false},
+			{"appuser", "app", true}, {"dashuser", "app-x", true}, {"dashuser", "app", false}, {"otheruser", "app", false},
+		} {
+			hasAccess, err := saman.HasPathAccess(context.Background(), check.username, "utv", check.path)
+			assert.Nil(t, err)
+			assert.Equal(t, check.expected, hasAccess, check)
+		}
+	})
+
+	t.Run("Should only accept policy documents as session policies", func(t *testing.T) {
+		assert.Nil(t, ValidateSessionPolicy(json.RawMessage(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:GetObject"],"Resource":["arn:aws:s3:::utv/appx/*"]}]}`)))
+		assert.Error(t, ValidateSessionPolicy(json.RawMessage(`{"Version":"2012-10-17"}`)))
+		assert.Error(t, ValidateSessionPolicy(json.RawMessage(`"READ"`)))
+	})
+}
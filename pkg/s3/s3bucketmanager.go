@@ -1,15 +1,16 @@
 package s3
 
 import (
+	"context"
 	"fmt"
 	"github.com/minio/minio-go/v6"
-	"github.com/sirupsen/logrus"
+	"github.com/skatteetaten/fiona/pkg/logging"
 )
 
 // BucketManager is an interfacce for bucket management
 type BucketManager interface {
-	MakeSureBucketExists() error
-	BucketNameExists(bucketName string) (bool, error)
+	MakeSureBucketExists(ctx context.Context) error
+	BucketNameExists(ctx context.Context, bucketName string) (bool, error)
 }
 
 type bucketClient interface {
@@ -46,44 +47,53 @@ func NewMinioBucketManager(s3config *Config, minioClient *minio.Client) *MinioBu
 }
 
 // MakeSureBucketExists checks that the default bucket exists and creates it if not
-func (bucketManager *MinioBucketManager) MakeSureBucketExists() error {
-	return bucketManager.makeSureNamedBucketExists(bucketManager.DefaultBucket)
+func (bucketManager *MinioBucketManager) MakeSureBucketExists(ctx context.Context) error {
+	return bucketManager.makeSureNamedBucketExists(ctx, bucketManager.DefaultBucket)
 }
 
 // BucketNameExists checks that the named bucket exists
-func (bucketManager *MinioBucketManager) BucketNameExists(bucketName string) (bool, error) {
-	return bucketManager.BucketExists(bucketName)
+func (bucketManager *MinioBucketManager) BucketNameExists(ctx context.Context, bucketName string) (bool, error) {
+	var found bool
+	err := Instrument(ctx, "BucketExists", func() (err error) {
+		found, err = bucketManager.BucketExists(bucketName)
+		return err
+	})
+	return found, err
 }
 
 // MakeSureNamedBucketExists checks that the named bucket exists and creates it if not
-func (bucketManager *MinioBucketManager) makeSureNamedBucketExists(bucketName string) error {
-	found, _ := bucketManager.BucketExists(bucketManager.DefaultBucket)
+func (bucketManager *MinioBucketManager) makeSureNamedBucketExists(ctx context.Context, bucketName string) error {
+	found, _ := bucketManager.BucketNameExists(ctx, bucketManager.DefaultBucket)
 	if !found {
-		err := bucketManager.MakeBucket(bucketManager.DefaultBucket, bucketManager.S3Region)
+		err := Instrument(ctx, "MakeBucket", func() error {
+			return bucketManager.MakeBucket(bucketManager.DefaultBucket, bucketManager.S3Region)
+		})
 		if err != nil {
-			logrus.Errorf("Could not create missing bucket %s in region %s", bucketManager.DefaultBucket, bucketManager.S3Region)
+			logging.FromContext(ctx).Errorf("Could not create missing bucket %s in region %s", bucketManager.DefaultBucket, bucketManager.S3Region)
 			return err
 		}
-		logrus.Infof("Created bucket %s", bucketManager.DefaultBucket)
+		logging.FromContext(ctx).Infof("Created bucket %s", bucketManager.DefaultBucket)
 	} else {
-		logrus.Infof("Found existing bucket %s", bucketManager.DefaultBucket)
+		logging.FromContext(ctx).Infof("Found existing bucket %s", bucketManager.DefaultBucket)
 	}
 
-	if err := bucketManager.setGeneralBucketPolicy(bucketManager.DefaultBucket); err != nil {
-		logrus.Errorf("Could not set general bucket policy on bucket %s.", bucketManager.DefaultBucket)
+	if err := bucketManager.setGeneralBucketPolicy(ctx, bucketManager.DefaultBucket); err != nil {
+		logging.FromContext(ctx).Errorf("Could not set general bucket policy on bucket %s.", bucketManager.DefaultBucket)
 		return err
 	}
 	return nil
 }
 
-func (bucketManager *MinioBucketManager) setGeneralBucketPolicy(bucketName string) error {
+func (bucketManager *MinioBucketManager) setGeneralBucketPolicy(ctx context.Context, bucketName string) error {
 	bucketpolicy := fmt.Sprintf(bucketPolicy, bucketName)
-	logrus.Debugf("Policy: \n %s", bucketpolicy)
-	err := bucketManager.SetBucketPolicy(bucketName, bucketpolicy)
+	logging.FromContext(ctx).Debugf("Policy: \n %s", bucketpolicy)
+	err := Instrument(ctx, "SetBucketPolicy", func() error {
+		return bucketManager.SetBucketPolicy(bucketName, bucketpolicy)
+	})
 	if err != nil {
-		logrus.Errorf("Bucket policy could not be set: %s", err)
+		logging.FromContext(ctx).Errorf("Bucket policy could not be set: %s", err)
 		return err
 	}
-	logrus.Infof("General bucket policy is set on bucket: %s", bucketName)
+	logging.FromContext(ctx).Infof("General bucket policy is set on bucket: %s", bucketName)
 	return nil
 }
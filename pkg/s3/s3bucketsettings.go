@@ -0,0 +1,301 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/minio/minio-go/v6"
+	"github.com/minio/minio/pkg/madmin"
+	"net/url"
+)
+
+// Default server-side encryption algorithms
+const (
+	EncryptionSSES3  = "AES256"
+	EncryptionSSEKMS = "aws:kms"
+)
+
+// BucketSettings are the settings of a bucket. Settings left out of an update are not changed.
+type BucketSettings struct {
+	QuotaBytes *int64              `json:"quotaBytes,omitempty"` // Hard quota, 0 for none
+	Versioning *bool               `json:"versioning,omitempty"`
+	ObjectLock *ObjectLockSettings `json:"objectLock,omitempty"`
+	Encryption *string             `json:"encryption,omitempty"` // Default server-side encryption, AES256, aws:kms or "" for none
+}
+
+// ObjectLockSettings enable object locking with an optional default retention. Object locking can only be enabled
+// when a bucket is created, and never disabled.
+type ObjectLockSettings struct {
+	Enabled  bool   `json:"enabled"`
+	Mode     string `json:"mode,omitempty"` // GOVERNANCE or COMPLIANCE
+	Validity uint   `json:"validity,omitempty"`
+	Unit     string `json:"unit,omitempty"` // DAYS or YEARS
+}
+
+// InvalidBucketSettingsError tells that settings can not be applied to a bucket
+type InvalidBucketSettingsError struct {
+	Reason string
+}
+
+func (err *InvalidBucketSettingsError) Error() string {
+	return err.Reason
+}
+
+// BucketSettingsManager creates buckets and manages their settings
+type BucketSettingsManager interface {
+	CreateBucket(ctx context.Context, bucket string, settings *BucketSettings) error
+	UpdateBucket(ctx context.Context, bucket string, settings *BucketSettings) error
+	GetBucketSettings(ctx context.Context, bucket string) (*BucketSettings, error)
+}
+
+type bucketSettingsClient interface {
+	MakeBucket(bucketName string, location string) error
+	MakeBucketWithObjectLock(bucketName string, location string) error
+	EnableVersioning(bucketName string) error
+	DisableVersioning(bucketName string) error
+	SetBucketObjectLockConfig(bucketName string, mode *minio.RetentionMode, validity *uint, unit *minio.ValidityUnit) error
+	GetBucketObjectLockConfig(bucketName string) (*minio.RetentionMode, *uint, *minio.ValidityUnit, error)
+	SetBucketEncryption(bucketName string, configuration minio.ServerSideEncryptionConfiguration) error
+	GetBucketEncryption(bucketName string) (minio.ServerSideEncryptionConfiguration, error)
+	DeleteBucketEncryption(bucketName string) error
+}
+
+type bucketAdminAPI interface {
+	call(ctx context.Context, method, relPath string, query url.Values, content []byte) ([]byte, error)
+	getBucketVersioning(ctx context.Context, bucket string) (string, error)
+}
+
+// MinioBucketSettingsManager manages bucket settings with the minio client, and bucket quotas with the admin API
+type MinioBucketSettingsManager struct {
+	bucketSettingsClient
+	adminAPI bucketAdminAPI
+	region   string
+}
+
+// bucketQuota is the bucket quota document of the minio admin API
+type bucketQuota struct {
+	Quota int64  `json:"quota"`
+	Type  string `json:"quotatype,omitempty"`
+}
+
+// NewMinioBucketSettingsManager is a factory for MinioBucketSettingsManager
+func NewMinioBucketSettingsManager(s3config *Config, minioClient *minio.Client, adminAPI *AdminAPI) *MinioBucketSettingsManager {
+	return &MinioBucketSettingsManager{bucketSettingsClient: minioClient, adminAPI: adminAPI, region: s3config.S3Region}
+}
+
+// ValidateBucketSettings checks settings before anything is changed
+func ValidateBucketSettings(settings *BucketSettings) error {
+	if settings.QuotaBytes != nil && *settings.QuotaBytes < 0 {
+		return &InvalidBucketSettingsError{"quotaBytes must not be negative"}
+	}
+	if settings.Encryption != nil && *settings.Encryption != "" && *settings.Encryption != EncryptionSSES3 && *settings.Encryption != EncryptionSSEKMS {
+		return &InvalidBucketSettingsError{fmt.Sprintf("encryption must be %s, %s or empty, was %q", EncryptionSSES3, EncryptionSSEKMS, *settings.Encryption)}
+	}
+	lock := settings.ObjectLock
+	if lock == nil {
+		return nil
+	}
+	if !lock.Enabled && (lock.Mode != "" || lock.Validity != 0 || lock.Unit != "") {
+		return &InvalidBucketSettingsError{"a default retention requires object locking"}
+	}
+	if lock.Enabled && settings.Versioning != nil && !*settings.Versioning {
+		return &InvalidBucketSettingsError{"object locking requires versioning"}
+	}
+	if lock.Mode == "" && lock.Validity == 0 && lock.Unit == "" {
+		return nil
+	}
+	if !minio.RetentionMode(lock.Mode).IsValid() {
+		return &InvalidBucketSettingsError{fmt.Sprintf("mode must be GOVERNANCE or COMPLIANCE, was %q", lock.Mode)}
+	}
+	if lock.Unit != string(minio.Days) && lock.Unit != string(minio.Years) {
+		return &InvalidBucketSettingsError{fmt.Sprintf("unit must be DAYS or YEARS, was %q", lock.Unit)}
+	}
+	if lock.Validity == 0 {
+		return &InvalidBucketSettingsError{"validity must be given with mode and unit"}
+	}
+	return nil
+}
+
+// CreateBucket creates a bucket, with object locking when asked for, and applies the settings
+func (settingsman *MinioBucketSettingsManager) CreateBucket(ctx context.Context, bucket string, settings *BucketSettings) error {
+	if err := ValidateBucketSettings(settings); err != nil {
+		return err
+	}
+	err := Instrument(ctx, "MakeBucket", func() error {
+		if settings.ObjectLock != nil && settings.ObjectLock.Enabled {
+			return settingsman.MakeBucketWithObjectLock(bucket, settingsman.region)
+		}
+		return settingsman.MakeBucket(bucket, settingsman.region)
+	})
+	if err != nil {
+		return err
+	}
+	return settingsman.applySettings(ctx, bucket, settings)
+}
+
+// UpdateBucket applies the settings to an existing bucket
+func (settingsman *MinioBucketSettingsManager) UpdateBucket(ctx context.Context, bucket string, settings *BucketSettings) error {
+	if err := ValidateBucketSettings(settings); err != nil {
+		return err
+	}
+	if settings.ObjectLock != nil || (settings.Versioning != nil && !*settings.Versioning) {
+		current, err := settingsman.getObjectLock(ctx, bucket)
+		if err != nil {
+			return err
+		}
+		if settings.ObjectLock != nil && settings.ObjectLock.Enabled != current.Enabled {
+			return &InvalidBucketSettingsError{"object locking can only be enabled when a bucket is created, and never disabled"}
+		}
+		if current.Enabled && settings.Versioning != nil && !*settings.Versioning {
+			return &InvalidBucketSettingsError{"versioning can not be suspended for a bucket with object locking"}
+		}
+	}
+	return settingsman.applySettings(ctx, bucket, settings)
+}
+
+func (settingsman *MinioBucketSettingsManager) applySettings(ctx context.Context, bucket string, settings *BucketSettings) error {
+	if settings.Versioning != nil {
+		err := Instrument(ctx, "SetVersioning", func() error {
+			if *settings.Versioning {
+				return settingsman.EnableVersioning(bucket)
+			}
+			return settingsman.DisableVersioning(bucket)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if lock := settings.ObjectLock; lock != nil && lock.Enabled {
+		var mode *minio.RetentionMode
+		var validity *uint
+		var unit *minio.ValidityUnit
+		if lock.Mode != "" {
+			retentionMode, retentionUnit, retentionValidity := minio.RetentionMode(lock.Mode), minio.ValidityUnit(lock.Unit), lock.Validity
+			mode, validity, unit = &retentionMode, &retentionValidity, &retentionUnit
+		}
+		err := Instrument(ctx, "SetBucketObjectLockConfig", func() error {
+			return settingsman.SetBucketObjectLockConfig(bucket, mode, validity, unit)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if settings.Encryption != nil {
+		err := Instrument(ctx, "SetBucketEncryption", func() error {
+			if *settings.Encryption == "" {
+				err := settingsman.DeleteBucketEncryption(bucket)
+				if isEncryptionNotFound(err) {
+					return nil
+				}
+				return err
+			}
+			return settingsman.SetBucketEncryption(bucket, minio.ServerSideEncryptionConfiguration{
+				Rules: []minio.Rule{{Apply: minio.ApplyServerSideEncryptionByDefault{SSEAlgorithm: *settings.Encryption}}},
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if settings.QuotaBytes != nil {
+		quota, err := json.Marshal(bucketQuota{Quota: *settings.QuotaBytes, Type: "hard"})
+		if err != nil {
+			return err
+		}
+		err = Instrument(ctx, "SetBucketQuota", func() error {
+			_, err := settingsman.adminAPI.call(ctx, "PUT", "/set-bucket-quota", url.Values{"bucket": {bucket}}, quota)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetBucketSettings returns the current settings of a bucket
+func (settingsman *MinioBucketSettingsManager) GetBucketSettings(ctx context.Context, bucket string) (*BucketSettings, error) {
+	var versioning string
+	err := Instrument(ctx, "GetBucketVersioning", func() (err error) {
+		versioning, err = settingsman.adminAPI.getBucketVersioning(ctx, bucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	versioningEnabled := versioning == "Enabled"
+
+	objectLock, err := settingsman.getObjectLock(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	encryption := ""
+	err = Instrument(ctx, "GetBucketEncryption", func() error {
+		configuration, err := settingsman.GetBucketEncryption(bucket)
+		if isEncryptionNotFound(err) {
+			return nil
+		}
+		if err == nil && len(configuration.Rules) > 0 {
+			encryption = configuration.Rules[0].Apply.SSEAlgorithm
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var quota bucketQuota
+	err = Instrument(ctx, "GetBucketQuota", func() error {
+		content, err := settingsman.adminAPI.call(ctx, "GET", "/get-bucket-quota", url.Values{"bucket": {bucket}}, nil)
+		if isQuotaNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(content, &quota)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &BucketSettings{
+		QuotaBytes: &quota.Quota,
+		Versioning: &versioningEnabled,
+		ObjectLock: objectLock,
+		Encryption: &encryption,
+	}, nil
+}
+
+func (settingsman *MinioBucketSettingsManager) getObjectLock(ctx context.Context, bucket string) (*ObjectLockSettings, error) {
+	objectLock := &ObjectLockSettings{}
+	err := Instrument(ctx, "GetBucketObjectLockConfig", func() error {
+		mode, validity, unit, err := settingsman.GetBucketObjectLockConfig(bucket)
+		if minio.ToErrorResponse(err).Code == "ObjectLockConfigurationNotFoundError" {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		objectLock.Enabled = true
+		if mode != nil && validity != nil && unit != nil {
+			objectLock.Mode, objectLock.Validity, objectLock.Unit = string(*mode), *validity, string(*unit)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objectLock, nil
+}
+
+func isEncryptionNotFound(err error) bool {
+	return minio.ToErrorResponse(err).Code == "ServerSideEncryptionConfigurationNotFoundError"
+}
+
+// isQuotaNotFound tells whether the admin API failed because the bucket has no quota
+func isQuotaNotFound(err error) bool {
+	code := madmin.ToErrorResponse(err).Code
+	return code == "XMinioAdminNoSuchQuotaConfiguration" || code == "XMinioAdminBucketQuotaConfigNotFound"
+}
@@ -0,0 +1,161 @@
+package s3
+
+import (
+	"context"
+	"github.com/minio/minio-go/v6"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type testBucketSettingsClient struct {
+	buckets    map[string]bool // Bucket name to whether object locking is enabled
+	versioning *bool
+	retention  *ObjectLockSettings
+	encryption string
+}
+
+func (tbsc *testBucketSettingsClient) MakeBucket(bucketName string, location string) error {
+	tbsc.buckets[bucketName] = false
+	return nil
+}
+
+func (tbsc *testBucketSettingsClient) MakeBucketWithObjectLock(bucketName string, location string) error {
+	tbsc.buckets[bucketName] = true
+	return nil
+}
+
+func (tbsc *testBucketSettingsClient) EnableVersioning(bucketName string) error {
+	enabled := true
+	tbsc.versioning = &enabled
+	return nil
+}
+
+func (tbsc *testBucketSettingsClient) DisableVersioning(bucketName string) error {
+	disabled := false
+	tbsc.versioning = &disabled
+	return nil
+}
+
+func (tbsc *testBucketSettingsClient) SetBucketObjectLockConfig(bucketName string, mode *minio.RetentionMode, validity *uint, unit *minio.ValidityUnit) error {
+	tbsc.retention = &ObjectLockSettings{Enabled: true}
+	if mode != nil {
+		tbsc.retention.Mode, tbsc.retention.Validity, tbsc.retention.Unit = string(*mode), *validity, string(*unit)
+	}
+	return nil
+}
+
+func (tbsc *testBucketSettingsClient) GetBucketObjectLockConfig(bucketName string) (*minio.RetentionMode, *uint, *minio.ValidityUnit, error) {
+	if !tbsc.buckets[bucketName] {
+		return nil, nil, nil, minio.ErrorResponse{Code: "ObjectLockConfigurationNotFoundError"}
+	}
+	if tbsc.retention == nil || tbsc.retention.Mode == "" {
+		return nil, nil, nil, nil
+	}
+	mode, unit := minio.RetentionMode(tbsc.retention.Mode), minio.ValidityUnit(tbsc.retention.Unit)
+	return &mode, &tbsc.retention.Validity, &unit, nil
+}
+
+func (tbsc *testBucketSettingsClient) SetBucketEncryption(bucketName string, configuration minio.ServerSideEncryptionConfiguration) error {
+	tbsc.encryption = configuration.Rules[0].Apply.SSEAlgorithm
+	return nil
+}
+
+func (tbsc *testBucketSettingsClient) GetBucketEncryption(bucketName string) (minio.ServerSideEncryptionConfiguration, error) {
+	if tbsc.encryption == "" {
+		return minio.ServerSideEncryptionConfiguration{}, minio.ErrorResponse{Code: "ServerSideEncryptionConfigurationNotFoundError"}
+	}
+	return minio.ServerSideEncryptionConfiguration{Rules: []minio.Rule{{Apply: minio.ApplyServerSideEncryptionByDefault{SSEAlgorithm: tbsc.encryption}}}}, nil
+}
+
+func (tbsc *testBucketSettingsClient) DeleteBucketEncryption(bucketName string) error {
+	tbsc.encryption = ""
+	return nil
+}
+
+func TestS3bucketsettings(t *testing.T) {
+	newSettingsManager := func(t *testing.T) (*MinioBucketSettingsManager, *testBucketSettingsClient, *stubAdminAPI) {
+		stub, adminAPI := newTestAdminAPI(t)
+		client := &testBucketSettingsClient{buckets: map[string]bool{}}
+		return &MinioBucketSettingsManager{bucketSettingsClient: client, adminAPI: adminAPI, region: "us-east-1"}, client, stub
+	}
+	quota, versioning, encryption := int64(1<<30), true, EncryptionSSES3
+
+	t.Run("Should create a bucket with object locking and report its settings", func(t *testing.T) {
+		settingsman, client, stub := newSettingsManager(t)
+		stub.versioning = "Enabled"
+
+		err := settingsman.CreateBucket(context.Background(), "archive", &BucketSettings{
+			QuotaBytes: &quota,
+			Versioning: &versioning,
+			ObjectLock: &ObjectLockSettings{Enabled: true, Mode: "COMPLIANCE", Validity: 10, Unit: "YEARS"},
+			Encryption: &encryption,
+		})
+		assert.Nil(t, err)
+		assert.True(t, client.buckets["archive"])
+		assert.JSONEq(t, `{"quota":1073741824,"quotatype":"hard"}`, string(stub.quotas["archive"]))
+
+		settings, err := settingsman.GetBucketSettings(context.Background(), "archive")
+		assert.Nil(t, err)
+		assert.Equal(t, quota, *settings.QuotaBytes)
+		assert.True(t, *settings.Versioning)
+		assert.Equal(t, &ObjectLockSettings{Enabled: true, Mode: "COMPLIANCE", Validity: 10, Unit: "YEARS"}, settings.ObjectLock)
+		assert.Equal(t, EncryptionSSES3, *settings.Encryption)
+	})
+
+	t.Run("Should report a bucket without settings", func(t *testing.T) {
+		settingsman, client, _ := newSettingsManager(t)
+		client.buckets["utv"] = false
+
+		settings, err := settingsman.GetBucketSettings(context.Background(), "utv")
+
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), *settings.QuotaBytes)
+		assert.False(t, *settings.Versioning)
+		assert.False(t, settings.ObjectLock.Enabled)
+		assert.Equal(t, "", *settings.Encryption)
+	})
+
+	t.Run("Should only change the settings given in an update", func(t *testing.T) {
+		settingsman, client, stub := newSettingsManager(t)
+		client.buckets["utv"] = false
+		none := ""
+		client.encryption = EncryptionSSES3
+
+		err := settingsman.UpdateBucket(context.Background(), "utv", &BucketSettings{Encryption: &none})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "", client.encryption)
+		assert.Nil(t, client.versioning)
+		assert.Empty(t, stub.quotas)
+	})
+
+	t.Run("Should refuse to enable object locking or suspend versioning of a locked bucket in an update", func(t *testing.T) {
+		settingsman, client, _ := newSettingsManager(t)
+		client.buckets["utv"], client.buckets["archive"] = false, true
+		suspended := false
+
+		err := settingsman.UpdateBucket(context.Background(), "utv", &BucketSettings{ObjectLock: &ObjectLockSettings{Enabled: true}})
+		assert.IsType(t, &InvalidBucketSettingsError{}, err)
+		err = settingsman.UpdateBucket(context.Background(), "archive", &BucketSettings{Versioning: &suspended})
+		assert.IsType(t, &InvalidBucketSettingsError{}, err)
+		err = settingsman.UpdateBucket(context.Background(), "archive", &BucketSettings{ObjectLock: &ObjectLockSettings{Enabled: true, Mode: "GOVERNANCE", Validity: 30, Unit: "DAYS"}})
+		assert.Nil(t, err)
+		assert.Equal(t, "GOVERNANCE", client.retention.Mode)
+	})
+
+	t.Run("Should validate settings", func(t *testing.T) {
+		negative, suspended, unknown := int64(-1), false, "rot13"
+		for _, settings := range []*BucketSettings{
+			{QuotaBytes: &negative},
+			{Encryption: &unknown},
+			{ObjectLock: &ObjectLockSettings{Mode: "GOVERNANCE", Validity: 1, Unit: "DAYS"}},
+			{ObjectLock: &ObjectLockSettings{Enabled: true}, Versioning: &suspended},
+			{ObjectLock: &ObjectLockSettings{Enabled: true, Mode: "FOREVER", Validity: 1, Unit: "DAYS"}},
+			{ObjectLock: &ObjectLockSettings{Enabled: true, Mode: "GOVERNANCE", Validity: 1, Unit: "WEEKS"}},
+			{ObjectLock: &ObjectLockSettings{Enabled: true, Mode: "GOVERNANCE", Unit: "DAYS"}},
+		} {
+			assert.Error(t, ValidateBucketSettings(settings))
+		}
+		assert.Nil(t, ValidateBucketSettings(&BucketSettings{ObjectLock: &ObjectLockSettings{Enabled: true}}))
+	})
+}
@@ -15,6 +15,12 @@ func NewClient(s3config *Config) (*minio.Client, error) {
 		logrus.Errorf("Could not create S3 client %v", err)
 		return nil, err
 	}
+	transport, err := newTransport(s3config)
+	if err != nil {
+		logrus.Errorf("Could not create transport for S3 client %v", err)
+		return nil, err
+	}
+	minioClient.SetCustomTransport(transport)
 
 	return minioClient, nil
 }
@@ -1,5 +1,10 @@
 package s3
 
+import (
+	"github.com/skatteetaten/fiona/pkg/jobs"
+	"time"
+)
+
 // Config for the minio S3 clients and S3 operations
 type Config struct {
 	S3Host          string
@@ -11,4 +16,42 @@ type Config struct {
 	AccessKey       string
 	SecretKey       string
 	DefaultBucket   string // Default "utv"
+	UseGroups       bool   // App users get access through a shared group per bucket, path and access
+	TLS             TLSConfig
+	STS             STSConfig
+	Quota           QuotaConfig
+	Jobs            jobs.Config
+	// SeedTemplatePrefix is the only prefix new paths may be seeded from, default ".fiona/templates/". Empty disables seeding
+	SeedTemplatePrefix string
+	// NotificationTargets maps names callers use to the ARNs of notification targets configured in minio
+	NotificationTargets map[string]string
+}
+
+// STSConfig for issuing temporary credentials with AssumeRole. Disabled when AccessKey is empty.
+type STSConfig struct {
+	AccessKey  string // The Fiona-owned minio user credentials are assumed from. Not the admin user
+	SecretKey  string
+	DefaultTTL time.Duration // Default 1h
+	MaxTTL     time.Duration // Default 12h, the longest minio allows
+}
+
+// Enabled tells whether temporary credentials can be issued
+func (config *STSConfig) Enabled() bool {
+	return config.AccessKey != ""
+}
+
+// QuotaConfig for the usage scans of paths with a quota
+type QuotaConfig struct {
+	ScanInterval time.Duration // How often the usage of paths with a quota is scanned, default 15m
+	Enforce      bool          // Disable the users of a path over quota, and enable them again when under
+}
+
+// TLSConfig for the connection to minio when S3UseSSL is true
+type TLSConfig struct {
+	CABundle           string // PEM file with CA certificates to trust in addition to the system pool
+	ServerName         string // Overrides the server name used for verification
+	InsecureSkipVerify bool   // Disables certificate verification. Never use in production
+	ClientCertFile     string // Client certificate presented to minio
+	ClientKeyFile      string
+	MinVersion         string // "1.2" or "1.3", default "1.2"
 }
@@ -6,7 +6,8 @@ func endpoint(s3config *Config) string {
 	return s3config.S3Host + ":" + s3config.S3Port
 }
 
-func (c *Config) getServiceEndpoint() string {
+// ServiceEndpoint returns the URL of the S3 server
+func (c *Config) ServiceEndpoint() string {
 
 	protocol := "http"
 	if c.S3UseSSL {
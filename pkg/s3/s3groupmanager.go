@@ -0,0 +1,158 @@
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/minio/minio/pkg/madmin"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"github.com/skatteetaten/fiona/pkg/metrics"
+	"strings"
+)
+
+// GroupPrefix starts the name of every group managed by Fiona
+const GroupPrefix = "fiona-"
+
+// GroupManager manages minio groups granting an access list on a bucket path
+type GroupManager interface {
+	CreateAccessGroup(ctx context.Context, bucket, path string, access []string, members []string) (string, error)
+	UpdateGroupMembers(ctx context.Context, group string, members []string, remove bool) error
+	DescribeGroup(ctx context.Context, group string) (*madmin.GroupDesc, error)
+}
+
+type groupClient interface {
+	AddCannedPolicy(policyName, policy string) error
+	SetPolicy(policyName, entityName string, isGroup bool) error
+	UpdateGroupMembers(g madmin.GroupAddRemove) error
+	GetGroupDescription(group string) (*madmin.GroupDesc, error)
+}
+
+// MinioGroupManager provides methods to manage access groups
+type MinioGroupManager struct {
+	groupClient
+}
+
+// NewMinioGroupManager is a factory for MinioGroupManager
+func NewMinioGroupManager(adminClient *madmin.AdminClient) *MinioGroupManager {
+	return &MinioGroupManager{groupClient: adminClient}
+}
+
+// AccessGroupName returns the name of the group granting access on a bucket path, e.g. fiona-utv-appx-3030f118-rw.
+// Bucket names and paths may contain dashes, so the name holds a hash of bucket/path to tell apart pairs like a-b/c and
+// a/b-c.
+func AccessGroupName(bucket, path string, access []string) (string, error) {
+	granted := map[string]bool{}
+	for _, a := range access {
+		granted[strings.ToUpper(a)] = true
+	}
+	if len(granted) == 0 {
+		return "", fmt.Errorf("no access given for group on %s/%s", bucket, path)
+	}
+	suffix := ""
+	for _, a := range []string{"READ", "WRITE", "DELETE"} {
+		if granted[a] {
+			suffix += strings.ToLower(a[0:1])
+			delete(granted, a)
+		}
+	}
+	if len(granted) > 0 {
+		return "", fmt.Errorf("Got illegal access parameter")
+	}
+	return fmt.Sprintf("%s%s-%s-%s-%s", GroupPrefix, bucket, path, bucketPathHash(bucket, path), suffix), nil
+}
+
+// bucketPathHash returns the first 8 hex digits of the SHA-256 of bucket/path
+func bucketPathHash(bucket, path string) string {
+	sum := sha256.Sum256([]byte(bucket + "/" + path))
+	return hex.EncodeToString(sum[:4])
+}
+
+// IsPathAccessGroup tells whether group is the access group on bucket/path for one of the access lists
+func IsPathAccessGroup(group, bucket, path string) bool {
+	for _, access := range [][]string{{"READ"}, {"WRITE"}, {"DELETE"}, {"READ", "WRITE"}, {"READ", "DELETE"}, {"WRITE", "DELETE"}, {"READ", "WRITE", "DELETE"}} {
+		if name, err := AccessGroupName(bucket, path, access); err == nil && name == group {
+			return true
+		}
+	}
+	return false
+}
+
+// IsNotFound tells whether err is minio reporting that the group, a user or a policy does not exist
+func IsNotFound(err error) bool {
+	code := madmin.ToErrorResponse(err).Code
+	return code == "XMinioAdminNoSuchGroup" || code == "XMinioAdminNoSuchUser" || code == "XMinioAdminNoSuchPolicy"
+}
+
+// IsManagedGroup tells whether group is managed by Fiona
+func IsManagedGroup(group string) bool {
+	return strings.HasPrefix(group, GroupPrefix)
+}
+
+// CreateAccessGroup makes sure the group for the access list on bucket/path exists with members and its policy.
+// Minio creates a group when members are first added, so at least one member is required.
+func (groupman *MinioGroupManager) CreateAccessGroup(ctx context.Context, bucket, path string, access []string, members []string) (string, error) {
+	group, err := AccessGroupName(bucket, path, access)
+	if err != nil {
+		return "", err
+	}
+	if len(members) == 0 {
+		return "", fmt.Errorf("group %s needs at least one member", group)
+	}
+	generatedPolicy, err := generateAppUserPolicy(&CreateAppUserInput{Bucketname: bucket, Path: path, Access: access})
+	if err != nil {
+		return "", err
+	}
+	policy, err := json.Marshal(generatedPolicy)
+	if err != nil {
+		return "", err
+	}
+
+	if err := groupman.UpdateGroupMembers(ctx, group, members, false); err != nil {
+		logging.FromContext(ctx).Errorf("Failed to add members to group %s: %s", group, err)
+		return "", err
+	}
+	if err := groupman.addCannedPolicy(ctx, group, string(policy)); err != nil {
+		logging.FromContext(ctx).Errorf("Failed to create canned policy %s: %s", group, err)
+		return "", err
+	}
+	if err := groupman.setPolicy(ctx, group, group, true); err != nil {
+		logging.FromContext(ctx).Errorf("Failed to set policy %s for group %s: %s", group, group, err)
+		return "", err
+	}
+	metrics.CountPolicy(metrics.ActionCreated)
+
+	logging.FromContext(ctx).Infof("Success: Group %s has policy %s and members %v.", group, group, members)
+	return group, nil
+}
+
+// UpdateGroupMembers adds members to or removes members from a group
+func (groupman *MinioGroupManager) UpdateGroupMembers(ctx context.Context, group string, members []string, remove bool) error {
+	return Instrument(ctx, "UpdateGroupMembers", func() error {
+		return groupman.groupClient.UpdateGroupMembers(madmin.GroupAddRemove{Group: group, Members: members, IsRemove: remove})
+	})
+}
+
+// DescribeGroup returns the members, policy and status of a group
+func (groupman *MinioGroupManager) DescribeGroup(ctx context.Context, group string) (*madmin.GroupDesc, error) {
+	var description *madmin.GroupDesc
+	err := Instrument(ctx, "GetGroupDescription", func() error {
+		var err error
+		description, err = groupman.GetGroupDescription(group)
+		return err
+	})
+	return description, err
+}
+
+func (groupman *MinioGroupManager) addCannedPolicy(ctx context.Context, policyName, policy string) error {
+	return Instrument(ctx, "AddCannedPolicy", func() error {
+		return groupman.AddCannedPolicy(policyName, policy)
+	})
+}
+
+func (groupman *MinioGroupManager) setPolicy(ctx context.Context, policyName, entityName string, isGroup bool) error {
+	return Instrument(ctx, "SetPolicy", func() error {
+		return groupman.SetPolicy(policyName, entityName, isGroup)
+	})
+}
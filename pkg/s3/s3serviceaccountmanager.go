@@ -0,0 +1,237 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/minio/minio/pkg/madmin"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ServiceAccountManager manages minio service accounts under app users
+type ServiceAccountManager interface {
+	HasPathAccess(ctx context.Context, username, bucket, path string) (bool, error)
+	CreateServiceAccount(ctx context.Context, parentUser string, policy json.RawMessage) (*ServiceAccount, error)
+	ListServiceAccounts(ctx context.Context, parentUser string) ([]string, error)
+	DeleteServiceAccount(ctx context.Context, accessKey string) error
+}
+
+// ServiceAccount holds the credentials of a service account
+type ServiceAccount struct {
+	AccessKey string `json:"accessKey"`
+	SecretKey string `json:"secretKey"`
+}
+
+type userInfoClient interface {
+	policyInfoClient
+	GetUserInfo(name string) (madmin.UserInfo, error)
+}
+
+type policyInfoClient interface {
+	InfoCannedPolicy(policyName string) ([]byte, error)
+}
+
+type adminAPICaller interface {
+	call(ctx context.Context, method, relPath string, query url.Values, content []byte) ([]byte, error)
+	encrypt(data []byte) ([]byte, error)
+	decrypt(data []byte) ([]byte, error)
+}
+
+// MinioServiceAccountManager provides methods to manage service accounts
+type MinioServiceAccountManager struct {
+	userInfoClient
+	adminAPI adminAPICaller
+}
+
+// NewMinioServiceAccountManager is a factory for MinioServiceAccountManager
+func NewMinioServiceAccountManager(adminClient *madmin.AdminClient, adminAPI *AdminAPI) *MinioServiceAccountManager {
+	return &MinioServiceAccountManager{userInfoClient: adminClient, adminAPI: adminAPI}
+}
+
+// ValidateSessionPolicy checks that policy is an IAM policy document. Minio limits a service account to the
+// intersection of the session policy and the policy of the parent user, so it can only narrow access.
+func ValidateSessionPolicy(policy json.RawMessage) error {
+	var document struct {
+		Version   string            `json:"Version"`
+		Statement []json.RawMessage `json:"Statement"`
+	}
+	if err := json.Unmarshal(policy, &document); err != nil {
+		return fmt.Errorf("session policy is not a policy document: %v", err)
+	}
+	if len(document.Statement) == 0 {
+		return errors.New("session policy has no statements")
+	}
+	return nil
+}
+
+// HasPathAccess tells whether username is an app user with access to bucket/path, either through its own policy or
+// through an access group
+func (saman *MinioServiceAccountManager) HasPathAccess(ctx context.Context, username, bucket, path string) (bool, error) {
+	var userInfo madmin.UserInfo
+	err := Instrument(ctx, "GetUserInfo", func() error {
+		var err error
+		userInfo, err = saman.GetUserInfo(username)
+		return err
+	})
+	if err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return grantsPathAccess(ctx, saman, userInfo, username, bucket, path)
+}
+
+// grantsPathAccess tells whether the policy or groups of an app user grant access to bucket/path. Names are compared
+// exactly, and the policy document is read to tell apart bucket and path pairs that concatenate to the same policy
+// name, like utv/app and utva/pp.
+func grantsPathAccess(ctx context.Context, policies policyInfoClient, userInfo madmin.UserInfo, username, bucket, path string) (bool, error) {
+	for _, group := range userInfo.MemberOf {
+		if IsPathAccessGroup(group, bucket, path) {
+			return true, nil
+		}
+	}
+	return policyGrantsPathAccess(ctx, policies, userInfo.PolicyName, username, bucket, path)
+}
+
+// policyGrantsPathAccess tells whether policyName is the policy of the app user on bucket/path
+func policyGrantsPathAccess(ctx context.Context, policies policyInfoClient, policyName, username, bucket, path string) (bool, error) {
+	if !isAppUserPolicyName(policyName, username, bucket, path) {
+		return false, nil
+	}
+	var document []byte
+	err := Instrument(ctx, "InfoCannedPolicy", func() (err error) {
+		document, err = policies.InfoCannedPolicy(policyName)
+		return err
+	})
+	if err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return policyAllowsPath(document, bucket, path), nil
+}
+
+// isAppUserPolicyName tells whether policyName is named like the policy of the app user on bucket/path,
+// <bucket><path>_<username>_<access letters>
+func isAppUserPolicyName(policyName, username, bucket, path string) bool {
+	letters := strings.TrimPrefix(policyName, fmt.Sprintf("%s%s_%s_", bucket, path, username))
+	if letters == policyName || letters == "" {
+		return false
+	}
+	for _, letter := range letters {
+		if !strings.ContainsRune("RWDrwd", letter) {
+			return false
+		}
+	}
+	return true
+}
+
+// policyAllowsPath tells whether a statement of the policy document is on the objects of bucket/path
+func policyAllowsPath(document []byte, bucket, path string) bool {
+	var policy struct {
+		Statement []struct {
+			Resource json.RawMessage `json:"Resource"`
+		} `json:"Statement"`
+	}
+	if err := json.Unmarshal(document, &policy); err != nil {
+		return false
+	}
+	pathResource := fmt.Sprintf("arn:aws:s3:::%s/%s/*", bucket, path)
+	for _, statement := range policy.Statement {
+		var resources []string
+		if err := json.Unmarshal(statement.Resource, &resources); err != nil {
+			var resource string
+			if err := json.Unmarshal(statement.Resource, &resource); err != nil {
+				continue
+			}
+			resources = []string{resource}
+		}
+		for _, resource := range resources {
+			if resource == pathResource {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CreateServiceAccount creates a service account under parentUser, limited by the session policy when given
+func (saman *MinioServiceAccountManager) CreateServiceAccount(ctx context.Context, parentUser string, policy json.RawMessage) (*ServiceAccount, error) {
+	request, err := json.Marshal(struct {
+		Policy     json.RawMessage `json:"policy,omitempty"`
+		TargetUser string          `json:"targetUser"`
+	}{policy, parentUser})
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := saman.adminAPI.encrypt(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Credentials ServiceAccount `json:"credentials"`
+	}
+	err = Instrument(ctx, "AddServiceAccount", func() error {
+		body, err := saman.adminAPI.call(ctx, http.MethodPut, "/add-service-account", nil, encrypted)
+		if err != nil {
+			return err
+		}
+		decrypted, err := saman.adminAPI.decrypt(body)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(decrypted, &response)
+	})
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Failed to create service account for user %s: %s", parentUser, err)
+		return nil, err
+	}
+	logging.FromContext(ctx).Infof("Success: Created service account %s for user %s.", response.Credentials.AccessKey, parentUser)
+	return &response.Credentials, nil
+}
+
+// ListServiceAccounts returns the access keys of the service accounts under parentUser
+func (saman *MinioServiceAccountManager) ListServiceAccounts(ctx context.Context, parentUser string) ([]string, error) {
+	var response struct {
+		Accounts []string `json:"accounts"`
+	}
+	err := Instrument(ctx, "ListServiceAccounts", func() error {
+		body, err := saman.adminAPI.call(ctx, http.MethodGet, "/list-service-accounts", url.Values{"user": {parentUser}}, nil)
+		if err != nil {
+			return err
+		}
+		decrypted, err := saman.adminAPI.decrypt(body)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(decrypted, &response)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if response.Accounts == nil {
+		return []string{}, nil
+	}
+	return response.Accounts, nil
+}
+
+// DeleteServiceAccount deletes the service account with accessKey
+func (saman *MinioServiceAccountManager) DeleteServiceAccount(ctx context.Context, accessKey string) error {
+	err := Instrument(ctx, "DeleteServiceAccount", func() error {
+		_, err := saman.adminAPI.call(ctx, http.MethodDelete, "/delete-service-account", url.Values{"accessKey": {accessKey}}, nil)
+		return err
+	})
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Failed to delete service account %s: %s", accessKey, err)
+		return err
+	}
+	logging.FromContext(ctx).Infof("Success: Deleted service account %s.", accessKey)
+	return nil
+}
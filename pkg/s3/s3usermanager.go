@@ -1,11 +1,14 @@
 package s3
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/minio/minio/pkg/madmin"
-	"github.com/sirupsen/logrus"
+	"github.com/skatteetaten/fiona/pkg/kubernetes"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"github.com/skatteetaten/fiona/pkg/metrics"
 	"math/rand"
 	"strings"
 	"time"
@@ -13,8 +16,8 @@ import (
 
 // UserManager is a manager for managing users
 type UserManager interface {
-	CreateUser(userName string, path string) (*CreateUserResult, error)
-	CreateAppUser(createAppUserInput *CreateAppUserInput) (*CreateAppUserResult, error)
+	CreateUser(ctx context.Context, userName string, path string) (*CreateUserResult, error)
+	CreateAppUser(ctx context.Context, createAppUserInput *CreateAppUserInput) (*CreateAppUserResult, error)
 }
 
 const cannedPolicyTemplateForOldUser = `
@@ -50,6 +53,7 @@ const cannedPolicyTemplateForOldUser = `
 }`
 
 type userClient interface {
+	GetUserInfo(name string) (madmin.UserInfo, error)
 	AddUser(accessKey, secretKey string) error
 	AddCannedPolicy(policyName, policy string) error
 	SetPolicy(policyName, entityName string, isGroup bool) error
@@ -58,6 +62,8 @@ type userClient interface {
 // MinioUserManager provides methods to manage a users
 type MinioUserManager struct {
 	userClient
+	groups          GroupManager
+	useGroups       bool
 	randomUserpass  bool
 	defaultUserpass string
 	defaultBucket   string
@@ -79,39 +85,63 @@ type CreateAppUserInput struct {
 	Path       string   `json:"path"`
 	Username   string   `json:"username"`
 	Access     []string `json:"access"`
+	// KubernetesSecret names a secret the credentials are written to instead of being returned
+	KubernetesSecret *kubernetes.SecretReference `json:"kubernetesSecret,omitempty"`
+	// Vault writes the credentials to the configured Vault path instead of returning them
+	Vault bool `json:"vault,omitempty"`
+	// PublicKey is an age public key or RSA public key in PEM the returned secret key is encrypted with
+	PublicKey string `json:"publicKey,omitempty"`
+	// QuotaBytes records a quota for the path, replacing any earlier quota
+	QuotaBytes int64 `json:"quotaBytes,omitempty"`
+	// Lifecycle sets the lifecycle rules of the path, replacing any earlier rules
+	Lifecycle *PathLifecycle `json:"lifecycle,omitempty"`
+	// InitializePath puts a placeholder object in the path so it is listed before any object is written
+	InitializePath bool `json:"initializePath,omitempty"`
+	// SeedPrefix copies the objects below the prefix in the bucket into the path, implying InitializePath
+	SeedPrefix string `json:"seedPrefix,omitempty"`
 }
 
 // CreateAppUserResult provides information after for creating an application user
 type CreateAppUserResult struct {
-	AccessKey string `json:"accessKey"`
-	SecretKey string `json:"secretKey"`
-	HostURL   string `json:"host"`
+	AccessKey        string                      `json:"accessKey,omitempty"`
+	SecretKey        string                      `json:"secretKey,omitempty"`
+	SecretKeyScheme  string                      `json:"secretKeyEncryption,omitempty"` // Set when SecretKey is encrypted
+	HostURL          string                      `json:"host,omitempty"`
+	KubernetesSecret *kubernetes.SecretReference `json:"kubernetesSecret,omitempty"`
+	VaultPath        string                      `json:"vaultPath,omitempty"`
+	Group            string                      `json:"group,omitempty"` // Set when access is granted through a group
+	SeededObjects    int                         `json:"seededObjects,omitempty"`
+	PolicyName       string                      `json:"-"`
 }
 
 // NewMinioUserManager is a factory for MinioUserManager
 func NewMinioUserManager(s3config *Config, adminClient *madmin.AdminClient) *MinioUserManager {
 	return &MinioUserManager{
 		userClient:      adminClient,
+		groups:          NewMinioGroupManager(adminClient),
+		useGroups:       s3config.UseGroups,
 		randomUserpass:  s3config.RandomUserpass,
 		defaultUserpass: s3config.DefaultUserpass,
 		defaultBucket:   s3config.DefaultBucket,
-		serviceEndpoint: s3config.getServiceEndpoint(),
+		serviceEndpoint: s3config.ServiceEndpoint(),
 		bucketRegion:    s3config.S3Region,
 	}
 }
 
 // CreateUser creates a user with access policy for a folder path
-func (userman *MinioUserManager) CreateUser(userName string, path string) (*CreateUserResult, error) {
+func (userman *MinioUserManager) CreateUser(ctx context.Context, userName string, path string) (*CreateUserResult, error) {
 	secret := userman.getUserSecret()
-	if err := userman.AddUser(userName, secret); err != nil {
-		logrus.Error("Could not create new user")
+	if err := userman.addUser(ctx, userName, secret); err != nil {
+		logging.FromContext(ctx).Error("Could not create new user")
 		return nil, err
 	}
 
-	if err := userman.createCannedPolicyForUser(userName, path); err != nil {
-		logrus.Error("Could not create access policy for user")
+	if err := userman.createCannedPolicyForUser(ctx, userName, path); err != nil {
+		logging.FromContext(ctx).Error("Could not create access policy for user")
 		return nil, err
 	}
+	metrics.CountUser(metrics.ActionCreated)
+	metrics.CountPolicy(metrics.ActionCreated)
 	return &CreateUserResult{
 		SecretKey:       secret,
 		ServiceEndpoint: userman.serviceEndpoint,
@@ -120,23 +150,76 @@ func (userman *MinioUserManager) CreateUser(userName string, path string) (*Crea
 	}, nil
 }
 
-// CreateAppUser creates a user with access policy for a folder path
-func (userman *MinioUserManager) CreateAppUser(createAppUserInput *CreateAppUserInput) (*CreateAppUserResult, error) {
-	secret := userman.getUserSecret()
-	if err := userman.AddUser(createAppUserInput.Username, secret); err != nil {
-		logrus.Errorf("Could not create new user: %s", createAppUserInput.Username)
+// CreateAppUser creates a user with access policy for a folder path. An existing user gets a new secret, which is
+// counted as a rotation.
+func (userman *MinioUserManager) CreateAppUser(ctx context.Context, createAppUserInput *CreateAppUserInput) (*CreateAppUserResult, error) {
+	existing, err := userman.userExists(ctx, createAppUserInput.Username)
+	if err != nil {
 		return nil, err
 	}
-
-	if err := userman.createCannedPolicyForAppUser(createAppUserInput); err != nil {
-		logrus.Error("Could not create access policy for user")
+	secret := userman.getUserSecret()
+	if err := userman.addUser(ctx, createAppUserInput.Username, secret); err != nil {
+		logging.FromContext(ctx).Errorf("Could not create new user: %s", createAppUserInput.Username)
 		return nil, err
 	}
-	return &CreateAppUserResult{
+
+	result := &CreateAppUserResult{
 		AccessKey: createAppUserInput.Username,
 		SecretKey: secret,
 		HostURL:   userman.serviceEndpoint,
-	}, nil
+	}
+	if userman.useGroups {
+		group, err := userman.groups.CreateAccessGroup(ctx, createAppUserInput.Bucketname, createAppUserInput.Path, createAppUserInput.Access, []string{createAppUserInput.Username})
+		if err != nil {
+			logging.FromContext(ctx).Error("Could not add user to access group")
+			return nil, err
+		}
+		// The policy of a group is named after the group
+		result.Group, result.PolicyName = group, group
+	} else {
+		policyName, err := userman.createCannedPolicyForAppUser(ctx, createAppUserInput)
+		if err != nil {
+			logging.FromContext(ctx).Error("Could not create access policy for user")
+			return nil, err
+		}
+		metrics.CountPolicy(metrics.ActionCreated)
+		result.PolicyName = policyName
+	}
+	if existing {
+		metrics.CountUser(metrics.ActionRotated)
+	} else {
+		metrics.CountUser(metrics.ActionCreated)
+	}
+	return result, nil
+}
+
+func (userman *MinioUserManager) userExists(ctx context.Context, accessKey string) (bool, error) {
+	err := Instrument(ctx, "GetUserInfo", func() error {
+		_, err := userman.GetUserInfo(accessKey)
+		return err
+	})
+	if IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (userman *MinioUserManager) addUser(ctx context.Context, accessKey, secretKey string) error {
+	return Instrument(ctx, "AddUser", func() error {
+		return userman.AddUser(accessKey, secretKey)
+	})
+}
+
+func (userman *MinioUserManager) addCannedPolicy(ctx context.Context, policyName, policy string) error {
+	return Instrument(ctx, "AddCannedPolicy", func() error {
+		return userman.AddCannedPolicy(policyName, policy)
+	})
+}
+
+func (userman *MinioUserManager) setPolicy(ctx context.Context, policyName, entityName string, isGroup bool) error {
+	return Instrument(ctx, "SetPolicy", func() error {
+		return userman.SetPolicy(policyName, entityName, isGroup)
+	})
 }
 
 func (userman *MinioUserManager) getUserSecret() string {
@@ -146,24 +229,24 @@ func (userman *MinioUserManager) getUserSecret() string {
 	return userman.defaultUserpass
 }
 
-func (userman *MinioUserManager) createCannedPolicyForUser(username string, path string) error {
+func (userman *MinioUserManager) createCannedPolicyForUser(ctx context.Context, username string, path string) error {
 	bucket := userman.defaultBucket
 	policyName := fmt.Sprintf("RWD%s%s_%d", bucket, path, rand.Intn(1000))
 	policy := fmt.Sprintf(cannedPolicyTemplateForOldUser, bucket, bucket, path)
-	if err := userman.AddCannedPolicy(policyName, policy); err != nil {
-		logrus.Errorf("Failed to create canned policy %s: %s", policyName, err)
+	if err := userman.addCannedPolicy(ctx, policyName, policy); err != nil {
+		logging.FromContext(ctx).Errorf("Failed to create canned policy %s: %s", policyName, err)
 		return err
 	}
-	if err := userman.SetPolicy(policyName, username, false); err != nil {
-		logrus.Errorf("Failed to set policy %s for user %s: %s", policyName, username, err)
+	if err := userman.setPolicy(ctx, policyName, username, false); err != nil {
+		logging.FromContext(ctx).Errorf("Failed to set policy %s for user %s: %s", policyName, username, err)
 		return err
 	}
 
-	logrus.Infof("Success: Created policy %s and assigned to user %s.", policyName, username)
+	logging.FromContext(ctx).Infof("Success: Created policy %s and assigned to user %s.", policyName, username)
 	return nil
 }
 
-func (userman *MinioUserManager) createCannedPolicyForAppUser(createAppUserInput *CreateAppUserInput) error {
+func (userman *MinioUserManager) createCannedPolicyForAppUser(ctx context.Context, createAppUserInput *CreateAppUserInput) (string, error) {
 	bucket := createAppUserInput.Bucketname
 	path := createAppUserInput.Path
 	username := createAppUserInput.Username
@@ -175,26 +258,26 @@ func (userman *MinioUserManager) createCannedPolicyForAppUser(createAppUserInput
 
 	generatedAppUserPolicy, err := generateAppUserPolicy(createAppUserInput)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	policy, err := json.Marshal(generatedAppUserPolicy)
 	if err != nil {
-		logrus.Errorf("Failed to create canned policy %s: %s", policyName, err)
-		return err
+		logging.FromContext(ctx).Errorf("Failed to create canned policy %s: %s", policyName, err)
+		return "", err
 	}
 
-	if err := userman.AddCannedPolicy(policyName, string(policy)); err != nil {
-		logrus.Errorf("Failed to create canned policy %s: %s", policyName, err)
-		return err
+	if err := userman.addCannedPolicy(ctx, policyName, string(policy)); err != nil {
+		logging.FromContext(ctx).Errorf("Failed to create canned policy %s: %s", policyName, err)
+		return "", err
 	}
-	if err := userman.SetPolicy(policyName, username, false); err != nil {
-		logrus.Errorf("Failed to set policy %s for user %s: %s", policyName, username, err)
-		return err
+	if err := userman.setPolicy(ctx, policyName, username, false); err != nil {
+		logging.FromContext(ctx).Errorf("Failed to set policy %s for user %s: %s", policyName, username, err)
+		return "", err
 	}
 
-	logrus.Infof("Success: Created policy %s and assigned to user %s.", policyName, username)
-	return nil
+	logging.FromContext(ctx).Infof("Success: Created policy %s and assigned to user %s.", policyName, username)
+	return policyName, nil
 }
 
 func generateAppUserPolicy(createAppUserInput *CreateAppUserInput) (map[string]interface{}, error) {
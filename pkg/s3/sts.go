@@ -0,0 +1,212 @@
+package s3
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MinTTL is the shortest lifetime minio allows for temporary credentials
+const MinTTL = 15 * time.Minute
+
+// TemporaryCredentialsInput provides input for issuing temporary credentials for a path
+type TemporaryCredentialsInput struct {
+	Bucketname string
+	Path       string
+	Access     []string
+	TTL        time.Duration
+}
+
+// TemporaryCredentials are credentials that expire, and must be used with the session token
+type TemporaryCredentials struct {
+	AccessKey    string    `json:"accessKey"`
+	SecretKey    string    `json:"secretKey"`
+	SessionToken string    `json:"sessionToken"`
+	Expiration   time.Time `json:"expiration"`
+	HostURL      string    `json:"host"`
+}
+
+// CredentialIssuer issues temporary credentials limited to a path
+type CredentialIssuer interface {
+	AssumeRole(ctx context.Context, input *TemporaryCredentialsInput) (*TemporaryCredentials, error)
+}
+
+// MinioCredentialIssuer issues temporary credentials with minio's AssumeRole. The credentials get the intersection
+// of the policy of the STS user and a session policy generated for the path.
+type MinioCredentialIssuer struct {
+	config     STSConfig
+	endpoint   string
+	region     string
+	httpClient *http.Client
+}
+
+// NewMinioCredentialIssuer is a factory for MinioCredentialIssuer
+func NewMinioCredentialIssuer(s3config *Config) (*MinioCredentialIssuer, error) {
+	if !s3config.STS.Enabled() {
+		return nil, errors.New("temporary credentials are not enabled")
+	}
+	transport, err := newTransport(s3config)
+	if err != nil {
+		return nil, err
+	}
+	return &MinioCredentialIssuer{
+		config:     s3config.STS,
+		endpoint:   s3config.ServiceEndpoint(),
+		region:     s3config.S3Region,
+		httpClient: &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}, nil
+}
+
+// TTL returns the requested lifetime, or the default when none is requested, and fails when it is out of bounds
+func (config *STSConfig) TTL(requested time.Duration) (time.Duration, error) {
+	if requested == 0 {
+		return config.DefaultTTL, nil
+	}
+	if requested < MinTTL || requested > config.MaxTTL {
+		return 0, fmt.Errorf("ttl must be between %s and %s", MinTTL, config.MaxTTL)
+	}
+	return requested, nil
+}
+
+// AssumeRole issues temporary credentials for the access list on bucket/path
+func (issuer *MinioCredentialIssuer) AssumeRole(ctx context.Context, input *TemporaryCredentialsInput) (*TemporaryCredentials, error) {
+	generatedPolicy, err := generateAppUserPolicy(&CreateAppUserInput{Bucketname: input.Bucketname, Path: input.Path, Access: input.Access})
+	if err != nil {
+		return nil, err
+	}
+	policy, err := json.Marshal(generatedPolicy)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("Action", "AssumeRole")
+	form.Set("Version", "2011-06-15")
+	form.Set("DurationSeconds", strconv.Itoa(int(input.TTL.Seconds())))
+	form.Set("Policy", string(policy))
+
+	var response struct {
+		Result struct {
+			Credentials struct {
+				AccessKey    string    `xml:"AccessKeyId"`
+				SecretKey    string    `xml:"SecretAccessKey"`
+				Expiration   time.Time `xml:"Expiration"`
+				SessionToken string    `xml:"SessionToken"`
+			} `xml:"Credentials"`
+		} `xml:"AssumeRoleResult"`
+	}
+	err = Instrument(ctx, "AssumeRole", func() error {
+		body, err := issuer.post(ctx, form)
+		if err != nil {
+			return err
+		}
+		return xml.Unmarshal(body, &response)
+	})
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Failed to assume role for %s/%s: %s", input.Bucketname, input.Path, err)
+		return nil, err
+	}
+	credentials := response.Result.Credentials
+	return &TemporaryCredentials{
+		AccessKey:    credentials.AccessKey,
+		SecretKey:    credentials.SecretKey,
+		SessionToken: credentials.SessionToken,
+		Expiration:   credentials.Expiration,
+		HostURL:      issuer.endpoint,
+	}, nil
+}
+
+func (issuer *MinioCredentialIssuer) post(ctx context.Context, form url.Values) ([]byte, error) {
+	content := form.Encode()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, issuer.endpoint+"/", strings.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	contentHash := sha256.Sum256([]byte(content))
+	request.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(contentHash[:]))
+	signV4(request, hex.EncodeToString(contentHash[:]), issuer.config.AccessKey, issuer.config.SecretKey, issuer.region, "sts", time.Now())
+
+	response, err := issuer.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		var stsError struct {
+			Error struct {
+				Code    string `xml:"Code"`
+				Message string `xml:"Message"`
+			} `xml:"Error"`
+		}
+		if xml.Unmarshal(body, &stsError) == nil && stsError.Error.Code != "" {
+			return nil, fmt.Errorf("%s: %s", stsError.Error.Code, stsError.Error.Message)
+		}
+		return nil, fmt.Errorf("AssumeRole responded %s", response.Status)
+	}
+	return body, nil
+}
+
+// signV4 signs request and all its headers with AWS signature version 4 for service. The minio-go signer only signs
+// for s3, while minio requires AssumeRole to be signed for sts.
+func signV4(request *http.Request, payloadHash, accessKey, secretKey, region, service string, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102")
+	request.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		strings.ReplaceAll(request.URL.Query().Encode(), "+", "%20"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", now.Format("20060102T150405Z"), scope, hex.EncodeToString(canonicalHash[:])}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), date)
+	for _, part := range []string{region, service, "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,84 @@
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const assumeRoleResponse = `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+<AssumeRoleResult><Credentials><AccessKeyId>TEMPACCESSKEY</AccessKeyId><SecretAccessKey>s3cret</SecretAccessKey>
+<Expiration>2021-10-01T12:15:00Z</Expiration><SessionToken>sessiontoken</SessionToken></Credentials></AssumeRoleResult>
+</AssumeRoleResponse>`
+
+func TestSTS(t *testing.T) {
+	t.Run("Should sign with AWS signature version 4", func(t *testing.T) {
+		// The get-vanilla example of the AWS signature version 4 test suite
+		request, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+		emptyHash := sha256.Sum256(nil)
+
+		signV4(request, hex.EncodeToString(emptyHash[:]), "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+		assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31", request.Header.Get("Authorization"))
+	})
+
+	t.Run("Should assume role with a session policy for the path", func(t *testing.T) {
+		var form url.Values
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Contains(t, r.Header.Get("Authorization"), "Credential=fiona-sts/")
+			assert.Contains(t, r.Header.Get("Authorization"), "/us-east-1/sts/aws4_request")
+			_ = r.ParseForm()
+			form = r.PostForm
+			_, _ = w.Write([]byte(assumeRoleResponse))
+		}))
+		defer server.Close()
+		issuer := &MinioCredentialIssuer{config: STSConfig{AccessKey: "fiona-sts", SecretKey: "s3cret"}, endpoint: server.URL, region: "us-east-1", httpClient: server.Client()}
+
+		credentials, err := issuer.AssumeRole(context.Background(), &TemporaryCredentialsInput{Bucketname: "utv", Path: "appx", Access: []string{"READ"}, TTL: 15 * time.Minute})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "TEMPACCESSKEY", credentials.AccessKey)
+		assert.Equal(t, "sessiontoken", credentials.SessionToken)
+		assert.Equal(t, time.Date(2021, 10, 1, 12, 15, 0, 0, time.UTC), credentials.Expiration)
+		assert.Equal(t, "AssumeRole", form.Get("Action"))
+		assert.Equal(t, "900", form.Get("DurationSeconds"))
+		assert.Contains(t, form.Get("Policy"), "arn:aws:s3:::utv/appx/*")
+		assert.NotContains(t, form.Get("Policy"), "s3:PutObject")
+	})
+
+	t.Run("Should return STS errors", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`<ErrorResponse><Error><Code>AccessDenied</Code><Message>Access denied</Message></Error></ErrorResponse>`))
+		}))
+		defer server.Close()
+		issuer := &MinioCredentialIssuer{config: STSConfig{AccessKey: "fiona-sts", SecretKey: "wrong"}, endpoint: server.URL, region: "us-east-1", httpClient: server.Client()}
+
+		_, err := issuer.AssumeRole(context.Background(), &TemporaryCredentialsInput{Bucketname: "utv", Path: "appx", Access: []string{"READ"}, TTL: time.Hour})
+
+		assert.Error(t, err)
+		assert.True(t, strings.HasPrefix(err.Error(), "AccessDenied"))
+	})
+
+	t.Run("Should bound the requested ttl", func(t *testing.T) {
+		config := STSConfig{DefaultTTL: time.Hour, MaxTTL: 2 * time.Hour}
+
+		ttl, err := config.TTL(0)
+		assert.Nil(t, err)
+		assert.Equal(t, time.Hour, ttl)
+		ttl, err = config.TTL(30 * time.Minute)
+		assert.Nil(t, err)
+		assert.Equal(t, 30*time.Minute, ttl)
+		_, err = config.TTL(time.Minute)
+		assert.Error(t, err)
+		_, err = config.TTL(3 * time.Hour)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,71 @@
+package s3
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/minio/minio-go/v6"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+)
+
+var tlsVersions = map[string]uint16{
+	"":    tls.VersionTLS12,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTransport creates the http transport used by both the minio client and admin client
+func newTransport(s3config *Config) (http.RoundTripper, error) {
+	transport, err := minio.DefaultTransport(s3config.S3UseSSL)
+	if err != nil {
+		return nil, err
+	}
+	if !s3config.S3UseSSL {
+		return transport, nil
+	}
+	tlsConfig, err := newTLSClientConfig(&s3config.TLS)
+	if err != nil {
+		return nil, err
+	}
+	transport.(*http.Transport).TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+func newTLSClientConfig(config *TLSConfig) (*tls.Config, error) {
+	minVersion, ok := tlsVersions[config.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported minimum TLS version %q", config.MinVersion)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         minVersion,
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if config.InsecureSkipVerify {
+		logrus.Warn("!!! Certificate verification towards minio is DISABLED. Credentials may be intercepted. Never use this in production !!!")
+	}
+	if config.CABundle != "" {
+		caPEM, err := ioutil.ReadFile(config.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("could not read minio CA bundle %s: %w", config.CABundle, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in minio CA bundle %s", config.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.ClientCertFile != "" || config.ClientKeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(config.ClientCertFile, config.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load minio client certificate %s: %w", config.ClientCertFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,315 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"github.com/minio/minio-go/v6"
+	"github.com/minio/minio/pkg/madmin"
+	"github.com/skatteetaten/fiona/pkg/logging"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PathUsage is the storage used by the objects in a path
+type PathUsage struct {
+	Bucket     string    `json:"bucket"`
+	Path       string    `json:"path"`
+	Bytes      int64     `json:"bytes"`
+	Objects    int64     `json:"objects"`
+	QuotaBytes int64     `json:"quotaBytes,omitempty"` // Zero when the path has no quota
+	Exceeded   bool      `json:"exceeded"`
+	ScannedAt  time.Time `json:"scannedAt"`
+}
+
+// UsageReporter reports the storage used by paths
+type UsageReporter interface {
+	Usage(ctx context.Context, bucket, path string) (*PathUsage, error)
+	Scan(ctx context.Context, bucket, path string) (*PathUsage, error)
+}
+
+type objectLister interface {
+	ListObjectsV2(bucketName, objectPrefix string, recursive bool, doneCh <-chan struct{}) <-chan minio.ObjectInfo
+}
+
+type userStatusClient interface {
+	policyInfoClient
+	ListUsers() (map[string]madmin.UserInfo, error)
+	SetUserStatus(accessKey string, status madmin.AccountStatus) error
+	GetGroupDescription(group string) (*madmin.GroupDesc, error)
+	UpdateGroupMembers(g madmin.GroupAddRemove) error
+}
+
+// UsageMonitor computes the usage of paths by walking their prefix. The usage found is cached, and the paths with a
+// quota are scanned again in the background by Run.
+type UsageMonitor struct {
+	objects objectLister
+	quotas  QuotaRegistry
+	users   userStatusClient
+	config  QuotaConfig
+	mutex   sync.Mutex
+	usage   map[string]*PathUsage
+}
+
+// NewUsageMonitor is a factory for UsageMonitor
+func NewUsageMonitor(s3config *Config, minioClient *minio.Client, adminClient *madmin.AdminClient) *UsageMonitor {
+	return &UsageMonitor{
+		objects: minioClient,
+		quotas:  NewMinioQuotaRegistry(minioClient),
+		users:   adminClient,
+		config:  s3config.Quota,
+		usage:   map[string]*PathUsage{},
+	}
+}
+
+// ErrUsageNotScanned is returned by Usage for a path that has not been scanned yet
+var ErrUsageNotScanned = errors.New("usage of the path has not been scanned")
+
+// Usage returns the usage of a path found by the last scan, without listing the path. Paths with a quota are scanned
+// every scan interval by Run, other paths only when Scan is called.
+func (monitor *UsageMonitor) Usage(ctx context.Context, bucket, path string) (*PathUsage, error) {
+	monitor.mutex.Lock()
+	cached, found := monitor.usage[bucket+"/"+path]
+	monitor.mutex.Unlock()
+	if !found {
+		return nil, ErrUsageNotScanned
+	}
+	return monitor.againstQuota(ctx, cached)
+}
+
+// Scan lists the path to find its usage, refreshing the cache
+func (monitor *UsageMonitor) Scan(ctx context.Context, bucket, path string) (*PathUsage, error) {
+	scanned, err := monitor.scan(ctx, bucket, path)
+	if err != nil {
+		return nil, err
+	}
+	return monitor.againstQuota(ctx, scanned)
+}
+
+// againstQuota returns a copy of the scanned usage with the quota of the path
+func (monitor *UsageMonitor) againstQuota(ctx context.Context, scanned *PathUsage) (*PathUsage, error) {
+	quota, err := monitor.quotas.GetQuota(ctx, scanned.Bucket, scanned.Path)
+	if err != nil {
+		return nil, err
+	}
+	usage := *scanned
+	if quota != nil {
+		usage.QuotaBytes, usage.Exceeded = quota.Bytes, usage.Bytes > quota.Bytes
+	}
+	return &usage, nil
+}
+
+// Run scans the paths with a quota every scan interval until ctx is done
+func (monitor *UsageMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(monitor.config.ScanInterval)
+	defer ticker.Stop()
+	for {
+		monitor.ScanQuotas(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ScanQuotas scans the usage of every path with a quota, and disables or enables its users when enforcing quotas
+func (monitor *UsageMonitor) ScanQuotas(ctx context.Context) {
+	quotas, err := monitor.quotas.ListQuotas(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Warnf("Could not list quotas: %s", err)
+		return
+	}
+	for _, quota := range quotas {
+		if ctx.Err() != nil {
+			return
+		}
+		usage, err := monitor.scan(ctx, quota.Bucket, quota.Path)
+		if err != nil {
+			logging.FromContext(ctx).Warnf("Could not scan usage of %s/%s: %s", quota.Bucket, quota.Path, err)
+			continue
+		}
+		if monitor.config.Enforce {
+			if err := monitor.enforce(ctx, quota, usage.Bytes > quota.Bytes); err != nil {
+				logging.FromContext(ctx).Warnf("Could not enforce quota of %s/%s: %s", quota.Bucket, quota.Path, err)
+			}
+		}
+	}
+}
+
+func (monitor *UsageMonitor) scan(ctx context.Context, bucket, path string) (*PathUsage, error) {
+	usage := &PathUsage{Bucket: bucket, Path: path}
+	err := Instrument(ctx, "ListObjectsV2", func() error {
+		doneCh := make(chan struct{})
+		defer close(doneCh)
+		for object := range monitor.objects.ListObjectsV2(bucket, path+"/", true, doneCh) {
+			if object.Err != nil {
+				return object.Err
+			}
+			usage.Bytes += object.Size
+			usage.Objects++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	usage.ScannedAt = time.Now()
+
+	monitor.mutex.Lock()
+	monitor.usage[bucket+"/"+path] = usage
+	monitor.mutex.Unlock()
+	return usage, nil
+}
+
+// enforce takes away the access of the enabled users of a path over quota, and gives it back when under quota. Users
+// with access to the path only are disabled, while users with access to other paths are removed from the access
+// groups of the path, so their other access is kept.
+func (monitor *UsageMonitor) enforce(ctx context.Context, quota *PathQuota, exceeded bool) error {
+	if !exceeded {
+		return monitor.restore(ctx, quota)
+	}
+
+	var users map[string]madmin.UserInfo
+	err := Instrument(ctx, "ListUsers", func() (err error) {
+		users, err = monitor.users.ListUsers()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	var disabled []string
+	var removed []GroupMember
+	for username, userInfo := range users {
+		if userInfo.Status != madmin.AccountEnabled {
+			continue
+		}
+		granted, err := grantsPathAccess(ctx, monitor.users, userInfo, username, quota.Bucket, quota.Path)
+		if err != nil {
+			return err
+		}
+		if !granted {
+			continue
+		}
+		only, err := onlyGrantsPathAccess(ctx, monitor.users, userInfo, username, quota.Bucket, quota.Path)
+		if err != nil {
+			return err
+		}
+		if only {
+			disabled = append(disabled, username)
+			continue
+		}
+		memberships := 0
+		for _, group := range userInfo.MemberOf {
+			if IsPathAccessGroup(group, quota.Bucket, quota.Path) {
+				removed = append(removed, GroupMember{Group: group, Username: username})
+				memberships++
+			}
+		}
+		if memberships == 0 {
+			logging.FromContext(ctx).Warnf("User %s keeps access to %s/%s over quota, as its policy also grants access to other paths", username, quota.Bucket, quota.Path)
+		}
+	}
+	if len(disabled) == 0 && len(removed) == 0 {
+		return nil
+	}
+	sort.Strings(disabled)
+	sort.Slice(removed, func(i, j int) bool {
+		return removed[i].Username+"/"+removed[i].Group < removed[j].Username+"/"+removed[j].Group
+	})
+	// Recorded before taking the access away, so access is never taken away without being given back again
+	err = monitor.quotas.UpdateQuota(ctx, quota.Bucket, quota.Path, func(recorded *PathQuota) {
+		recorded.DisabledUsers = append(without(recorded.DisabledUsers, disabled), disabled...)
+		recorded.RemovedMembers = append(withoutMembers(recorded.RemovedMembers, removed), removed...)
+	})
+	if err != nil {
+		return err
+	}
+	for _, username := range disabled {
+		if err := monitor.setUserStatus(ctx, username, madmin.AccountDisabled); err != nil {
+			return err
+		}
+	}
+	for _, member := range removed {
+		if err := monitor.updateGroupMember(ctx, member, true); err != nil {
+			return err
+		}
+	}
+	logging.FromContext(ctx).Infof("Disabled users %v and removed group members %v of %s/%s, which is over quota", disabled, removed, quota.Bucket, quota.Path)
+	return nil
+}
+
+// restore enables the users disabled for exceeding the quota, and adds the removed group members again
+func (monitor *UsageMonitor) restore(ctx context.Context, quota *PathQuota) error {
+	if len(quota.DisabledUsers) == 0 && len(quota.RemovedMembers) == 0 {
+		return nil
+	}
+	for _, username := range quota.DisabledUsers {
+		if err := monitor.setUserStatus(ctx, username, madmin.AccountEnabled); err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+	for _, member := range quota.RemovedMembers {
+		// Adding a member creates the group, so groups removed meanwhile are left removed
+		err := Instrument(ctx, "GetGroupDescription", func() error {
+			_, err := monitor.users.GetGroupDescription(member.Group)
+			return err
+		})
+		if IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := monitor.updateGroupMember(ctx, member, false); err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+	logging.FromContext(ctx).Infof("Enabled users %v and added group members %v of %s/%s, which is under quota", quota.DisabledUsers, quota.RemovedMembers, quota.Bucket, quota.Path)
+	return monitor.quotas.UpdateQuota(ctx, quota.Bucket, quota.Path, func(recorded *PathQuota) {
+		recorded.DisabledUsers = without(recorded.DisabledUsers, quota.DisabledUsers)
+		recorded.RemovedMembers = withoutMembers(recorded.RemovedMembers, quota.RemovedMembers)
+	})
+}
+
+// without returns the names not in removed
+func without(names, removed []string) []string {
+	var kept []string
+	for _, name := range names {
+		found := false
+		for _, other := range removed {
+			found = found || name == other
+		}
+		if !found {
+			kept = append(kept, name)
+		}
+	}
+	return kept
+}
+
+// withoutMembers returns the members not in removed
+func withoutMembers(members, removed []GroupMember) []GroupMember {
+	var kept []GroupMember
+	for _, member := range members {
+		found := false
+		for _, other := range removed {
+			found = found || member == other
+		}
+		if !found {
+			kept = append(kept, member)
+		}
+	}
+	return kept
+}
+
+func (monitor *UsageMonitor) updateGroupMember(ctx context.Context, member GroupMember, remove bool) error {
+	return Instrument(ctx, "UpdateGroupMembers", func() error {
+		return monitor.users.UpdateGroupMembers(madmin.GroupAddRemove{Group: member.Group, Members: []string{member.Username}, IsRemove: remove})
+	})
+}
+
+func (monitor *UsageMonitor) setUserStatus(ctx context.Context, username string, status madmin.AccountStatus) error {
+	return Instrument(ctx, "SetUserStatus", func() error {
+		return monitor.users.SetUserStatus(username, status)
+	})
+}
@@ -0,0 +1,211 @@
+package s3
+
+import (
+	"context"
+	"github.com/minio/minio-go/v6"
+	"github.com/minio/minio/pkg/madmin"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type testObjectLister struct {
+	objects map[string][]minio.ObjectInfo
+	scans   int
+}
+
+func (tol *testObjectLister) ListObjectsV2(bucketName, objectPrefix string, recursive bool, doneCh <-chan struct{}) <-chan minio.ObjectInfo {
+	tol.scans++
+	objects := make(chan minio.ObjectInfo, len(tol.objects[bucketName+"/"+objectPrefix]))
+	for _, object := range tol.objects[bucketName+"/"+objectPrefix] {
+		objects <- object
+	}
+	close(objects)
+	return objects
+}
+
+type testQuotaRegistry struct {
+	quotas map[string]*PathQuota
+}
+
+func (tqr *testQuotaRegistry) UpdateQuota(ctx context.Context, bucket, path string, update func(quota *PathQuota)) error {
+	quota, found := tqr.quotas[bucket+"/"+path]
+	if !found {
+		quota = &PathQuota{Bucket: bucket, Path: path}
+		tqr.quotas[bucket+"/"+path] = quota
+	}
+	update(quota)
+	return nil
+}
+
+func (tqr *testQuotaRegistry) GetQuota(ctx context.Context, bucket, path string) (*PathQuota, error) {
+	if quota, found := tqr.quotas[bucket+"/"+path]; found {
+		copied := *quota
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (tqr *testQuotaRegistry) ListQuotas(ctx context.Context) ([]*PathQuota, error) {
+	var quotas []*PathQuota
+	for _, quota := range tqr.quotas {
+		copied := *quota
+		quotas = append(quotas, &copied)
+	}
+	return quotas, nil
+}
+
+type testUserStatusClient struct {
+	testPolicies
+	users       map[string]madmin.UserInfo
+	groups      map[string][]string
+	statusesSet func()
+}
+
+func (tusc *testUserStatusClient) ListUsers() (map[string]madmin.UserInfo, error) {
+	return tusc.users, nil
+}
+
+func (tusc *testUserStatusClient) SetUserStatus(accessKey string, status madmin.AccountStatus) error {
+	userInfo := tusc.users[accessKey]
+	userInfo.Status = status
+	tusc.users[accessKey] = userInfo
+	if tusc.statusesSet != nil {
+		tusc.statusesSet()
+	}
+	return nil
+}
+
+func (tusc *testUserStatusClient) GetGroupDescription(group string) (*madmin.GroupDesc, error) {
+	members, found := tusc.groups[group]
+	if !found {
+		return nil, madmin.ErrorResponse{Code: "XMinioAdminNoSuchGroup"}
+	}
+	return &madmin.GroupDesc{Name: group, Members: members}, nil
+}
+
+func (tusc *testUserStatusClient) UpdateGroupMembers(g madmin.GroupAddRemove) error {
+	for _, username := range g.Members {
+		userInfo := tusc.users[username]
+		userInfo.MemberOf = without(userInfo.MemberOf, []string{g.Group})
+		tusc.groups[g.Group] = without(tusc.groups[g.Group], []string{username})
+		if !g.IsRemove {
+			userInfo.MemberOf = append(userInfo.MemberOf, g.Group)
+			tusc.groups[g.Group] = append(tusc.groups[g.Group], username)
+		}
+		tusc.users[username] = userInfo
+	}
+	return nil
+}
+
+func TestUsageMonitor(t *testing.T) {
+	appyReaders, _ := AccessGroupName("utv", "appy", []string{"READ"})
+	newMonitor := func(enforce bool) (*UsageMonitor, *testObjectLister, *testQuotaRegistry, *testUserStatusClient) {
+		objects := &testObjectLister{objects: map[string][]minio.ObjectInfo{
+			"utv/appx/": {{Key: "appx/a", Size: 600}, {Key: "appx/b/c", Size: 500}},
+		}}
+		quotas := &testQuotaRegistry{quotas: map[string]*PathQuota{"utv/appx": {Bucket: "utv", Path: "appx", Bytes: 1000}}}
+		users := &testUserStatusClient{
+			testPolicies: testPolicies{"utvappx_appx-writer_RW": "utv/appx", "utvappx_appx-locked_R": "utv/appx", "utvappy_appy-writer_RW": "utv/appy"},
+			users: map[string]madmin.UserInfo{
+				"appx-writer": {PolicyName: "utvappx_appx-writer_RW", Status: madmin.AccountEnabled},
+				"appx-reader": {MemberOf: []string{"fiona-utv-appx-3030f118-r"}, Status: madmin.AccountEnabled},
+				"appx-locked": {PolicyName: "utvappx_appx-locked_R", Status: madmin.AccountDisabled},
+				"appy-writer": {PolicyName: "utvappy_appy-writer_RW", Status: madmin.AccountEnabled},
+				"dash-reader": {MemberOf: []string{"fiona-utv-appx-x-f7db2cdf-r"}, Status: madmin.AccountEnabled},
+				"both-reader": {MemberOf: []string{"fiona-utv-appx-3030f118-r", appyReaders}, Status: madmin.AccountEnabled},
+			},
+			groups: map[string][]string{
+				"fiona-utv-appx-3030f118-r":   {"appx-reader", "both-reader"},
+				"fiona-utv-appx-x-f7db2cdf-r": {"dash-reader"},
+				appyReaders:                   {"both-reader"},
+			},
+		}
+		config := QuotaConfig{ScanInterval: time.Minute, Enforce: enforce}
+		return &UsageMonitor{objects: objects, quotas: quotas, users: users, config: config, usage: map[string]*PathUsage{}}, objects, quotas, users
+	}
+
+	t.Run("Should report cached usage of the path against its quota", func(t *testing.T) {
+		monitor, objects, _, _ := newMonitor(false)
+
+		_, err := monitor.Usage(context.Background(), "utv", "appx")
+		assert.Equal(t, ErrUsageNotScanned, err)
+		assert.Equal(t, 0, objects.scans)
+
+		usage, err := monitor.Scan(context.Background(), "utv", "appx")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1100), usage.Bytes)
+		assert.Equal(t, int64(2), usage.Objects)
+		assert.Equal(t, int64(1000), usage.QuotaBytes)
+		assert.True(t, usage.Exceeded)
+
+		usage, err = monitor.Usage(context.Background(), "utv", "appx")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, objects.scans)
+		assert.Equal(t, int64(1100), usage.Bytes)
+		assert.True(t, usage.Exceeded)
+
+		_, _ = monitor.Scan(context.Background(), "utv", "appy")
+		usage, err = monitor.Usage(context.Background(), "utv", "appy")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), usage.QuotaBytes)
+		assert.False(t, usage.Exceeded)
+	})
+
+	t.Run("Should disable the users of a path over quota and enable them again when under", func(t *testing.T) {
+		monitor, objects, quotas, users := newMonitor(true)
+
+		monitor.ScanQuotas(context.Background())
+
+		assert.Equal(t, madmin.AccountDisabled, users.users["appx-writer"].Status)
+		assert.Equal(t, madmin.AccountDisabled, users.users["appx-reader"].Status)
+		assert.Equal(t, madmin.AccountEnabled, users.users["appy-writer"].Status)
+		assert.Equal(t, madmin.AccountEnabled, users.users["dash-reader"].Status, "users of paths starting with the path name must stay enabled")
+		assert.Equal(t, []string{"appx-reader", "appx-writer"}, quotas.quotas["utv/appx"].DisabledUsers)
+		assert.Equal(t, madmin.AccountEnabled, users.users["both-reader"].Status, "users with access to other paths must stay enabled")
+		assert.Equal(t, []string{appyReaders}, users.users["both-reader"].MemberOf)
+		assert.Equal(t, []GroupMember{{Group: "fiona-utv-appx-3030f118-r", Username: "both-reader"}}, quotas.quotas["utv/appx"].RemovedMembers)
+
+		objects.objects["utv/appx/"] = objects.objects["utv/appx/"][:1]
+		monitor.ScanQuotas(context.Background())
+
+		assert.ElementsMatch(t, []string{"fiona-utv-appx-3030f118-r", appyReaders}, users.users["both-reader"].MemberOf)
+		assert.Empty(t, quotas.quotas["utv/appx"].RemovedMembers)
+		assert.Equal(t, madmin.AccountEnabled, users.users["appx-writer"].Status)
+		assert.Equal(t, madmin.AccountEnabled, users.users["appx-reader"].Status)
+		assert.Equal(t, madmin.AccountDisabled, users.users["appx-locked"].Status, "users disabled by others must stay disabled")
+		assert.Empty(t, quotas.quotas["utv/appx"].DisabledUsers)
+	})
+
+	t.Run("Should only report usage when not enforcing quotas", func(t *testing.T) {
+		monitor, _, _, users := newMonitor(false)
+
+		monitor.ScanQuotas(context.Background())
+
+		assert.Equal(t, madmin.AccountEnabled, users.users["appx-writer"].Status)
+		usage, _ := monitor.Usage(context.Background(), "utv", "appx")
+		assert.True(t, usage.Exceeded)
+	})
+
+	t.Run("Should keep quota changes made while enforcing", func(t *testing.T) {
+		monitor, objects, quotas, users := newMonitor(true)
+		users.statusesSet = func() {
+			_ = quotas.UpdateQuota(context.Background(), "utv", "appx", func(quota *PathQuota) {
+				quota.Bytes = 2000
+				quota.DisabledUsers = append(without(quota.DisabledUsers, []string{"appz-reader"}), "appz-reader")
+			})
+		}
+
+		monitor.ScanQuotas(context.Background())
+
+		assert.Equal(t, int64(2000), quotas.quotas["utv/appx"].Bytes)
+		assert.Equal(t, []string{"appx-reader", "appx-writer", "appz-reader"}, quotas.quotas["utv/appx"].DisabledUsers)
+
+		users.statusesSet = nil
+		objects.objects["utv/appx/"] = objects.objects["utv/appx/"][:1]
+		monitor.ScanQuotas(context.Background())
+
+		assert.Equal(t, int64(2000), quotas.quotas["utv/appx"].Bytes)
+		assert.Empty(t, quotas.quotas["utv/appx"].DisabledUsers)
+	})
+}
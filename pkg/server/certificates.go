@@ -0,0 +1,104 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+const certificateCheckInterval = 10 * time.Second
+
+// CertificateReloader serves a certificate from disk and reloads it when the files change
+type CertificateReloader struct {
+	certFile    string
+	keyFile     string
+	mu          sync.Mutex
+	certificate *tls.Certificate
+	modTime     time.Time
+	lastCheck   time.Time
+}
+
+// NewCertificateReloader loads the certificate and key pair
+func NewCertificateReloader(certFile string, keyFile string) (*CertificateReloader, error) {
+	reloader := &CertificateReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// GetCertificate is a tls.Config.GetCertificate returning the current certificate
+func (reloader *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	reloader.mu.Lock()
+	defer reloader.mu.Unlock()
+	if time.Since(reloader.lastCheck) >= certificateCheckInterval {
+		reloader.lastCheck = time.Now()
+		if reloader.latestModTime().After(reloader.modTime) {
+			if err := reloader.reloadLocked(); err != nil {
+				logrus.Errorf("Could not reload TLS certificate, keeping the current one: %s", err)
+			} else {
+				logrus.Infof("Reloaded TLS certificate from %s", reloader.certFile)
+			}
+		}
+	}
+	return reloader.certificate, nil
+}
+
+func (reloader *CertificateReloader) reload() error {
+	reloader.mu.Lock()
+	defer reloader.mu.Unlock()
+	return reloader.reloadLocked()
+}
+
+func (reloader *CertificateReloader) reloadLocked() error {
+	modTime := reloader.latestModTime()
+	certificate, err := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+	if err != nil {
+		return fmt.Errorf("could not load TLS certificate %s: %w", reloader.certFile, err)
+	}
+	reloader.certificate = &certificate
+	reloader.modTime = modTime
+	reloader.lastCheck = time.Now()
+	return nil
+}
+
+func (reloader *CertificateReloader) latestModTime() time.Time {
+	var latest time.Time
+	for _, file := range []string{reloader.certFile, reloader.keyFile} {
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// newTLSConfig creates a TLS config with a reloading server certificate and, when a client CA is
+// configured, verification of client certificates presented by callers
+func newTLSConfig(config *Config) (*tls.Config, error) {
+	reloader, err := NewCertificateReloader(config.TLSCertFile, config.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if config.TLSClientCAFile != "" {
+		caPEM, err := ioutil.ReadFile(config.TLSClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read client CA %s: %w", config.TLSClientCAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in client CA %s", config.TLSClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeSelfSignedCertificate(t *testing.T, dir string, commonName string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		DNSNames:              []string{commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	assert.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, keyFile
+}
+
+func TestCertificateReloader(t *testing.T) {
+	t.Run("Should reload certificate when files change", func(t *testing.T) {
+		dir, _ := ioutil.TempDir("", "fiona-tls")
+		defer os.RemoveAll(dir)
+		certFile, keyFile := writeSelfSignedCertificate(t, dir, "first.fiona")
+		reloader, err := NewCertificateReloader(certFile, keyFile)
+		assert.Nil(t, err)
+
+		first, _ := reloader.GetCertificate(&tls.ClientHelloInfo{})
+		writeSelfSignedCertificate(t, dir, "second.fiona")
+		later := time.Now().Add(time.Minute)
+		_ = os.Chtimes(certFile, later, later)
+		reloader.lastCheck = time.Time{}
+		second, _ := reloader.GetCertificate(&tls.ClientHelloInfo{})
+
+		firstLeaf, _ := x509.ParseCertificate(first.Certificate[0])
+		secondLeaf, _ := x509.ParseCertificate(second.Certificate[0])
+		assert.Equal(t, "first.fiona", firstLeaf.Subject.CommonName)
+		assert.Equal(t, "second.fiona", secondLeaf.Subject.CommonName)
+	})
+
+	t.Run("Should fail when certificate is missing", func(t *testing.T) {
+		_, err := NewCertificateReloader("testdata/nofile.crt", "testdata/nofile.key")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Should verify client certificates when client CA is configured", func(t *testing.T) {
+		dir, _ := ioutil.TempDir("", "fiona-tls")
+		defer os.RemoveAll(dir)
+		certFile, keyFile := writeSelfSignedCertificate(t, dir, "fiona")
+
+		tlsConfig, err := newTLSConfig(&Config{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSClientCAFile: certFile})
+
+		assert.Nil(t, err)
+		assert.Equal(t, tls.VerifyClientCertIfGiven, tlsConfig.ClientAuth)
+		assert.NotNil(t, tlsConfig.ClientCAs)
+	})
+}
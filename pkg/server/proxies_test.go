@@ -0,0 +1,43 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trustedProxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	assert.Nil(t, err)
+
+	request := func(remoteAddr string, forwardedFor string) *http.Request {
+		r, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+		r.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		return r
+	}
+
+	t.Run("Should ignore X-Forwarded-For from untrusted peers", func(t *testing.T) {
+		assert.Equal(t, "203.0.113.7", ClientIP(request("203.0.113.7:41234", "198.51.100.1"), trustedProxies))
+		assert.Equal(t, "10.0.0.1", ClientIP(request("10.0.0.1:41234", "198.51.100.1"), nil))
+	})
+
+	t.Run("Should take the last address not of a trusted proxy", func(t *testing.T) {
+		assert.Equal(t, "198.51.100.1", ClientIP(request("10.0.0.1:41234", "198.51.100.1"), trustedProxies))
+		assert.Equal(t, "198.51.100.1", ClientIP(request("10.0.0.1:41234", "203.0.113.9, 198.51.100.1, 192.168.1.1"), trustedProxies))
+		assert.Equal(t, "10.0.0.2", ClientIP(request("10.0.0.1:41234", "garbage, 10.0.0.2"), trustedProxies))
+	})
+
+	t.Run("Should use the peer of a trusted proxy without X-Forwarded-For", func(t *testing.T) {
+		assert.Equal(t, "10.0.0.1", ClientIP(request("10.0.0.1:41234", ""), trustedProxies))
+	})
+
+	t.Run("Should reject proxies that are not addresses or ranges", func(t *testing.T) {
+		_, err := ParseTrustedProxies([]string{"proxy.example.com"})
+		assert.Error(t, err)
+		_, err = ParseTrustedProxies([]string{"10.0.0.0/33"})
+		assert.Error(t, err)
+	})
+}
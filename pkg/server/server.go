@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Config for the http servers
+type Config struct {
+	ListenAddress           string        // Default ":8080"
+	ManagementListenAddress string        // Default ":8081"
+	ReadTimeout             time.Duration // Default 30s
+	WriteTimeout            time.Duration // Default 60s
+	IdleTimeout             time.Duration // Default 120s
+	MaxHeaderBytes          int           // Default 1 MB
+	ShutdownTimeout         time.Duration // Time allowed for in-flight requests to finish, default 30s
+	TLSCertFile             string        // Serve the API over TLS when set together with TLSKeyFile
+	TLSKeyFile              string
+	TLSClientCAFile         string   // Verify client certificates signed by this CA when set
+	TrustedProxies          []string // IP addresses and CIDR ranges of proxies whose X-Forwarded-For is honored
+}
+
+// TLSEnabled tells whether a certificate and key are configured
+func (config *Config) TLSEnabled() bool {
+	return config.TLSCertFile != "" && config.TLSKeyFile != ""
+}
+
+// Server is a named http.Server
+type Server struct {
+	*http.Server
+	Name string
+}
+
+// New creates a Server for handler on address with the timeouts and limits from config
+func New(name string, address string, handler http.Handler, config *Config) *Server {
+	return &Server{
+		Server: &http.Server{
+			Addr:           address,
+			Handler:        handler,
+			ReadTimeout:    config.ReadTimeout,
+			WriteTimeout:   config.WriteTimeout,
+			IdleTimeout:    config.IdleTimeout,
+			MaxHeaderBytes: config.MaxHeaderBytes,
+		},
+		Name: name,
+	}
+}
+
+// NewTLS creates a Server like New, serving TLS with the certificate, key and client CA from config.
+// The certificate is reloaded when the files change.
+func NewTLS(name string, address string, handler http.Handler, config *Config) (*Server, error) {
+	tlsConfig, err := newTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	server := New(name, address, handler, config)
+	server.TLSConfig = tlsConfig
+	return server, nil
+}
+
+// Run serves on all servers until ctx is done or one of them fails. All servers are then shut down,
+// waiting up to shutdownTimeout for in-flight requests to finish.
+func Run(ctx context.Context, shutdownTimeout time.Duration, servers ...*Server) error {
+	failed := make(chan error, len(servers))
+	for _, server := range servers {
+		listener, err := net.Listen("tcp", server.Addr)
+		if err != nil {
+			shutdown(shutdownTimeout, servers)
+			return fmt.Errorf("could not listen on %s for %s: %w", server.Addr, server.Name, err)
+		}
+		logrus.Infof("Starting %s on %s using tls=%t", server.Name, server.Addr, server.TLSConfig != nil)
+		go func(server *Server) {
+			var err error
+			if server.TLSConfig != nil {
+				err = server.ServeTLS(listener, "", "")
+			} else {
+				err = server.Serve(listener)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				failed <- fmt.Errorf("%s failed: %w", server.Name, err)
+			}
+		}(server)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		logrus.Info("Shutting down, waiting for in-flight requests to finish")
+	case err = <-failed:
+		logrus.Errorf("Shutting down: %s", err)
+	}
+	if shutdownErr := shutdown(shutdownTimeout, servers); shutdownErr != nil && err == nil {
+		err = shutdownErr
+	}
+	return err
+}
+
+func shutdown(timeout time.Duration, servers []*Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *Server) {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				errs <- fmt.Errorf("%s did not shut down cleanly: %w", server.Name, err)
+			}
+		}(server)
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
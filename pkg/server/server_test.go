@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func freeAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestServer(t *testing.T) {
+	t.Run("Should let in-flight requests finish before shutting down", func(t *testing.T) {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			_, _ = w.Write([]byte("done"))
+		})
+		address := freeAddress(t)
+		api := New("api", address, handler, &Config{})
+		management := New("management", freeAddress(t), http.NotFoundHandler(), &Config{})
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := make(chan error)
+		go func() { stopped <- Run(ctx, 5*time.Second, api, management) }()
+
+		body := make(chan string)
+		go func() {
+			for i := 0; i < 50; i++ {
+				response, err := http.Get("http://" + address + "/")
+				if err == nil {
+					b, _ := ioutil.ReadAll(response.Body)
+					response.Body.Close()
+					body <- string(b)
+					return
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+			body <- ""
+		}()
+		<-started
+		cancel()
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+
+		assert.Equal(t, "done", <-body)
+		assert.Nil(t, <-stopped)
+	})
+
+	t.Run("Should fail when address is in use", func(t *testing.T) {
+		listener, _ := net.Listen("tcp", "127.0.0.1:0")
+		defer listener.Close()
+
+		err := Run(context.Background(), time.Second, New("api", listener.Addr().String(), http.NotFoundHandler(), &Config{}))
+
+		assert.NotNil(t, err)
+	})
+}
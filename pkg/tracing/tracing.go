@@ -0,0 +1,105 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// ServiceName is the name fiona reports to the tracing backend
+const ServiceName = "fiona"
+
+// Exporter types
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Config for tracing
+type Config struct {
+	Exporter     string // Default "none"
+	OTLPEndpoint string // host:port of an OTLP/HTTP collector, default "localhost:4318"
+	OTLPInsecure bool   // Use plain http towards the collector
+}
+
+// ShutdownFunc flushes and stops the trace exporter
+type ShutdownFunc func(ctx context.Context) error
+
+// Init installs the global tracer provider and W3C trace context propagation
+func Init(config *Config) (ShutdownFunc, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporter, err := newExporter(config)
+	if err != nil {
+		return nil, err
+	}
+	if exporter == nil {
+		return func(ctx context.Context) error { return nil }, nil
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	logrus.Infof("Tracing enabled with %s exporter", config.Exporter)
+	return provider.Shutdown, nil
+}
+
+func newExporter(config *Config) (sdktrace.SpanExporter, error) {
+	switch config.Exporter {
+	case ExporterNone, "":
+		return nil, nil
+	case ExporterStdout:
+		return stdouttrace.New()
+	case ExporterOTLP:
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(config.OTLPEndpoint)}
+		if config.OTLPInsecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(context.Background(), options...)
+	}
+	return nil, fmt.Errorf("unknown tracing exporter %q", config.Exporter)
+}
+
+// StartSpan starts a span as a child of any span in ctx
+func StartSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(ServiceName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// EndSpan records err, if any, and ends the span
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// RouteMiddleware names the server span of the request after the matched route template. The span is started by the
+// otelmux middleware wrapping the whole router, where the route is not yet known.
+func RouteMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				span := trace.SpanFromContext(r.Context())
+				span.SetName(template)
+				span.SetAttributes(semconv.HTTPRouteKey.String(template))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,60 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTracing(t *testing.T) {
+	t.Run("Should initialize without exporter", func(t *testing.T) {
+		shutdown, err := Init(&Config{Exporter: ExporterNone})
+		assert.Nil(t, err)
+		assert.Nil(t, shutdown(context.Background()))
+	})
+
+	t.Run("Should fail on unknown exporter", func(t *testing.T) {
+		_, err := Init(&Config{Exporter: "zipkinish"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Should record child span with error status", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+		ctx, parent := StartSpan(context.Background(), "parent")
+		_, child := StartSpan(ctx, "minio.AddUser")
+		EndSpan(child, errors.New("minio is down"))
+		EndSpan(parent, nil)
+
+		spans := recorder.Ended()
+		assert.Equal(t, 2, len(spans))
+		assert.Equal(t, "minio.AddUser", spans[0].Name())
+		assert.Equal(t, codes.Error, spans[0].Status().Code)
+		assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+	})
+
+	t.Run("Should name the request span after the matched route", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		router := mux.NewRouter()
+		router.Use(RouteMiddleware)
+		router.HandleFunc("/buckets/{bucketname}", func(w http.ResponseWriter, r *http.Request) {})
+
+		request := httptest.NewRequest("GET", "http://localhost:8080/buckets/utv", nil)
+		otelmux.Middleware(ServiceName)(router).ServeHTTP(httptest.NewRecorder(), request)
+
+		spans := recorder.Ended()
+		assert.Equal(t, 1, len(spans))
+		assert.Equal(t, "/buckets/{bucketname}", spans[0].Name())
+	})
+}
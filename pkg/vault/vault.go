@@ -0,0 +1,219 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/skatteetaten/fiona/pkg/tracing"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPathTemplate is where credentials are written when no template is configured
+const DefaultPathTemplate = "secret/s3/{bucket}/{path}/{username}"
+
+// tokenRenewMargin is how long before expiry an AppRole token is replaced
+const tokenRenewMargin = 30 * time.Second
+
+// Config for writing secrets to a Vault KV version 2 secrets engine
+type Config struct {
+	Address      string // Vault is enabled when set, e.g. https://vault:8200
+	PathTemplate string // <kv mount>/<path>, where {cluster}, {bucket}, {path} and {username} are replaced
+	Token        string // Static token. AppRole is used when empty
+	RoleID       string
+	SecretID     string
+	AppRoleMount string // Default "approle"
+	CAFile       string
+}
+
+// Enabled tells whether Vault has been configured
+func (config *Config) Enabled() bool {
+	return config.Address != ""
+}
+
+// PathParams are the values substituted into the path template
+type PathParams struct {
+	Cluster  string
+	Bucket   string
+	Path     string
+	Username string
+}
+
+// SecretWriter writes secrets to the path rendered from the template, and returns the path
+type SecretWriter interface {
+	WriteSecret(ctx context.Context, params PathParams, data map[string]string) (string, error)
+}
+
+// Client is a minimal Vault client writing KV version 2 secrets
+type Client struct {
+	config     Config
+	httpClient *http.Client
+
+	mutex       sync.Mutex
+	token       string
+	tokenExpiry time.Time // Zero for tokens that do not expire
+}
+
+// NewClient creates a Client for the Vault in config
+func NewClient(config *Config) (*Client, error) {
+	if err := ValidatePathTemplate(config.PathTemplate); err != nil {
+		return nil, err
+	}
+	if config.Token == "" && (config.RoleID == "" || config.SecretID == "") {
+		return nil, errors.New("vault needs a token, or a role id and secret id for AppRole")
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.CAFile != "" {
+		caPEM, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read Vault CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	client := &Client{
+		config: *config,
+		httpClient: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		},
+		token: config.Token,
+	}
+	client.config.Address = strings.TrimSuffix(config.Address, "/")
+	if client.config.AppRoleMount == "" {
+		client.config.AppRoleMount = "approle"
+	}
+	return client, nil
+}
+
+// ValidatePathTemplate checks that the template names a KV mount and a path unique per user
+func ValidatePathTemplate(template string) error {
+	if !strings.Contains(template, "{username}") {
+		return fmt.Errorf("vault path template %q must contain {username}", template)
+	}
+	if parts := strings.SplitN(strings.Trim(template, "/"), "/", 2); len(parts) < 2 || strings.Contains(parts[0], "{") {
+		return fmt.Errorf("vault path template %q must start with the KV mount, e.g. secret/", template)
+	}
+	return nil
+}
+
+// RenderPath returns the path of the secret for params
+func (client *Client) RenderPath(params PathParams) (string, error) {
+	replacements := []string{"{cluster}", params.Cluster, "{bucket}", params.Bucket, "{path}", params.Path, "{username}", params.Username}
+	for i := 1; i < len(replacements); i += 2 {
+		value := replacements[i]
+		if value == "" || value == "." || value == ".." || strings.ContainsAny(value, "/?#") {
+			return "", fmt.Errorf("%q can not be used in a vault path for %s", value, replacements[i-1])
+		}
+	}
+	return strings.Trim(strings.NewReplacer(replacements...).Replace(client.config.PathTemplate), "/"), nil
+}
+
+// WriteSecret writes data as a new version of the secret at the path rendered for params
+func (client *Client) WriteSecret(ctx context.Context, params PathParams, data map[string]string) (path string, err error) {
+	ctx, span := tracing.StartSpan(ctx, "vault.WriteSecret")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	path, err = client.RenderPath(params)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.SplitN(path, "/", 2)
+	dataURL := fmt.Sprintf("%s/v1/%s/data/%s", client.config.Address, parts[0], parts[1])
+	body := map[string]interface{}{"data": data}
+
+	status, err := client.send(ctx, dataURL, body)
+	if status == http.StatusForbidden && client.config.Token == "" {
+		// The AppRole token may have been revoked, log in again once
+		client.clearToken()
+		status, err = client.send(ctx, dataURL, body)
+	}
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (client *Client) send(ctx context.Context, url string, body interface{}) (int, error) {
+	token, err := client.currentToken(ctx)
+	if err != nil {
+		return 0, err
+	}
+	status, _, err := client.post(ctx, url, token, body)
+	return status, err
+}
+
+func (client *Client) currentToken(ctx context.Context) (string, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	if client.token != "" && (client.tokenExpiry.IsZero() || time.Now().Before(client.tokenExpiry)) {
+		return client.token, nil
+	}
+
+	loginURL := fmt.Sprintf("%s/v1/auth/%s/login", client.config.Address, client.config.AppRoleMount)
+	_, response, err := client.post(ctx, loginURL, "", map[string]string{"role_id": client.config.RoleID, "secret_id": client.config.SecretID})
+	if err != nil {
+		return "", fmt.Errorf("vault AppRole login failed: %v", err)
+	}
+	var login struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	if err := json.Unmarshal(response, &login); err != nil || login.Auth.ClientToken == "" {
+		return "", errors.New("vault AppRole login returned no token")
+	}
+	client.token = login.Auth.ClientToken
+	client.tokenExpiry = time.Time{}
+	if login.Auth.LeaseDuration > 0 {
+		client.tokenExpiry = time.Now().Add(time.Duration(login.Auth.LeaseDuration)*time.Second - tokenRenewMargin)
+	}
+	return client.token, nil
+}
+
+func (client *Client) clearToken() {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	client.token = ""
+}
+
+// post returns the status code and body of successful responses, and an error with Vault's messages otherwise
+func (client *Client) post(ctx context.Context, url, token string, body interface{}) (int, []byte, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return 0, nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		request.Header.Set("X-Vault-Token", token)
+	}
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer response.Body.Close()
+	responseBody, _ := ioutil.ReadAll(response.Body)
+	if response.StatusCode/100 == 2 {
+		return response.StatusCode, responseBody, nil
+	}
+	var vaultErrors struct {
+		Errors []string `json:"errors"`
+	}
+	_ = json.Unmarshal(responseBody, &vaultErrors)
+	return response.StatusCode, nil, fmt.Errorf("vault responded %s: %s", response.Status, strings.Join(vaultErrors.Errors, "; "))
+}
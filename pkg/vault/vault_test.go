@@ -0,0 +1,114 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// stubVault accepts AppRole logins and KV version 2 writes under the secret mount
+type stubVault struct {
+	validToken string
+	logins     int
+	secrets    map[string]map[string]interface{}
+}
+
+func (vault *stubVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	if r.URL.Path == "/v1/auth/approle/login" {
+		if body["role_id"] != "fiona" || body["secret_id"] != "s3cret-id" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":["invalid role or secret ID"]}`))
+			return
+		}
+		vault.logins++
+		_, _ = w.Write([]byte(`{"auth":{"client_token":"` + vault.validToken + `","lease_duration":3600}}`))
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != vault.validToken {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+		return
+	}
+	vault.secrets[r.URL.Path] = body["data"].(map[string]interface{})
+	_, _ = w.Write([]byte(`{"data":{"version":1}}`))
+}
+
+func newStubVault(t *testing.T) (*stubVault, string) {
+	vault := &stubVault{validToken: "s.valid", secrets: map[string]map[string]interface{}{}}
+	server := httptest.NewServer(vault)
+	t.Cleanup(server.Close)
+	return vault, server.URL
+}
+
+func TestWriteSecret(t *testing.T) {
+	params := PathParams{Cluster: "default", Bucket: "utv", Path: "appx", Username: "appxuser"}
+
+	t.Run("Should write with a static token", func(t *testing.T) {
+		vault, address := newStubVault(t)
+		client, err := NewClient(&Config{Address: address, PathTemplate: DefaultPathTemplate, Token: "s.valid"})
+		assert.Nil(t, err)
+
+		path, err := client.WriteSecret(context.Background(), params, map[string]string{"secretKey": "s3cret"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "secret/s3/utv/appx/appxuser", path)
+		assert.Equal(t, "s3cret", vault.secrets["/v1/secret/data/s3/utv/appx/appxuser"]["secretKey"])
+	})
+
+	t.Run("Should log in with AppRole and reuse the token", func(t *testing.T) {
+		vault, address := newStubVault(t)
+		client, _ := NewClient(&Config{Address: address, PathTemplate: "kv/{cluster}/{username}", RoleID: "fiona", SecretID: "s3cret-id"})
+
+		_, err := client.WriteSecret(context.Background(), params, map[string]string{})
+		assert.Nil(t, err)
+		_, err = client.WriteSecret(context.Background(), params, map[string]string{})
+		assert.Nil(t, err)
+
+		assert.Equal(t, 1, vault.logins)
+		assert.Contains(t, vault.secrets, "/v1/kv/data/default/appxuser")
+	})
+
+	t.Run("Should log in again when the AppRole token is revoked", func(t *testing.T) {
+		vault, address := newStubVault(t)
+		client, _ := NewClient(&Config{Address: address, PathTemplate: DefaultPathTemplate, RoleID: "fiona", SecretID: "s3cret-id"})
+		_, _ = client.WriteSecret(context.Background(), params, map[string]string{})
+		vault.validToken = "s.renewed"
+
+		_, err := client.WriteSecret(context.Background(), params, map[string]string{})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 2, vault.logins)
+	})
+
+	t.Run("Should return Vault errors", func(t *testing.T) {
+		_, address := newStubVault(t)
+		client, _ := NewClient(&Config{Address: address, PathTemplate: DefaultPathTemplate, Token: "s.wrong"})
+
+		_, err := client.WriteSecret(context.Background(), params, map[string]string{})
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "permission denied")
+	})
+
+	t.Run("Should refuse values escaping the path", func(t *testing.T) {
+		_, address := newStubVault(t)
+		client, _ := NewClient(&Config{Address: address, PathTemplate: DefaultPathTemplate, Token: "s.valid"})
+
+		_, err := client.WriteSecret(context.Background(), PathParams{Cluster: "default", Bucket: "utv", Path: "..", Username: "appxuser"}, map[string]string{})
+
+		assert.Error(t, err)
+	})
+}
+
+func TestValidatePathTemplate(t *testing.T) {
+	assert.Nil(t, ValidatePathTemplate(DefaultPathTemplate))
+	assert.Error(t, ValidatePathTemplate("secret/s3/{bucket}/{path}"))
+	assert.Error(t, ValidatePathTemplate("{username}"))
+	assert.Error(t, ValidatePathTemplate("{bucket}/{username}"))
+}